@@ -0,0 +1,122 @@
+/*
+ * AuthPlz Administrative Command Line Tool
+ * Provides account, OAuth client and database management for AuthPlz instances
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/modules/audit"
+)
+
+// Options global command line options
+type Options struct {
+	config.AuthPlzCLI
+
+	User    UserCommand    `command:"user" description:"Manage user accounts"`
+	OAuth   OAuthCommand   `command:"oauth" description:"Manage OAuth clients"`
+	Link    LinkCommand    `command:"link" description:"Issue activation, unlock, reactivation and recovery links"`
+	Migrate MigrateCommand `command:"migrate" description:"Run database schema migrations"`
+	Audit   AuditCommand   `command:"audit" description:"Dump audit events for a user"`
+}
+
+var opts Options
+
+// ErrUserNotFound returned when a user cannot be resolved from the provided identifier
+var ErrUserNotFound = errors.New("AuthPlzCtl: user not found")
+
+// Source tag added to events emitted by the command line tool
+const eventSource = "authplzctl"
+
+// auditEmitter synchronously writes emitted events to the audit log
+// The server event bus is not available to the command line tool, so events are audited directly
+type auditEmitter struct {
+	ac *audit.Controller
+}
+
+// SendEvent tags and records an event
+func (e *auditEmitter) SendEvent(event interface{}) {
+	if d, ok := event.(interface {
+		GetData() map[string]string
+	}); ok && d.GetData() != nil {
+		d.GetData()["Source"] = eventSource
+	}
+	e.ac.HandleEvent(event)
+}
+
+// load loads the configuration and opens the associated datastore
+func load() (*config.AuthPlzConfig, *datastore.DataStore, error) {
+	c, err := config.LoadConfig(opts.ConfigFile, opts.Prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ds, err := datastore.NewDataStore(c.Database)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, ds, nil
+}
+
+// newEmitter creates an event emitter that records events in the audit log
+func newEmitter(ds *datastore.DataStore) *auditEmitter {
+	return &auditEmitter{audit.NewController(ds)}
+}
+
+// resolveUser fetches a user by email, external ID, or username
+func resolveUser(ds *datastore.DataStore, id string) (*datastore.User, error) {
+	var u interface{}
+	var err error
+
+	if strings.Contains(id, "@") {
+		u, err = ds.GetUserByEmail(id)
+	} else {
+		u, err = ds.GetUserByExtID(id)
+		if err == nil && u == nil {
+			u, err = ds.GetUserByUsername(id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return u.(*datastore.User), nil
+}
+
+// printJSON writes an indented JSON representation of the provided object to stdout
+func printJSON(i interface{}) error {
+	js, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(js))
+	return nil
+}
+
+func main() {
+	parser := flags.NewParser(&opts, flags.Default)
+
+	if _, err := parser.Parse(); err != nil {
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+}
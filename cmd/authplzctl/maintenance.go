@@ -0,0 +1,143 @@
+/*
+ * AuthPlz Administrative Command Line Tool
+ * Link issuing, migration and audit commands
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/controllers/token"
+	"github.com/ryankurte/authplz/lib/modules/audit"
+)
+
+// Default validity for issued links, matching emailed links
+const defaultLinkDuration = time.Hour
+
+// buildLink builds an action or recovery link for the provided user
+func buildLink(tc *token.TokenController, address, userID string, action api.TokenAction, duration time.Duration) (string, error) {
+	t, err := tc.BuildToken(userID, action, duration)
+	if err != nil {
+		return "", err
+	}
+
+	if action == api.TokenActionRecovery {
+		return fmt.Sprintf("%s/api/recovery?token=%s", address, t), nil
+	}
+	return fmt.Sprintf("%s/api/action?token=%s", address, t), nil
+}
+
+// LinkCommand issues activation, unlock, reactivation and recovery links
+type LinkCommand struct {
+	Duration time.Duration `short:"d" long:"duration" description:"Link validity period" default:"1h"`
+
+	Args struct {
+		Action string `positional-arg-name:"action" description:"Link action (activate, unlock, reactivate or recover)"`
+		User   string `positional-arg-name:"user" description:"User email, external ID or username"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute issues a link for the provided user
+// Note that recovery links are only valid in a session where recovery has been started for the user
+func (cmd *LinkCommand) Execute(args []string) error {
+	action := api.TokenAction(cmd.Args.Action)
+	switch action {
+	case api.TokenActionActivate, api.TokenActionUnlock, api.TokenActionReactivate, api.TokenActionRecovery:
+	default:
+		return fmt.Errorf("Invalid link action: %s (allowed: %s, %s, %s, %s)", cmd.Args.Action,
+			api.TokenActionActivate, api.TokenActionUnlock, api.TokenActionReactivate, api.TokenActionRecovery)
+	}
+
+	c, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	u, err := resolveUser(ds, cmd.Args.User)
+	if err != nil {
+		return err
+	}
+
+	tc := token.NewTokenController(c.Address, c.TokenSecret, ds)
+
+	link, err := buildLink(tc, c.ExternalAddress, u.GetExtID(), action, cmd.Duration)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(link)
+
+	return nil
+}
+
+// MigrateCommand runs database schema migrations
+type MigrateCommand struct {
+	Force bool `long:"force" description:"Drop and recreate all tables (destroys all data)"`
+}
+
+// Execute runs database schema migrations
+// Migrations are run when the datastore is opened, so this only needs to handle forced migration
+func (cmd *MigrateCommand) Execute(args []string) error {
+	_, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	if cmd.Force {
+		ds.ForceSync()
+		fmt.Println("Database schema recreated")
+		return nil
+	}
+
+	fmt.Println("Database schema migrated")
+
+	// Report accounts that block creation of the canonical identity indexes
+	collisions, err := ds.IdentityCollisions()
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		fmt.Printf("Found %d identity collisions, these must be resolved manually:\n", len(collisions))
+		return printJSON(collisions)
+	}
+
+	return nil
+}
+
+// AuditCommand dumps audit events for a user, or for the external ID of a removed user
+type AuditCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute dumps audit events for a user as JSON
+func (cmd *AuditCommand) Execute(args []string) error {
+	_, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	// Events for removed accounts are listed by external ID
+	userID := cmd.Args.User
+	u, err := resolveUser(ds, cmd.Args.User)
+	if err == nil {
+		userID = u.GetExtID()
+	} else if err != ErrUserNotFound {
+		return err
+	}
+
+	events, err := audit.NewController(ds).ListEvents(userID)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(events)
+}
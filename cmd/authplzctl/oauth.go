@@ -0,0 +1,99 @@
+/*
+ * AuthPlz Administrative Command Line Tool
+ * OAuth client management commands
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ryankurte/authplz/lib/modules/oauth"
+)
+
+// OAuthCommand OAuth client management commands
+type OAuthCommand struct {
+	Create OAuthCreateCommand `command:"create" description:"Create an OAuth client for a user"`
+	List   OAuthListCommand   `command:"list" description:"List OAuth clients owned by a user"`
+	Rotate OAuthRotateCommand `command:"rotate" description:"Rotate the secret for an OAuth client"`
+}
+
+// withOAuth resolves the provided user and runs the provided function with an OAuth controller
+func withOAuth(id string, fn func(oc *oauth.Controller, userID string) error) error {
+	c, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	u, err := resolveUser(ds, id)
+	if err != nil {
+		return err
+	}
+
+	return fn(oauth.NewController(ds, c.OAuth), u.GetExtID())
+}
+
+// OAuthCreateCommand creates an OAuth client
+type OAuthCreateCommand struct {
+	Scopes        []string `short:"s" long:"scope" description:"Client scope (may be repeated)"`
+	Redirects     []string `short:"r" long:"redirect" description:"Client redirect URI (may be repeated)"`
+	GrantTypes    []string `short:"g" long:"grant" description:"Client grant type (may be repeated)" default:"client_credentials"`
+	ResponseTypes []string `long:"response" description:"Client response type (may be repeated)" default:"token"`
+	Public        bool     `long:"public" description:"Create a public client"`
+
+	Args struct {
+		User string `positional-arg-name:"user" description:"Owning user email, external ID or username"`
+		Name string `positional-arg-name:"name" description:"Client name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute creates an OAuth client and prints the client credentials
+func (cmd *OAuthCreateCommand) Execute(args []string) error {
+	return withOAuth(cmd.Args.User, func(oc *oauth.Controller, userID string) error {
+		client, err := oc.CreateClient(userID, cmd.Args.Name, cmd.Scopes, cmd.Redirects, cmd.GrantTypes, cmd.ResponseTypes, cmd.Public)
+		if err != nil {
+			return err
+		}
+		return printJSON(client)
+	})
+}
+
+// OAuthListCommand lists OAuth clients owned by a user
+type OAuthListCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute lists OAuth clients owned by a user
+func (cmd *OAuthListCommand) Execute(args []string) error {
+	return withOAuth(cmd.Args.User, func(oc *oauth.Controller, userID string) error {
+		clients, err := oc.GetClients(userID)
+		if err != nil {
+			return err
+		}
+		return printJSON(clients)
+	})
+}
+
+// OAuthRotateCommand rotates the secret for an OAuth client
+type OAuthRotateCommand struct {
+	Args struct {
+		User     string `positional-arg-name:"user" description:"Owning user email, external ID or username"`
+		ClientID string `positional-arg-name:"client-id" description:"Client ID"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute rotates the secret for an OAuth client and prints the new client credentials
+func (cmd *OAuthRotateCommand) Execute(args []string) error {
+	return withOAuth(cmd.Args.User, func(oc *oauth.Controller, userID string) error {
+		client, err := oc.RotateClientSecret(userID, cmd.Args.ClientID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotated secret for client %s\n", client.ClientID)
+		return printJSON(client)
+	})
+}
@@ -0,0 +1,356 @@
+/*
+ * AuthPlz Administrative Command Line Tool
+ * User account management commands
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/controllers/password"
+	"github.com/ryankurte/authplz/lib/controllers/token"
+	"github.com/ryankurte/authplz/lib/modules/admin"
+	"github.com/ryankurte/authplz/lib/modules/user"
+)
+
+// UserCommand user account management commands
+type UserCommand struct {
+	Create  UserCreateCommand  `command:"create" description:"Create a user account"`
+	List    UserListCommand    `command:"list" description:"List user accounts"`
+	Enable  UserEnableCommand  `command:"enable" description:"Enable a user account"`
+	Disable UserDisableCommand `command:"disable" description:"Disable a user account"`
+	Unlock  UserUnlockCommand  `command:"unlock" description:"Unlock a user account"`
+	Expire  UserExpireCommand  `command:"expire-password" description:"Require a password change at next login"`
+	Promote UserPromoteCommand `command:"promote" description:"Grant admin rights to a user account"`
+	Demote  UserDemoteCommand  `command:"demote" description:"Revoke admin rights from a user account"`
+	Service UserServiceCommand `command:"service" description:"Mark a user account as a service account (exempt from dormancy checks)"`
+	Delete  UserDeleteCommand  `command:"delete" description:"Permanently delete a user account"`
+	Purge   UserPurgeCommand   `command:"purge" description:"Remove accounts past the deletion grace period"`
+}
+
+// UserArgs positional arguments for commands operating on a single user
+type UserArgs struct {
+	User string `positional-arg-name:"user" description:"User email, external ID or username"`
+}
+
+// UserCreateCommand creates a user account
+type UserCreateCommand struct {
+	Activate bool `long:"activate" description:"Activate the account without email verification"`
+	Admin    bool `long:"admin" description:"Grant admin rights to the account"`
+
+	Args struct {
+		Email    string `positional-arg-name:"email" description:"Account email address"`
+		Username string `positional-arg-name:"username" description:"Account username"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute creates a user account, reading the password from stdin
+func (cmd *UserCreateCommand) Execute(args []string) error {
+	c, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	pass, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	policy, err := password.NewPolicy(c.Password)
+	if err != nil {
+		return err
+	}
+	defer policy.Close()
+
+	uc := user.NewController(ds, newEmitter(ds))
+	uc.SetPasswordPolicy(policy)
+
+	u, err := uc.Create(cmd.Args.Email, cmd.Args.Username, pass)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Activate {
+		if u, err = uc.Activate(cmd.Args.Email); err != nil {
+			return err
+		}
+	}
+	if cmd.Admin {
+		if u, err = uc.SetAdmin(u.GetExtID(), true); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Created user %s (%s)\n", u.GetEmail(), u.GetExtID())
+
+	// Issue an activation link in place of the activation email
+	if !cmd.Activate {
+		tc := token.NewTokenController(c.Address, c.TokenSecret, ds)
+		link, err := buildLink(tc, c.ExternalAddress, u.GetExtID(), api.TokenActionActivate, defaultLinkDuration)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Activation link: %s\n", link)
+	}
+
+	return nil
+}
+
+// readPassword reads a password from stdin
+// Input is not echoed where stdin is a terminal
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		pass, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil || len(pass) == 0 {
+			return "", errors.New("No password provided")
+		}
+		return string(pass), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("No password provided")
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// UserListCommand lists user accounts
+type UserListCommand struct {
+	Limit  uint `short:"l" long:"limit" description:"Maximum number of users to list" default:"100"`
+	Offset uint `short:"o" long:"offset" description:"Number of users to skip" default:"0"`
+	JSON   bool `long:"json" description:"Output users as JSON"`
+}
+
+// Execute lists user accounts
+func (cmd *UserListCommand) Execute(args []string) error {
+	_, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	users, err := ds.GetUsers(datastore.QueryFilter{Limit: cmd.Limit, Offset: cmd.Offset})
+	if err != nil {
+		return err
+	}
+
+	// Map users to the admin API response to avoid printing password hashes and internal fields
+	if cmd.JSON {
+		resp := make([]api.AdminUserResp, len(users))
+		for i, u := range users {
+			resp[i] = admin.NewUserResp(u.(*datastore.User))
+		}
+		return printJSON(resp)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tUSERNAME\tACTIVATED\tENABLED\tLOCKED\tADMIN\tLAST LOGIN")
+	for _, i := range users {
+		u := i.(*datastore.User)
+		lastLogin := "never"
+		if !u.LastLogin.IsZero() {
+			lastLogin = u.LastLogin.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%t\t%t\t%s\n", u.ExtID, u.Email, u.Username,
+			u.Activated, u.Enabled, u.Locked, u.Admin, lastLogin)
+	}
+
+	return w.Flush()
+}
+
+// withUser resolves the provided user and runs the provided function with a user controller
+func withUser(id string, fn func(uc *user.Controller, u *datastore.User) error) error {
+	_, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	u, err := resolveUser(ds, id)
+	if err != nil {
+		return err
+	}
+
+	return fn(user.NewController(ds, newEmitter(ds)), u)
+}
+
+// UserEnableCommand enables a user account
+type UserEnableCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute enables a user account
+func (cmd *UserEnableCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetEnabled(u.GetExtID(), true); err != nil {
+			return err
+		}
+		fmt.Printf("Enabled user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserDisableCommand disables a user account
+type UserDisableCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute disables a user account
+func (cmd *UserDisableCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetEnabled(u.GetExtID(), false); err != nil {
+			return err
+		}
+		fmt.Printf("Disabled user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserUnlockCommand unlocks a user account
+type UserUnlockCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute unlocks a user account
+func (cmd *UserUnlockCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.Unlock(u.GetEmail()); err != nil {
+			return err
+		}
+		fmt.Printf("Unlocked user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserExpireCommand requires a password change at next login
+type UserExpireCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute requires a password change at next login
+func (cmd *UserExpireCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetPasswordChangeRequired(u.GetExtID(), true); err != nil {
+			return err
+		}
+		fmt.Printf("Password change required for user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserPromoteCommand grants admin rights to a user account
+type UserPromoteCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute grants admin rights to a user account
+func (cmd *UserPromoteCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetAdmin(u.GetExtID(), true); err != nil {
+			return err
+		}
+		fmt.Printf("Granted admin to user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserDemoteCommand revokes admin rights from a user account
+type UserDemoteCommand struct {
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute revokes admin rights from a user account
+func (cmd *UserDemoteCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetAdmin(u.GetExtID(), false); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked admin from user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserServiceCommand marks a user account as a service account
+type UserServiceCommand struct {
+	Remove bool `long:"remove" description:"Remove service account status"`
+
+	Args UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute sets the service account status for a user account
+func (cmd *UserServiceCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if _, err := uc.SetServiceAccount(u.GetExtID(), !cmd.Remove); err != nil {
+			return err
+		}
+		fmt.Printf("Service account status for user %s: %t\n", u.GetEmail(), !cmd.Remove)
+		return nil
+	})
+}
+
+// UserDeleteCommand permanently deletes a user account
+type UserDeleteCommand struct {
+	Force bool     `short:"f" long:"force" description:"Delete without confirmation"`
+	Args  UserArgs `positional-args:"yes" required:"yes"`
+}
+
+// Execute permanently deletes a user account
+func (cmd *UserDeleteCommand) Execute(args []string) error {
+	return withUser(cmd.Args.User, func(uc *user.Controller, u *datastore.User) error {
+		if !cmd.Force {
+			fmt.Fprintf(os.Stderr, "Permanently delete user %s and all associated data? [y/N]: ", u.GetEmail())
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if strings.ToLower(strings.TrimSpace(line)) != "y" {
+				return errors.New("Deletion cancelled")
+			}
+		}
+
+		if err := uc.Delete(u.GetExtID()); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted user %s\n", u.GetEmail())
+		return nil
+	})
+}
+
+// UserPurgeCommand removes deleted accounts past the deletion grace period
+type UserPurgeCommand struct{}
+
+// Execute removes deleted accounts past the deletion grace period
+func (cmd *UserPurgeCommand) Execute(args []string) error {
+	c, ds, err := load()
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	uc := user.NewController(ds, newEmitter(ds))
+	uc.SetDeletionGracePeriod(c.DeletionGracePeriod)
+
+	count, err := uc.PurgeDeleted()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d deleted accounts\n", count)
+	return nil
+}
@@ -0,0 +1,40 @@
+// Defines administrator API types
+
+package api
+
+import (
+	"time"
+)
+
+// AdminUserResp is the user account object returned by administrator requests
+type AdminUserResp struct {
+	UserResp
+	Admin                  bool
+	LoginRetries           uint
+	PasswordChanged        time.Time
+	PasswordChangeRequired bool
+	ServiceAccount         bool
+	Dormant                bool
+	AllowedNetworks        []string
+}
+
+// AdminUserList is a paginated list of user accounts returned by administrator searches
+type AdminUserList struct {
+	Paginate
+	Users []AdminUserResp
+}
+
+// AdminSecondFactors lists the second factors registered to a user account
+type AdminSecondFactors struct {
+	TOTP   []TOTPToken
+	U2F    []U2FToken
+	Backup []BackupCode
+}
+
+// ImpersonationStatus describes the impersonation state of the current session
+type ImpersonationStatus struct {
+	Impersonating bool
+	AdminID       string `json:",omitempty"`
+	UserID        string `json:",omitempty"`
+	Started       time.Time
+}
@@ -0,0 +1,25 @@
+// Defines audit API types
+
+package api
+
+import (
+	"time"
+)
+
+// RequestContext describes the request an action was made in
+// This is attached to events and audit records to show where each action came from
+type RequestContext struct {
+	RequestID string
+	IP        string
+	UserAgent string
+}
+
+// AuditEvent is the API safe audit event object returned by audit requests
+type AuditEvent struct {
+	Type      string
+	Time      time.Time
+	Data      map[string]string
+	RequestID string
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,51 @@
+// Defines personal data export API types
+
+package api
+
+import (
+	"time"
+)
+
+// Data export status values
+const (
+	DataExportPending  = "pending"
+	DataExportComplete = "complete"
+	DataExportFailed   = "failed"
+)
+
+// DataExportStatus describes a personal data export request
+// Completed exports can be downloaded from URL until they expire
+type DataExportStatus struct {
+	ID          string
+	Status      string
+	CreatedAt   time.Time
+	CompletedAt time.Time
+	ExpiresAt   time.Time
+	URL         string `json:",omitempty"`
+}
+
+// DataExportUser contains the account fields included in a data export
+type DataExportUser struct {
+	ExtID           string
+	Email           string
+	Username        string
+	CreatedAt       time.Time
+	LastLogin       time.Time
+	PasswordChanged time.Time
+	Activated       bool
+	Enabled         bool
+	Locked          bool
+	Admin           bool
+}
+
+// DataExport is the archive of personal data held for a user account
+type DataExport struct {
+	Generated     time.Time
+	User          DataExportUser
+	TOTP          []TOTPToken
+	U2F           []U2FToken
+	Backup        []BackupCode
+	OAuthClients  []OAuthClientResp
+	OAuthSessions OAuthUserSessions
+	AuditEvents   []AuditEvent
+}
@@ -0,0 +1,17 @@
+// Defines registration invitation API types
+
+package api
+
+import (
+	"time"
+)
+
+// Invite describes a registration invitation
+// Codes are only returned to the user that issued the invitation
+type Invite struct {
+	Code      string `json:",omitempty"`
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
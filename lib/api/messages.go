@@ -42,6 +42,59 @@ type ApiMessageContainer struct {
 	NoOAuthTokenFound        string
 	FormParsingError         string
 	DuplicateUserAccount     string
+	AdminRequired            string
+	SudoRequired             string
+	SudoGranted              string
+	SudoCleared              string
+	SudoPasswordRequired     string
+	SudoPasswordIncorrect    string
+	UserNotFound             string
+	AdminActionSuccessful    string
+	AdminSelfActionBlocked   string
+	ImpersonationBlocked     string
+	ImpersonationNotActive   string
+	UserDisabled             string
+	AccountDeleted           string
+	AccountRestored          string
+	AccountRestoreFailed     string
+	ExportPending            string
+	ExportNotFound           string
+	ExportExpired            string
+	EmailChangeRequested     string
+	UsernameUpdated          string
+	UsernameInvalid          string
+	UsernameReserved         string
+	UsernameChangeCooldown   string
+	PasswordTooShort         string
+	PasswordTooLong          string
+	PasswordTooWeak          string
+	PasswordContainsIdentity string
+	PasswordBreached         string
+	PasswordReused           string
+	PasswordChangeRequired   string
+	PasswordChangeComplete   string
+	CreateUserInvited        string
+	RegistrationDisabled     string
+	InviteRequired           string
+	InviteInvalid            string
+	InviteNotAllowed         string
+	InviteCreated            string
+	InviteRevoked            string
+	EmailDomainNotAllowed    string
+	RegistrationRejected     string
+	RegistrationUnavailable  string
+	SecondFactorEnrolment    string
+	SecondFactorEnrolled     string
+	SecondFactorRemoved      string
+	SecondFactorNotFound     string
+	LastSecondFactor         string
+	DeviceRevoked            string
+	DeviceNotFound           string
+	NetworksUpdated          string
+	NetworksInvalid          string
+	NetworksExcludeCurrent   string
+	NetworkBlocked           string
+	LoginBlocked             string
 }
 
 // Create API message structure for English responses
@@ -68,6 +121,99 @@ var ApiMessageEn = ApiMessageContainer{
 	NoOAuthTokenFound:        "No OAuth Token Found",
 	FormParsingError:         "Error parsing submitted form",
 	DuplicateUserAccount:     "A user account with that username or email address already exists",
+	AdminRequired:            "You must be an administrator to view this page",
+	SudoRequired:             "You must re-authenticate to perform this action",
+	SudoGranted:              "Re-authentication successful",
+	SudoCleared:              "Re-authentication cleared",
+	SudoPasswordRequired:     "Your password is required to re-authenticate",
+	SudoPasswordIncorrect:    "Incorrect password",
+	UserNotFound:             "User account not found",
+	AdminActionSuccessful:    "Administrative action complete",
+	AdminSelfActionBlocked:   "Administrators cannot perform this action on their own account",
+	ImpersonationBlocked:     "This action is not available while impersonating a user",
+	ImpersonationNotActive:   "No impersonation session active",
+	UserDisabled:             "User account is disabled",
+	AccountDeleted:           "Account deleted, it can be restored until the end of the deletion grace period",
+	AccountRestored:          "Account restored, please log in to continue",
+	AccountRestoreFailed:     "Unable to restore account, check your email and password",
+	ExportPending:            "A data export is already being prepared, check your emails for a download link",
+	ExportNotFound:           "Data export not found",
+	ExportExpired:            "Data export has expired, please request a new export",
+	EmailChangeRequested:     "Email change requested, check your new email address for a confirmation link",
+	UsernameUpdated:          "Username updated",
+	UsernameInvalid:          "Usernames must be 3 to 32 characters of lower case letters, numbers, '.', '-' or '_'",
+	UsernameReserved:         "That username is reserved",
+	UsernameChangeCooldown:   "Your username was changed too recently, please try again later",
+	PasswordTooShort:         "Password is too short",
+	PasswordTooLong:          "Password is too long",
+	PasswordTooWeak:          "Password is too easy to guess, try a longer password or more varied characters",
+	PasswordContainsIdentity: "Password must not contain your username or email address",
+	PasswordBreached:         "Password has appeared in a data breach, please choose a different password",
+	PasswordReused:           "Password has been used recently, please choose a different password",
+	PasswordChangeRequired:   "Your password has expired and must be changed before you can log in",
+	PasswordChangeComplete:   "Password updated, please log in with your new password",
+	CreateUserInvited:        "Created user account, please log in to continue",
+	RegistrationDisabled:     "Registration is currently disabled",
+	InviteRequired:           "An invitation is required to create an account",
+	InviteInvalid:            "Invitation is invalid, expired or has already been used",
+	InviteNotAllowed:         "You are not permitted to issue invitations",
+	InviteCreated:            "Invitation sent",
+	InviteRevoked:            "Invitation revoked",
+	EmailDomainNotAllowed:    "Accounts cannot be created with email addresses from that domain",
+	RegistrationRejected:     "Your registration could not be accepted",
+	RegistrationUnavailable:  "Registration is temporarily unavailable, please try again later",
+	SecondFactorEnrolment:    "You must enrol a second factor before you can log in",
+	SecondFactorEnrolled:     "Second factor enrolled, please log in to continue",
+	SecondFactorRemoved:      "Second factor removed",
+	SecondFactorNotFound:     "Second factor not found",
+	LastSecondFactor:         "Your last second factor cannot be removed while second factors are required",
+	DeviceRevoked:            "Remembered device removed",
+	DeviceNotFound:           "Remembered device not found",
+	NetworksUpdated:          "Allowed networks updated",
+	NetworksInvalid:          "Allowed networks must be valid addresses or CIDRs",
+	NetworksExcludeCurrent:   "Allowed networks must include your current address",
+	NetworkBlocked:           "Access is not permitted from your current network",
+	LoginBlocked:             "Login blocked, check your emails for an unlock link",
+}
+
+// PasswordReason fetches the message for a password policy rejection reason
+func (m *ApiMessageContainer) PasswordReason(code string) string {
+	switch code {
+	case PasswordReasonTooShort:
+		return m.PasswordTooShort
+	case PasswordReasonTooLong:
+		return m.PasswordTooLong
+	case PasswordReasonTooWeak:
+		return m.PasswordTooWeak
+	case PasswordReasonContainsIdentity:
+		return m.PasswordContainsIdentity
+	case PasswordReasonBreached:
+		return m.PasswordBreached
+	case PasswordReasonReused:
+		return m.PasswordReused
+	default:
+		return m.PasswordComplexityTooLow
+	}
+}
+
+// LoginBlockedReason fetches the message for a login blocked by a PreLogin hook
+func (m *ApiMessageContainer) LoginBlockedReason(code string) string {
+	switch code {
+	case LoginBlockedReasonNetwork:
+		return m.NetworkBlocked
+	default:
+		return m.LoginBlocked
+	}
+}
+
+// RegistrationReason fetches the message for a registration rejection reason
+func (m *ApiMessageContainer) RegistrationReason(code string) string {
+	switch code {
+	case RegistrationReasonUnavailable:
+		return m.RegistrationUnavailable
+	default:
+		return m.RegistrationRejected
+	}
 }
 
 // Default locale for external use
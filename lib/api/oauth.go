@@ -0,0 +1,106 @@
+// Defines OAuth API types
+
+package api
+
+import (
+	"time"
+)
+
+// OAuthClientReq is a client request object used to create an OAuth client
+type OAuthClientReq struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Redirects []string `json:"redirects"`
+	Grants    []string `json:"grant_types"`
+	Responses []string `json:"response_types"`
+	// Optional token lifespan overrides
+	Lifespans *OAuthLifespans `json:"lifespans,omitempty"`
+}
+
+// OAuthClientResp is the API safe object returned by client requests
+type OAuthClientResp struct {
+	ClientID      string         `json:"id"`
+	Name          string         `json:"name"`
+	CreatedAt     time.Time      `json:"created_at"`
+	LastUsed      time.Time      `json:"last_used"`
+	Scopes        []string       `json:"allowed_scopes"`
+	GrantTypes    []string       `json:"grant_types"`
+	ResponseTypes []string       `json:"response_types"`
+	RedirectURIs  []string       `json:"redirect_uris"`
+	Lifespans     OAuthLifespans `json:"lifespans"`
+	Secret        string         `json:"secret"`
+}
+
+// OAuthLifespans is the API safe representation of client token lifespan overrides (in seconds)
+// Zero values indicate the global default is used
+type OAuthLifespans struct {
+	AccessToken   uint `json:"access_token"`
+	AuthorizeCode uint `json:"authorize_code"`
+	IDToken       uint `json:"id_token"`
+	RefreshToken  uint `json:"refresh_token"`
+}
+
+// OAuthOptionResp lists the client options available to a user
+type OAuthOptionResp struct {
+	Scopes        []string `json:"scopes"`
+	GrantTypes    []string `json:"grant_types"`
+	ResponseTypes []string `json:"response_types"`
+}
+
+// OAuthAuthorizationRequest is a pending authorization request awaiting user confirmation
+type OAuthAuthorizationRequest struct {
+	State       string   `json:"state"`
+	Name        string   `json:"name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+}
+
+// OAuthAuthorizeConfirm authorization confirmation object
+type OAuthAuthorizeConfirm struct {
+	Accept        bool     `json:"accept"`
+	State         string   `json:"state"`
+	GrantedScopes []string `json:"granted_scopes"`
+}
+
+// OAuthAccessTokenInfo is an access token information response
+type OAuthAccessTokenInfo struct {
+	RequestedAt time.Time
+	ExpiresAt   time.Time
+}
+
+// OAuthGrantInfo describes an OAuth grant (authorization code or token session)
+type OAuthGrantInfo struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Scopes      []string  `json:"scopes"`
+	RequestedAt time.Time `json:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// OAuthUserSessions lists the OAuth grants associated with a user
+type OAuthUserSessions struct {
+	AuthorizationCodes []OAuthGrantInfo `json:"authorization_codes"`
+	RefreshTokens      []OAuthGrantInfo `json:"refresh_tokens"`
+	AccessCodes        []OAuthGrantInfo `json:"access_codes"`
+}
+
+// OAuthTokenResp is the token endpoint response object (RFC6749 section 5.1)
+type OAuthTokenResp struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthIntrospection is the token introspection response object (RFC7662 section 2.2)
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
@@ -0,0 +1,61 @@
+// Defines password policy API types
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Password policy rejection reasons
+const (
+	PasswordReasonTooShort         = "too_short"
+	PasswordReasonTooLong          = "too_long"
+	PasswordReasonTooWeak          = "too_weak"
+	PasswordReasonContainsIdentity = "contains_identity"
+	PasswordReasonBreached         = "breached"
+	PasswordReasonReused           = "reused"
+)
+
+// PasswordPolicyError is returned when a password does not meet the password policy
+// Reasons lists each of the policy rules the password failed
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("password does not meet policy requirements (%s)", strings.Join(e.Reasons, ", "))
+}
+
+// PasswordPolicyReason describes a password policy rule failed by a password
+type PasswordPolicyReason struct {
+	// Reason code (one of the PasswordReason constants)
+	Code string `json:"code"`
+	// Message describing the reason
+	Message string `json:"message"`
+}
+
+// PasswordPolicyResponse API response for passwords rejected by the password policy
+type PasswordPolicyResponse struct {
+	// Always "error"
+	Result string `json:"result"`
+	// Message corresponding to response status
+	Message string `json:"message"`
+	// Policy rules failed by the password
+	Reasons []PasswordPolicyReason `json:"reasons"`
+}
+
+// NewPasswordPolicyResponse builds a password policy response using the provided locale
+func NewPasswordPolicyResponse(locale *ApiMessageContainer, err *PasswordPolicyError) *PasswordPolicyResponse {
+	resp := PasswordPolicyResponse{
+		Result:  ResultError,
+		Message: locale.PasswordComplexityTooLow,
+		Reasons: make([]PasswordPolicyReason, len(err.Reasons)),
+	}
+
+	for i, code := range err.Reasons {
+		resp.Reasons[i] = PasswordPolicyReason{Code: code, Message: locale.PasswordReason(code)}
+	}
+
+	return &resp
+}
@@ -0,0 +1,54 @@
+// Defines account registration API types
+
+package api
+
+import (
+	"fmt"
+)
+
+// Registration rejection reasons returned by registration hooks
+const (
+	RegistrationReasonRejected    = "rejected"
+	RegistrationReasonUnavailable = "unavailable"
+)
+
+// Registration describes an account registration passed to registration hooks
+// PreCreate hooks may add to Data to enrich the registration, this is included in the
+// account created event and passed to PostCreate hooks
+type Registration struct {
+	Email    string
+	Username string
+	Invited  bool
+	Data     map[string]string
+}
+
+// RegistrationError is returned by registration hooks to reject a registration
+type RegistrationError struct {
+	// Reason code (one of the RegistrationReason constants)
+	Reason string
+	// Hook the registration was rejected by
+	Hook string
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("registration rejected by %s (%s)", e.Hook, e.Reason)
+}
+
+// RegistrationResponse API response for registrations rejected by a registration hook
+type RegistrationResponse struct {
+	// Always "error"
+	Result string `json:"result"`
+	// Message corresponding to the rejection reason
+	Message string `json:"message"`
+	// Rejection reason code
+	Reason string `json:"reason"`
+}
+
+// NewRegistrationResponse builds a registration rejection response using the provided locale
+func NewRegistrationResponse(locale *ApiMessageContainer, err *RegistrationError) *RegistrationResponse {
+	return &RegistrationResponse{
+		Result:  ResultError,
+		Message: locale.RegistrationReason(err.Reason),
+		Reason:  err.Reason,
+	}
+}
@@ -13,6 +13,11 @@ type TokenAction string
 const TokenActionActivate TokenAction = "activate"
 const TokenActionUnlock TokenAction = "unlock"
 const TokenActionRecovery TokenAction = "recover"
+const TokenActionEmailChange TokenAction = "email-change"
+const TokenActionEmailCancel TokenAction = "email-cancel"
+const TokenActionEmailRevert TokenAction = "email-revert"
+const TokenActionReactivate TokenAction = "reactivate"
+const TokenActionSecure TokenAction = "secure"
 
 // Token error actions
 const TokenActionInvalid TokenAction = "invalid"
@@ -0,0 +1,66 @@
+// Defines second factor (TOTP, U2F and backup code) API types
+
+package api
+
+import (
+	"time"
+)
+
+// TOTPRegisterChallenge is a TOTP registration challenge
+type TOTPRegisterChallenge struct {
+	AccountName string
+	Issuer      string
+	TokenName   string
+	URL         string
+	Image       string
+	Secret      string
+}
+
+// TOTPToken is a sanatised TOTP token instance
+type TOTPToken struct {
+	Name       string
+	LastUsed   time.Time
+	UsageCount uint
+}
+
+// U2FToken is a sanatised U2F token instance
+type U2FToken struct {
+	Name      string
+	KeyHandle string
+	Counter   uint
+	LastUsed  time.Time
+}
+
+// TrustedDevice is a sanatised remembered device instance
+// The second factor is skipped when logging in from a remembered device until it expires
+type TrustedDevice struct {
+	DeviceID  string
+	UserAgent string
+	CreatedAt time.Time
+	LastUsed  time.Time
+	ExpiresAt time.Time
+}
+
+// BackupKey structure for API use
+type BackupKey struct {
+	// Mnemonic key name
+	Name string
+	// Mnemonic key code
+	Code string
+	// Key Hash
+	Hash string
+}
+
+// BackupCodes is the response object returned when backup codes are created
+type BackupCodes struct {
+	Service string
+	Tokens  []BackupKey
+}
+
+// BackupCode is a sanatised backup code instance
+type BackupCode struct {
+	Name      string
+	Used      bool
+	CreatedAt time.Time
+	UsedAt    time.Time
+}
@@ -0,0 +1,65 @@
+// Defines user account API types
+
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserResp is the API safe user account object returned by account requests
+type UserResp struct {
+	ExtId     string
+	Email     string
+	Username  string
+	Activated bool
+	Enabled   bool
+	Locked    bool
+	LastLogin time.Time
+	CreatedAt time.Time
+}
+
+// GetExtID fetches the user ExtID
+func (ur *UserResp) GetExtID() string { return ur.ExtId }
+
+// GetEmail fetches the user Email
+func (ur *UserResp) GetEmail() string { return ur.Email }
+
+// LoginContext describes the client a login was made from
+// This is passed to login context hooks to allow logins from new devices to be detected
+type LoginContext struct {
+	IP        string
+	UserAgent string
+}
+
+// Login blocked reasons returned by PreLogin hooks
+const (
+	LoginBlockedReasonNetwork = "network"
+)
+
+// LoginBlockedError is returned by PreLogin hooks to block a login with a reason reported to the user
+type LoginBlockedError struct {
+	// Reason code (one of the LoginBlockedReason constants)
+	Reason string
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("login blocked (%s)", e.Reason)
+}
+
+// SudoStatus is the re-authentication state of a user session
+// Sensitive account actions are allowed until the sudo session expires
+type SudoStatus struct {
+	Active  bool
+	Expires time.Time
+}
+
+// AllowedNetworks is the list of networks (CIDRs or addresses) an account may be logged in to from
+// An empty list allows logins from any network permitted by the server configuration
+type AllowedNetworks struct {
+	Networks []string
+}
+
+// SecondFactors is the set of second factors available to a user, returned with
+// a 202 (Accepted) response when a partial login requires a second factor
+type SecondFactors map[string]bool
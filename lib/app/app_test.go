@@ -14,7 +14,6 @@ import (
 	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
-	"github.com/ryankurte/authplz/lib/modules/2fa/totp"
 	"github.com/ryankurte/authplz/lib/test"
 )
 
@@ -348,6 +347,62 @@ func TestMain(t *testing.T) {
 		}
 	})
 
+	t.Run("Sensitive account actions require sudo", func(t *testing.T) {
+		v := url.Values{}
+		v.Set("old_password", fakePass)
+		v.Set("new_password", "New fake password 88@#")
+		resp, err := client.PostForm("/account", http.StatusForbidden, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultError, api.GetAPILocale(api.DefaultLocale).SudoRequired)
+		if err != nil {
+			t.Error(err)
+		}
+
+		status := api.SudoStatus{}
+		if err := client.GetJSON("/sudo", http.StatusOK, &status); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if status.Active {
+			t.Errorf("Unexpected sudo session")
+		}
+
+		// Sudo requires the correct password
+		v = url.Values{}
+		v.Set("password", "wrong password")
+		resp, err = client.PostForm("/sudo", http.StatusUnauthorized, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultError, api.GetAPILocale(api.DefaultLocale).SudoPasswordIncorrect)
+		if err != nil {
+			t.Error(err)
+		}
+
+		v.Set("password", fakePass)
+		resp, err = client.PostForm("/sudo", http.StatusOK, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultOk, api.GetAPILocale(api.DefaultLocale).SudoGranted)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if err := client.GetJSON("/sudo", http.StatusOK, &status); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if !status.Active || !status.Expires.After(time.Now()) {
+			t.Errorf("Expected active sudo session (received %+v)", status)
+		}
+	})
+
 	t.Run("Logged in users can update passwords", func(t *testing.T) {
 
 		v := url.Values{}
@@ -474,6 +529,155 @@ func TestMain(t *testing.T) {
 		//TODO
 	})
 
+	t.Run("Users requiring a password change can only change their password", func(t *testing.T) {
+		newPass := "Rotated fake password 77@#"
+
+		if _, err := server.userModule.SetPasswordChangeRequired(userID, true); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		// Login results in a password change session
+		v := url.Values{}
+		v.Set("email", fakeEmail)
+		v.Set("password", fakePass)
+		resp, err := client.PostForm("/login", http.StatusForbidden, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultError, api.GetAPILocale(api.DefaultLocale).PasswordChangeRequired)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if _, err := client.Get("/account", http.StatusUnauthorized); err != nil {
+			t.Error(err)
+		}
+
+		// Password can be changed with the password change session
+		v = url.Values{}
+		v.Set("old_password", fakePass)
+		v.Set("new_password", newPass)
+		resp, err = client.PostForm("/account", http.StatusOK, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultOk, api.GetAPILocale(api.DefaultLocale).PasswordChangeComplete)
+		if err != nil {
+			t.Error(err)
+		}
+		fakePass = newPass
+
+		// Users can then log in with the new password
+		v = url.Values{}
+		v.Set("email", fakeEmail)
+		v.Set("password", fakePass)
+		if _, err := client.PostForm("/login", http.StatusOK, v); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Users required to use second factors must enrol one to log in", func(t *testing.T) {
+		client2 := test.NewTestClient(apiPath)
+
+		policy := config.SecondFactorConfig{Required: config.SecondFactorAll}
+		if err := server.userModule.SetSecondFactorPolicy(policy); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer server.userModule.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+
+		// Login results in a second factor enrolment session
+		v := url.Values{}
+		v.Set("email", fakeEmail)
+		v.Set("password", fakePass)
+		resp, err := client2.PostForm("/login", http.StatusForbidden, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultError, api.GetAPILocale(api.DefaultLocale).SecondFactorEnrolment)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if err := client2.GetAPIResponse("/status", http.StatusOK, api.ResultError, api.GetAPILocale(api.DefaultLocale).Unauthorized); err != nil {
+			t.Error(err)
+		}
+
+		// A second factor can be enrolled with the enrolment session
+		v = url.Values{}
+		v.Set("name", "enrolmentToken")
+		var rc api.TOTPRegisterChallenge
+		if err := client2.GetJSONWithParams("/totp/enrol", http.StatusOK, v, &rc); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		code, err := _totp.GenerateCode(rc.Secret, time.Now())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		v = url.Values{}
+		v.Set("code", code)
+		resp, err = client2.PostForm("/totp/enrol", http.StatusOK, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultOk, api.GetAPILocale(api.DefaultLocale).SecondFactorEnrolled)
+		if err != nil {
+			t.Error(err)
+		}
+
+		// Users must then log in using the enrolled factor
+		v = url.Values{}
+		v.Set("email", fakeEmail)
+		v.Set("password", fakePass)
+		if _, err := client2.PostForm("/login", http.StatusAccepted, v); err != nil {
+			t.Error(err)
+		}
+
+		// Logged in users with second factors must complete one to obtain sudo
+		v = url.Values{}
+		v.Set("password", fakePass)
+		if _, err := client.PostForm("/sudo", http.StatusAccepted, v); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		code, err = _totp.GenerateCode(rc.Secret, time.Now())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		v = url.Values{}
+		v.Set("code", code)
+		if _, err := client.PostForm("/totp/authenticate", http.StatusOK, v); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		// The last second factor cannot be removed while second factors are required
+		v = url.Values{}
+		v.Set("name", "enrolmentToken")
+		resp, err = client.DeleteWithParams("/totp/tokens", http.StatusForbidden, v)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = test.ParseAndCheckAPIResponse(resp, api.ResultError, api.GetAPILocale(api.DefaultLocale).LastSecondFactor)
+		if err != nil {
+			t.Error(err)
+		}
+
+		server.userModule.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+		if _, err := client.DeleteWithParams("/totp/tokens", http.StatusOK, v); err != nil {
+			t.Error(err)
+		}
+	})
+
 	t.Run("Logged in users can enrol fido tokens", func(t *testing.T) {
 		v := url.Values{}
 		v.Set("name", "fakeToken")
@@ -519,7 +723,7 @@ func TestMain(t *testing.T) {
 	})
 
 	t.Run("Logged in users can list fido tokens", func(t *testing.T) {
-		var regs []u2f.Registration
+		var regs []api.U2FToken
 		if err := client.GetJSON("/u2f/tokens", 200, &regs); err != nil {
 			t.Error(err)
 			t.FailNow()
@@ -536,7 +740,7 @@ func TestMain(t *testing.T) {
 		// Generate enrolment request
 		v := url.Values{}
 		v.Set("name", "fakeToken")
-		var rc totp.RegisterChallenge
+		var rc api.TOTPRegisterChallenge
 		if err := client.GetJSONWithParams("/totp/enrol", http.StatusOK, v, &rc); err != nil {
 			t.Error(err)
 			t.FailNow()
@@ -571,7 +775,7 @@ func TestMain(t *testing.T) {
 	})
 
 	t.Run("Logged in users can list totp tokens", func(t *testing.T) {
-		var tokens []totp.TokenResp
+		var tokens []api.TOTPToken
 		if err := client.GetJSON("/totp/tokens", 200, &tokens); err != nil {
 			t.Error(err)
 		}
@@ -644,6 +848,7 @@ func TestMain(t *testing.T) {
 	t.Run("Second factor allows login (totp)", func(t *testing.T) {
 
 		client2 := test.NewTestClient(apiPath)
+		loginStart := time.Now()
 
 		// Start login
 		v := url.Values{}
@@ -671,6 +876,88 @@ func TestMain(t *testing.T) {
 			t.Error(err)
 		}
 
+		// Logins completed with a second factor count as activity for dormancy checks
+		u, err := server.ds.GetUserByEmail(fakeEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if u.(*datastore.User).GetLastLogin().Before(loginStart) {
+			t.Errorf("Last login not updated by second factor login")
+		}
+
+		server.userModule.SetDormancy(time.Since(loginStart), 365*24*time.Hour)
+		defer server.userModule.SetDormancy(c.Dormancy.WarnAfter, c.Dormancy.DisableAfter)
+		if _, _, err := server.userModule.CheckDormantAccounts(); err != nil {
+			t.Error(err)
+		}
+
+		u, _ = server.ds.GetUserByEmail(fakeEmail)
+		if user := u.(*datastore.User); !user.IsEnabled() || user.GetDormancyWarned().After(loginStart) {
+			t.Errorf("User active with a second factor treated as dormant")
+		}
+	})
+
+	t.Run("Remembered devices skip the second factor until revoked", func(t *testing.T) {
+		client2 := test.NewTestClient(apiPath)
+
+		v := url.Values{}
+		v.Set("email", fakeEmail)
+		v.Set("password", fakePass)
+		if _, err := client2.PostForm("/login", http.StatusAccepted, v); err != nil {
+			t.Error(err)
+		}
+
+		// Complete the second factor and remember the device
+		code, err := _totp.GenerateCode(totpSecret, time.Now())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		cv := url.Values{}
+		cv.Set("code", code)
+		cv.Set("remember", "true")
+		if _, err := client2.PostForm("/totp/authenticate", http.StatusOK, cv); err != nil {
+			t.Error(err)
+		}
+
+		// Logging in again from the remembered device skips the second factor
+		if _, err := client2.Get("/logout", http.StatusOK); err != nil {
+			t.Error(err)
+		}
+		if _, err := client2.PostForm("/login", http.StatusOK, v); err != nil {
+			t.Error(err)
+		}
+
+		var devices []api.TrustedDevice
+		if err := client2.GetJSON("/account/devices", http.StatusOK, &devices); err != nil {
+			t.Error(err)
+		}
+		if len(devices) != 1 {
+			t.Errorf("Expected one remembered device (%+v)", devices)
+			t.FailNow()
+		}
+
+		// Revoking devices requires a sudo session
+		if _, err := client2.DeleteWithParams("/account/devices/"+devices[0].DeviceID, http.StatusForbidden, nil); err != nil {
+			t.Error(err)
+		}
+		sv := url.Values{}
+		sv.Set("password", fakePass)
+		if _, err := client2.PostForm("/sudo", http.StatusOK, sv); err != nil {
+			t.Error(err)
+		}
+
+		// Revoked devices require the second factor
+		if _, err := client2.DeleteWithParams("/account/devices/"+devices[0].DeviceID, http.StatusOK, nil); err != nil {
+			t.Error(err)
+		}
+		if _, err := client2.Get("/logout", http.StatusOK); err != nil {
+			t.Error(err)
+		}
+		if _, err := client2.PostForm("/login", http.StatusAccepted, v); err != nil {
+			t.Error(err)
+		}
 	})
 
 	t.Run("Users can request password resets with 2fa", func(t *testing.T) {
@@ -733,4 +1020,33 @@ func TestMain(t *testing.T) {
 		}
 	})
 
+	t.Run("Anonymous actions require confirmation", func(t *testing.T) {
+		st, _ := server.tokenControl.BuildToken(userID, api.TokenActionSecure, time.Hour)
+
+		client2 := test.NewTestClient(apiPath)
+		v := url.Values{}
+		v.Set("token", st)
+
+		// Fetching the link (ie. by a mail scanner) redirects to a confirmation page
+		if _, err := client2.GetWithParams("/action", http.StatusFound, v); err != nil {
+			t.Error(err)
+		}
+		if _, err := client2.PostForm("/action", http.StatusBadRequest, v); err != nil {
+			t.Error(err)
+		}
+		u, _ := server.ds.GetUserByExtID(userID)
+		if u.(*datastore.User).IsLocked() {
+			t.Errorf("Account locked without confirmation")
+		}
+
+		v.Set("confirm", "true")
+		if _, err := client2.PostForm("/action", http.StatusOK, v); err != nil {
+			t.Error(err)
+		}
+		u, _ = server.ds.GetUserByExtID(userID)
+		if !u.(*datastore.User).IsLocked() {
+			t.Errorf("Account not locked by confirmed action")
+		}
+	})
+
 }
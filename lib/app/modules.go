@@ -0,0 +1,101 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/gocraft/web"
+
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/controllers/token"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// Built in module names, used to enable, disable and configure modules in the modules config section
+const (
+	ModuleU2F    = "u2f"
+	ModuleTOTP   = "totp"
+	ModuleBackup = "backup"
+	ModuleAudit  = "audit"
+	ModuleOAuth  = "oauth"
+	ModuleMailer = "mailer"
+)
+
+var builtinModules = []string{ModuleU2F, ModuleTOTP, ModuleBackup, ModuleAudit, ModuleOAuth, ModuleMailer}
+
+// ErrorModuleRegistered is returned when registering a module with a name that is already in use
+var ErrorModuleRegistered = errors.New("AuthPlzServer: a module with this name is already registered")
+
+// ModuleContext provides the shared services available to registered modules on creation
+type ModuleContext struct {
+	// Server configuration
+	Config config.AuthPlzConfig
+	// Module specific options from the modules config section
+	Options map[string]string
+	// Datastore instance
+	DataStore *datastore.DataStore
+	// Event emitter for sending events to async services
+	Emitter events.EventEmitter
+	// Token controller for creating and validating action tokens
+	TokenControl *token.TokenController
+}
+
+// ModuleFactory creates a registered module instance
+// Modules are bound to the core module using core.BindModule, to the router where they
+// implement APIBinder, and as an async service where they implement core.EventHandler
+type ModuleFactory func(ctx *ModuleContext) (interface{}, error)
+
+// APIBinder is implemented by modules providing API endpoints
+type APIBinder interface {
+	BindAPI(router *web.Router)
+}
+
+var registry = struct {
+	sync.Mutex
+	factories map[string]ModuleFactory
+}{factories: make(map[string]ModuleFactory)}
+
+// RegisterModule registers a module factory by name, this is intended to be called from
+// the init function of third party modules. Registered modules are created and bound by
+// NewServer unless disabled in the modules config section
+func RegisterModule(name string, factory ModuleFactory) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, b := range builtinModules {
+		if b == name {
+			return ErrorModuleRegistered
+		}
+	}
+	if _, ok := registry.factories[name]; ok {
+		return ErrorModuleRegistered
+	}
+
+	registry.factories[name] = factory
+
+	return nil
+}
+
+// RegisteredModules lists the names of registered modules
+func RegisteredModules() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// registeredModule fetches a registered module factory by name
+func registeredModule(name string) ModuleFactory {
+	registry.Lock()
+	defer registry.Unlock()
+
+	return registry.factories[name]
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleRegistry(t *testing.T) {
+	factory := func(ctx *ModuleContext) (interface{}, error) {
+		return ctx.Options, nil
+	}
+
+	t.Run("Modules can be registered by name", func(t *testing.T) {
+		err := RegisterModule("test-module", factory)
+		assert.Nil(t, err)
+		assert.Contains(t, RegisteredModules(), "test-module")
+		assert.True(t, isKnownModule("test-module"))
+
+		mod, err := registeredModule("test-module")(&ModuleContext{Options: map[string]string{"key": "value"}})
+		assert.Nil(t, err)
+		assert.EqualValues(t, "value", mod.(map[string]string)["key"])
+	})
+
+	t.Run("Duplicate and built in module names are rejected", func(t *testing.T) {
+		assert.EqualValues(t, ErrorModuleRegistered, RegisterModule("test-module", factory))
+		assert.EqualValues(t, ErrorModuleRegistered, RegisterModule(ModuleTOTP, factory))
+	})
+
+	t.Run("Unknown modules are detected", func(t *testing.T) {
+		assert.True(t, isKnownModule(ModuleMailer))
+		assert.False(t, isKnownModule("missing-module"))
+	})
+
+	t.Run("Module options are merged over defaults", func(t *testing.T) {
+		defaults := map[string]string{"domain": "default", "key": "default"}
+		merged := mergeOptions(defaults, map[string]string{"key": "value"})
+		assert.EqualValues(t, "default", merged["domain"])
+		assert.EqualValues(t, "value", merged["key"])
+		assert.EqualValues(t, "default", defaults["key"])
+	})
+}
@@ -1,10 +1,12 @@
 package app
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"time"
 
 	"github.com/gocraft/web"
 	"github.com/gorilla/context"
@@ -16,14 +18,18 @@ import (
 
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
 	"github.com/ryankurte/authplz/lib/controllers/mailer"
+	"github.com/ryankurte/authplz/lib/controllers/password"
 	"github.com/ryankurte/authplz/lib/controllers/token"
 
 	"github.com/ryankurte/authplz/lib/modules/2fa/backup"
 	"github.com/ryankurte/authplz/lib/modules/2fa/totp"
 	"github.com/ryankurte/authplz/lib/modules/2fa/u2f"
 
+	"github.com/ryankurte/authplz/lib/modules/admin"
 	"github.com/ryankurte/authplz/lib/modules/audit"
 	"github.com/ryankurte/authplz/lib/modules/core"
+	"github.com/ryankurte/authplz/lib/modules/export"
+	"github.com/ryankurte/authplz/lib/modules/ipfilter"
 	"github.com/ryankurte/authplz/lib/modules/oauth"
 	"github.com/ryankurte/authplz/lib/modules/user"
 
@@ -40,10 +46,17 @@ type AuthPlzServer struct {
 	router         *web.Router
 	tokenControl   *token.TokenController
 	serviceManager *async.ServiceManager
+	userModule     *user.Controller
+	exportModule   *export.Controller
+	passwordPolicy *password.Policy
+	purgeDone      chan struct{}
 }
 
 const bufferSize uint = 64
 
+// Interval at which deleted accounts and expired exports are purged
+const purgeInterval = time.Hour
+
 // NewServer Create an AuthPlz server instance
 func NewServer(config config.AuthPlzConfig) *AuthPlzServer {
 	server := AuthPlzServer{}
@@ -73,46 +86,169 @@ func NewServer(config config.AuthPlzConfig) *AuthPlzServer {
 	// Create service manager
 	server.serviceManager = async.NewServiceManager(bufferSize)
 
+	// Create password policy
+	passwordPolicy, err := password.NewPolicy(config.Password)
+	if err != nil {
+		log.Panicf("Error loading password policy (%s)", err)
+	}
+	server.passwordPolicy = passwordPolicy
+
 	// User management module
 	userModule := user.NewController(dataStore, server.serviceManager)
+	userModule.SetPasswordPolicy(passwordPolicy)
+	userModule.SetPasswordExpiry(config.Password.MaxAge, config.Password.ExpiryWarning)
+	userModule.SetDormancy(config.Dormancy.WarnAfter, config.Dormancy.DisableAfter)
+	userModule.SetDeletionGracePeriod(config.DeletionGracePeriod)
+	userModule.SetUsernameChangeCooldown(config.UsernameChangeCooldown)
+	if len(config.ReservedUsernames) > 0 {
+		userModule.SetReservedUsernames(config.ReservedUsernames)
+	}
+	if err := userModule.SetRegistration(config.Registration); err != nil {
+		log.Panicf("Error loading registration configuration (%s)", err)
+	}
+	if err := userModule.SetSecondFactorPolicy(config.SecondFactor); err != nil {
+		log.Panicf("Error loading second factor configuration (%s)", err)
+	}
+	server.userModule = userModule
+	server.purgeDone = make(chan struct{})
 
 	// Core module
 	coreModule := core.NewController(tokenControl, userModule, server.serviceManager)
 
-	coreModule.BindModule("user", userModule)
-	coreModule.BindActionHandler(api.TokenActionActivate, userModule)
-	coreModule.BindActionHandler(api.TokenActionUnlock, userModule)
+	if err := coreModule.BindModule("user", userModule); err != nil {
+		log.Panicf("Error binding user module (%s)", err)
+	}
+	userModule.SetCreateHooks(coreModule)
+
+	userActions := []api.TokenAction{
+		api.TokenActionActivate,
+		api.TokenActionUnlock,
+		api.TokenActionEmailChange,
+		api.TokenActionEmailCancel,
+		api.TokenActionEmailRevert,
+		api.TokenActionReactivate,
+		api.TokenActionSecure,
+	}
+	for _, action := range userActions {
+		if err := coreModule.BindActionHandler(action, userModule); err != nil {
+			log.Panicf("Error binding token action %s (%s)", action, err)
+		}
+	}
 
-	// 2fa modules
-	u2fModule := u2f.NewController(config.ExternalAddress, dataStore, server.serviceManager)
-	coreModule.BindSecondFactor("u2f", u2fModule)
+	// IP filter module
+	ipFilterModule, err := ipfilter.NewController(dataStore, server.serviceManager, config.IPFilter)
+	if err != nil {
+		log.Panicf("Error loading IP filter configuration (%s)", err)
+	}
+	if err := coreModule.BindModule("ipfilter", ipFilterModule); err != nil {
+		log.Panicf("Error binding IP filter module (%s)", err)
+	}
 
-	totpModule := totp.NewController(config.Name, dataStore, server.serviceManager)
-	coreModule.BindSecondFactor("totp", totpModule)
+	// APIs bound to the router once modules are created
+	apiModules := []APIBinder{coreModule, userModule, ipFilterModule}
 
-	backupModule := backup.NewController(config.Name, dataStore, server.serviceManager)
-	coreModule.BindSecondFactor("backup", backupModule)
+	// 2fa modules
+	if err := checkSecondFactorModules(config.Modules, dataStore); err != nil {
+		log.Panicf("Error loading second factor modules (%s)", err)
+	}
+	if config.Modules.IsEnabled(ModuleU2F) {
+		u2fModule := u2f.NewController(config.ExternalAddress, dataStore, server.serviceManager)
+		u2fModule.SetRemovalPolicy(userModule)
+		server.bindSecondFactor(coreModule, ModuleU2F, u2fModule)
+		apiModules = append(apiModules, u2fModule)
+	}
+	if config.Modules.IsEnabled(ModuleTOTP) {
+		totpModule := totp.NewController(config.Name, dataStore, server.serviceManager)
+		totpModule.SetRemovalPolicy(userModule)
+		server.bindSecondFactor(coreModule, ModuleTOTP, totpModule)
+		apiModules = append(apiModules, totpModule)
+	}
+	if config.Modules.IsEnabled(ModuleBackup) {
+		backupModule := backup.NewController(config.Name, dataStore, server.serviceManager)
+		server.bindSecondFactor(coreModule, ModuleBackup, backupModule)
+		apiModules = append(apiModules, backupModule)
+	}
 
 	// Audit module (async components)
-	auditModule := audit.NewController(dataStore)
-	auditSvc := async.NewAsyncService(auditModule, bufferSize)
-	server.serviceManager.BindService(&auditSvc)
+	if config.Modules.IsEnabled(ModuleAudit) {
+		auditModule := audit.NewController(dataStore)
+		auditSvc := async.NewAsyncService(auditModule, bufferSize)
+		server.serviceManager.BindService(&auditSvc)
+		apiModules = append(apiModules, auditModule)
+	}
 
 	// Mailer module
-	mailController, err := mailer.NewMailController(config.Name, config.ExternalAddress, config.Mailer.Driver, config.Mailer.Options, dataStore, tokenControl, config.TemplateDir)
-	if err != nil {
-		log.Fatalf("Error loading mail controller: %s", err)
-		return nil
+	if config.Modules.IsEnabled(ModuleMailer) {
+		mailerOptions := mergeOptions(config.Mailer.Options, config.Modules.Get(ModuleMailer).Options)
+		mailController, err := mailer.NewMailController(config.Name, config.ExternalAddress, config.Mailer.Driver, mailerOptions, dataStore, tokenControl, config.TemplateDir)
+		if err != nil {
+			log.Fatalf("Error loading mail controller: %s", err)
+			return nil
+		}
+
+		mailController.SetReactivationLifetime(config.Dormancy.ReactivationLifetime)
+		mailController.SetEmailChangeLifetimes(config.EmailChangeLifetime, config.EmailRevertLifetime)
+
+		mailSvc := async.NewAsyncService(mailController, bufferSize)
+		server.serviceManager.BindService(&mailSvc)
 	}
 
-	mailSvc := async.NewAsyncService(mailController, bufferSize)
-	server.serviceManager.BindService(&mailSvc)
-
 	// OAuth management module
+	// This is always created as it is used by the admin and export modules, disabling the
+	// module disables the OAuth endpoints
 	oauthModule := oauth.NewController(dataStore, config.OAuth)
+	oauthModule.SetAccessFilter(ipFilterModule)
+
+	// Admin management module
+	adminModule := admin.NewController(dataStore, oauthModule, server.serviceManager)
+
+	// Personal data export module (async components)
+	exportModule := export.NewController(dataStore, oauthModule, server.serviceManager, config.ExportLifetime)
+	exportSvc := async.NewAsyncService(exportModule, bufferSize)
+	server.serviceManager.BindService(&exportSvc)
+	server.exportModule = exportModule
+
+	apiModules = append(apiModules, adminModule, exportModule)
+
+	// Registered (third party) modules
+	moduleCtx := ModuleContext{
+		Config:       config,
+		DataStore:    dataStore,
+		Emitter:      server.serviceManager,
+		TokenControl: tokenControl,
+	}
+	for _, name := range RegisteredModules() {
+		if !config.Modules.IsEnabled(name) {
+			log.Printf("Registered module %s disabled", name)
+			continue
+		}
+		mod := server.bindRegisteredModule(coreModule, name, moduleCtx)
+		if binder, ok := mod.(APIBinder); ok {
+			apiModules = append(apiModules, binder)
+		}
+	}
+
+	for name, m := range config.Modules {
+		if !isKnownModule(name) {
+			log.Printf("Warning: configuration found for unknown module %s", name)
+		} else if isBuiltinModule(name) && name != ModuleMailer && len(m.Options) > 0 {
+			log.Printf("Warning: options are not supported by built in module %s and will be ignored", name)
+		}
+	}
+
+	for _, h := range coreModule.Hooks() {
+		log.Printf("Core hook bound: %s %s (priority %d)", h.Chain, h.Name, h.Priority)
+	}
 
 	// Create a global context object
 	server.ctx = appcontext.NewGlobalCtx(sessionStore)
+	server.ctx.SessionValidator = userModule
+	server.ctx.DeviceTrust = userModule
+	server.ctx.LoginCompleter = coreModule
+	server.ctx.SudoDuration = config.SudoDuration
+	if err := server.ctx.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Panicf("Error loading trusted proxies (%s)", err)
+	}
 
 	// Create router
 	router := web.New(appcontext.AuthPlzCtx{}).
@@ -120,6 +256,7 @@ func NewServer(config config.AuthPlzConfig) *AuthPlzServer {
 		//Middleware(web.LoggerMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).SessionMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).GetIPMiddleware).
+		Middleware((*appcontext.AuthPlzCtx).RequestIDMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).GetLocaleMiddleware)
 
 	router.OptionsHandler(appcontext.NewOptionsHandler(config.AllowedOrigins))
@@ -131,19 +268,108 @@ func NewServer(config config.AuthPlzConfig) *AuthPlzServer {
 	router.Middleware(web.StaticMiddleware(staticPath))
 
 	// Bind modules to router
-	coreModule.BindAPI(router)
-	userModule.BindAPI(router)
-	u2fModule.BindAPI(router)
-	totpModule.BindAPI(router)
-	backupModule.BindAPI(router)
-	auditModule.BindAPI(router)
-	oauthModule.BindAPI(router)
+	for _, m := range apiModules {
+		m.BindAPI(router)
+	}
+	if config.Modules.IsEnabled(ModuleOAuth) {
+		oauthModule.BindAPI(router)
+	}
 
 	server.router = router
 
 	return &server
 }
 
+// bindSecondFactor binds a built in second factor module to the core module
+func (server *AuthPlzServer) bindSecondFactor(coreModule *core.Controller, name string, provider core.SecondFactorProvider) {
+	if err := coreModule.BindSecondFactor(name, provider); err != nil {
+		log.Panicf("Error binding second factor %s (%s)", name, err)
+	}
+}
+
+// bindRegisteredModule creates a registered module and binds it to the core module
+// Modules implementing core.EventHandler are bound as async services
+func (server *AuthPlzServer) bindRegisteredModule(coreModule *core.Controller, name string, ctx ModuleContext) interface{} {
+	moduleConfig := server.config.Modules.Get(name)
+	ctx.Options = moduleConfig.Options
+
+	mod, err := registeredModule(name)(&ctx)
+	if err != nil {
+		log.Panicf("Error creating module %s (%s)", name, err)
+	}
+
+	priority := moduleConfig.Priority
+	if priority == 0 {
+		priority = core.DefaultPriority
+	}
+	if err := coreModule.BindModuleWithPriority(name, priority, mod); err != nil {
+		log.Panicf("Error binding module %s (%s)", name, err)
+	}
+
+	if handler, ok := mod.(core.EventHandler); ok {
+		svc := async.NewAsyncService(handler, bufferSize)
+		server.serviceManager.BindService(&svc)
+	}
+
+	log.Printf("Registered module %s bound", name)
+
+	return mod
+}
+
+// isBuiltinModule checks whether a module name is built in
+func isBuiltinModule(name string) bool {
+	for _, b := range builtinModules {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownModule checks whether a module name is built in or registered
+func isKnownModule(name string) bool {
+	return isBuiltinModule(name) || registeredModule(name) != nil
+}
+
+// mergeOptions merges module options over a set of default options
+func mergeOptions(defaults, options map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range options {
+		merged[k] = v
+	}
+	return merged
+}
+
+// secondFactorCounter counts the tokens enrolled for a second factor module
+type secondFactorCounter func() (int, error)
+
+// checkSecondFactorModules refuses to disable second factor modules while users have tokens enrolled,
+// as these users would otherwise be able to log in with only a password
+func checkSecondFactorModules(modules config.ModulesConfig, dataStore *datastore.DataStore) error {
+	counters := map[string]secondFactorCounter{
+		ModuleU2F:  dataStore.CountFidoTokens,
+		ModuleTOTP: dataStore.CountTotpTokens,
+	}
+
+	for _, name := range []string{ModuleU2F, ModuleTOTP} {
+		if modules.IsEnabled(name) {
+			continue
+		}
+		count, err := counters[name]()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("module %s is disabled with %d tokens enrolled, these users would bypass their second factor", name, count)
+		}
+	}
+
+	return nil
+}
+
 // Start an instance of the AuthPlzServer
 func (server *AuthPlzServer) Start() {
 	// Start listening
@@ -157,6 +383,9 @@ func (server *AuthPlzServer) Start() {
 	// Start async services
 	server.serviceManager.Run()
 
+	// Start purging deleted accounts and expired exports
+	go server.purge()
+
 	// Start with/without TLS
 	var err error
 	if server.config.TLS.Disabled == true {
@@ -184,8 +413,56 @@ func (server *AuthPlzServer) Close() {
 	// TODO: stop HTTP server
 
 	// Stop workers
+	close(server.purgeDone)
 	server.serviceManager.Exit()
 
+	server.passwordPolicy.Close()
+
 	// Close datastore
 	server.ds.Close()
 }
+
+// purge periodically removes accounts past the deletion grace period and expired exports,
+// warns users of expiring passwords, disables dormant accounts and reminds users to enrol second factors
+func (server *AuthPlzServer) purge() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := server.userModule.PurgeDeleted()
+		if err != nil {
+			log.Printf("AuthPlzServer: error purging deleted accounts (%s)", err)
+		} else if count > 0 {
+			log.Printf("AuthPlzServer: purged %d deleted accounts", count)
+		}
+
+		server.exportModule.PurgeExpired()
+
+		count, err = server.userModule.WarnExpiringPasswords()
+		if err != nil {
+			log.Printf("AuthPlzServer: error warning expiring passwords (%s)", err)
+		} else if count > 0 {
+			log.Printf("AuthPlzServer: warned %d users of expiring passwords", count)
+		}
+
+		warned, disabled, err := server.userModule.CheckDormantAccounts()
+		if err != nil {
+			log.Printf("AuthPlzServer: error checking dormant accounts (%s)", err)
+		} else if warned > 0 || disabled > 0 {
+			log.Printf("AuthPlzServer: warned %d and disabled %d dormant accounts", warned, disabled)
+		}
+
+		count, err = server.userModule.RemindSecondFactorEnrolment()
+		if err != nil {
+			log.Printf("AuthPlzServer: error reminding second factor enrolment (%s)", err)
+		} else if count > 0 {
+			log.Printf("AuthPlzServer: reminded %d users to enrol second factors", count)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-server.purgeDone:
+			return
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package appcontext
+
+import (
+	"log"
+	"time"
+
+	"github.com/gocraft/web"
+)
+
+// DeviceTrustProvider issues and validates remembered device tokens
+// This allows users to skip the second factor when logging in from a device they have chosen to remember
+type DeviceTrustProvider interface {
+	// RememberDevice records a device for the user, returning the device token and expiry
+	// A blank token is returned where remembering devices is disabled
+	RememberDevice(userID, userAgent string) (string, time.Time, error)
+	// ValidateDevice checks a device token is recorded and unexpired for the user
+	ValidateDevice(userID, token string) bool
+}
+
+const (
+	trustedDeviceSessionName = "trusted-device"
+	rememberDeviceParam      = "remember"
+)
+
+// RememberDevice issues a device token for a user and stores it in a signed device cookie
+// Tokens are stored per user, so a device can be remembered for multiple accounts
+func (c *AuthPlzCtx) RememberDevice(userID string, rw web.ResponseWriter, req *web.Request) {
+	if c.Global.DeviceTrust == nil {
+		return
+	}
+
+	token, expiry, err := c.Global.DeviceTrust.RememberDevice(userID, req.UserAgent())
+	if err != nil {
+		log.Printf("AuthPlzCtx.RememberDevice: error remembering device for user %s (%s)", userID, err)
+		return
+	}
+	if token == "" {
+		return
+	}
+
+	session, _ := c.Global.SessionStore.Get(req.Request, trustedDeviceSessionName)
+	session.Values[userID] = token
+	session.Options.MaxAge = int(time.Until(expiry).Seconds())
+	session.Save(req.Request, rw)
+
+	log.Printf("AuthPlzCtx.RememberDevice: remembered device for user %s until %s", userID, expiry)
+}
+
+// IsTrustedDevice checks whether the request is from a device remembered by a user
+func (c *AuthPlzCtx) IsTrustedDevice(userID string, req *web.Request) bool {
+	if c.Global.DeviceTrust == nil {
+		return false
+	}
+
+	session, _ := c.Global.SessionStore.Get(req.Request, trustedDeviceSessionName)
+	token, _ := session.Values[userID].(string)
+	if token == "" {
+		return false
+	}
+
+	return c.Global.DeviceTrust.ValidateDevice(userID, token)
+}
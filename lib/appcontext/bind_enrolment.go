@@ -0,0 +1,52 @@
+package appcontext
+
+import (
+	"log"
+	"time"
+
+	"github.com/gocraft/web"
+)
+
+// SecondFactorEnrolmentRequest is a restricted session for a user that must enrol a second factor prior to logging in
+// This only allows a second factor to be enrolled for the bound user
+type SecondFactorEnrolmentRequest struct {
+	UserID  string
+	Created time.Time
+}
+
+const (
+	secondFactorEnrolmentSessionKey = "2fa-enrolment-session"
+	secondFactorEnrolmentTimeout    = 15 * time.Minute
+)
+
+// BindSecondFactorEnrolmentRequest binds a second factor enrolment request for a user to the session
+// This should only be called after all [possible] authentication has been executed
+func (c *AuthPlzCtx) BindSecondFactorEnrolmentRequest(userID string, rw web.ResponseWriter, req *web.Request) {
+	log.Printf("AuthPlzCtx.BindSecondFactorEnrolmentRequest adding 2fa enrolment session for user %s\n", userID)
+
+	c.session.Values[secondFactorEnrolmentSessionKey] = SecondFactorEnrolmentRequest{
+		UserID:  userID,
+		Created: time.Now(),
+	}
+	c.session.Save(req.Request, rw)
+}
+
+// GetSecondFactorEnrolmentRequest fetches the user id for a current second factor enrolment request
+// Blank if no enrolment request is bound or the request has expired
+func (c *AuthPlzCtx) GetSecondFactorEnrolmentRequest(rw web.ResponseWriter, req *web.Request) string {
+	request, ok := c.session.Values[secondFactorEnrolmentSessionKey].(SecondFactorEnrolmentRequest)
+	if !ok {
+		return ""
+	}
+	if time.Now().After(request.Created.Add(secondFactorEnrolmentTimeout)) {
+		c.ClearSecondFactorEnrolmentRequest(rw, req)
+		return ""
+	}
+	return request.UserID
+}
+
+// ClearSecondFactorEnrolmentRequest removes a second factor enrolment request from the session
+func (c *AuthPlzCtx) ClearSecondFactorEnrolmentRequest(rw web.ResponseWriter, req *web.Request) {
+	delete(c.session.Values, secondFactorEnrolmentSessionKey)
+	c.session.Save(req.Request, rw)
+}
@@ -0,0 +1,52 @@
+package appcontext
+
+import (
+	"log"
+	"time"
+
+	"github.com/gocraft/web"
+)
+
+// PasswordChangeRequest is a restricted session for a user that must change their password prior to logging in
+// This only allows the password for the bound user to be changed
+type PasswordChangeRequest struct {
+	UserID  string
+	Created time.Time
+}
+
+const (
+	passwordChangeRequestSessionKey = "password-change-request-session"
+	passwordChangeRequestTimeout    = 15 * time.Minute
+)
+
+// BindPasswordChangeRequest binds a password change request for a user to the session
+// This should only be called after all [possible] authentication has been executed
+func (c *AuthPlzCtx) BindPasswordChangeRequest(userID string, rw web.ResponseWriter, req *web.Request) {
+	log.Printf("AuthPlzCtx.BindPasswordChangeRequest adding password change session for user %s\n", userID)
+
+	c.session.Values[passwordChangeRequestSessionKey] = PasswordChangeRequest{
+		UserID:  userID,
+		Created: time.Now(),
+	}
+	c.session.Save(req.Request, rw)
+}
+
+// GetPasswordChangeRequest fetches the user id for a current password change request
+// Blank if no password change request is bound or the request has expired
+func (c *AuthPlzCtx) GetPasswordChangeRequest(rw web.ResponseWriter, req *web.Request) string {
+	request, ok := c.session.Values[passwordChangeRequestSessionKey].(PasswordChangeRequest)
+	if !ok {
+		return ""
+	}
+	if time.Now().After(request.Created.Add(passwordChangeRequestTimeout)) {
+		c.ClearPasswordChangeRequest(rw, req)
+		return ""
+	}
+	return request.UserID
+}
+
+// ClearPasswordChangeRequest removes a password change request from the session
+func (c *AuthPlzCtx) ClearPasswordChangeRequest(rw web.ResponseWriter, req *web.Request) {
+	delete(c.session.Values, passwordChangeRequestSessionKey)
+	c.session.Save(req.Request, rw)
+}
@@ -11,33 +11,57 @@ import (
 	"github.com/gocraft/web"
 	"github.com/gorilla/sessions"
 	"github.com/ryankurte/authplz/lib/api"
+	"github.com/satori/go.uuid"
 )
 
 func init() {
 	gob.Register(SudoSession{})
+	gob.Register(ImpersonationSession{})
 	gob.Register(SecondFactorRequest{})
+	gob.Register(PasswordChangeRequest{})
+	gob.Register(SecondFactorEnrolmentRequest{})
+}
+
+// SessionValidator checks whether a logged in user session is still valid
+// This allows sessions to be revoked server side (ie. when an account is disabled)
+type SessionValidator interface {
+	ValidateSession(userID string, loginAt time.Time) bool
+}
+
+// LoginCompleter runs post login actions for logins completed with a second factor
+// Logins completed by the core login handler run these directly
+type LoginCompleter interface {
+	CompleteLogin(userID string, request *api.RequestContext) error
 }
 
 // AuthPlzGlobalCtx Application global / static context
 type AuthPlzGlobalCtx struct {
-	SessionStore *sessions.CookieStore
+	SessionStore     *sessions.CookieStore
+	SessionValidator SessionValidator
+	DeviceTrust      DeviceTrustProvider
+	LoginCompleter   LoginCompleter
+	// Proxies trusted to report client addresses in forwarding headers
+	TrustedProxies []*net.IPNet
+	// Period for which re-authentication allows sensitive account actions
+	SudoDuration time.Duration
 }
 
 // NewGlobalCtx creates a new global context instance
 func NewGlobalCtx(sessionStore *sessions.CookieStore) AuthPlzGlobalCtx {
-	return AuthPlzGlobalCtx{sessionStore}
+	return AuthPlzGlobalCtx{SessionStore: sessionStore}
 }
 
 // AuthPlzCtx is the common per-request context
 // Modules implement their own contexts that extend this as a base
 type AuthPlzCtx struct {
-	Global       *AuthPlzGlobalCtx
-	session      *sessions.Session
-	userid       string
-	message      string
-	remoteAddr   string
-	forwardedFor string
-	locale       string
+	Global     *AuthPlzGlobalCtx
+	session    *sessions.Session
+	userid     string
+	message    string
+	remoteAddr string
+	userAgent  string
+	requestID  string
+	locale     string
 }
 
 type User interface {
@@ -45,6 +69,11 @@ type User interface {
 	IsAdmin() string
 }
 
+const (
+	userIDKey  = "userId"
+	loginAtKey = "loginAt"
+)
+
 // Convenience type to describe middleware functions
 type MiddlewareFunc func(c *AuthPlzCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc)
 
@@ -97,20 +126,63 @@ func (c *AuthPlzCtx) SessionMiddleware(rw web.ResponseWriter, req *web.Request,
 	// Save session for further use
 	c.session = session
 
-	// TODO: load user from session
+	// Drop logins that have since been revoked
+	userID, _ := session.Values[userIDKey].(string)
+	if userID != "" && c.Global.SessionValidator != nil {
+		loginAt, _ := session.Values[loginAtKey].(int64)
+		valid := c.Global.SessionValidator.ValidateSession(userID, time.Unix(0, loginAt))
+
+		// Impersonation also requires the original administrator session to remain valid
+		if impersonation, ok := session.Values[impersonationSessionKey].(ImpersonationSession); ok && valid {
+			valid = c.Global.SessionValidator.ValidateSession(impersonation.AdminID, time.Unix(0, impersonation.AdminLoginAt))
+		}
+
+		if !valid {
+			log.Printf("Context: session for user %s is no longer valid", userID)
+			delete(session.Values, userIDKey)
+			delete(session.Values, loginAtKey)
+			delete(session.Values, sudoSessionKey)
+			delete(session.Values, impersonationSessionKey)
+		}
+	}
 
 	session.Save(req.Request, rw)
 	next(rw, req)
 }
 
-// GetIPMiddleware Middleware to grab IP & forwarding headers and store in session
+// GetIPMiddleware Middleware to resolve the client IP address
+// Forwarding headers are only used for requests received from trusted proxies
 func (c *AuthPlzCtx) GetIPMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-	c.remoteAddr, _, _ = net.SplitHostPort(req.RemoteAddr)
-	c.forwardedFor = req.Header.Get("x-forwarded-for")
+	c.remoteAddr = resolveClientIP(req.Request, c.Global.TrustedProxies)
 
 	next(rw, req)
 }
 
+// GetRemoteAddr fetches the resolved address of the client making the request
+// This should be used for any per client handling (rate limiting, audit, device detection)
+func (c *AuthPlzCtx) GetRemoteAddr() string {
+	return c.remoteAddr
+}
+
+// RequestIDMiddleware Middleware to assign a unique ID to each request
+// The ID is returned in the X-Request-ID header to allow requests to be matched with audit records
+func (c *AuthPlzCtx) RequestIDMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	c.requestID = uuid.NewV4().String()
+	c.userAgent = req.UserAgent()
+	rw.Header().Set("X-Request-ID", c.requestID)
+
+	next(rw, req)
+}
+
+// GetRequestContext fetches the context of the request for attaching to events
+func (c *AuthPlzCtx) GetRequestContext() *api.RequestContext {
+	return &api.RequestContext{
+		RequestID: c.requestID,
+		IP:        c.remoteAddr,
+		UserAgent: c.userAgent,
+	}
+}
+
 // Middleware to ensure only logged in access to an endpoint
 func (c *AuthPlzCtx) RequireAccountMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	if c.userid == "" {
@@ -127,7 +199,8 @@ func (c *AuthPlzCtx) LoginUser(userid string, rw web.ResponseWriter, req *web.Re
 		return
 	}
 
-	c.session.Values["userId"] = userid
+	c.session.Values[userIDKey] = userid
+	c.session.Values[loginAtKey] = time.Now().UnixNano()
 	c.session.Save(req.Request, rw)
 	c.userid = userid
 	log.Printf("Context: logged in user %s", userid)
@@ -144,7 +217,7 @@ func (c *AuthPlzCtx) LogoutUser(rw web.ResponseWriter, req *web.Request) {
 // GetUserID Fetch user id from a session
 // Blank if a user is not logged in
 func (c *AuthPlzCtx) GetUserID() string {
-	id := c.session.Values["userId"]
+	id := c.session.Values[userIDKey]
 	if id != nil {
 		return id.(string)
 	} else {
@@ -156,18 +229,32 @@ func (c *AuthPlzCtx) GetUserID() string {
 // This is provided to allow modules to execute global actions as a given user across the API boundaries
 // For example, this allows 2fa to be used to validate a user action
 // TODO: a more elegant solution to this could be nice.
-func (c *AuthPlzCtx) UserAction(userid, action string, rw web.ResponseWriter, req *web.Request) {
+// Errors completing logins are returned prior to the user being logged in
+func (c *AuthPlzCtx) UserAction(userid, action string, rw web.ResponseWriter, req *web.Request) error {
 	switch action {
 	case "login":
+		if c.Global.LoginCompleter != nil {
+			if err := c.Global.LoginCompleter.CompleteLogin(userid, c.GetRequestContext()); err != nil {
+				log.Printf("AuthPlzCtx.UserAction error completing login (%s)", err)
+				return err
+			}
+		}
 		c.LoginUser(userid, rw, req)
+		// Users may opt in to skipping the second factor on this device in future
+		if req.FormValue(rememberDeviceParam) == "true" {
+			c.RememberDevice(userid, rw, req)
+		}
 	case "recover":
 		c.BindRecoveryRequest(userid, rw, req)
+	case "password-change":
+		c.BindPasswordChangeRequest(userid, rw, req)
 	case "sudo":
-		// TODO: how to propagate duration through to here?
-		c.SetSudo(userid, time.Minute*5, rw, req)
+		c.SetSudo(userid, c.GetSudoDuration(), rw, req)
 	default:
 		log.Printf("AuthPlzCtx.UserAction error: unrecognised user action (%s)", action)
 	}
+
+	return nil
 }
 
 const (
@@ -0,0 +1,84 @@
+package appcontext
+
+import (
+	"log"
+	"time"
+
+	"github.com/gocraft/web"
+)
+
+// ImpersonationSession stores the original administrator session while an administrator impersonates a user
+type ImpersonationSession struct {
+	AdminID      string
+	AdminLoginAt int64
+	UserID       string
+	Started      time.Time
+}
+
+// impersonationSessionKey is the cookie key used for impersonation session storage
+const impersonationSessionKey = "impersonation-session"
+
+// StartImpersonation switches the logged in administrator session to the provided user
+// The administrator session is stored so that it can be restored with StopImpersonation
+// Any sudo session is cleared, so administrators must re-authenticate after impersonation
+func (c *AuthPlzCtx) StartImpersonation(userID string, rw web.ResponseWriter, req *web.Request) {
+	adminID := c.GetUserID()
+	adminLoginAt, _ := c.session.Values[loginAtKey].(int64)
+
+	log.Printf("AuthPlzCtx.StartImpersonation: admin %s impersonating user %s", adminID, userID)
+
+	c.session.Values[impersonationSessionKey] = ImpersonationSession{
+		AdminID:      adminID,
+		AdminLoginAt: adminLoginAt,
+		UserID:       userID,
+		Started:      time.Now(),
+	}
+	delete(c.session.Values, sudoSessionKey)
+
+	c.LoginUser(userID, rw, req)
+}
+
+// StopImpersonation restores the original administrator session
+// This returns the impersonation session that was stopped, or nil if no impersonation was in progress
+func (c *AuthPlzCtx) StopImpersonation(rw web.ResponseWriter, req *web.Request) *ImpersonationSession {
+	impersonation := c.GetImpersonation()
+	if impersonation == nil {
+		return nil
+	}
+
+	log.Printf("AuthPlzCtx.StopImpersonation: admin %s stopped impersonating user %s", impersonation.AdminID, impersonation.UserID)
+
+	c.session.Values[userIDKey] = impersonation.AdminID
+	c.session.Values[loginAtKey] = impersonation.AdminLoginAt
+	delete(c.session.Values, impersonationSessionKey)
+	delete(c.session.Values, sudoSessionKey)
+	c.session.Save(req.Request, rw)
+	c.userid = impersonation.AdminID
+
+	return impersonation
+}
+
+// GetImpersonation fetches the current impersonation session, or nil if no impersonation is in progress
+func (c *AuthPlzCtx) GetImpersonation() *ImpersonationSession {
+	impersonation, ok := c.session.Values[impersonationSessionKey].(ImpersonationSession)
+	if !ok || impersonation.UserID != c.GetUserID() {
+		return nil
+	}
+	return &impersonation
+}
+
+// IsImpersonating checks whether the current session is an administrator impersonating a user
+// Sensitive account actions must be blocked while impersonating
+func (c *AuthPlzCtx) IsImpersonating() bool {
+	return c.GetImpersonation() != nil
+}
+
+// GetImpersonatorID fetches the ID of the administrator impersonating the current user
+// Blank if the session is not an impersonation session
+func (c *AuthPlzCtx) GetImpersonatorID() string {
+	impersonation := c.GetImpersonation()
+	if impersonation == nil {
+		return ""
+	}
+	return impersonation.AdminID
+}
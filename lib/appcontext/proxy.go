@@ -0,0 +1,127 @@
+package appcontext
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNetworks parses a list of CIDRs (ie. trusted proxies or IP allow / deny lists)
+// Plain addresses are accepted and treated as single host networks
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, p := range cidrs {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %s", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %s (%s)", p, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// SetTrustedProxies sets the proxies trusted to report client addresses in forwarding headers
+func (g *AuthPlzGlobalCtx) SetTrustedProxies(proxies []string) error {
+	networks, err := ParseNetworks(proxies)
+	if err != nil {
+		return err
+	}
+	g.TrustedProxies = networks
+	return nil
+}
+
+// ContainsIP checks whether an address is within one of the provided networks
+func ContainsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwardedAddr parses an address from a forwarding header, removing quotes, brackets and ports
+// Returns nil for obfuscated or unknown addresses
+func parseForwardedAddr(addr string) net.IP {
+	addr = strings.Trim(strings.TrimSpace(addr), "\"")
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// forwardedAddrs fetches the chain of forwarded addresses from a request, from client to nearest proxy
+// The standard Forwarded header is preferred, followed by X-Forwarded-For and X-Real-IP
+func forwardedAddrs(req *http.Request) []string {
+	addrs := make([]string, 0)
+
+	if forwarded := req.Header["Forwarded"]; len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					addrs = append(addrs, kv[1])
+				}
+			}
+		}
+		return addrs
+	}
+
+	if forwardedFor := req.Header["X-Forwarded-For"]; len(forwardedFor) > 0 {
+		return strings.Split(strings.Join(forwardedFor, ","), ",")
+	}
+
+	if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+		addrs = append(addrs, realIP)
+	}
+
+	return addrs
+}
+
+// resolveClientIP resolves the address of the client making a request
+// Forwarding headers are only used where the request was received from a trusted proxy, and are
+// read right to left, with the first address that is not a trusted proxy taken as the client
+func resolveClientIP(req *http.Request, trusted []*net.IPNet) string {
+	remoteAddr, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteAddr = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(remoteAddr)
+	if ip == nil || !ContainsIP(trusted, ip) {
+		return remoteAddr
+	}
+
+	addrs := forwardedAddrs(req)
+	for i := len(addrs) - 1; i >= 0; i-- {
+		forwarded := parseForwardedAddr(addrs[i])
+		if forwarded == nil {
+			// Unknown addresses end the chain at the last trusted proxy
+			break
+		}
+
+		ip = forwarded
+		if !ContainsIP(trusted, ip) {
+			break
+		}
+	}
+
+	return ip.String()
+}
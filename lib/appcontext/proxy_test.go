@@ -0,0 +1,70 @@
+package appcontext
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	newRequest := func(remoteAddr string, headers map[string]string) *http.Request {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	t.Run("Rejects invalid proxies", func(t *testing.T) {
+		if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+			t.Error("Expected invalid network to be rejected")
+		}
+		if _, err := ParseNetworks([]string{"not-an-address"}); err == nil {
+			t.Error("Expected invalid address to be rejected")
+		}
+	})
+
+	t.Run("Ignores forwarding headers from untrusted clients", func(t *testing.T) {
+		req := newRequest("203.0.113.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"})
+		if ip := resolveClientIP(req, trusted); ip != "203.0.113.1" {
+			t.Errorf("Unexpected client IP %s", ip)
+		}
+	})
+
+	t.Run("Resolves X-Forwarded-For right to left", func(t *testing.T) {
+		req := newRequest("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.7, 192.168.1.1"})
+		if ip := resolveClientIP(req, trusted); ip != "203.0.113.7" {
+			t.Errorf("Unexpected client IP %s", ip)
+		}
+	})
+
+	t.Run("Prefers the Forwarded header", func(t *testing.T) {
+		req := newRequest("10.0.0.1:1234", map[string]string{
+			"Forwarded":       `for="[2001:db8::1]:4711";proto=https, for=10.1.2.3`,
+			"X-Forwarded-For": "198.51.100.9",
+		})
+		if ip := resolveClientIP(req, trusted); ip != "2001:db8::1" {
+			t.Errorf("Unexpected client IP %s", ip)
+		}
+	})
+
+	t.Run("Falls back to X-Real-IP", func(t *testing.T) {
+		req := newRequest("[fd00::1]:1234", map[string]string{"X-Real-IP": "198.51.100.2"})
+		if ip := resolveClientIP(req, trusted); ip != "198.51.100.2" {
+			t.Errorf("Unexpected client IP %s", ip)
+		}
+	})
+
+	t.Run("Stops at unknown addresses", func(t *testing.T) {
+		req := newRequest("10.0.0.1:1234", map[string]string{"Forwarded": "for=unknown, for=10.0.0.2"})
+		if ip := resolveClientIP(req, trusted); ip != "10.0.0.2" {
+			t.Errorf("Unexpected client IP %s", ip)
+		}
+	})
+}
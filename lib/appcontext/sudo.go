@@ -2,15 +2,19 @@ package appcontext
 
 import (
 	"log"
+	"net/http"
 	"time"
 
 	"github.com/gocraft/web"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // SudoSession used to store user reauthorization sessions for protected account actions
 // Such as password changes or 2fa alterations
 type SudoSession struct {
 	UserID       string
+	LoginAt      int64
 	SessionStart time.Time
 	SessionEnd   time.Time
 }
@@ -18,14 +22,27 @@ type SudoSession struct {
 // SudoSessionKey is the cookie key used for sudo session storage
 const sudoSessionKey = "sudo-session"
 
+// DefaultSudoDuration is the sudo session duration used where not configured
+const DefaultSudoDuration = 5 * time.Minute
+
+// GetSudoDuration fetches the configured sudo session duration
+func (c *AuthPlzCtx) GetSudoDuration() time.Duration {
+	if c.Global == nil || c.Global.SudoDuration == 0 {
+		return DefaultSudoDuration
+	}
+	return c.Global.SudoDuration
+}
+
 // SetSudo used to indicate a user has reauthorized to allow protected account actions
-// TODO: could this be pinned to more things? (user agent, IP, real invalidation so it can't be reused if cancelled?)
-// Guess re-use is a bit moot given there is no reason to cancel atm
+// Sudo sessions are bound to the current login, so are invalidated by logging out or in again
 func (c *AuthPlzCtx) SetSudo(userID string, timeout time.Duration, rw web.ResponseWriter, req *web.Request) {
 	log.Printf("AuthPlzCtx.SetSudo: creating sudo session fo user %s", c.userid)
 
+	loginAt, _ := c.session.Values[loginAtKey].(int64)
+
 	sudoSession := SudoSession{
 		UserID:       userID,
+		LoginAt:      loginAt,
 		SessionStart: time.Now(),
 		SessionEnd:   time.Now().Add(timeout),
 	}
@@ -40,28 +57,60 @@ func (c *AuthPlzCtx) ClearSudo(rw web.ResponseWriter, req *web.Request) {
 	c.session.Save(req.Request, rw)
 }
 
-// CanSudo checks whether a user has a current sudo session
-func (c *AuthPlzCtx) CanSudo(rw web.ResponseWriter, req *web.Request) bool {
+// GetSudo fetches the current sudo session for a user, clearing invalid or expired sessions
+// Returns nil where the user does not have a current sudo session
+func (c *AuthPlzCtx) GetSudo(rw web.ResponseWriter, req *web.Request) *SudoSession {
 	sudoSession := c.session.Values[sudoSessionKey]
 	if sudoSession == nil {
-		return false
+		return nil
 	}
 	session, ok := sudoSession.(SudoSession)
 	if !ok {
 		c.ClearSudo(rw, req)
-		return false
+		return nil
 	}
 	if time.Now().Before(session.SessionStart) {
 		c.ClearSudo(rw, req)
-		return false
+		return nil
 	}
 	if time.Now().After(session.SessionEnd) {
 		c.ClearSudo(rw, req)
-		return false
+		return nil
 	}
 	if session.UserID != c.GetUserID() {
 		c.ClearSudo(rw, req)
+		return nil
+	}
+	if loginAt, _ := c.session.Values[loginAtKey].(int64); session.LoginAt != loginAt {
+		c.ClearSudo(rw, req)
+		return nil
+	}
+	return &session
+}
+
+// CanSudo checks whether a user has a current sudo session
+func (c *AuthPlzCtx) CanSudo(rw web.ResponseWriter, req *web.Request) bool {
+	return c.GetSudo(rw, req) != nil
+}
+
+// CheckSudo checks that logged in users have a current sudo session prior to sensitive account actions,
+// writing an error response where they do not. This is intended for use in module sudo middleware
+// Requests without a login (ie. password change or enrolment sessions) are passed through to be handled
+// by the endpoint, and sensitive actions are always blocked while impersonating
+func (c *AuthPlzCtx) CheckSudo(rw web.ResponseWriter, req *web.Request) bool {
+	if c.GetUserID() == "" {
+		return true
+	}
+
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return false
+	}
+
+	if !c.CanSudo(rw, req) {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().SudoRequired)
 		return false
 	}
+
 	return true
 }
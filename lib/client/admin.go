@@ -0,0 +1,177 @@
+/*
+ * AuthPlz API Client
+ * Administrator user management methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// Admin methods require the logged in user to be an administrator with a current sudo session
+
+// adminUserPath builds the admin API path for a user
+func adminUserPath(userID, action string) string {
+	path := fmt.Sprintf("/admin/users/%s", url.PathEscape(userID))
+	if action != "" {
+		path = path + "/" + action
+	}
+	return path
+}
+
+// AdminSearchUsers searches user accounts by email, username or ID
+// A count of zero uses the server default
+func (c *Client) AdminSearchUsers(query string, count, offset uint) (*api.AdminUserList, error) {
+	v := url.Values{}
+	v.Set("q", query)
+	if count > 0 {
+		v.Set("count", strconv.FormatUint(uint64(count), 10))
+	}
+	v.Set("offset", strconv.FormatUint(uint64(offset), 10))
+
+	users := api.AdminUserList{}
+	if err := c.getJSON("/admin/users", v, &users); err != nil {
+		return nil, err
+	}
+	return &users, nil
+}
+
+// AdminUser fetches a user account
+func (c *Client) AdminUser(userID string) (*api.AdminUserResp, error) {
+	user := api.AdminUserResp{}
+	if err := c.getJSON(adminUserPath(userID, ""), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AdminUserSecondFactors fetches the second factors registered to a user account
+func (c *Client) AdminUserSecondFactors(userID string) (*api.AdminSecondFactors, error) {
+	factors := api.AdminSecondFactors{}
+	if err := c.getJSON(adminUserPath(userID, "factors"), nil, &factors); err != nil {
+		return nil, err
+	}
+	return &factors, nil
+}
+
+// AdminUserOAuthClients fetches the OAuth clients owned by a user account
+func (c *Client) AdminUserOAuthClients(userID string) ([]api.OAuthClientResp, error) {
+	clients := make([]api.OAuthClientResp, 0)
+	if err := c.getJSON(adminUserPath(userID, "clients"), nil, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// adminAction performs an administrative action on a user account
+func (c *Client) adminAction(method, userID, action string) error {
+	req, err := http.NewRequest(method, c.basePath+adminUserPath(userID, action), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// AdminSetEnabled enables or disables a user account
+func (c *Client) AdminSetEnabled(userID string, enabled bool) error {
+	if enabled {
+		return c.adminAction("POST", userID, "enable")
+	}
+	return c.adminAction("POST", userID, "disable")
+}
+
+// AdminSetLocked locks or unlocks a user account
+func (c *Client) AdminSetLocked(userID string, locked bool) error {
+	if locked {
+		return c.adminAction("POST", userID, "lock")
+	}
+	return c.adminAction("POST", userID, "unlock")
+}
+
+// AdminForcePasswordReset invalidates the password for a user account, requiring account recovery
+func (c *Client) AdminForcePasswordReset(userID string) error {
+	return c.adminAction("POST", userID, "reset")
+}
+
+// AdminRequirePasswordChange requires a user to change their password at next login
+func (c *Client) AdminRequirePasswordChange(userID string) error {
+	return c.adminAction("POST", userID, "password-change")
+}
+
+// AdminRevokeSessions revokes all sessions and OAuth tokens for a user account
+func (c *Client) AdminRevokeSessions(userID string) error {
+	return c.adminAction("POST", userID, "revoke")
+}
+
+// AdminSetAdmin grants or revokes administrator rights for a user account
+func (c *Client) AdminSetAdmin(userID string, admin bool) error {
+	if admin {
+		return c.adminAction("POST", userID, "admin")
+	}
+	return c.adminAction("DELETE", userID, "admin")
+}
+
+// AdminSetAllowedNetworks sets the networks a user account may log in from
+// An empty list removes the restriction
+func (c *Client) AdminSetAllowedNetworks(userID string, networks []string) error {
+	resp, err := c.postJSON(adminUserPath(userID, "networks"), &api.AllowedNetworks{Networks: networks}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// AdminDeleteUser deletes a user account
+// Accounts are purged once the deletion grace period expires
+func (c *Client) AdminDeleteUser(userID string) error {
+	return c.adminAction("DELETE", userID, "")
+}
+
+// AdminImpersonate starts impersonating a user account
+// The client session acts as the impersonated user until StopImpersonation is called
+func (c *Client) AdminImpersonate(userID string) error {
+	return c.adminAction("POST", userID, "impersonate")
+}
+
+// ImpersonationStatus fetches the impersonation status of the current session
+func (c *Client) ImpersonationStatus() (*api.ImpersonationStatus, error) {
+	status := api.ImpersonationStatus{}
+	if err := c.getJSON("/impersonation", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StopImpersonation stops impersonating a user account and restores the administrator session
+func (c *Client) StopImpersonation() error {
+	req, err := http.NewRequest("POST", c.basePath+"/impersonation/stop", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
@@ -0,0 +1,22 @@
+/*
+ * AuthPlz API Client
+ * Audit log methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// AuditEvents fetches the audit log for the logged in user
+func (c *Client) AuditEvents() ([]api.AuditEvent, error) {
+	events := make([]api.AuditEvent, 0)
+	if err := c.getJSON("/audit/", nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
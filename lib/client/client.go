@@ -0,0 +1,258 @@
+/*
+ * AuthPlz API Client
+ * Provides a typed client for the AuthPlz HTTP API
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// ErrUnexpectedStatus indicates the server responded with an unexpected status and no API message
+var ErrUnexpectedStatus = errors.New("AuthPlz Client: unexpected response status")
+
+// ErrNoRedirect indicates a redirect was expected but the server did not provide one
+var ErrNoRedirect = errors.New("AuthPlz Client: expected redirect not found")
+
+// Error is returned when the server responds with an error
+type Error struct {
+	// HTTP status code returned by the server
+	StatusCode int
+	// API result string, where provided
+	Result string
+	// API message (or OAuth error description), where provided
+	Message string
+	// Password policy rules failed, where a password was rejected
+	Reasons []api.PasswordPolicyReason
+	// Registration rejection reason, where a registration was rejected by a registration hook
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("AuthPlz Client: request failed with status %d (%s)", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("AuthPlz Client: request failed with status %d", e.StatusCode)
+}
+
+// Client is an AuthPlz API client
+// Session cookies are stored in the client, so a single client instance represents a single user session
+type Client struct {
+	http           *http.Client
+	address        string
+	basePath       string
+	rememberDevice bool
+}
+
+// NewClient creates an API client for the AuthPlz server at the provided address (ie. https://auth.example.com)
+func NewClient(address string) (*Client, error) {
+	return NewClientWithHTTP(address, &http.Client{})
+}
+
+// NewClientWithHTTP creates an API client using the provided http.Client
+// The client cookie jar and redirect policy are overwritten as these are required for session management
+func NewClientWithHTTP(address string, httpClient *http.Client) (*Client, error) {
+	if _, err := url.Parse(address); err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Jar = jar
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	address = strings.TrimSuffix(address, "/")
+
+	return &Client{
+		http:     httpClient,
+		address:  address,
+		basePath: address + "/api",
+	}, nil
+}
+
+// HTTPClient fetches the underlying http client (and cookie jar) used by the client
+func (c *Client) HTTPClient() *http.Client {
+	return c.http
+}
+
+// SetRememberDevice sets whether second factor authentication requests ask the server to remember the client
+// Remembered clients skip the second factor at login until the device expires, is revoked or the password is changed
+func (c *Client) SetRememberDevice(remember bool) {
+	c.rememberDevice = remember
+}
+
+// rememberValues adds the remember device parameter to second factor authentication requests
+func (c *Client) rememberValues(v url.Values) url.Values {
+	if c.rememberDevice {
+		v.Set("remember", "true")
+	}
+	return v
+}
+
+// do executes a request against the API and checks the response status
+func (c *Client) do(req *http.Request, statusCodes ...int) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	return nil, parseError(resp)
+}
+
+// get performs a GET request with optional query parameters
+func (c *Client) get(path string, v url.Values, statusCodes ...int) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.basePath+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		req.URL.RawQuery = v.Encode()
+	}
+	return c.do(req, statusCodes...)
+}
+
+// postForm performs a form encoded POST request
+func (c *Client) postForm(path string, v url.Values, statusCodes ...int) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.basePath+path, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, statusCodes...)
+}
+
+// postJSON performs a JSON encoded POST request
+func (c *Client) postJSON(path string, inst interface{}, statusCodes ...int) (*http.Response, error) {
+	js, err := json.Marshal(inst)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.basePath+path, bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, statusCodes...)
+}
+
+// delete performs a DELETE request with optional query parameters
+func (c *Client) delete(path string, v url.Values, statusCodes ...int) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", c.basePath+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		req.URL.RawQuery = v.Encode()
+	}
+	return c.do(req, statusCodes...)
+}
+
+// getJSON performs a GET request and decodes the JSON response into the provided instance
+func (c *Client) getJSON(path string, v url.Values, inst interface{}) error {
+	resp, err := c.get(path, v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(resp, inst)
+}
+
+// decodeJSON decodes and closes a JSON response body
+func decodeJSON(resp *http.Response, inst interface{}) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(inst)
+}
+
+// checkAPIResponse decodes an API response object and returns an error if the result is not ok
+// A number of endpoints return errors with a 200 status, so the result must always be checked
+func checkAPIResponse(resp *http.Response) (*api.ApiResponse, error) {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Endpoints may respond with status codes only
+	if len(body) == 0 {
+		return &api.ApiResponse{Result: api.ResultOk}, nil
+	}
+
+	apiResp := api.ApiResponse{}
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, err
+	}
+
+	if apiResp.Result != api.ResultOk {
+		return &apiResp, &Error{StatusCode: resp.StatusCode, Result: apiResp.Result, Message: apiResp.Message}
+	}
+
+	return &apiResp, nil
+}
+
+// discard closes a response body that is not required
+func discard(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// parseError builds an Error from an unexpected response
+// This handles both API response objects and OAuth error objects
+func parseError(resp *http.Response) error {
+	apiErr := Error{StatusCode: resp.StatusCode}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(body) == 0 {
+		return &apiErr
+	}
+
+	errResp := struct {
+		api.ApiResponse
+		OAuthError       string                     `json:"error"`
+		OAuthDescription string                     `json:"error_description"`
+		Reasons          []api.PasswordPolicyReason `json:"reasons"`
+		Reason           string                     `json:"reason"`
+	}{}
+	if err := json.Unmarshal(body, &errResp); err != nil {
+		return &apiErr
+	}
+
+	apiErr.Result = errResp.Result
+	apiErr.Message = errResp.Message
+	apiErr.Reasons = errResp.Reasons
+	apiErr.Reason = errResp.Reason
+	if apiErr.Message == "" && errResp.OAuthError != "" {
+		apiErr.Result = api.ResultError
+		apiErr.Message = errResp.OAuthError
+		if errResp.OAuthDescription != "" {
+			apiErr.Message = fmt.Sprintf("%s: %s", errResp.OAuthError, errResp.OAuthDescription)
+		}
+	}
+
+	return &apiErr
+}
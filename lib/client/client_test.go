@@ -0,0 +1,155 @@
+/*
+ * AuthPlz API Client Tests
+ * Tests the client against a mock AuthPlz server
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+const (
+	expiredEmail = "expired@abc.com"
+	blockedEmail = "blocked@abc.com"
+	fakeEmail    = "test@abc.com"
+	fakePass     = "abcDEF123@abcDEF123@"
+	fakeTOTPCode = "123456"
+)
+
+func writeJSON(rw http.ResponseWriter, status int, i interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(i)
+}
+
+func TestClient(t *testing.T) {
+
+	loggedIn := false
+
+	// Mock AuthPlz API
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", func(rw http.ResponseWriter, req *http.Request) {
+		switch req.FormValue("email") {
+		case expiredEmail:
+			writeJSON(rw, http.StatusForbidden, api.ApiResponse{Result: api.ResultError, Message: api.ApiMessageEn.PasswordChangeRequired})
+			return
+		case blockedEmail:
+			writeJSON(rw, http.StatusForbidden, api.ApiResponse{Result: api.ResultError, Message: api.ApiMessageEn.ImpersonationBlocked})
+			return
+		}
+		if req.FormValue("email") != fakeEmail || req.FormValue("password") != fakePass {
+			writeJSON(rw, http.StatusUnauthorized, api.ApiResponse{Result: api.ResultError, Message: "Incorrect email or password"})
+			return
+		}
+		writeJSON(rw, http.StatusAccepted, api.SecondFactors{"totp": true, "u2f": false})
+	})
+	mux.HandleFunc("/api/totp/authenticate", func(rw http.ResponseWriter, req *http.Request) {
+		if req.FormValue("code") != fakeTOTPCode {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		loggedIn = true
+		rw.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/status", func(rw http.ResponseWriter, req *http.Request) {
+		if !loggedIn {
+			writeJSON(rw, http.StatusOK, api.ApiResponse{Result: api.ResultError, Message: api.ApiMessageEn.Unauthorized})
+			return
+		}
+		writeJSON(rw, http.StatusOK, api.ApiResponse{Result: api.ResultOk, Message: api.ApiMessageEn.LoginSuccessful})
+	})
+	mux.HandleFunc("/api/create", func(rw http.ResponseWriter, req *http.Request) {
+		writeJSON(rw, http.StatusOK, api.ApiResponse{Result: api.ResultError, Message: api.ApiMessageEn.DuplicateUserAccount})
+	})
+	mux.HandleFunc("/api/oauth/token", func(rw http.ResponseWriter, req *http.Request) {
+		if id, secret, ok := req.BasicAuth(); !ok || id != "fake-client" || secret != "fake-secret" {
+			writeJSON(rw, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		writeJSON(rw, http.StatusOK, api.OAuthTokenResp{AccessToken: "fake-token", TokenType: "bearer", ExpiresIn: 3600})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c, err := NewClient(server.URL)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	t.Run("Invalid credentials return an API error", func(t *testing.T) {
+		_, err := c.Login(fakeEmail, "wrong password")
+		assert.NotNil(t, err)
+
+		apiErr, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.EqualValues(t, http.StatusUnauthorized, apiErr.StatusCode)
+		assert.EqualValues(t, "Incorrect email or password", apiErr.Message)
+	})
+
+	t.Run("Forbidden logins are discriminated by message", func(t *testing.T) {
+		res, err := c.Login(expiredEmail, fakePass)
+		assert.Nil(t, err)
+		assert.True(t, res.PasswordChangeRequired)
+
+		_, err = c.Login(blockedEmail, fakePass)
+		assert.NotNil(t, err)
+
+		apiErr, ok := err.(*Error)
+		assert.True(t, ok)
+		assert.EqualValues(t, http.StatusForbidden, apiErr.StatusCode)
+		assert.EqualValues(t, api.ApiMessageEn.ImpersonationBlocked, apiErr.Message)
+	})
+
+	t.Run("Partial logins return available second factors", func(t *testing.T) {
+		res, err := c.Login(fakeEmail, fakePass)
+		assert.Nil(t, err)
+		assert.True(t, res.SecondFactorRequired)
+		assert.True(t, res.SecondFactors["totp"])
+	})
+
+	t.Run("Status reports logged out before second factor completion", func(t *testing.T) {
+		ok, err := c.Status()
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Second factor completes login", func(t *testing.T) {
+		err := c.TOTPAuthenticate(fakeTOTPCode)
+		assert.Nil(t, err)
+
+		ok, err := c.Status()
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("API errors with OK status are returned", func(t *testing.T) {
+		err := c.Create(fakeEmail, "test", fakePass)
+		assert.NotNil(t, err)
+		assert.EqualValues(t, api.ApiMessageEn.DuplicateUserAccount, err.(*Error).Message)
+	})
+
+	t.Run("Client credentials grant returns tokens", func(t *testing.T) {
+		token, err := c.OAuthClientCredentials("fake-client", "fake-secret", "introspect")
+		assert.Nil(t, err)
+		assert.EqualValues(t, "fake-token", token.AccessToken)
+	})
+
+	t.Run("OAuth errors are returned", func(t *testing.T) {
+		_, err := c.OAuthClientCredentials("fake-client", "wrong-secret")
+		assert.NotNil(t, err)
+		assert.EqualValues(t, "invalid_client", err.(*Error).Message)
+	})
+}
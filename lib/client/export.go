@@ -0,0 +1,50 @@
+/*
+ * AuthPlz API Client
+ * Personal data export methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// RequestExport requests a personal data export for the logged in user
+// Exports are generated asynchronously, use Exports to check for completion
+func (c *Client) RequestExport() (*api.DataExportStatus, error) {
+	resp, err := c.postJSON("/export/", nil, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	status := api.DataExportStatus{}
+	if err := decodeJSON(resp, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Exports lists the data exports for the logged in user
+func (c *Client) Exports() ([]api.DataExportStatus, error) {
+	exports := make([]api.DataExportStatus, 0)
+	if err := c.getJSON("/export/", nil, &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// DownloadExport downloads a completed data export
+func (c *Client) DownloadExport(exportID string) (*api.DataExport, error) {
+	export := api.DataExport{}
+	if err := c.getJSON(fmt.Sprintf("/export/%s", url.PathEscape(exportID)), nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * AuthPlz API Client
+ * Registration invitation methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// CreateWithInvite creates a new user account using an invitation code
+// The email address must match the invitation, and the account is activated on creation
+func (c *Client) CreateWithInvite(email, username, password, code string) error {
+	v := url.Values{}
+	v.Set("email", email)
+	v.Set("username", username)
+	v.Set("password", password)
+	v.Set("invite", code)
+
+	resp, err := c.postForm("/create", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// Invite fetches a valid invitation by code, used to pre-fill registration
+func (c *Client) Invite(code string) (*api.Invite, error) {
+	invite := api.Invite{}
+	if err := c.getJSON(fmt.Sprintf("/invites/%s", url.PathEscape(code)), nil, &invite); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// Invites lists the invitations issued by the logged in user
+func (c *Client) Invites() ([]api.Invite, error) {
+	invites := make([]api.Invite, 0)
+	if err := c.getJSON("/invites", nil, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// CreateInvite issues an invitation to the provided email address
+// The invitation code is emailed to the invited address
+func (c *Client) CreateInvite(email string) error {
+	v := url.Values{}
+	v.Set("email", email)
+
+	resp, err := c.postForm("/invites", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// RevokeInvite revokes an unused invitation issued by the logged in user
+func (c *Client) RevokeInvite(code string) error {
+	req, err := http.NewRequest("DELETE", c.basePath+fmt.Sprintf("/invites/%s", url.PathEscape(code)), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
@@ -0,0 +1,254 @@
+/*
+ * AuthPlz API Client
+ * OAuth client management, authorization and token methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// OAuthOptions fetches the OAuth client options available to the logged in user
+func (c *Client) OAuthOptions() (*api.OAuthOptionResp, error) {
+	options := api.OAuthOptionResp{}
+	if err := c.getJSON("/oauth/options", nil, &options); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// OAuthClients lists the OAuth clients owned by the logged in user
+func (c *Client) OAuthClients() ([]api.OAuthClientResp, error) {
+	clients := make([]api.OAuthClientResp, 0)
+	if err := c.getJSON("/oauth/clients", nil, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// OAuthCreateClient creates an OAuth client
+// The client secret is only returned at creation and must be stored by the caller
+func (c *Client) OAuthCreateClient(clientReq *api.OAuthClientReq) (*api.OAuthClientResp, error) {
+	resp, err := c.postJSON("/oauth/clients", clientReq, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	client := api.OAuthClientResp{}
+	if err := decodeJSON(resp, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// OAuthSetClientLifespans sets the token lifespan overrides for an OAuth client
+func (c *Client) OAuthSetClientLifespans(clientID string, lifespans api.OAuthLifespans) (*api.OAuthLifespans, error) {
+	path := fmt.Sprintf("/oauth/clients/%s/lifespans", url.PathEscape(clientID))
+
+	resp, err := c.postJSON(path, &lifespans, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := api.OAuthLifespans{}
+	if err := decodeJSON(resp, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// OAuthRotateClientSecret generates a new secret for an OAuth client, invalidating the previous secret
+// The new secret is only returned here and must be stored by the caller
+func (c *Client) OAuthRotateClientSecret(clientID string) (*api.OAuthClientResp, error) {
+	path := fmt.Sprintf("/oauth/clients/%s/secret", url.PathEscape(clientID))
+
+	resp, err := c.postForm(path, url.Values{}, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	client := api.OAuthClientResp{}
+	if err := decodeJSON(resp, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// OAuthAuthorizeStart starts an authorization code or implicit grant for the logged in user
+// The server binds the request to the client session, which can then be fetched with OAuthAuthorizePending
+func (c *Client) OAuthAuthorizeStart(clientID, responseType, redirectURI, state string, scopes ...string) error {
+	v := url.Values{}
+	v.Set("client_id", clientID)
+	v.Set("response_type", responseType)
+	v.Set("redirect_uri", redirectURI)
+	v.Set("state", state)
+	v.Set("scope", strings.Join(scopes, " "))
+
+	resp, err := c.get("/oauth/auth", v, http.StatusFound)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	return nil
+}
+
+// OAuthAuthorizePending fetches the pending authorization request for the logged in user
+func (c *Client) OAuthAuthorizePending() (*api.OAuthAuthorizationRequest, error) {
+	resp, err := c.get("/oauth/pending", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing authorizations are reported with an API response
+	ar := struct {
+		api.OAuthAuthorizationRequest
+		api.ApiResponse
+	}{}
+	if err := decodeJSON(resp, &ar); err != nil {
+		return nil, err
+	}
+	if ar.Result == api.ResultError {
+		return nil, &Error{StatusCode: resp.StatusCode, Result: ar.Result, Message: ar.Message}
+	}
+
+	return &ar.OAuthAuthorizationRequest, nil
+}
+
+// OAuthAuthorizeConfirm accepts or rejects the pending authorization request
+// On acceptance the redirect (including the authorization code or token) is returned
+func (c *Client) OAuthAuthorizeConfirm(confirm *api.OAuthAuthorizeConfirm) (*url.URL, error) {
+	resp, err := c.postJSON("/oauth/auth", confirm, http.StatusOK, http.StatusFound, http.StatusSeeOther)
+	if err != nil {
+		return nil, err
+	}
+	discard(resp)
+
+	if !confirm.Accept {
+		return nil, nil
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return nil, ErrNoRedirect
+	}
+	return location, nil
+}
+
+// OAuthSessions lists the OAuth grants for the logged in user
+func (c *Client) OAuthSessions() (*api.OAuthUserSessions, error) {
+	sessions := api.OAuthUserSessions{}
+	if err := c.getJSON("/oauth/sessions", nil, &sessions); err != nil {
+		return nil, err
+	}
+	return &sessions, nil
+}
+
+// OAuthExchangeCode exchanges an authorization code for tokens using the client credentials
+func (c *Client) OAuthExchangeCode(clientID, clientSecret, code, redirectURI string) (*api.OAuthTokenResp, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURI)
+
+	return c.oauthToken(clientID, clientSecret, v)
+}
+
+// OAuthClientCredentials fetches an access token using the client credentials grant
+func (c *Client) OAuthClientCredentials(clientID, clientSecret string, scopes ...string) (*api.OAuthTokenResp, error) {
+	v := url.Values{}
+	v.Set("grant_type", "client_credentials")
+	v.Set("scope", strings.Join(scopes, " "))
+
+	return c.oauthToken(clientID, clientSecret, v)
+}
+
+// OAuthRefresh exchanges a refresh token for a new access token
+func (c *Client) OAuthRefresh(clientID, clientSecret, refreshToken string) (*api.OAuthTokenResp, error) {
+	v := url.Values{}
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", refreshToken)
+
+	return c.oauthToken(clientID, clientSecret, v)
+}
+
+// oauthToken performs a token endpoint request authenticated with client credentials
+func (c *Client) oauthToken(clientID, clientSecret string, v url.Values) (*api.OAuthTokenResp, error) {
+	req, err := http.NewRequest("POST", c.basePath+"/oauth/token", strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	token := api.OAuthTokenResp{}
+	if err := decodeJSON(resp, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// OAuthIntrospect introspects a token using the credentials of a client granted the introspect scope
+func (c *Client) OAuthIntrospect(clientID, clientSecret, token string) (*api.OAuthIntrospection, error) {
+	v := url.Values{}
+	v.Set("token", token)
+
+	req, err := http.NewRequest("POST", c.basePath+"/oauth/introspect", strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	info := api.OAuthIntrospection{}
+	if err := decodeJSON(resp, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// OAuthTokenInfo fetches information about the provided access token
+func (c *Client) OAuthTokenInfo(accessToken string) (*api.OAuthAccessTokenInfo, error) {
+	req, err := http.NewRequest("GET", c.basePath+"/oauth/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	// Missing tokens are reported with an API response
+	info := struct {
+		api.OAuthAccessTokenInfo
+		api.ApiResponse
+	}{}
+	if err := decodeJSON(resp, &info); err != nil {
+		return nil, err
+	}
+	if info.Result == api.ResultError {
+		return nil, &Error{StatusCode: resp.StatusCode, Result: info.Result, Message: info.Message}
+	}
+
+	return &info.OAuthAccessTokenInfo, nil
+}
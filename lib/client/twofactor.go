@@ -0,0 +1,186 @@
+/*
+ * AuthPlz API Client
+ * Second factor (TOTP, U2F and backup code) methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ryankurte/go-u2f"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// TOTPEnrolStart fetches a TOTP registration challenge for a new token with the provided name
+func (c *Client) TOTPEnrolStart(name string) (*api.TOTPRegisterChallenge, error) {
+	v := url.Values{}
+	v.Set("name", name)
+
+	challenge := api.TOTPRegisterChallenge{}
+	if err := c.getJSON("/totp/enrol", v, &challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// TOTPEnrolComplete completes TOTP registration with a code generated from the challenge secret
+func (c *Client) TOTPEnrolComplete(code string) error {
+	v := url.Values{}
+	v.Set("code", code)
+
+	resp, err := c.postForm("/totp/enrol", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	return nil
+}
+
+// TOTPAuthenticate completes a pending second factor request using a TOTP code
+func (c *Client) TOTPAuthenticate(code string) error {
+	v := url.Values{}
+	v.Set("code", code)
+
+	resp, err := c.postForm("/totp/authenticate", c.rememberValues(v), http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// TOTPTokens lists the TOTP tokens registered to the logged in user
+func (c *Client) TOTPTokens() ([]api.TOTPToken, error) {
+	tokens := make([]api.TOTPToken, 0)
+	if err := c.getJSON("/totp/tokens", nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TOTPRemove removes the named TOTP token from the logged in user
+// The last second factor cannot be removed where second factors are required for the user
+func (c *Client) TOTPRemove(name string) error {
+	v := url.Values{}
+	v.Set("name", name)
+
+	resp, err := c.delete("/totp/tokens", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// U2FEnrolStart fetches a U2F registration request for a new token with the provided name
+func (c *Client) U2FEnrolStart(name string) (*u2f.RegisterRequestMessage, error) {
+	v := url.Values{}
+	v.Set("name", name)
+
+	rr := u2f.RegisterRequestMessage{}
+	if err := c.getJSON("/u2f/enrol", v, &rr); err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// U2FEnrolComplete completes U2F registration with the response from the token
+func (c *Client) U2FEnrolComplete(registerResp *u2f.RegisterResponse) error {
+	resp, err := c.postJSON("/u2f/enrol", registerResp, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// U2FAuthenticateStart fetches a U2F sign request for a pending second factor request
+func (c *Client) U2FAuthenticateStart() (*u2f.SignRequestMessage, error) {
+	sr := u2f.SignRequestMessage{}
+	if err := c.getJSON("/u2f/authenticate", nil, &sr); err != nil {
+		return nil, err
+	}
+	return &sr, nil
+}
+
+// U2FAuthenticateComplete completes a pending second factor request with the response from the token
+func (c *Client) U2FAuthenticateComplete(signResp *u2f.SignResponse) error {
+	path := "/u2f/authenticate"
+	if v := c.rememberValues(url.Values{}); len(v) > 0 {
+		path += "?" + v.Encode()
+	}
+
+	resp, err := c.postJSON(path, signResp, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// U2FTokens lists the U2F tokens registered to the logged in user
+func (c *Client) U2FTokens() ([]api.U2FToken, error) {
+	tokens := make([]api.U2FToken, 0)
+	if err := c.getJSON("/u2f/tokens", nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// U2FRemove removes the named U2F token from the logged in user
+// The last second factor cannot be removed where second factors are required for the user
+func (c *Client) U2FRemove(name string) error {
+	v := url.Values{}
+	v.Set("name", name)
+
+	resp, err := c.delete("/u2f/tokens", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// BackupCodesCreate creates a new set of backup codes for the logged in user
+// Codes are only returned at creation and must be stored by the user
+func (c *Client) BackupCodesCreate() (*api.BackupCodes, error) {
+	codes := api.BackupCodes{}
+	if err := c.getJSON("/backupcode/create", nil, &codes); err != nil {
+		return nil, err
+	}
+	return &codes, nil
+}
+
+// BackupCodeAuthenticate completes a pending second factor request using a backup code
+func (c *Client) BackupCodeAuthenticate(code string) error {
+	v := url.Values{}
+	v.Set("code", code)
+
+	resp, err := c.postForm("/backupcode/authenticate", c.rememberValues(v), http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// BackupCodes lists the backup codes for the logged in user
+func (c *Client) BackupCodes() ([]api.BackupCode, error) {
+	codes := make([]api.BackupCode, 0)
+	if err := c.getJSON("/backupcode/codes", nil, &codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,350 @@
+/*
+ * AuthPlz API Client
+ * User account and login methods
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// LoginResult is the result of a login or recovery attempt
+type LoginResult struct {
+	// SecondFactorRequired indicates a partial login, which must be completed using one of
+	// the available second factors (ie. TOTPAuthenticate, U2FAuthenticate or BackupCodeAuthenticate)
+	SecondFactorRequired bool
+	// SecondFactors lists the second factors available to the user
+	SecondFactors api.SecondFactors
+	// PasswordChangeRequired indicates the users password has expired (or must otherwise be changed)
+	// The password must be changed using UpdatePassword, after which the user can log in
+	PasswordChangeRequired bool
+	// SecondFactorEnrolmentRequired indicates the user must enrol a second factor prior to logging in
+	// A factor must be enrolled using TOTPEnrol* or U2FEnrol*, after which the user can log in
+	SecondFactorEnrolmentRequired bool
+}
+
+// Create creates a new user account
+// Registrations rejected by the server return an *Error, with Reason set where rejected by a registration hook
+func (c *Client) Create(email, username, password string) error {
+	v := url.Values{}
+	v.Set("email", email)
+	v.Set("username", username)
+	v.Set("password", password)
+
+	resp, err := c.postForm("/create", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// Login attempts to log in with the provided credentials
+// The identifier may be either an email address or username
+// Where a second factor is required the returned result lists the available factors
+func (c *Client) Login(identifier, password string) (*LoginResult, error) {
+	v := url.Values{}
+	if strings.Contains(identifier, "@") {
+		v.Set("email", identifier)
+	} else {
+		v.Set("username", identifier)
+	}
+	v.Set("password", password)
+
+	resp, err := c.postForm("/login", v, http.StatusOK, http.StatusAccepted, http.StatusForbidden)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginResult(resp)
+}
+
+// loginResult parses a login or recovery response
+func loginResult(resp *http.Response) (*LoginResult, error) {
+	if resp.StatusCode == http.StatusAccepted {
+		factors := api.SecondFactors{}
+		if err := decodeJSON(resp, &factors); err != nil {
+			return nil, err
+		}
+		return &LoginResult{SecondFactorRequired: true, SecondFactors: factors}, nil
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		apiResp := api.ApiResponse{}
+		if err := decodeJSON(resp, &apiResp); err != nil {
+			return nil, err
+		}
+		// Other forbidden responses (ie. impersonation or sudo required) are returned as errors
+		locale := api.GetAPILocale(api.DefaultLocale)
+		switch apiResp.Message {
+		case locale.SecondFactorEnrolment:
+			return &LoginResult{SecondFactorEnrolmentRequired: true}, nil
+		case locale.PasswordChangeRequired:
+			return &LoginResult{PasswordChangeRequired: true}, nil
+		default:
+			return nil, &Error{StatusCode: resp.StatusCode, Result: apiResp.Result, Message: apiResp.Message}
+		}
+	}
+
+	if _, err := checkAPIResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return &LoginResult{}, nil
+}
+
+// Logout ends the current user session
+func (c *Client) Logout() error {
+	resp, err := c.get("/logout", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	return nil
+}
+
+// Status checks whether the client is logged in
+func (c *Client) Status() (bool, error) {
+	resp, err := c.get("/status", nil, http.StatusOK)
+	if err != nil {
+		return false, err
+	}
+
+	apiResp, err := checkAPIResponse(resp)
+	if apiResp != nil && apiResp.Result == api.ResultError {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Sudo re-authenticates the logged in user to allow sensitive account actions
+// The password may be omitted where the user has second factors, and where a second factor is required
+// the returned result lists the available factors, with sudo granted once the factor is completed
+func (c *Client) Sudo(password string) (*LoginResult, error) {
+	v := url.Values{}
+	if password != "" {
+		v.Set("password", password)
+	}
+
+	resp, err := c.postForm("/sudo", v, http.StatusOK, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginResult(resp)
+}
+
+// SudoStatus fetches the sudo status of the current session
+func (c *Client) SudoStatus() (*api.SudoStatus, error) {
+	status := api.SudoStatus{}
+	if err := c.getJSON("/sudo", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ClearSudo ends the sudo session for the current session
+func (c *Client) ClearSudo() error {
+	resp, err := c.delete("/sudo", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// Account fetches the account of the logged in user
+func (c *Client) Account() (*api.UserResp, error) {
+	user := api.UserResp{}
+	if err := c.getJSON("/account", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdatePassword updates the password of the logged in user
+// This requires a current sudo session, except where changing the password after a login returns
+// PasswordChangeRequired
+func (c *Client) UpdatePassword(oldPassword, newPassword string) error {
+	v := url.Values{}
+	v.Set("old_password", oldPassword)
+	v.Set("new_password", newPassword)
+
+	resp, err := c.postForm("/account", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// Action submits an action token (ie. from an activation or unlock email)
+// Tokens are applied immediately for logged in users, otherwise at the next login.
+// Actions applied without logging in (ie. securing an account) are confirmed by submitting the token
+func (c *Client) Action(token string) error {
+	v := url.Values{}
+	v.Set("token", token)
+	v.Set("confirm", "true")
+
+	resp, err := c.postForm("/action", v, http.StatusFound, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	return nil
+}
+
+// TrustedDevices lists the devices remembered by the logged in user
+func (c *Client) TrustedDevices() ([]api.TrustedDevice, error) {
+	devices := make([]api.TrustedDevice, 0)
+	if err := c.getJSON("/account/devices", nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// RevokeTrustedDevice revokes a device remembered by the logged in user
+func (c *Client) RevokeTrustedDevice(deviceID string) error {
+	resp, err := c.delete("/account/devices/"+url.PathEscape(deviceID), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// AllowedNetworks fetches the networks the logged in user may log in from
+func (c *Client) AllowedNetworks() ([]string, error) {
+	networks := api.AllowedNetworks{}
+	if err := c.getJSON("/account/networks/", nil, &networks); err != nil {
+		return nil, err
+	}
+	return networks.Networks, nil
+}
+
+// SetAllowedNetworks sets the networks the logged in user may log in from
+// The list must include the current address, an empty list removes the restriction
+func (c *Client) SetAllowedNetworks(networks []string) error {
+	resp, err := c.postJSON("/account/networks/", &api.AllowedNetworks{Networks: networks}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// RecoveryStart starts account recovery for the provided email address
+func (c *Client) RecoveryStart(email string) error {
+	v := url.Values{}
+	v.Set("email", email)
+
+	resp, err := c.postForm("/recovery", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	discard(resp)
+	return nil
+}
+
+// RecoveryToken submits an emailed recovery token
+// This must be called from the same client as RecoveryStart, and where a second factor is required
+// the returned result lists the available factors
+func (c *Client) RecoveryToken(token string) (*LoginResult, error) {
+	v := url.Values{}
+	v.Set("token", token)
+
+	resp, err := c.get("/recovery", v, http.StatusOK, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginResult(resp)
+}
+
+// ResetPassword sets a new password to complete account recovery
+func (c *Client) ResetPassword(password string) error {
+	v := url.Values{}
+	v.Set("password", password)
+
+	resp, err := c.postForm("/reset", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// ChangeEmail requests a change of email address for the logged in user
+// This requires a current sudo session, and the change is applied once confirmed via the emailed link
+func (c *Client) ChangeEmail(email string) error {
+	v := url.Values{}
+	v.Set("email", email)
+
+	resp, err := c.postForm("/account/email", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// ChangeUsername changes the username of the logged in user
+func (c *Client) ChangeUsername(username string) error {
+	v := url.Values{}
+	v.Set("username", username)
+
+	resp, err := c.postForm("/account/username", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// DeleteAccount deletes the logged in user account
+// This requires a current sudo session, and the account can be restored until the deletion grace period expires
+func (c *Client) DeleteAccount() error {
+	req, err := http.NewRequest("DELETE", c.basePath+"/account", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
+
+// RestoreAccount cancels the deletion of an account within the deletion grace period
+func (c *Client) RestoreAccount(email, password string) error {
+	v := url.Values{}
+	v.Set("email", email)
+	v.Set("password", password)
+
+	resp, err := c.postForm("/account/restore", v, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = checkAPIResponse(resp)
+	return err
+}
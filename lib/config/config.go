@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"io/ioutil"
 
@@ -34,6 +35,8 @@ type AuthPlzConfig struct {
 	Port            string   `yaml:"bind-port"`
 	ExternalAddress string   `yaml:"external-address"`
 	AllowedOrigins  []string `yaml:"allowed-origins"`
+	// TrustedProxies are the proxy networks (CIDRs) trusted to report client addresses
+	TrustedProxies []string `yaml:"trusted-proxies"`
 
 	Database     string `yaml:"database"`
 	CookieSecret string `yaml:"cookie-secret"`
@@ -47,7 +50,50 @@ type AuthPlzConfig struct {
 	Mailer MailerConfig `yaml:"mailer"`
 	Routes RouteConfig  `yaml:"routes"`
 
+	// Password defines the password policy
+	Password PasswordConfig `yaml:"password"`
+	// MinimumPasswordLength is deprecated, use password.min-length
 	MinimumPasswordLength int `yaml:"password-len"`
+	// Dormancy defines warning and disabling of inactive accounts
+	Dormancy DormancyConfig `yaml:"dormancy"`
+	// Registration defines who can create accounts
+	Registration RegistrationConfig `yaml:"registration"`
+	// SecondFactor defines which users must enrol a second factor
+	SecondFactor SecondFactorConfig `yaml:"second-factor"`
+	// IPFilter defines the networks logins are allowed and denied from
+	IPFilter IPFilterConfig `yaml:"ip-filter"`
+	// Modules enables, disables and configures built in and registered modules
+	Modules ModulesConfig `yaml:"modules"`
+
+	// DeletionGracePeriod is the period after deletion during which accounts can be restored
+	DeletionGracePeriod time.Duration `yaml:"deletion-grace-period"`
+	// ExportLifetime is the period for which personal data exports can be downloaded
+	ExportLifetime time.Duration `yaml:"export-lifetime"`
+	// EmailChangeLifetime is the period for which email change confirmation and cancellation links are valid
+	EmailChangeLifetime time.Duration `yaml:"email-change-lifetime"`
+	// EmailRevertLifetime is the period for which links to revert a confirmed email change are valid
+	EmailRevertLifetime time.Duration `yaml:"email-revert-lifetime"`
+	// UsernameChangeCooldown is the minimum period between username changes
+	UsernameChangeCooldown time.Duration `yaml:"username-change-cooldown"`
+	// SudoDuration is the period for which re-authentication allows sensitive account actions
+	SudoDuration time.Duration `yaml:"sudo-duration"`
+	// ReservedUsernames overrides the default list of usernames that cannot be claimed
+	ReservedUsernames []string `yaml:"reserved-usernames"`
+}
+
+// mapDeprecated maps deprecated configuration options to their replacements
+// Replacement options take precedence where both are set
+func (apc *AuthPlzConfig) mapDeprecated() {
+	if apc.MinimumPasswordLength == 0 {
+		return
+	}
+
+	log.Printf("Warning: password-len is deprecated and will be removed, use password.min-length")
+	if apc.Password.MinLength != DefaultPasswordConfig().MinLength {
+		log.Printf("Warning: password-len ignored as password.min-length is set")
+		return
+	}
+	apc.Password.MinLength = apc.MinimumPasswordLength
 }
 
 // GetRoutes fetches routes from the configuration object
@@ -86,7 +132,18 @@ func DefaultConfig() (*AuthPlzConfig, error) {
 	c.StaticDir = "./authplz-ui/build"
 	c.TemplateDir = "./templates"
 
-	c.MinimumPasswordLength = 12
+	c.Password = DefaultPasswordConfig()
+	c.Dormancy = DefaultDormancyConfig()
+	c.Registration = DefaultRegistrationConfig()
+	c.SecondFactor = DefaultSecondFactorConfig()
+	c.Modules = make(ModulesConfig)
+
+	c.DeletionGracePeriod = 30 * 24 * time.Hour
+	c.ExportLifetime = 24 * time.Hour
+	c.EmailChangeLifetime = time.Hour
+	c.EmailRevertLifetime = 7 * 24 * time.Hour
+	c.UsernameChangeCooldown = 30 * 24 * time.Hour
+	c.SudoDuration = 5 * time.Minute
 
 	c.Mailer.Driver = "logger"
 	c.Mailer.Options = make(map[string]string)
@@ -132,6 +189,8 @@ func LoadConfig(filename, envPrefix string) (*AuthPlzConfig, error) {
 	em := structparse.NewEnvironmentMapper("$", envPrefix)
 	structparse.Strings(em, c)
 
+	c.mapDeprecated()
+
 	// Load external address if not specified
 	if c.ExternalAddress == "" {
 		prefix := "https"
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"time"
 )
 
 func TestConfig(t *testing.T) {
@@ -28,3 +29,52 @@ func TestConfig(t *testing.T) {
 	assert.EqualValues(t, testTokenSecret, c.TokenSecret)
 
 }
+
+func TestDeprecatedConfig(t *testing.T) {
+	t.Run("Password length alias maps to the password policy", func(t *testing.T) {
+		c := AuthPlzConfig{Password: DefaultPasswordConfig(), MinimumPasswordLength: 16}
+		c.mapDeprecated()
+		assert.EqualValues(t, 16, c.Password.MinLength)
+	})
+
+	t.Run("Password policy length takes precedence", func(t *testing.T) {
+		c := AuthPlzConfig{Password: DefaultPasswordConfig(), MinimumPasswordLength: 16}
+		c.Password.MinLength = 20
+		c.mapDeprecated()
+		assert.EqualValues(t, 20, c.Password.MinLength)
+	})
+}
+
+func TestTokenLifespans(t *testing.T) {
+	defaults := DefaultOAuthConfig().Lifespans
+
+	t.Run("Zero overrides use defaults", func(t *testing.T) {
+		merged := defaults.Merge(TokenLifespans{})
+		assert.EqualValues(t, defaults, merged)
+	})
+
+	t.Run("Non-zero overrides are applied", func(t *testing.T) {
+		merged := defaults.Merge(TokenLifespans{AccessToken: time.Minute})
+		assert.EqualValues(t, time.Minute, merged.AccessToken)
+		assert.EqualValues(t, defaults.RefreshToken, merged.RefreshToken)
+	})
+}
+
+func TestModulesConfig(t *testing.T) {
+	disabled := false
+	modules := ModulesConfig{
+		"totp":   ModuleConfig{Enabled: &disabled},
+		"custom": ModuleConfig{Priority: 10, Options: map[string]string{"key": "value"}},
+	}
+
+	t.Run("Modules are enabled unless disabled", func(t *testing.T) {
+		assert.False(t, modules.IsEnabled("totp"))
+		assert.True(t, modules.IsEnabled("custom"))
+		assert.True(t, modules.IsEnabled("u2f"))
+	})
+
+	t.Run("Module options are available by name", func(t *testing.T) {
+		assert.EqualValues(t, "value", modules.Get("custom").Options["key"])
+		assert.EqualValues(t, 0, modules.Get("u2f").Priority)
+	})
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"time"
+)
+
+// DormancyConfig dormant account configuration structure
+// Administrators and service accounts are exempt from dormancy checks
+type DormancyConfig struct {
+	// WarnAfter is the period of inactivity after which users are warned, zero disables warnings
+	WarnAfter time.Duration `yaml:"warn-after"`
+	// DisableAfter is the period of inactivity after which accounts are disabled, zero disables dormancy checks
+	DisableAfter time.Duration `yaml:"disable-after"`
+	// ReactivationLifetime is the period for which emailed reactivation links are valid
+	ReactivationLifetime time.Duration `yaml:"reactivation-lifetime"`
+}
+
+// DefaultDormancyConfig generates a default dormant account configuration
+// Dormancy checks are disabled by default
+func DefaultDormancyConfig() DormancyConfig {
+	return DormancyConfig{
+		ReactivationLifetime: 7 * 24 * time.Hour,
+	}
+}
@@ -0,0 +1,12 @@
+package config
+
+// IPFilterConfig IP allow / deny list configuration structure
+// Lists contain CIDRs or plain addresses, and are checked against the resolved client address
+type IPFilterConfig struct {
+	// Allow restricts logins to the listed networks, empty allows all networks
+	Allow []string `yaml:"allow"`
+	// Deny blocks logins and OAuth token issuance from the listed networks
+	Deny []string `yaml:"deny"`
+	// AdminAllow restricts administrator logins to the listed networks in place of Allow, empty applies Allow
+	AdminAllow []string `yaml:"admin-allow"`
+}
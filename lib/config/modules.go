@@ -0,0 +1,33 @@
+package config
+
+// ModuleConfig module configuration structure
+// Modules are enabled unless explicitly disabled
+type ModuleConfig struct {
+	// Enabled enables or disables the module
+	Enabled *bool `yaml:"enabled"`
+	// Priority is the priority of the module in core hook chains, lower values run first (zero for the default)
+	Priority int `yaml:"priority"`
+	// Options are module specific options
+	Options map[string]string `yaml:"options"`
+}
+
+// ModulesConfig module configuration by module name
+type ModulesConfig map[string]ModuleConfig
+
+// IsEnabled checks whether the named module is enabled
+func (mc ModulesConfig) IsEnabled(name string) bool {
+	m, ok := mc[name]
+	if !ok || m.Enabled == nil {
+		return true
+	}
+	return *m.Enabled
+}
+
+// Get fetches the configuration for the named module
+func (mc ModulesConfig) Get(name string) ModuleConfig {
+	m, ok := mc[name]
+	if !ok {
+		return ModuleConfig{}
+	}
+	return m
+}
@@ -1,5 +1,9 @@
 package config
 
+import (
+	"time"
+)
+
 type configSplit struct {
 	Admin []string
 	User  []string
@@ -17,6 +21,36 @@ type OAuthConfig struct {
 	AllowedGrants configSplit
 	// AllowedResponses defines response types a client can support
 	AllowedResponses []string
+	// Lifespans defines the default validity periods for issued tokens
+	// These may be overridden on a per-client basis
+	Lifespans TokenLifespans
+}
+
+// TokenLifespans defines validity periods for OAuth tokens
+// A zero value indicates no override (when used per-client)
+type TokenLifespans struct {
+	AccessToken   time.Duration `yaml:"access-token"`
+	AuthorizeCode time.Duration `yaml:"authorize-code"`
+	IDToken       time.Duration `yaml:"id-token"`
+	RefreshToken  time.Duration `yaml:"refresh-token"`
+}
+
+// Merge returns a copy of the lifespans with any non-zero values from the
+// provided overrides applied
+func (tl TokenLifespans) Merge(overrides TokenLifespans) TokenLifespans {
+	if overrides.AccessToken > 0 {
+		tl.AccessToken = overrides.AccessToken
+	}
+	if overrides.AuthorizeCode > 0 {
+		tl.AuthorizeCode = overrides.AuthorizeCode
+	}
+	if overrides.IDToken > 0 {
+		tl.IDToken = overrides.IDToken
+	}
+	if overrides.RefreshToken > 0 {
+		tl.RefreshToken = overrides.RefreshToken
+	}
+	return tl
 }
 
 // DefaultOAuthConfig generates a default configuration for the OAuth module
@@ -34,5 +68,11 @@ func DefaultOAuthConfig() OAuthConfig {
 			User:  []string{"authorization_code", "implicit", "refresh_token"},
 		},
 		AllowedResponses: []string{"code", "token", "id_token"},
+		Lifespans: TokenLifespans{
+			AccessToken:   time.Hour * 1,
+			AuthorizeCode: time.Hour * 1,
+			IDToken:       time.Hour * 1,
+			RefreshToken:  time.Hour * 24 * 30,
+		},
 	}
 }
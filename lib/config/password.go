@@ -0,0 +1,35 @@
+package config
+
+import (
+	"time"
+)
+
+// PasswordConfig password policy configuration structure
+type PasswordConfig struct {
+	// MinLength is the minimum password length in bytes
+	MinLength int `yaml:"min-length"`
+	// MaxLength is the maximum password length in bytes (bcrypt only uses the first 72 bytes)
+	MaxLength int `yaml:"max-length"`
+	// MinEntropy is the minimum estimated password strength in bits, zero disables strength checks
+	MinEntropy float64 `yaml:"min-entropy"`
+	// BreachFile is an optional file of breached password SHA-1 hashes, sorted by hash, one per line
+	// (ie. the ordered-by-hash password list from haveibeenpwned.com)
+	BreachFile string `yaml:"breach-file"`
+	// History is the number of previous passwords that cannot be reused, zero disables history checks
+	History int `yaml:"history"`
+	// MaxAge is the maximum password age after which users must change their password, zero disables expiry
+	MaxAge time.Duration `yaml:"max-age"`
+	// ExpiryWarning is the period prior to expiry in which users are warned that their password will expire
+	ExpiryWarning time.Duration `yaml:"expiry-warning"`
+}
+
+// DefaultPasswordConfig generates a default password policy configuration
+func DefaultPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		MinLength:     12,
+		MaxLength:     72,
+		MinEntropy:    30,
+		History:       5,
+		ExpiryWarning: 7 * 24 * time.Hour,
+	}
+}
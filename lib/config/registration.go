@@ -0,0 +1,43 @@
+package config
+
+import (
+	"time"
+)
+
+// Registration modes
+const (
+	// RegistrationOpen allows anyone to create an account
+	RegistrationOpen = "open"
+	// RegistrationDisabled prevents the creation of new accounts
+	RegistrationDisabled = "disabled"
+	// RegistrationInvite requires a valid invitation to create an account
+	RegistrationInvite = "invite"
+)
+
+// RegistrationConfig account registration configuration structure
+// Domain restrictions apply in all registration modes
+type RegistrationConfig struct {
+	// Mode is the registration mode, one of open, disabled or invite
+	Mode string `yaml:"mode"`
+	// AllowedDomains if set limits registration to email addresses within these domains
+	AllowedDomains []string `yaml:"allowed-domains"`
+	// DeniedDomains lists email domains that cannot be used for registration
+	DeniedDomains []string `yaml:"denied-domains"`
+	// BlockDisposable blocks registration using known disposable email domains
+	BlockDisposable bool `yaml:"block-disposable"`
+	// DisposableFile is an optional file listing additional disposable email domains, one per line
+	DisposableFile string `yaml:"disposable-file"`
+	// InviteLifetime is the period for which invitations are valid
+	InviteLifetime time.Duration `yaml:"invite-lifetime"`
+	// UserInvites allows non-admin users to issue invitations
+	UserInvites bool `yaml:"user-invites"`
+}
+
+// DefaultRegistrationConfig generates a default registration configuration
+// Registration is open by default
+func DefaultRegistrationConfig() RegistrationConfig {
+	return RegistrationConfig{
+		Mode:           RegistrationOpen,
+		InviteLifetime: 7 * 24 * time.Hour,
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"time"
+)
+
+// Second factor requirement policies
+const (
+	// SecondFactorOptional allows users to choose whether to enrol second factors
+	SecondFactorOptional = "optional"
+	// SecondFactorAdmins requires administrators to enrol a second factor
+	SecondFactorAdmins = "admins"
+	// SecondFactorAll requires all users to enrol a second factor
+	SecondFactorAll = "all"
+)
+
+// SecondFactorConfig second factor requirement configuration structure
+// Users the policy applies to may log in without a second factor until the grace period expires,
+// after which they are only granted a session that allows a second factor to be enrolled
+type SecondFactorConfig struct {
+	// Required is the second factor requirement policy, one of optional, admins or all
+	Required string `yaml:"required"`
+	// GracePeriod is the period from when the policy first applies to a user in which they must enrol a second factor
+	GracePeriod time.Duration `yaml:"grace-period"`
+	// ReminderInterval is the interval at which users are reminded to enrol during the grace period, zero disables reminders
+	ReminderInterval time.Duration `yaml:"reminder-interval"`
+	// RememberDevice is the period for which users may choose to skip the second factor on a device, zero disables remembering devices
+	RememberDevice time.Duration `yaml:"remember-device"`
+}
+
+// DefaultSecondFactorConfig generates a default second factor configuration
+// Second factors are optional by default
+func DefaultSecondFactorConfig() SecondFactorConfig {
+	return SecondFactorConfig{
+		Required:         SecondFactorOptional,
+		GracePeriod:      7 * 24 * time.Hour,
+		ReminderInterval: 24 * time.Hour,
+		RememberDevice:   30 * 24 * time.Hour,
+	}
+}
@@ -91,8 +91,8 @@ func (ds *DataStore) GetActionTokens(userid string) ([]interface{}, error) {
 	err = ds.db.Model(user).Related(&ActionTokens).Error
 
 	interfaces := make([]interface{}, len(ActionTokens))
-	for i, t := range ActionTokens {
-		interfaces[i] = &t
+	for i := range ActionTokens {
+		interfaces[i] = &ActionTokens[i]
 	}
 
 	return interfaces, err
@@ -7,12 +7,18 @@ import (
 )
 
 // AuditEvent for a user account
+// Events are associated with the user by external ID so that events emitted on account removal
+// (where the user no longer exists) can still be recorded
 type AuditEvent struct {
 	gorm.Model
-	UserID uint
-	Type   string
-	Time   time.Time
-	Data   string
+	UserID    uint
+	UserExtID string `gorm:"index"`
+	Type      string
+	Time      time.Time
+	Data      string
+	RequestID string
+	IP        string
+	UserAgent string
 }
 
 // GetType fetches the type of the event
@@ -21,6 +27,15 @@ func (ae *AuditEvent) GetType() string { return ae.Type }
 // GetTime fetches the time at which the event occured
 func (ae *AuditEvent) GetTime() time.Time { return ae.Time }
 
+// GetRequestID fetches the ID of the request that caused the event
+func (ae *AuditEvent) GetRequestID() string { return ae.RequestID }
+
+// GetIP fetches the IP address of the client that caused the event
+func (ae *AuditEvent) GetIP() string { return ae.IP }
+
+// GetUserAgent fetches the user agent of the client that caused the event
+func (ae *AuditEvent) GetUserAgent() string { return ae.UserAgent }
+
 // GetData fetches a map of the associated data
 func (ae *AuditEvent) GetData() (map[string]string, error) {
 	data := make(map[string]string)
@@ -31,13 +46,15 @@ func (ae *AuditEvent) GetData() (map[string]string, error) {
 }
 
 // AddAuditEvent creates an audit event in the database
-func (dataStore *DataStore) AddAuditEvent(userid, eventType string, eventTime time.Time, data map[string]string) (interface{}, error) {
+// The request ID, IP and user agent are empty for events not caused by a request
+func (dataStore *DataStore) AddAuditEvent(userid, eventType string, eventTime time.Time, requestID, ip, userAgent string, data map[string]string) (interface{}, error) {
 
-	u, err := dataStore.GetUserByExtID(userid)
-	if err != nil {
+	// Events are recorded for soft deleted accounts, and by external ID alone for removed accounts
+	var user User
+	err := dataStore.db.Unscoped().Where(&User{ExtID: userid}).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, err
 	}
-	user := u.(*User)
 
 	encodedData, err := json.Marshal(data)
 	if err != nil {
@@ -45,18 +62,26 @@ func (dataStore *DataStore) AddAuditEvent(userid, eventType string, eventTime ti
 	}
 
 	auditEvent := AuditEvent{
-		UserID: user.ID,
-		Type:   eventType,
-		Time:   eventTime,
-		Data:   string(encodedData),
+		UserID:    user.ID,
+		UserExtID: userid,
+		Type:      eventType,
+		Time:      eventTime,
+		Data:      string(encodedData),
+		RequestID: requestID,
+		IP:        ip,
+		UserAgent: userAgent,
 	}
 
-	user.AuditEvents = append(user.AuditEvents, auditEvent)
-	_, err = dataStore.UpdateUser(user)
-	return user.AuditEvents, err
+	err = dataStore.db.Create(&auditEvent).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditEvent, nil
 }
 
-// GetAuditEvents fetches a list of audit events for a given userr
+// GetAuditEvents fetches a list of audit events for a given user
+// Events for deleted or removed accounts are fetched by external ID
 func (dataStore *DataStore) GetAuditEvents(userid string) ([]interface{}, error) {
 	var auditEvents []AuditEvent
 
@@ -66,13 +91,15 @@ func (dataStore *DataStore) GetAuditEvents(userid string) ([]interface{}, error)
 		return nil, err
 	}
 
-	user := u.(*User)
-
-	err = dataStore.db.Model(user).Related(&auditEvents).Error
+	if u != nil {
+		err = dataStore.db.Model(u.(*User)).Related(&auditEvents).Error
+	} else {
+		err = dataStore.db.Where("user_ext_id = ?", userid).Find(&auditEvents).Error
+	}
 
 	interfaces := make([]interface{}, len(auditEvents))
-	for i, t := range auditEvents {
-		interfaces[i] = &t
+	for i := range auditEvents {
+		interfaces[i] = &auditEvents[i]
 	}
 
 	return interfaces, err
@@ -107,8 +107,8 @@ func (dataStore *DataStore) GetBackupTokens(userid string) ([]interface{}, error
 	err = dataStore.db.Model(user).Related(&BackupTokens).Error
 
 	interfaces := make([]interface{}, len(BackupTokens))
-	for i, t := range BackupTokens {
-		interfaces[i] = &t
+	for i := range BackupTokens {
+		interfaces[i] = &BackupTokens[i]
 	}
 
 	return interfaces, err
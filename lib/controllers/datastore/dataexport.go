@@ -0,0 +1,126 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DataExport personal data export object
+// Exports are generated asynchronously, with the archive stored until the export expires
+type DataExport struct {
+	gorm.Model
+	ExportID    string `gorm:"not null;unique"`
+	UserExtID   string
+	UserID      uint
+	Status      string
+	Data        string `gorm:"type:text"`
+	CompletedAt time.Time
+	ExpiresAt   time.Time
+}
+
+// Getters and setters for external interface compliance
+
+// GetExportID fetches the export ID
+func (e *DataExport) GetExportID() string { return e.ExportID }
+
+// GetUserExtID fetches the external ID of the user the export belongs to
+func (e *DataExport) GetUserExtID() string { return e.UserExtID }
+
+// GetStatus fetches the export status
+func (e *DataExport) GetStatus() string { return e.Status }
+
+// GetData fetches the export archive
+func (e *DataExport) GetData() string { return e.Data }
+
+// GetCreatedAt fetches the export creation time
+func (e *DataExport) GetCreatedAt() time.Time { return e.CreatedAt }
+
+// GetCompletedAt fetches the export completion time
+func (e *DataExport) GetCompletedAt() time.Time { return e.CompletedAt }
+
+// GetExpiresAt fetches the export expiry time
+func (e *DataExport) GetExpiresAt() time.Time { return e.ExpiresAt }
+
+// SetComplete sets the export archive and marks the export as complete
+func (e *DataExport) SetComplete(status, data string) {
+	e.Status = status
+	e.Data = data
+	e.CompletedAt = time.Now()
+}
+
+// AddDataExport creates a data export for the provided user account
+func (ds *DataStore) AddDataExport(userExtID, exportID, status string, expiry time.Time) (interface{}, error) {
+	u, err := ds.GetUserByExtID(userExtID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("No user found by ID: %s", userExtID)
+	}
+	user := u.(*User)
+
+	export := DataExport{
+		ExportID:  exportID,
+		UserExtID: userExtID,
+		UserID:    user.ID,
+		Status:    status,
+		ExpiresAt: expiry,
+	}
+
+	err = ds.db.Create(&export).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// GetDataExport fetches a data export by export ID
+func (ds *DataStore) GetDataExport(exportID string) (interface{}, error) {
+	var export DataExport
+
+	err := ds.db.Where(&DataExport{ExportID: exportID}).First(&export).Error
+	if (err != nil) && (err != gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return &export, nil
+}
+
+// GetDataExports fetches the data exports for a given user
+// Export archives are not loaded
+func (ds *DataStore) GetDataExports(userExtID string) ([]interface{}, error) {
+	var exports []DataExport
+
+	err := ds.db.Select("id, created_at, updated_at, deleted_at, export_id, user_ext_id, user_id, status, completed_at, expires_at").
+		Where(&DataExport{UserExtID: userExtID}).Order("created_at desc").Find(&exports).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(exports))
+	for i := range exports {
+		interfaces[i] = &exports[i]
+	}
+
+	return interfaces, nil
+}
+
+// UpdateDataExport updates a data export instance in the database
+func (ds *DataStore) UpdateDataExport(export interface{}) (interface{}, error) {
+	err := ds.db.Save(export).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// RemoveExpiredDataExports removes data exports that expired prior to the provided time
+func (ds *DataStore) RemoveExpiredDataExports(t time.Time) error {
+	return ds.db.Unscoped().Where("expires_at < ?", t).Delete(&DataExport{}).Error
+}
@@ -3,6 +3,7 @@ package datastore
 import (
 	"errors"
 	"fmt"
+	"log"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
@@ -56,6 +57,11 @@ func (dataStore *DataStore) Drop() {
 	db = db.Exec("DROP TABLE IF EXISTS backup_tokens CASCADE;")
 	db = db.Exec("DROP TABLE IF EXISTS action_tokens CASCADE;")
 	db = db.Exec("DROP TABLE IF EXISTS audit_events CASCADE;")
+	db = db.Exec("DROP TABLE IF EXISTS data_exports CASCADE;")
+	db = db.Exec("DROP TABLE IF EXISTS password_histories CASCADE;")
+	db = db.Exec("DROP TABLE IF EXISTS invites CASCADE;")
+	db = db.Exec("DROP TABLE IF EXISTS trusted_devices CASCADE;")
+	db = db.Exec("DROP TABLE IF EXISTS login_devices CASCADE;")
 	db = db.Exec("DROP TABLE IF EXISTS users CASCADE;")
 
 	dataStore.db = db
@@ -72,10 +78,22 @@ func (dataStore *DataStore) Sync() {
 	db = db.AutoMigrate(&BackupToken{})
 
 	db = db.AutoMigrate(&AuditEvent{})
+	db = db.AutoMigrate(&DataExport{})
+	db = db.AutoMigrate(&PasswordHistory{})
+	db = db.AutoMigrate(&Invite{})
+	db = db.AutoMigrate(&TrustedDevice{})
+	db = db.AutoMigrate(&LoginDevice{})
 
 	db = dataStore.OauthStore.Sync(true)
 
 	dataStore.db = db
+
+	// Identity migration errors are logged rather than failing startup
+	// so that existing collisions can be resolved with the admin tooling
+	err := dataStore.migrateIdentities()
+	if err != nil {
+		log.Printf("DataStore.Sync: identity migration error (%s)", err)
+	}
 }
 
 // ForceSync Drop and create existing tables to match required schema
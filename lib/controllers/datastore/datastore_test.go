@@ -2,7 +2,9 @@ package datastore
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ryankurte/authplz/lib/config"
 )
@@ -84,6 +86,38 @@ func TestDatastore(t *testing.T) {
 		}
 	})
 
+	t.Run("Finds users by canonical email and username", func(t *testing.T) {
+		u, err := ds.GetUserByEmail(strings.ToUpper(fakeEmail))
+		if err != nil || u == nil {
+			t.Errorf("User find by email failed (%v)", err)
+			return
+		}
+		if u.(*User).GetEmail() != fakeEmail {
+			t.Error("Email address mismatch")
+		}
+
+		u, err = ds.GetUserByUsername(strings.ToUpper(fakeName))
+		if err != nil || u == nil {
+			t.Errorf("User find by username failed (%v)", err)
+			return
+		}
+	})
+
+	t.Run("Rejects users with colliding identities", func(t *testing.T) {
+		_, err := ds.AddUser(strings.ToUpper(fakeEmail), "another.name", fakePass)
+		if err == nil {
+			t.Error("Duplicate canonical email allowed")
+		}
+
+		collisions, err := ds.IdentityCollisions()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(collisions) != 0 {
+			t.Errorf("Unexpected identity collisions %+v", collisions)
+		}
+	})
+
 	t.Run("Finds users by uuid", func(t *testing.T) {
 		// Create user
 		u, err := ds.GetUserByEmail(fakeEmail)
@@ -159,6 +193,62 @@ func TestDatastore(t *testing.T) {
 
 	})
 
+	t.Run("Update users with legacy identities", func(t *testing.T) {
+		u, err := ds.AddUser("legacy@abc.com", "legacy.user", fakePass)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		userInst := u.(*User)
+
+		// Legacy identifiers may not be valid canonical identities
+		ds.db.Model(userInst).UpdateColumn("username", "")
+		userInst.Username = ""
+
+		userInst.SetLoginRetries(1)
+		if _, err := ds.UpdateUser(userInst); err != nil {
+			t.Errorf("Legacy user update failed (%s)", err)
+		}
+
+		ds.RemoveUser(userInst)
+	})
+
+	t.Run("Find users with legacy identities", func(t *testing.T) {
+		u, err := ds.AddUser("legacy.find@abc.com", "legacy.find", fakePass)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		userInst := u.(*User)
+
+		// Legacy addresses with invalid domains are keyed by their lower case fallback
+		legacyEmail := "Legacy.Find@Invalid_Domain.com"
+		userInst.Email = legacyEmail
+		if _, err := ds.UpdateUser(userInst); err != nil {
+			t.Errorf("Legacy user update failed (%s)", err)
+		}
+
+		u, err = ds.GetUserByEmail(strings.ToUpper(legacyEmail))
+		if err != nil {
+			t.Error(err)
+		}
+		if u == nil {
+			t.Errorf("Legacy user find by email failed")
+		} else if u.(*User).GetExtID() != userInst.GetExtID() {
+			t.Errorf("Legacy user find by email returned the wrong user")
+		}
+
+		u, err = ds.GetUserByUsername("Legacy.Find")
+		if err != nil {
+			t.Error(err)
+		}
+		if u == nil {
+			t.Errorf("Legacy user find by username failed")
+		}
+
+		ds.RemoveUser(userInst)
+	})
+
 	t.Run("Add U2F tokens", func(t *testing.T) {
 		// Create user
 		u, err := ds.GetUserByEmail(fakeEmail)
@@ -192,6 +282,208 @@ func TestDatastore(t *testing.T) {
 		}
 	})
 
+	t.Run("List users", func(t *testing.T) {
+		_, err := ds.AddUser("test2@abc.com", "user.two", fakePass)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		users, err := ds.GetUsers(QueryFilter{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 2 {
+			t.Errorf("Expected 2 users, received %d", len(users))
+			return
+		}
+
+		users, err = ds.GetUsers(QueryFilter{Limit: 1, Offset: 1})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 1 || users[0].(*User).GetEmail() != "test2@abc.com" {
+			t.Errorf("Filtered user list mismatch (%+v)", users)
+			return
+		}
+	})
+
+	t.Run("Search users", func(t *testing.T) {
+		users, err := ds.SearchUsers("USER.TWO", 0, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 1 || users[0].(*User).GetEmail() != "test2@abc.com" {
+			t.Errorf("User search mismatch (%+v)", users)
+			return
+		}
+
+		users, err = ds.SearchUsers("%", 0, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 0 {
+			t.Errorf("Expected wildcards to be escaped (%+v)", users)
+			return
+		}
+	})
+
+	t.Run("Find users without second factors", func(t *testing.T) {
+		u, err := ds.GetUserByEmail("test2@abc.com")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		u.(*User).SetActivated(true)
+		if _, err = ds.UpdateUser(u); err != nil {
+			t.Error(err)
+			return
+		}
+
+		users, err := ds.GetUsersWithoutSecondFactors(false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 1 || users[0].(*User).GetEmail() != "test2@abc.com" {
+			t.Errorf("Users without second factors mismatch (%+v)", users)
+			return
+		}
+
+		users, err = ds.GetUsersWithoutSecondFactors(true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(users) != 0 {
+			t.Errorf("Expected no admins without second factors (%+v)", users)
+			return
+		}
+	})
+
+	t.Run("Add and remove trusted devices", func(t *testing.T) {
+		u, err := ds.GetUserByEmail("test2@abc.com")
+		if err != nil || u == nil {
+			t.Errorf("Error fetching user (%v)", err)
+			return
+		}
+		userID := u.(*User).GetExtID()
+
+		_, err = ds.AddTrustedDevice(userID, "device-1", "hash-1", "agent", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = ds.AddTrustedDevice(userID, "device-2", "hash-2", "agent", time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		devices, err := ds.GetTrustedDevices(userID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(devices) != 1 || devices[0].(*TrustedDevice).GetDeviceID() != "device-1" {
+			t.Errorf("Expected only unexpired devices (%+v)", devices)
+			return
+		}
+
+		err = ds.RemoveTrustedDevices(userID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		devices, err = ds.GetTrustedDevices(userID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(devices) != 0 {
+			t.Errorf("Trusted devices not removed (%+v)", devices)
+		}
+	})
+
+	t.Run("Soft delete and restore users", func(t *testing.T) {
+		u, err := ds.GetUserByEmail("test2@abc.com")
+		if err != nil || u == nil {
+			t.Errorf("Error fetching user (%v)", err)
+			return
+		}
+
+		err = ds.SoftDeleteUser(u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		u2, err := ds.GetUserByEmail("test2@abc.com")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if u2 != nil {
+			t.Error("Soft deleted user returned by lookup")
+			return
+		}
+
+		deleted, err := ds.GetUsersDeletedBefore(time.Now().Add(time.Minute))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(deleted) != 1 || deleted[0].(*User).GetEmail() != "test2@abc.com" {
+			t.Errorf("Deleted user list mismatch (%+v)", deleted)
+			return
+		}
+
+		d, err := ds.GetDeletedUserByEmail("test2@abc.com")
+		if err != nil || d == nil {
+			t.Errorf("Error fetching deleted user (%v)", err)
+			return
+		}
+
+		err = ds.RestoreUser(d)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		u2, err = ds.GetUserByEmail("test2@abc.com")
+		if err != nil || u2 == nil {
+			t.Errorf("User not restored (%v)", err)
+		}
+	})
+
+	t.Run("Remove users", func(t *testing.T) {
+		u, err := ds.GetUserByEmail("test2@abc.com")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = ds.RemoveUser(u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		u, err = ds.GetUserByEmail("test2@abc.com")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if u != nil {
+			t.Error("User not removed")
+		}
+	})
+
 	// Tear down user controller
 
 }
@@ -88,13 +88,20 @@ func (dataStore *DataStore) GetFidoTokens(userid string) ([]interface{}, error)
 	err = dataStore.db.Model(u).Related(&fidoTokens).Error
 
 	interfaces := make([]interface{}, len(fidoTokens))
-	for i, t := range fidoTokens {
-		interfaces[i] = &t
+	for i := range fidoTokens {
+		interfaces[i] = &fidoTokens[i]
 	}
 
 	return interfaces, err
 }
 
+// CountFidoTokens counts the fido tokens enrolled across all users
+func (dataStore *DataStore) CountFidoTokens() (int, error) {
+	var count int
+	err := dataStore.db.Model(&FidoToken{}).Count(&count).Error
+	return count, err
+}
+
 // UpdateFidoToken updates a fido token instance
 func (dataStore *DataStore) UpdateFidoToken(token interface{}) (interface{}, error) {
 
@@ -105,3 +112,8 @@ func (dataStore *DataStore) UpdateFidoToken(token interface{}) (interface{}, err
 
 	return token, nil
 }
+
+// RemoveFidoToken removes a fido token instance from the database
+func (dataStore *DataStore) RemoveFidoToken(token interface{}) error {
+	return dataStore.db.Delete(token).Error
+}
@@ -0,0 +1,141 @@
+package datastore
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ryankurte/authplz/lib/identity"
+)
+
+// IdentityCollision describes user accounts that share a canonical email or username
+// These must be resolved before the canonical unique indexes can be created
+type IdentityCollision struct {
+	Field string   `json:"field"`
+	Key   string   `json:"key"`
+	Users []string `json:"users"`
+}
+
+// Canonical identity columns and their unique indexes
+var identityIndexes = []struct {
+	field, column, index string
+}{
+	{"email", "email_key", "idx_users_email_key"},
+	{"username", "username_key", "idx_users_username_key"},
+}
+
+// canonicalEmailKey computes the identity key for an email address
+// Addresses that cannot be canonicalized fall back to lower case so legacy accounts remain usable,
+// the canonicalization error is returned alongside the fallback key
+func canonicalEmailKey(email string) (string, error) {
+	key, err := identity.CanonicalEmail(email)
+	if err != nil {
+		return strings.ToLower(email), err
+	}
+	return key, nil
+}
+
+// canonicalUsernameKey computes the identity key for a username, falling back to lower case as above
+func canonicalUsernameKey(username string) (string, error) {
+	key, err := identity.CanonicalUsername(username)
+	if err != nil {
+		return strings.ToLower(username), err
+	}
+	return key, nil
+}
+
+// identityKeys computes the canonical identity keys for a user
+// Existing identifiers that cannot be canonicalized fall back to lower case so legacy accounts remain usable
+func identityKeys(u *User) (string, string) {
+	emailKey, err := canonicalEmailKey(u.Email)
+	if err != nil {
+		log.Printf("DataStore.identityKeys: user %s email cannot be canonicalized (%s)", u.ExtID, err)
+	}
+	usernameKey, err := canonicalUsernameKey(u.Username)
+	if err != nil {
+		log.Printf("DataStore.identityKeys: user %s username cannot be canonicalized (%s)", u.ExtID, err)
+	}
+
+	return emailKey, usernameKey
+}
+
+// migrateIdentities backfills canonical identity keys for existing users and creates
+// unique indexes on them. Indexes are only created once no collisions exist, collisions
+// are logged and can be listed with IdentityCollisions
+func (dataStore *DataStore) migrateIdentities() error {
+	db := dataStore.db.Unscoped()
+
+	var users []User
+	err := db.Where("email_key IS NULL OR email_key = '' OR username_key IS NULL OR username_key = ''").Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		u := &users[i]
+
+		emailKey, usernameKey := identityKeys(u)
+
+		err = db.Model(u).UpdateColumns(map[string]interface{}{"email_key": emailKey, "username_key": usernameKey}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	collisions, err := dataStore.IdentityCollisions()
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range identityIndexes {
+		blocked := false
+		for _, c := range collisions {
+			if c.Field == idx.field {
+				log.Printf("DataStore.migrateIdentities: %s collision for '%s' between users %s", c.Field, c.Key, strings.Join(c.Users, ", "))
+				blocked = true
+			}
+		}
+		if blocked {
+			log.Printf("DataStore.migrateIdentities: unique index %s not created, resolve collisions and restart", idx.index)
+			continue
+		}
+
+		err = db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON users (%s)", idx.index, idx.column)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IdentityCollisions lists user accounts (including deleted accounts) that share a canonical email or username
+func (dataStore *DataStore) IdentityCollisions() ([]IdentityCollision, error) {
+	collisions := make([]IdentityCollision, 0)
+
+	for _, idx := range identityIndexes {
+		var users []User
+
+		query := fmt.Sprintf("%s IN (SELECT %s FROM users GROUP BY %s HAVING COUNT(*) > 1)", idx.column, idx.column, idx.column)
+		err := dataStore.db.Unscoped().Where(query).Order(idx.column).Order("id").Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// Group users by key, users are ordered by key so groups are contiguous
+		for _, u := range users {
+			key := u.EmailKey
+			if idx.field == "username" {
+				key = u.UsernameKey
+			}
+
+			if n := len(collisions); n == 0 || collisions[n-1].Field != idx.field || collisions[n-1].Key != key {
+				collisions = append(collisions, IdentityCollision{Field: idx.field, Key: key})
+			}
+			c := &collisions[len(collisions)-1]
+			c.Users = append(c.Users, u.ExtID)
+		}
+	}
+
+	return collisions, nil
+}
@@ -0,0 +1,142 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Invite registration invitation object
+// Invitations are single use and bound to the email address they were issued for
+type Invite struct {
+	gorm.Model
+	Code      string `gorm:"not null;unique"`
+	UserExtID string
+	UserID    uint
+	Email     string
+	ExpiresAt time.Time
+	Used      bool `gorm:"not null; default:false"`
+	UsedAt    time.Time
+	UsedBy    string
+}
+
+// Getters and setters for external interface compliance
+
+// GetID fetches the invitation ID
+func (i *Invite) GetID() uint { return i.ID }
+
+// GetCode fetches the invitation code
+func (i *Invite) GetCode() string { return i.Code }
+
+// GetUserExtID fetches the external ID of the user that issued the invitation
+func (i *Invite) GetUserExtID() string { return i.UserExtID }
+
+// GetEmail fetches the email address the invitation was issued for
+func (i *Invite) GetEmail() string { return i.Email }
+
+// GetCreatedAt fetches the invitation creation time
+func (i *Invite) GetCreatedAt() time.Time { return i.CreatedAt }
+
+// GetExpiry fetches the invitation expiry time
+func (i *Invite) GetExpiry() time.Time { return i.ExpiresAt }
+
+// IsUsed checks if an invitation has been used
+func (i *Invite) IsUsed() bool { return i.Used }
+
+// GetUsedBy fetches the external ID of the user created with the invitation
+func (i *Invite) GetUsedBy() string { return i.UsedBy }
+
+// SetUsed marks the invitation as used by the provided user
+func (i *Invite) SetUsed(userExtID string, t time.Time) {
+	i.Used = true
+	i.UsedAt = t
+	i.UsedBy = userExtID
+}
+
+// AddInvite creates an invitation issued by the provided user account
+func (ds *DataStore) AddInvite(userExtID, code, email string, expiry time.Time) (interface{}, error) {
+	u, err := ds.GetUserByExtID(userExtID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("No user found by ID: %s", userExtID)
+	}
+	user := u.(*User)
+
+	invite := Invite{
+		Code:      code,
+		UserExtID: userExtID,
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: expiry,
+	}
+
+	err = ds.db.Create(&invite).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// GetInviteByID fetches an invitation by ID
+func (ds *DataStore) GetInviteByID(id uint) (interface{}, error) {
+	var invite Invite
+
+	err := ds.db.First(&invite, id).Error
+	if (err != nil) && (err != gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return &invite, nil
+}
+
+// GetInviteByCode fetches an invitation by invitation code
+func (ds *DataStore) GetInviteByCode(code string) (interface{}, error) {
+	var invite Invite
+
+	err := ds.db.Where(&Invite{Code: code}).First(&invite).Error
+	if (err != nil) && (err != gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return &invite, nil
+}
+
+// GetInvites fetches the invitations issued by a given user
+func (ds *DataStore) GetInvites(userExtID string) ([]interface{}, error) {
+	var invites []Invite
+
+	err := ds.db.Where(&Invite{UserExtID: userExtID}).Order("created_at desc").Find(&invites).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(invites))
+	for i := range invites {
+		interfaces[i] = &invites[i]
+	}
+
+	return interfaces, nil
+}
+
+// UpdateInvite updates an invitation instance in the database
+func (ds *DataStore) UpdateInvite(invite interface{}) (interface{}, error) {
+	err := ds.db.Save(invite).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// RemoveInvite removes an invitation from the database
+func (ds *DataStore) RemoveInvite(invite interface{}) error {
+	return ds.db.Unscoped().Delete(invite).Error
+}
@@ -0,0 +1,106 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LoginDevice login fingerprint object
+// This records the clients a user has logged in from so that logins from new devices can be detected
+type LoginDevice struct {
+	gorm.Model
+	UserExtID       string
+	UserID          uint
+	IP              string
+	IPPrefix        string
+	UserAgentFamily string
+	UserAgent       string
+	LastSeen        time.Time
+}
+
+// Getters and setters for external interface compliance
+
+// GetIP fetches the IP address the device last logged in from
+func (d *LoginDevice) GetIP() string { return d.IP }
+
+// SetIP sets the IP address the device last logged in from
+func (d *LoginDevice) SetIP(ip string) { d.IP = ip }
+
+// GetIPPrefix fetches the network prefix of the IP address the device logged in from
+func (d *LoginDevice) GetIPPrefix() string { return d.IPPrefix }
+
+// GetUserAgentFamily fetches the browser and operating system family of the device
+func (d *LoginDevice) GetUserAgentFamily() string { return d.UserAgentFamily }
+
+// GetUserAgent fetches the full user agent the device last logged in with
+func (d *LoginDevice) GetUserAgent() string { return d.UserAgent }
+
+// SetUserAgent sets the full user agent the device last logged in with
+func (d *LoginDevice) SetUserAgent(userAgent string) { d.UserAgent = userAgent }
+
+// GetCreatedAt fetches the time the device was first seen
+func (d *LoginDevice) GetCreatedAt() time.Time { return d.CreatedAt }
+
+// GetLastSeen fetches the time the device last logged in
+func (d *LoginDevice) GetLastSeen() time.Time { return d.LastSeen }
+
+// SetLastSeen sets the time the device last logged in
+func (d *LoginDevice) SetLastSeen(t time.Time) { d.LastSeen = t }
+
+// AddLoginDevice records a login device for the provided user account
+func (ds *DataStore) AddLoginDevice(userExtID, ip, ipPrefix, userAgentFamily, userAgent string) (interface{}, error) {
+	u, err := ds.GetUserByExtID(userExtID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("No user found by ID: %s", userExtID)
+	}
+	user := u.(*User)
+
+	device := LoginDevice{
+		UserExtID:       userExtID,
+		UserID:          user.ID,
+		IP:              ip,
+		IPPrefix:        ipPrefix,
+		UserAgentFamily: userAgentFamily,
+		UserAgent:       userAgent,
+		LastSeen:        time.Now(),
+	}
+
+	err = ds.db.Create(&device).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// GetLoginDevices fetches the login devices for a given user
+func (ds *DataStore) GetLoginDevices(userExtID string) ([]interface{}, error) {
+	var devices []LoginDevice
+
+	err := ds.db.Where(&LoginDevice{UserExtID: userExtID}).Order("last_seen desc").Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(devices))
+	for i := range devices {
+		interfaces[i] = &devices[i]
+	}
+
+	return interfaces, nil
+}
+
+// UpdateLoginDevice updates a login device instance in the database
+func (ds *DataStore) UpdateLoginDevice(device interface{}) (interface{}, error) {
+	err := ds.db.Save(device).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
@@ -133,6 +133,6 @@ func (os *OauthStore) GetClientByAccessTokenSession(signature string) (interface
 
 // RemoveAccessTokenSession Remove an access token by session key
 func (os *OauthStore) RemoveAccessTokenSession(signature string) error {
-	err := os.db.Delete(&OauthAccessToken{Signature: signature}).Error
+	err := os.db.Where(&OauthAccessToken{Signature: signature}).Delete(&OauthAccessToken{}).Error
 	return err
 }
@@ -119,7 +119,5 @@ func (oauthStore *OauthStore) RemoveAuthorizeCodeSession(code string) error {
 		Code: code,
 	}
 
-	oauthStore.db = oauthStore.db.Delete(&authorization)
-
-	return oauthStore.db.Error
+	return oauthStore.db.Where(&authorization).Delete(&OauthAuthorizeCode{}).Error
 }
@@ -24,6 +24,12 @@ type OauthClient struct {
 
 	UserData string
 	Public   bool
+
+	// Token lifespan overrides, zero values fall back to global defaults
+	AccessTokenLifespan   time.Duration
+	AuthorizeCodeLifespan time.Duration
+	IDTokenLifespan       time.Duration
+	RefreshTokenLifespan  time.Duration
 }
 
 func (c *OauthClient) GetID() string     { return c.ClientID }
@@ -41,6 +47,16 @@ func (c *OauthClient) SetLastUsed(t time.Time) { c.LastUsed = t }
 func (c *OauthClient) SetSecret(secret string)     { c.Secret = secret }
 func (c *OauthClient) SetUserData(userData string) { c.UserData = userData }
 
+func (c *OauthClient) GetAccessTokenLifespan() time.Duration   { return c.AccessTokenLifespan }
+func (c *OauthClient) GetAuthorizeCodeLifespan() time.Duration { return c.AuthorizeCodeLifespan }
+func (c *OauthClient) GetIDTokenLifespan() time.Duration       { return c.IDTokenLifespan }
+func (c *OauthClient) GetRefreshTokenLifespan() time.Duration  { return c.RefreshTokenLifespan }
+
+func (c *OauthClient) SetAccessTokenLifespan(d time.Duration)   { c.AccessTokenLifespan = d }
+func (c *OauthClient) SetAuthorizeCodeLifespan(d time.Duration) { c.AuthorizeCodeLifespan = d }
+func (c *OauthClient) SetIDTokenLifespan(d time.Duration)       { c.IDTokenLifespan = d }
+func (c *OauthClient) SetRefreshTokenLifespan(d time.Duration)  { c.RefreshTokenLifespan = d }
+
 func (c *OauthClient) GetRedirectURIs() []string {
 	return stringToArray(c.RedirectURIs)
 }
@@ -133,8 +149,8 @@ func (oauthStore *OauthStore) GetClientsByUserID(userID string) ([]interface{},
 	err = oauthStore.db.Model(u).Related(&oauthClients).Error
 
 	interfaces := make([]interface{}, len(oauthClients))
-	for i, t := range oauthClients {
-		interfaces[i] = &t
+	for i := range oauthClients {
+		interfaces[i] = &oauthClients[i]
 	}
 
 	return interfaces, err
@@ -158,7 +174,5 @@ func (oauthStore *OauthStore) RemoveClientByID(clientID string) error {
 		ClientID: clientID,
 	}
 
-	oauthStore.db = oauthStore.db.Delete(&client)
-
-	return oauthStore.db.Error
+	return oauthStore.db.Where(&client).Delete(&OauthClient{}).Error
 }
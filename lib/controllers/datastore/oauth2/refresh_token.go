@@ -131,6 +131,6 @@ func (os *OauthStore) GetClientByRefreshToken(signature string) (interface{}, er
 }
 
 func (os *OauthStore) RemoveRefreshToken(signature string) error {
-	err := os.db.Delete(&OauthRefreshToken{Signature: signature}).Error
+	err := os.db.Where(&OauthRefreshToken{Signature: signature}).Delete(&OauthRefreshToken{}).Error
 	return err
 }
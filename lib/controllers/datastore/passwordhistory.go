@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PasswordHistory previous password hash object
+// This is used to prevent reuse of previous passwords
+type PasswordHistory struct {
+	gorm.Model
+	UserExtID string
+	UserID    uint
+	Hash      string
+}
+
+// GetHash fetches the stored password hash
+func (ph *PasswordHistory) GetHash() string { return ph.Hash }
+
+// AddPasswordHistory records a password hash for the provided user account
+func (ds *DataStore) AddPasswordHistory(userExtID, hash string) (interface{}, error) {
+	u, err := ds.GetUserByExtID(userExtID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("No user found by ID: %s", userExtID)
+	}
+	user := u.(*User)
+
+	ph := PasswordHistory{
+		UserExtID: userExtID,
+		UserID:    user.ID,
+		Hash:      hash,
+	}
+
+	err = ds.db.Create(&ph).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &ph, nil
+}
+
+// GetPasswordHistory fetches up to limit of the most recent password hashes for the provided user account
+func (ds *DataStore) GetPasswordHistory(userExtID string, limit int) ([]interface{}, error) {
+	var history []PasswordHistory
+
+	err := ds.db.Where(&PasswordHistory{UserExtID: userExtID}).Order("created_at desc").Order("id desc").Limit(limit).Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(history))
+	for i := range history {
+		interfaces[i] = &history[i]
+	}
+
+	return interfaces, nil
+}
+
+// TrimPasswordHistory removes all but the most recent keep password hashes for the provided user account
+func (ds *DataStore) TrimPasswordHistory(userExtID string, keep int) error {
+	var history []PasswordHistory
+
+	err := ds.db.Select("id").Where(&PasswordHistory{UserExtID: userExtID}).Order("created_at desc").Order("id desc").Offset(keep).Find(&history).Error
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(history))
+	for i := range history {
+		ids[i] = history[i].ID
+	}
+
+	return ds.db.Unscoped().Where("id IN (?)", ids).Delete(&PasswordHistory{}).Error
+}
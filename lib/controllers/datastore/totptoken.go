@@ -71,13 +71,20 @@ func (ds *DataStore) GetTotpTokens(userid string) ([]interface{}, error) {
 	err = ds.db.Model(user).Related(&totpTokens).Error
 
 	interfaces := make([]interface{}, len(totpTokens))
-	for i, t := range totpTokens {
-		interfaces[i] = &t
+	for i := range totpTokens {
+		interfaces[i] = &totpTokens[i]
 	}
 
 	return interfaces, err
 }
 
+// CountTotpTokens counts the TOTP tokens enrolled across all users
+func (ds *DataStore) CountTotpTokens() (int, error) {
+	var count int
+	err := ds.db.Model(&TotpToken{}).Count(&count).Error
+	return count, err
+}
+
 // UpdateTotpToken updates a TOTP token instance in the database
 func (ds *DataStore) UpdateTotpToken(token interface{}) (interface{}, error) {
 
@@ -88,3 +95,8 @@ func (ds *DataStore) UpdateTotpToken(token interface{}) (interface{}, error) {
 
 	return token, nil
 }
+
+// RemoveTotpToken removes a TOTP token instance from the database
+func (ds *DataStore) RemoveTotpToken(token interface{}) error {
+	return ds.db.Delete(token).Error
+}
@@ -0,0 +1,115 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TrustedDevice remembered device object
+// Trusted devices allow the second factor to be skipped at login until the device expires
+// Only a hash of the device token is stored, the token itself is held by the device
+type TrustedDevice struct {
+	gorm.Model
+	DeviceID  string `gorm:"not null;unique"`
+	UserExtID string
+	UserID    uint
+	TokenHash string `gorm:"not null"`
+	UserAgent string
+	LastUsed  time.Time
+	ExpiresAt time.Time
+}
+
+// Getters and setters for external interface compliance
+
+// GetDeviceID fetches the device ID
+func (d *TrustedDevice) GetDeviceID() string { return d.DeviceID }
+
+// GetUserExtID fetches the external ID of the user the device belongs to
+func (d *TrustedDevice) GetUserExtID() string { return d.UserExtID }
+
+// GetTokenHash fetches the device token hash
+func (d *TrustedDevice) GetTokenHash() string { return d.TokenHash }
+
+// GetUserAgent fetches the user agent of the device when it was remembered
+func (d *TrustedDevice) GetUserAgent() string { return d.UserAgent }
+
+// GetCreatedAt fetches the time the device was remembered
+func (d *TrustedDevice) GetCreatedAt() time.Time { return d.CreatedAt }
+
+// GetLastUsed fetches the last time the device was used to log in
+func (d *TrustedDevice) GetLastUsed() time.Time { return d.LastUsed }
+
+// SetLastUsed sets the last time the device was used to log in
+func (d *TrustedDevice) SetLastUsed(t time.Time) { d.LastUsed = t }
+
+// GetExpiry fetches the device expiry time
+func (d *TrustedDevice) GetExpiry() time.Time { return d.ExpiresAt }
+
+// AddTrustedDevice creates a trusted device for the provided user account
+func (ds *DataStore) AddTrustedDevice(userExtID, deviceID, tokenHash, userAgent string, expiry time.Time) (interface{}, error) {
+	u, err := ds.GetUserByExtID(userExtID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("No user found by ID: %s", userExtID)
+	}
+	user := u.(*User)
+
+	device := TrustedDevice{
+		DeviceID:  deviceID,
+		UserExtID: userExtID,
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		UserAgent: userAgent,
+		LastUsed:  time.Now(),
+		ExpiresAt: expiry,
+	}
+
+	err = ds.db.Create(&device).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// GetTrustedDevices fetches the unexpired trusted devices for a given user
+func (ds *DataStore) GetTrustedDevices(userExtID string) ([]interface{}, error) {
+	var devices []TrustedDevice
+
+	err := ds.db.Where(&TrustedDevice{UserExtID: userExtID}).Where("expires_at > ?", time.Now()).
+		Order("created_at desc").Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(devices))
+	for i := range devices {
+		interfaces[i] = &devices[i]
+	}
+
+	return interfaces, nil
+}
+
+// UpdateTrustedDevice updates a trusted device instance in the database
+func (ds *DataStore) UpdateTrustedDevice(device interface{}) (interface{}, error) {
+	err := ds.db.Save(device).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// RemoveTrustedDevice removes a trusted device from the database
+func (ds *DataStore) RemoveTrustedDevice(device interface{}) error {
+	return ds.db.Unscoped().Delete(device).Error
+}
+
+// RemoveTrustedDevices removes all trusted devices for a given user
+func (ds *DataStore) RemoveTrustedDevices(userExtID string) error {
+	return ds.db.Unscoped().Where(&TrustedDevice{UserExtID: userExtID}).Delete(&TrustedDevice{}).Error
+}
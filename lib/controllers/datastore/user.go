@@ -3,6 +3,7 @@ package datastore
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -18,27 +19,48 @@ var ErrInvalidQuery = errors.New("Invalid DB Query argument")
 
 // User represents the user for this application
 type User struct {
-	ID              uint      `gorm:"primary_key" description:"External user ID"`
-	CreatedAt       time.Time `description:"Creation time"`
-	UpdatedAt       time.Time `description:"Last update time"`
-	DeletedAt       *time.Time
-	ExtID           string `gorm:"not null;unique"`
-	Email           string `gorm:"not null;unique"`
-	Username        string `gorm:"not null;unique"`
-	Password        string `gorm:"not null"`
-	PasswordChanged time.Time
-	Activated       bool `gorm:"not null; default:false"`
-	Enabled         bool `gorm:"not null; default:false"`
-	Locked          bool `gorm:"not null; default:false"`
-	Admin           bool `gorm:"not null; default:false"`
-	LoginRetries    uint `gorm:"not null; default:0"`
-	LastLogin       time.Time
+	ID                     uint      `gorm:"primary_key" description:"External user ID"`
+	CreatedAt              time.Time `description:"Creation time"`
+	UpdatedAt              time.Time `description:"Last update time"`
+	DeletedAt              *time.Time
+	ExtID                  string `gorm:"not null;unique"`
+	Email                  string `gorm:"not null;unique"`
+	PendingEmail           string
+	Username               string `gorm:"not null;unique"`
+	UsernameChanged        time.Time
+	EmailKey               string `description:"Canonical email for lookups"`
+	UsernameKey            string `description:"Canonical username for lookups"`
+	Password               string `gorm:"not null"`
+	PasswordChanged        time.Time
+	PasswordExpiryWarned   time.Time
+	PasswordChangeRequired bool `gorm:"not null; default:false"`
+	Activated              bool `gorm:"not null; default:false"`
+	Enabled                bool `gorm:"not null; default:false"`
+	Locked                 bool `gorm:"not null; default:false"`
+	Admin                  bool `gorm:"not null; default:false"`
+	LoginRetries           uint `gorm:"not null; default:0"`
+	LastLogin              time.Time
+	SessionsRevoked        time.Time
+	ServiceAccount         bool `gorm:"not null; default:false"`
+	Dormant                bool `gorm:"not null; default:false"`
+	DormancyWarned         time.Time
+	Reactivated            time.Time
+	SecondFactorDeadline   time.Time
+	SecondFactorReminded   time.Time
+	AllowedNetworks        string `description:"Comma separated networks the user may log in from"`
 
 	ActionTokens []ActionToken
 	FidoTokens   []FidoToken
 	TotpTokens   []TotpToken
 	BackupTokens []BackupToken
 	AuditEvents  []AuditEvent
+	DataExports  []DataExport
+	Invites      []Invite
+
+	TrustedDevices []TrustedDevice
+	LoginDevices   []LoginDevice
+
+	PasswordHistory []PasswordHistory
 
 	OauthClients               []oauthstore.OauthClient
 	OauthAccessTokenSessions   []oauthstore.OauthAccessToken
@@ -57,15 +79,46 @@ func (u *User) GetExtID() string { return u.ExtID }
 // GetEmail fetches a users Email
 func (u *User) GetEmail() string { return u.Email }
 
+// SetEmail sets a users Email
+func (u *User) SetEmail(email string) { u.Email = email }
+
+// GetPendingEmail fetches the unconfirmed email address a user has requested to change to
+func (u *User) GetPendingEmail() string { return u.PendingEmail }
+
+// SetPendingEmail sets the unconfirmed email address a user has requested to change to
+func (u *User) SetPendingEmail(email string) { u.PendingEmail = email }
+
 // GetUsername fetches a users Username
 func (u *User) GetUsername() string { return u.Username }
 
+// SetUsername sets a users Username
+func (u *User) SetUsername(username string) {
+	u.Username = username
+	u.UsernameChanged = time.Now()
+}
+
+// GetUsernameChanged fetches the time at which a users Username was last changed
+// This is a zero time for users that have never changed their username
+func (u *User) GetUsernameChanged() time.Time { return u.UsernameChanged }
+
 // GetPassword fetches a users Password
 func (u *User) GetPassword() string { return u.Password }
 
 // GetPasswordChanged fetches a users PasswordChanged time
 func (u *User) GetPasswordChanged() time.Time { return u.PasswordChanged }
 
+// IsPasswordChangeRequired checks whether a user must change their password prior to logging in
+func (u *User) IsPasswordChangeRequired() bool { return u.PasswordChangeRequired }
+
+// SetPasswordChangeRequired sets whether a user must change their password prior to logging in
+func (u *User) SetPasswordChangeRequired(required bool) { u.PasswordChangeRequired = required }
+
+// GetPasswordExpiryWarned fetches the time at which a user was last warned of password expiry
+func (u *User) GetPasswordExpiryWarned() time.Time { return u.PasswordExpiryWarned }
+
+// SetPasswordExpiryWarned sets the time at which a user was last warned of password expiry
+func (u *User) SetPasswordExpiryWarned(t time.Time) { u.PasswordExpiryWarned = t }
+
 // IsActivated checks if a user is activated
 func (u *User) IsActivated() bool { return u.Activated }
 
@@ -76,7 +129,13 @@ func (u *User) SetActivated(activated bool) { u.Activated = activated }
 func (u *User) IsEnabled() bool { return u.Enabled }
 
 // SetEnabled sets a users enabled status
-func (u *User) SetEnabled(enabled bool) { u.Enabled = enabled }
+// Enabling a user clears the dormant status
+func (u *User) SetEnabled(enabled bool) {
+	u.Enabled = enabled
+	if enabled {
+		u.Dormant = false
+	}
+}
 
 // IsLocked checkes if a user account is locked
 func (u *User) IsLocked() bool { return u.Locked }
@@ -99,21 +158,98 @@ func (u *User) SetLoginRetries(retries uint) { u.LoginRetries = retries }
 // ClearLoginRetries clears a users login retry count
 func (u *User) ClearLoginRetries() { u.LoginRetries = 0 }
 
+// GetCreatedAt fetches a users account creation time
+func (u *User) GetCreatedAt() time.Time { return u.CreatedAt }
+
+// GetSessionsRevoked fetches the time at which a users sessions were last revoked
+func (u *User) GetSessionsRevoked() time.Time { return u.SessionsRevoked }
+
+// SetSessionsRevoked sets the time at which a users sessions were last revoked
+// Sessions created prior to this time are no longer valid
+func (u *User) SetSessionsRevoked(t time.Time) { u.SessionsRevoked = t }
+
+// GetDeletedAt fetches the time at which a user account was deleted
+// This is a zero time for accounts that have not been deleted
+func (u *User) GetDeletedAt() time.Time {
+	if u.DeletedAt == nil {
+		return time.Time{}
+	}
+	return *u.DeletedAt
+}
+
 // GetLastLogin fetches a users LastLogin time
 func (u *User) GetLastLogin() time.Time { return u.LastLogin }
 
 // SetLastLogin sets a users LastLogin time
 func (u *User) SetLastLogin(t time.Time) { u.LastLogin = t }
 
+// IsServiceAccount checks if a user is a service account (exempt from dormancy checks)
+func (u *User) IsServiceAccount() bool { return u.ServiceAccount }
+
+// SetServiceAccount sets a users service account status
+func (u *User) SetServiceAccount(service bool) { u.ServiceAccount = service }
+
+// IsDormant checks if a user has been disabled due to inactivity
+func (u *User) IsDormant() bool { return u.Dormant }
+
+// SetDormant sets a users dormant status
+func (u *User) SetDormant(dormant bool) { u.Dormant = dormant }
+
+// GetDormancyWarned fetches the time at which a user was last warned of inactivity
+func (u *User) GetDormancyWarned() time.Time { return u.DormancyWarned }
+
+// SetDormancyWarned sets the time at which a user was last warned of inactivity
+func (u *User) SetDormancyWarned(t time.Time) { u.DormancyWarned = t }
+
+// GetReactivated fetches the time at which a dormant user was last reactivated
+func (u *User) GetReactivated() time.Time { return u.Reactivated }
+
+// SetReactivated sets the time at which a dormant user was last reactivated
+func (u *User) SetReactivated(t time.Time) { u.Reactivated = t }
+
+// GetSecondFactorDeadline fetches the time by which a user must enrol a second factor
+// This is a zero time where a second factor requirement has not applied to the user
+func (u *User) GetSecondFactorDeadline() time.Time { return u.SecondFactorDeadline }
+
+// SetSecondFactorDeadline sets the time by which a user must enrol a second factor
+func (u *User) SetSecondFactorDeadline(t time.Time) { u.SecondFactorDeadline = t }
+
+// GetSecondFactorReminded fetches the time at which a user was last reminded to enrol a second factor
+func (u *User) GetSecondFactorReminded() time.Time { return u.SecondFactorReminded }
+
+// SetSecondFactorReminded sets the time at which a user was last reminded to enrol a second factor
+func (u *User) SetSecondFactorReminded(t time.Time) { u.SecondFactorReminded = t }
+
+// GetAllowedNetworks fetches the networks a user may log in from, empty where not restricted
+func (u *User) GetAllowedNetworks() []string {
+	if u.AllowedNetworks == "" {
+		return []string{}
+	}
+	return strings.Split(u.AllowedNetworks, ",")
+}
+
+// SetAllowedNetworks sets the networks a user may log in from
+func (u *User) SetAllowedNetworks(networks []string) { u.AllowedNetworks = strings.Join(networks, ",") }
+
 // SecondFactors Checks if a user has attached second factors
 func (u *User) SecondFactors() bool {
 	return (len(u.FidoTokens) > 0) || (len(u.TotpTokens) > 0)
 }
 
 // SetPassword sets a user password
+// This clears any outstanding requirement to change password
 func (u *User) SetPassword(pass string) {
 	u.Password = pass
 	u.PasswordChanged = time.Now()
+	u.PasswordChangeRequired = false
+}
+
+// BeforeSave updates the canonical identity keys prior to saving a user
+// This is called by gorm on Create and Save. New identifiers are validated by the user module,
+// so legacy identifiers that cannot be canonicalized are saved with the lower case fallback
+func (u *User) BeforeSave() error {
+	u.EmailKey, u.UsernameKey = identityKeys(u)
+	return nil
 }
 
 // AddUser Adds a user to the datastore
@@ -135,8 +271,7 @@ func (dataStore *DataStore) AddUser(email, username, pass string) (interface{},
 		CreatedAt: time.Now(),
 	}
 
-	dataStore.db = dataStore.db.Create(user)
-	err := dataStore.db.Error
+	err := dataStore.db.Create(user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -150,8 +285,11 @@ func (dataStore *DataStore) GetUserByEmail(email string) (interface{}, error) {
 		return nil, ErrInvalidQuery
 	}
 
+	// Lookups use the same fallback as saved keys so legacy addresses can be found
+	key, _ := canonicalEmailKey(email)
+
 	var user User
-	err := dataStore.db.Where(&User{Email: email}).First(&user).Error
+	err := dataStore.db.Where(&User{EmailKey: key}).First(&user).Error
 	if (err != nil) && (err != gorm.ErrRecordNotFound) {
 		return nil, err
 	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
@@ -185,8 +323,11 @@ func (dataStore *DataStore) GetUserByUsername(username string) (interface{}, err
 		return nil, ErrInvalidQuery
 	}
 
+	// Lookups use the same fallback as saved keys so legacy usernames can be found
+	key, _ := canonicalUsernameKey(username)
+
 	var user User
-	err := dataStore.db.Where(&User{Username: username}).First(&user).Error
+	err := dataStore.db.Where(&User{UsernameKey: key}).First(&user).Error
 	if (err != nil) && (err != gorm.ErrRecordNotFound) {
 		return nil, err
 	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
@@ -208,6 +349,241 @@ func (dataStore *DataStore) UpdateUser(user interface{}) (interface{}, error) {
 	return user, nil
 }
 
+// GetUsers Fetches a list of user accounts using the provided filter
+func (dataStore *DataStore) GetUsers(filter QueryFilter) ([]interface{}, error) {
+	return dataStore.SearchUsers("", filter.Offset, filter.Limit)
+}
+
+// SearchUsers Fetches a list of user accounts with an email, username or external ID containing the provided query
+// An empty query matches all users, and a limit of zero returns all matching users
+func (dataStore *DataStore) SearchUsers(query string, offset, limit uint) ([]interface{}, error) {
+	var users []User
+
+	db := dataStore.db.Order("id asc").Offset(int(offset))
+	if limit > 0 {
+		db = db.Limit(int(limit))
+	}
+	if query != "" {
+		// Escape LIKE wildcards so queries are matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(query))
+		match := "%" + escaped + "%"
+		db = db.Where("lower(email) LIKE ? OR lower(username) LIKE ? OR ext_id LIKE ?", match, match, match)
+	}
+
+	err := db.Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(users))
+	for i := range users {
+		interfaces[i] = &users[i]
+	}
+
+	return interfaces, nil
+}
+
+// RemoveUser Removes a user account and all associated objects from the datastore
+// This is permanent, and does not retain audit events or oauth clients belonging to the user
+func (dataStore *DataStore) RemoveUser(user interface{}) error {
+	u := user.(*User)
+
+	associated := []interface{}{
+		&ActionToken{},
+		&FidoToken{},
+		&TotpToken{},
+		&BackupToken{},
+		&AuditEvent{},
+		&DataExport{},
+		&PasswordHistory{},
+		&Invite{},
+		&TrustedDevice{},
+		&LoginDevice{},
+		&oauthstore.OauthClient{},
+		&oauthstore.OauthAuthorizeCode{},
+		&oauthstore.OauthAccessToken{},
+		&oauthstore.OauthRefreshToken{},
+	}
+
+	tx := dataStore.db.Begin()
+
+	for _, a := range associated {
+		err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(a).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err := tx.Unscoped().Delete(u).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// SoftDeleteUser Marks a user account as deleted, revokes sessions and removes associated credentials
+// Audit events are retained until the account is permanently removed with RemoveUser
+func (dataStore *DataStore) SoftDeleteUser(user interface{}) error {
+	u := user.(*User)
+
+	credentials := []interface{}{
+		&ActionToken{},
+		&FidoToken{},
+		&TotpToken{},
+		&BackupToken{},
+		&DataExport{},
+		&PasswordHistory{},
+		&Invite{},
+		&TrustedDevice{},
+		&LoginDevice{},
+		&oauthstore.OauthClient{},
+		&oauthstore.OauthAuthorizeCode{},
+		&oauthstore.OauthAccessToken{},
+		&oauthstore.OauthRefreshToken{},
+	}
+
+	tx := dataStore.db.Begin()
+
+	for _, c := range credentials {
+		err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(c).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Revoke sessions so a restored account requires a fresh login
+	u.SessionsRevoked = time.Now()
+	err := tx.Save(u).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Gorm sets DeletedAt rather than removing the row
+	err = tx.Delete(u).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// GetDeletedUserByEmail Fetches a soft deleted user account by email
+func (dataStore *DataStore) GetDeletedUserByEmail(email string) (interface{}, error) {
+	if email == "" {
+		return nil, ErrInvalidQuery
+	}
+
+	key, _ := canonicalEmailKey(email)
+
+	var user User
+	err := dataStore.db.Unscoped().Where(&User{EmailKey: key}).Where("deleted_at IS NOT NULL").First(&user).Error
+	if (err != nil) && (err != gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if (err != nil) && (err == gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+// GetUsersPasswordChangedBefore Fetches enabled user accounts with passwords last changed prior to the provided time
+func (dataStore *DataStore) GetUsersPasswordChangedBefore(t time.Time) ([]interface{}, error) {
+	var users []User
+
+	err := dataStore.db.Where("enabled = ? AND (password_changed IS NULL OR password_changed < ?)", true, t).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(users))
+	for i := range users {
+		interfaces[i] = &users[i]
+	}
+
+	return interfaces, nil
+}
+
+// GetUsersInactiveSince Fetches enabled and activated user accounts with no login, creation or reactivation since the provided time
+func (dataStore *DataStore) GetUsersInactiveSince(t time.Time) ([]interface{}, error) {
+	var users []User
+
+	err := dataStore.db.Where("enabled = ? AND activated = ? AND created_at < ?", true, true, t).
+		Where("(last_login IS NULL OR last_login < ?) AND (reactivated IS NULL OR reactivated < ?)", t, t).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(users))
+	for i := range users {
+		interfaces[i] = &users[i]
+	}
+
+	return interfaces, nil
+}
+
+// GetUsersWithoutSecondFactors Fetches enabled and activated user accounts with no registered U2F or TOTP tokens
+// Where adminsOnly is set only administrator accounts are returned
+func (dataStore *DataStore) GetUsersWithoutSecondFactors(adminsOnly bool) ([]interface{}, error) {
+	var users []User
+
+	db := dataStore.db.Where("enabled = ? AND activated = ?", true, true).
+		Where("id NOT IN (SELECT user_id FROM fido_tokens WHERE deleted_at IS NULL)").
+		Where("id NOT IN (SELECT user_id FROM totp_tokens WHERE deleted_at IS NULL)")
+	if adminsOnly {
+		db = db.Where("admin = ?", true)
+	}
+
+	err := db.Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(users))
+	for i := range users {
+		interfaces[i] = &users[i]
+	}
+
+	return interfaces, nil
+}
+
+// GetUsersDeletedBefore Fetches soft deleted user accounts that were deleted prior to the provided time
+func (dataStore *DataStore) GetUsersDeletedBefore(t time.Time) ([]interface{}, error) {
+	var users []User
+
+	err := dataStore.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", t).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]interface{}, len(users))
+	for i := range users {
+		interfaces[i] = &users[i]
+	}
+
+	return interfaces, nil
+}
+
+// RestoreUser Restores a soft deleted user account
+func (dataStore *DataStore) RestoreUser(user interface{}) error {
+	u := user.(*User)
+
+	err := dataStore.db.Unscoped().Model(u).Update("deleted_at", gorm.Expr("NULL")).Error
+	if err != nil {
+		return err
+	}
+
+	u.DeletedAt = nil
+
+	return nil
+}
+
 // GetTokens Fetches tokens attached to a user account
 func (dataStore *DataStore) GetTokens(user interface{}) (interface{}, error) {
 	var err error
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"strconv"
 
 	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/controllers/mailer/drivers"
@@ -27,10 +28,12 @@ type MailDriver interface {
 
 type Storer interface {
 	GetUserByExtID(extID string) (interface{}, error)
+	GetInviteByID(id uint) (interface{}, error)
 }
 
 type TokenCreator interface {
 	BuildToken(userID string, action api.TokenAction, duration time.Duration) (string, error)
+	BuildTokenWithData(userID string, action api.TokenAction, data string, duration time.Duration) (string, error)
 }
 
 type User interface {
@@ -38,6 +41,10 @@ type User interface {
 	GetEmail() string
 }
 
+type Invite interface {
+	GetCode() string
+}
+
 // MailController Mail controller instance
 type MailController struct {
 	domain       string
@@ -48,10 +55,26 @@ type MailController struct {
 	storer       Storer
 	tokenCreator TokenCreator
 	options      map[string]string
+
+	reactivationLifetime time.Duration
+	emailChangeLifetime  time.Duration
+	emailRevertLifetime  time.Duration
 }
 
+// DefaultReactivationLifetime is the default validity period for dormant account reactivation links
+const DefaultReactivationLifetime = 7 * 24 * time.Hour
+
+// DefaultEmailChangeLifetime is the default validity period for email change confirmation and cancellation links
+const DefaultEmailChangeLifetime = time.Hour
+
+// DefaultEmailRevertLifetime is the default validity period for links to revert a confirmed email change
+const DefaultEmailRevertLifetime = 7 * 24 * time.Hour
+
+// LoginNoticeLifetime is the validity period for account securing links sent with login notices
+const LoginNoticeLifetime = 7 * 24 * time.Hour
+
 // Standard mailing templates (required for MailController creation)
-var templateNames = [...]string{"activation", "passwordreset", "loginnotice"}
+var templateNames = [...]string{"activation", "passwordreset", "loginnotice", "dataexport", "emailchange", "emailchangenotice", "emailchanged", "passwordexpiry", "dormancywarning", "dormancydisabled", "secondfactorreminder", "invite", "accountdeleted"}
 
 type MailerConfig struct {
 	AppName      string
@@ -101,9 +124,25 @@ func NewMailController(appName, domain, driver string, options map[string]string
 		storer:       storer,
 		tokenCreator: tokenCreator,
 		options:      options,
+
+		reactivationLifetime: DefaultReactivationLifetime,
+		emailChangeLifetime:  DefaultEmailChangeLifetime,
+		emailRevertLifetime:  DefaultEmailRevertLifetime,
 	}, nil
 }
 
+// SetReactivationLifetime sets the validity period for dormant account reactivation links
+func (mc *MailController) SetReactivationLifetime(lifetime time.Duration) {
+	mc.reactivationLifetime = lifetime
+}
+
+// SetEmailChangeLifetimes sets the validity periods for email change confirmation and cancellation links,
+// and for links to revert a confirmed email change
+func (mc *MailController) SetEmailChangeLifetimes(change, revert time.Duration) {
+	mc.emailChangeLifetime = change
+	mc.emailRevertLifetime = revert
+}
+
 // SendMail Send a message to the provided email address
 func (mc *MailController) SendMail(address, subject, body string) error {
 	return mc.driver.Send(address, subject, body)
@@ -134,6 +173,61 @@ func (mc *MailController) SendPasswordReset(email string, data map[string]string
 	return mc.SendTemplate("passwordreset", email, mc.appName+" Password Reset", data)
 }
 
+// SendDataExport Send a data export download link to the provided address
+func (mc *MailController) SendDataExport(email string, data map[string]string) error {
+	return mc.SendTemplate("dataexport", email, mc.appName+" Data Export", data)
+}
+
+// SendEmailChange Send an email change confirmation link to the provided (new) address
+func (mc *MailController) SendEmailChange(email string, data map[string]string) error {
+	return mc.SendTemplate("emailchange", email, mc.appName+" Confirm Email Change", data)
+}
+
+// SendEmailChangeNotice Send an email change notice with cancellation link to the provided (old) address
+func (mc *MailController) SendEmailChangeNotice(email string, data map[string]string) error {
+	return mc.SendTemplate("emailchangenotice", email, mc.appName+" Email Change Requested", data)
+}
+
+// SendAccountDeleted Send an account deletion notice to the provided address
+func (mc *MailController) SendAccountDeleted(email string, data map[string]string) error {
+	return mc.SendTemplate("accountdeleted", email, mc.appName+" Account Deleted", data)
+}
+
+// SendEmailChanged Send an email changed notice with revert link to the provided (old) address
+func (mc *MailController) SendEmailChanged(email string, data map[string]string) error {
+	return mc.SendTemplate("emailchanged", email, mc.appName+" Email Address Changed", data)
+}
+
+// SendPasswordExpiry Send a password expiry warning to the provided address
+func (mc *MailController) SendPasswordExpiry(email string, data map[string]string) error {
+	return mc.SendTemplate("passwordexpiry", email, mc.appName+" Password Expiry", data)
+}
+
+// SendDormancyWarning Send an inactive account warning to the provided address
+func (mc *MailController) SendDormancyWarning(email string, data map[string]string) error {
+	return mc.SendTemplate("dormancywarning", email, mc.appName+" Inactive Account", data)
+}
+
+// SendDormancyDisabled Send an inactive account disabled notice with reactivation link to the provided address
+func (mc *MailController) SendDormancyDisabled(email string, data map[string]string) error {
+	return mc.SendTemplate("dormancydisabled", email, mc.appName+" Account Disabled", data)
+}
+
+// SendSecondFactorReminder Send a reminder to enrol a second factor to the provided address
+func (mc *MailController) SendSecondFactorReminder(email string, data map[string]string) error {
+	return mc.SendTemplate("secondfactorreminder", email, mc.appName+" Second Factor Required", data)
+}
+
+// SendInvite Send a registration invitation to the provided address
+func (mc *MailController) SendInvite(email string, data map[string]string) error {
+	return mc.SendTemplate("invite", email, mc.appName+" Invitation", data)
+}
+
+// SendLoginNotice Send a new device login notice with account securing link to the provided address
+func (mc *MailController) SendLoginNotice(email string, data map[string]string) error {
+	return mc.SendTemplate("loginnotice", email, mc.appName+" New Login", data)
+}
+
 func mergeMaps(a, b map[string]string) map[string]string {
 	c := make(map[string]string)
 	for i := range a {
@@ -148,6 +242,12 @@ func mergeMaps(a, b map[string]string) map[string]string {
 func (mc *MailController) HandleEvent(e interface{}) error {
 	event := e.(*events.AuthPlzEvent)
 
+	// Deleted accounts cannot be fetched, so deletion notices are sent using the details in the event
+	if event.GetType() == events.EventAccountDeleted {
+		data := map[string]string{"Domain": mc.domain, "ServiceName": mc.appName}
+		return mc.SendAccountDeleted(event.GetData()["Email"], mergeMaps(data, event.GetData()))
+	}
+
 	// Fetch the user object for further use
 	// TODO: I wonder if we should just be passing this around to save DB accesses?
 	userID := event.GetUserExtID()
@@ -156,6 +256,10 @@ func (mc *MailController) HandleEvent(e interface{}) error {
 		log.Printf("MailController.HandleEvent error: %s", err)
 		return err
 	}
+	if u == nil {
+		// Deleted accounts are not sent mail
+		return nil
+	}
 	user := u.(User)
 
 	// Fill in base data
@@ -170,6 +274,10 @@ func (mc *MailController) HandleEvent(e interface{}) error {
 	switch event.GetType() {
 	case events.EventAccountCreated:
 		// Account creation causes an activation email to be sent
+		// Invited accounts are activated on creation
+		if event.GetData()["Invited"] != "" {
+			break
+		}
 		token, err := mc.tokenCreator.BuildToken(userID, api.TokenActionActivate, time.Hour)
 		if err != nil {
 			log.Printf("MailController.HandleEvent error creating token %s", err)
@@ -188,6 +296,94 @@ func (mc *MailController) HandleEvent(e interface{}) error {
 		data["Token"] = token
 		data["ActionURL"] = fmt.Sprintf("%s/api/recovery?token=%s", mc.domain, token)
 		err = mc.SendPasswordReset(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventDataExportReady:
+		// Completed data exports cause a download link to be sent
+		data["ActionURL"] = fmt.Sprintf("%s/api/export/%s", mc.domain, event.GetData()["Export"])
+		err = mc.SendDataExport(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventEmailChangeRequested:
+		// Email change requests cause a confirmation link to be sent to the new address
+		// and a notice with cancellation link to be sent to the existing address
+		// Tokens are bound to the requested address so they only apply to this request
+		newEmail := event.GetData()["NewEmail"]
+		token, err := mc.tokenCreator.BuildTokenWithData(userID, api.TokenActionEmailChange, newEmail, mc.emailChangeLifetime)
+		if err != nil {
+			log.Printf("MailController.HandleEvent error creating token %s", err)
+			return err
+		}
+		data["ActionURL"] = fmt.Sprintf("%s/api/action?token=%s", mc.domain, token)
+		err = mc.SendEmailChange(newEmail, mergeMaps(data, event.GetData()))
+		if err != nil {
+			log.Printf("MailController.HandleEvent error sending email change confirmation %s", err)
+			return err
+		}
+
+		token, err = mc.tokenCreator.BuildTokenWithData(userID, api.TokenActionEmailCancel, newEmail, mc.emailChangeLifetime)
+		if err != nil {
+			log.Printf("MailController.HandleEvent error creating token %s", err)
+			return err
+		}
+		data["ActionURL"] = fmt.Sprintf("%s/api/action?token=%s", mc.domain, token)
+		return mc.SendEmailChangeNotice(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventEmailChanged:
+		// Confirmed email changes cause a notice with a link to revert the change to be sent to the previous address
+		oldEmail := event.GetData()["OldEmail"]
+		token, err := mc.tokenCreator.BuildTokenWithData(userID, api.TokenActionEmailRevert, oldEmail, mc.emailRevertLifetime)
+		if err != nil {
+			log.Printf("MailController.HandleEvent error creating token %s", err)
+			return err
+		}
+		data["ActionURL"] = fmt.Sprintf("%s/api/action?token=%s", mc.domain, token)
+		return mc.SendEmailChanged(oldEmail, mergeMaps(data, event.GetData()))
+	case events.EventPasswordExpiring:
+		// Passwords nearing expiry cause a warning to be sent
+		err = mc.SendPasswordExpiry(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventAccountDormant:
+		// Inactive accounts are warned prior to being disabled
+		err = mc.SendDormancyWarning(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventAccountDisabled:
+		// Accounts disabled due to inactivity are sent a reactivation link
+		if event.GetData()["Reason"] != "dormant" {
+			break
+		}
+		token, err := mc.tokenCreator.BuildToken(userID, api.TokenActionReactivate, mc.reactivationLifetime)
+		if err != nil {
+			log.Printf("MailController.HandleEvent error creating token %s", err)
+			return err
+		}
+		data["ActionURL"] = fmt.Sprintf("%s/api/action?token=%s", mc.domain, token)
+		return mc.SendDormancyDisabled(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.Event2faEnrolmentReminder:
+		// Users that must enrol a second factor are reminded during the grace period
+		err = mc.SendSecondFactorReminder(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventAccountLoginNewDevice:
+		// Logins from new devices cause a notice to be sent with a link to secure the account
+		token, err := mc.tokenCreator.BuildToken(userID, api.TokenActionSecure, LoginNoticeLifetime)
+		if err != nil {
+			log.Printf("MailController.HandleEvent error creating token %s", err)
+			return err
+		}
+		data["ActionURL"] = fmt.Sprintf("%s/api/action?token=%s", mc.domain, token)
+		return mc.SendLoginNotice(user.GetEmail(), mergeMaps(data, event.GetData()))
+	case events.EventInviteCreated:
+		// Invitations are sent to the invited address with a link to the registration page
+		// The invite code is not included in events so is fetched using the invite ID
+		inviteID, err := strconv.ParseUint(event.GetData()["InviteID"], 10, 32)
+		if err != nil {
+			log.Printf("MailController.HandleEvent invalid invite ID %s", err)
+			return err
+		}
+		i, err := mc.storer.GetInviteByID(uint(inviteID))
+		if err != nil {
+			log.Printf("MailController.HandleEvent error fetching invite %s", err)
+			return err
+		}
+		if i == nil {
+			// Revoked invites are not sent
+			return nil
+		}
+		data["InvitedBy"] = user.GetUsername()
+		data["ActionURL"] = fmt.Sprintf("%s/#/create?invite=%s", mc.domain, i.(Invite).GetCode())
+		return mc.SendInvite(event.GetData()["Email"], mergeMaps(data, event.GetData()))
 	default:
 	}
 
@@ -19,8 +19,13 @@ func (ftg *FakeTokenGenerator) BuildToken(userID string, action api.TokenAction,
 	return fmt.Sprintf("%s:%s:%s", userID, action, duration), nil
 }
 
+func (ftg *FakeTokenGenerator) BuildTokenWithData(userID string, action api.TokenAction, data string, duration time.Duration) (string, error) {
+	return fmt.Sprintf("%s:%s:%s:%s", userID, action, data, duration), nil
+}
+
 type FakeStorer struct {
-	Users map[string]datastore.User
+	Users   map[string]datastore.User
+	Invites map[uint]datastore.Invite
 }
 
 func (fs *FakeStorer) GetUserByExtID(extID string) (interface{}, error) {
@@ -31,6 +36,14 @@ func (fs *FakeStorer) GetUserByExtID(extID string) (interface{}, error) {
 	return &u, nil
 }
 
+func (fs *FakeStorer) GetInviteByID(id uint) (interface{}, error) {
+	i, ok := fs.Invites[id]
+	if !ok {
+		return nil, nil
+	}
+	return &i, nil
+}
+
 type FakeDriver struct {
 	To      string
 	Subject string
@@ -54,12 +67,13 @@ func TestMailController(t *testing.T) {
 
 	testAddress := "test@kurte.nz"
 
-	storer := FakeStorer{make(map[string]datastore.User)}
+	storer := FakeStorer{make(map[string]datastore.User), make(map[uint]datastore.Invite)}
 	storer.Users["test-id"] = datastore.User{
 		ExtID:    "test-id",
 		Username: "test-username",
 		Email:    "test-email",
 	}
+	storer.Invites[1] = datastore.Invite{Code: "invite-code", Email: "invited-email"}
 
 	driver := FakeDriver{}
 
@@ -127,4 +141,161 @@ func TestMailController(t *testing.T) {
 		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Password Reset", mc.appName))
 	})
 
+	t.Run("Handles EmailChangeRequested event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["OldEmail"] = "test-email"
+		data["NewEmail"] = "new-email"
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventEmailChangeRequested,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		// Notice is sent to the existing address after the confirmation
+		assert.EqualValues(t, "test-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Email Change Requested", mc.appName))
+	})
+
+	t.Run("Handles AccountDeleted event for removed accounts", func(t *testing.T) {
+		data := map[string]string{"Email": "deleted-email", "Username": "deleted-user"}
+		e := events.AuthPlzEvent{
+			UserExtID: "removed-id",
+			Time:      time.Now(),
+			Type:      events.EventAccountDeleted,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, "deleted-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Account Deleted", mc.appName))
+	})
+
+	t.Run("Handles EmailChanged event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["OldEmail"] = "test-email"
+		data["NewEmail"] = "new-email"
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventEmailChanged,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		// Revert link is sent to the previous address and bound to it
+		assert.EqualValues(t, "test-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Email Address Changed", mc.appName))
+		assert.Contains(t, driver.Body, fmt.Sprintf("test-id:%s:test-email", api.TokenActionEmailRevert))
+	})
+
+	t.Run("Handles PasswordExpiring event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["Expires"] = time.Now().Format(time.RFC1123)
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventPasswordExpiring,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, "test-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Password Expiry", mc.appName))
+	})
+
+	t.Run("Handles dormant AccountDisabled event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["Reason"] = "dormant"
+		data["LastActive"] = time.Now().Format(time.RFC1123)
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventAccountDisabled,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Account Disabled", mc.appName))
+		assert.Contains(t, driver.Body, string(api.TokenActionReactivate))
+	})
+
+	t.Run("Handles 2faEnrolmentReminder event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["Deadline"] = time.Now().Format(time.RFC1123)
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.Event2faEnrolmentReminder,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, "test-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Second Factor Required", mc.appName))
+	})
+
+	t.Run("Handles AccountLoginNewDevice event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["IP"] = "10.1.2.3"
+		data["Device"] = "Firefox on Linux"
+		data["Time"] = time.Now().Format(time.RFC1123)
+		data["Suspicious"] = "true"
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventAccountLoginNewDevice,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		assert.EqualValues(t, "test-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s New Login", mc.appName))
+		assert.Contains(t, driver.Body, "Firefox on Linux")
+		assert.Contains(t, driver.Body, string(api.TokenActionSecure))
+	})
+
+	t.Run("Handles InviteCreated event", func(t *testing.T) {
+		data := make(map[string]string)
+		data["Email"] = "invited-email"
+		data["InviteID"] = "1"
+		data["Expires"] = time.Now().Format(time.RFC1123)
+		e := events.AuthPlzEvent{
+			UserExtID: "test-id",
+			Time:      time.Now(),
+			Type:      events.EventInviteCreated,
+			Data:      data,
+		}
+
+		err := mc.HandleEvent(&e)
+		assert.Nil(t, err)
+
+		// Invitations are sent to the invited address
+		assert.EqualValues(t, "invited-email", driver.To)
+		assert.EqualValues(t, driver.Subject, fmt.Sprintf("%s Invitation", mc.appName))
+		assert.Contains(t, driver.Body, "invite=invite-code")
+
+		// Revoked invites are not sent
+		driver.To = ""
+		data["InviteID"] = "2"
+		err = mc.HandleEvent(&e)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "", driver.To)
+	})
+
 }
@@ -0,0 +1,117 @@
+/*
+ * Breached password list
+ * Checks passwords against a local sorted list of breached password SHA-1 hashes
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// Maximum line length in the breach file, lines are a 40 character hash with an optional count
+const maxBreachLineLength = 128
+
+// BreachList breached password list backed by a file of upper case hex SHA-1 hashes
+// sorted by hash, one per line with an optional ':count' suffix
+// The file is binary searched on disk rather than loaded into memory
+type BreachList struct {
+	file *os.File
+	size int64
+}
+
+// NewBreachList opens a breached password list file
+func NewBreachList(fileName string) (*BreachList, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &BreachList{file: f, size: info.Size()}, nil
+}
+
+// Close closes the breached password list file
+func (b *BreachList) Close() error {
+	return b.file.Close()
+}
+
+// Contains checks whether the provided password is in the breached password list
+func (b *BreachList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Binary search over byte offsets, lo is always the start of a line
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := b.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			// No lines start in [mid, hi)
+			hi = mid
+			continue
+		}
+
+		hash := strings.ToUpper(strings.TrimSpace(strings.SplitN(line, ":", 2)[0]))
+		switch {
+		case hash == target:
+			return true, nil
+		case hash < target:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineAt reads the first line starting at or after the provided offset
+// This returns the line start offset and the line (without line endings)
+func (b *BreachList) lineAt(off int64) (int64, string, error) {
+	buf := make([]byte, maxBreachLineLength)
+
+	// Move to the start of the next line unless already at a line start
+	if off > 0 {
+		n, err := b.file.ReadAt(buf, off-1)
+		if err != nil && err != io.EOF {
+			return 0, "", err
+		}
+		i := bytes.IndexByte(buf[:n], '\n')
+		if i < 0 {
+			return b.size, "", nil
+		}
+		off = off + int64(i)
+	}
+	if off >= b.size {
+		return b.size, "", nil
+	}
+
+	n, err := b.file.ReadAt(buf, off)
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	line := buf[:n]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return off, string(line), nil
+}
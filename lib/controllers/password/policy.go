@@ -0,0 +1,162 @@
+/*
+ * Password policy controller
+ * Checks passwords against configurable length, strength, identity, breach and reuse rules
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package password
+
+import (
+	"log"
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/config"
+)
+
+// Identities shorter than this are not checked for inclusion in passwords
+const minIdentityLength = 3
+
+// Policy password policy instance
+type Policy struct {
+	config config.PasswordConfig
+	breach *BreachList
+}
+
+// NewPolicy creates a password policy, loading the breached password file if configured
+func NewPolicy(c config.PasswordConfig) (*Policy, error) {
+	p := Policy{config: c}
+
+	if c.BreachFile != "" {
+		b, err := NewBreachList(c.BreachFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breach = b
+	}
+
+	return &p, nil
+}
+
+// Close closes the breached password file (if loaded)
+func (p *Policy) Close() {
+	if p.breach != nil {
+		p.breach.Close()
+	}
+}
+
+// HistorySize fetches the number of previous passwords that cannot be reused
+func (p *Policy) HistorySize() int {
+	return p.config.History
+}
+
+// Check checks a password against the policy, where identities are the email
+// addresses and usernames associated with the account.
+// This returns an *api.PasswordPolicyError listing each failed rule if the password is rejected
+func (p *Policy) Check(password string, identities ...string) error {
+	reasons := make([]string, 0)
+
+	if len(password) < p.config.MinLength {
+		reasons = append(reasons, api.PasswordReasonTooShort)
+	}
+	if p.config.MaxLength > 0 && len(password) > p.config.MaxLength {
+		reasons = append(reasons, api.PasswordReasonTooLong)
+	}
+	if p.config.MinEntropy > 0 && Entropy(password) < p.config.MinEntropy {
+		reasons = append(reasons, api.PasswordReasonTooWeak)
+	}
+
+	lower := strings.ToLower(password)
+	for _, id := range identities {
+		if len(id) >= minIdentityLength && strings.Contains(lower, strings.ToLower(id)) {
+			reasons = append(reasons, api.PasswordReasonContainsIdentity)
+			break
+		}
+	}
+
+	if p.breach != nil {
+		breached, err := p.breach.Contains(password)
+		if err != nil {
+			// Breach list errors do not block password changes
+			log.Printf("PasswordPolicy.Check: error checking breached passwords (%s)", err)
+		} else if breached {
+			reasons = append(reasons, api.PasswordReasonBreached)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &api.PasswordPolicyError{Reasons: reasons}
+	}
+
+	return nil
+}
+
+// CheckHistory checks a password against previous password hashes
+// This returns an *api.PasswordPolicyError if the password matches a previous password
+func (p *Policy) CheckHistory(password string, hashes []string) error {
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			return &api.PasswordPolicyError{Reasons: []string{api.PasswordReasonReused}}
+		}
+	}
+	return nil
+}
+
+// Entropy estimates the strength of a password in bits
+// Each character contributes bits based on the character classes used, except where the
+// character repeats or continues a sequence (ie. 'aaa', 'abc' or '321') from the previous character
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	var prev rune
+	count := 0
+
+	for i, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+
+		// Compare case insensitively so 'abCD' is treated as a sequence
+		c := unicode.ToLower(r)
+		if i == 0 || (c != prev && c != prev+1 && c != prev-1) {
+			count++
+		}
+		prev = c
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(count) * math.Log2(float64(pool))
+}
@@ -0,0 +1,91 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/config"
+)
+
+func reasons(err error) []string {
+	if err == nil {
+		return nil
+	}
+	return err.(*api.PasswordPolicyError).Reasons
+}
+
+func TestPasswordPolicy(t *testing.T) {
+
+	// Build a sorted breach file
+	breached := []string{"password123456", "correct horse battery staple", "letmein!letmein!"}
+	for i := 0; i < 100; i++ {
+		breached = append(breached, fmt.Sprintf("filler password %d", i))
+	}
+	lines := make([]string, len(breached))
+	for i, p := range breached {
+		sum := sha1.Sum([]byte(p))
+		lines[i] = fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1)
+	}
+	sort.Strings(lines)
+
+	f, err := ioutil.TempFile("", "authplz-breach")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(strings.Join(lines, "\r\n"))
+	f.Close()
+
+	c := config.DefaultPasswordConfig()
+	c.BreachFile = f.Name()
+
+	policy, err := NewPolicy(c)
+	assert.Nil(t, err)
+	defer policy.Close()
+
+	t.Run("Accepts passwords meeting the policy", func(t *testing.T) {
+		assert.Nil(t, policy.Check("abcDEF123@abcDEF123@", "test@abc.com", "test.user"))
+		assert.Nil(t, policy.Check("Reset Password 78@ cats", "test@abc.com", "test.user"))
+	})
+
+	t.Run("Rejects passwords by length", func(t *testing.T) {
+		assert.EqualValues(t, []string{api.PasswordReasonTooShort}, reasons(policy.Check("Sh0rt!pass")))
+		assert.Contains(t, reasons(policy.Check(strings.Repeat("Long pass 1@ ", 10))), api.PasswordReasonTooLong)
+	})
+
+	t.Run("Rejects weak passwords", func(t *testing.T) {
+		assert.EqualValues(t, []string{api.PasswordReasonTooWeak}, reasons(policy.Check("aaaaaaaaaaaaaaaa")))
+		assert.EqualValues(t, []string{api.PasswordReasonTooWeak}, reasons(policy.Check("abcdefghijklmnop")))
+		assert.EqualValues(t, []string{api.PasswordReasonTooWeak}, reasons(policy.Check("1234567890987654")))
+	})
+
+	t.Run("Rejects passwords containing identities", func(t *testing.T) {
+		assert.EqualValues(t, []string{api.PasswordReasonContainsIdentity},
+			reasons(policy.Check("my name is Test.User!", "test@abc.com", "test.user")))
+		assert.EqualValues(t, []string{api.PasswordReasonContainsIdentity},
+			reasons(policy.Check("TEST@abc.com 4 ever", "test@abc.com", "test.user")))
+	})
+
+	t.Run("Rejects breached passwords", func(t *testing.T) {
+		for _, p := range breached {
+			assert.Contains(t, reasons(policy.Check(p)), api.PasswordReasonBreached, p)
+		}
+		assert.Nil(t, policy.Check("not a breached password 1@"))
+	})
+
+	t.Run("Rejects reused passwords", func(t *testing.T) {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("abcDEF123@abcDEF123@"), 4)
+		hashes := []string{string(hash)}
+
+		assert.EqualValues(t, []string{api.PasswordReasonReused}, reasons(policy.CheckHistory("abcDEF123@abcDEF123@", hashes)))
+		assert.Nil(t, policy.CheckHistory("another password 1@", hashes))
+	})
+}
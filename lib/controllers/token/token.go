@@ -17,7 +17,8 @@ import (
 
 // Custom claims object
 type TokenClaims struct {
-	Action api.TokenAction `json:"act"` // Token action
+	Action api.TokenAction `json:"act"`           // Token action
+	Data   string          `json:"dat,omitempty"` // Data bound to the token action
 	jwt.StandardClaims
 }
 
@@ -41,10 +42,11 @@ func NewTokenController(address string, hmacSecret string, storer Storer) *Token
 }
 
 // Generate an action token
-func (tc *TokenController) buildSignedToken(userID, tokenID string, action api.TokenAction, duration time.Duration) (string, error) {
+func (tc *TokenController) buildSignedToken(userID, tokenID string, action api.TokenAction, data string, duration time.Duration) (string, error) {
 
 	claims := TokenClaims{
 		Action: action,
+		Data:   data,
 		StandardClaims: jwt.StandardClaims{
 			Id:        tokenID,
 			IssuedAt:  time.Now().Unix(),
@@ -63,6 +65,12 @@ func (tc *TokenController) buildSignedToken(userID, tokenID string, action api.T
 }
 
 func (tc *TokenController) BuildToken(userID string, action api.TokenAction, duration time.Duration) (string, error) {
+	return tc.BuildTokenWithData(userID, action, "", duration)
+}
+
+// BuildTokenWithData builds an action token with data bound to the action
+// Token data is signed but not encrypted, so must not be secret
+func (tc *TokenController) BuildTokenWithData(userID string, action api.TokenAction, data string, duration time.Duration) (string, error) {
 
 	tokenID := uuid.NewV4().String()
 
@@ -71,7 +79,7 @@ func (tc *TokenController) BuildToken(userID string, action api.TokenAction, dur
 		return "", err
 	}
 
-	signedToken, err := tc.buildSignedToken(userID, tokenID, action, duration)
+	signedToken, err := tc.buildSignedToken(userID, tokenID, action, data, duration)
 	if err != nil {
 		return "", err
 	}
@@ -141,6 +149,26 @@ func (tc *TokenController) ValidateToken(userID, tokenString string) (*api.Token
 	return &claims.Action, nil
 }
 
+// GetTokenSubject fetches the user ID a signed token was issued for
+// This does not validate the token against the backing store, tokens must still be validated with ValidateToken
+func (tc *TokenController) GetTokenSubject(tokenString string) (string, error) {
+	claims, err := tc.parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// GetTokenData fetches the data bound to a signed token
+// This does not validate the token against the backing store, tokens must still be validated with ValidateToken
+func (tc *TokenController) GetTokenData(tokenString string) (string, error) {
+	claims, err := tc.parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.Data, nil
+}
+
 // SetUsed marks a token as used in the backing datastore
 func (tc *TokenController) SetUsed(tokenString string) error {
 	// Parse and validate
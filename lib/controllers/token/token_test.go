@@ -94,6 +94,19 @@ func TestTokenController(t *testing.T) {
 		assert.EqualValues(t, api.TokenActionActivate, *action)
 	})
 
+	t.Run("Binds data to tokens", func(t *testing.T) {
+		token, err := tc.BuildTokenWithData(fakeUserExtID, api.TokenActionEmailChange, "new@abc.com", time.Minute)
+		assert.Nil(t, err)
+
+		data, err := tc.GetTokenData(token)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "new@abc.com", data)
+
+		data, err = tc.GetTokenData(tokenString)
+		assert.Nil(t, err)
+		assert.EqualValues(t, "", data)
+	})
+
 	t.Run("Rejects invalid token signatures", func(t *testing.T) {
 		brokenToken := []byte(tokenString[0 : len(tokenString)-1])
 		brokenToken[len(brokenToken)-1] = brokenToken[len(brokenToken)-1] - 1
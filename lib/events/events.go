@@ -10,6 +10,8 @@ package events
 
 import (
 	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // EventType wraps strings for type safety
@@ -18,15 +20,46 @@ type EventType string
 const (
 	// Account Events
 
-	EventAccountCreated   string = "account_created"
-	EventAccountActivated string = "account_activated"
-	EventAccountLocked    string = "account_locked"
-	EventAccountUnlocked  string = "account_unlocked"
-	EventAccountEnabled   string = "account_enabled"
-	EventAccountDisabled  string = "account_disabled"
-	EventAccountDeleted   string = "account_deleted"
-	EventPasswordUpdate   string = "password_update"
-	EventPasswordResetReq string = "password_reset_request"
+	EventAccountCreated     string = "account_created"
+	EventAccountActivated   string = "account_activated"
+	EventAccountLocked      string = "account_locked"
+	EventAccountUnlocked    string = "account_unlocked"
+	EventAccountEnabled     string = "account_enabled"
+	EventAccountDisabled    string = "account_disabled"
+	EventAccountDeleted     string = "account_deleted"
+	EventAccountAdminGrant  string = "account_admin_granted"
+	EventAccountAdminRevoke string = "account_admin_revoked"
+	EventSessionsRevoked    string = "sessions_revoked"
+
+	EventAccountImpersonationStart string = "account_impersonation_started"
+	EventAccountImpersonationStop  string = "account_impersonation_stopped"
+
+	EventAccountDormant     string = "account_dormant"
+	EventAccountReactivated string = "account_reactivated"
+
+	EventInviteCreated string = "invite_created"
+	EventInviteRevoked string = "invite_revoked"
+
+	EventAccountDeletionCancelled string = "account_deletion_cancelled"
+	EventAccountPurged            string = "account_purged"
+
+	EventEmailChangeRequested string = "email_change_requested"
+	EventEmailChanged         string = "email_changed"
+	EventEmailChangeCancelled string = "email_change_cancelled"
+	EventEmailChangeReverted  string = "email_change_reverted"
+
+	EventUsernameChanged string = "username_changed"
+
+	EventPasswordUpdate         string = "password_update"
+	EventPasswordResetReq       string = "password_reset_request"
+	EventPasswordResetForce     string = "password_reset_forced"
+	EventPasswordExpiring       string = "password_expiring"
+	EventPasswordExpired        string = "password_expired"
+	EventPasswordChangeRequired string = "password_change_required"
+
+	// Admin Events
+
+	EventAdminAction string = "admin_action"
 
 	// 2FA Events
 
@@ -39,12 +72,19 @@ const (
 	Event2faBackupCodesAdded   string = "backup_code_added"
 	Event2faBackupCodesUsed    string = "backup_code_used"
 	Event2faBackupCodesRemoved string = "backup_code_removed"
+	Event2faEnrolmentReminder  string = "2fa_enrolment_reminder"
+	Event2faEnrolmentRequired  string = "2fa_enrolment_required"
+	Event2faDeviceRemembered   string = "2fa_device_remembered"
+	Event2faDeviceRevoked      string = "2fa_device_revoked"
 
 	// Login Events
 
 	EventAccountLoginSuccess   string = "login_success"
 	EventAccountLoginFailure   string = "login_failure"
 	EventAccountLoginNewDevice string = "login_new_device"
+	EventAccountAccessBlocked  string = "access_blocked"
+
+	EventAllowedNetworksUpdated string = "allowed_networks_updated"
 
 	// OAuth Events
 
@@ -52,6 +92,12 @@ const (
 	EventClientRemoved      string = "oauth_client_removed"
 	EventClientAuthorized   string = "oauth_client_authorized"
 	EventClientDeauthorized string = "oauth_client_deauthorized"
+
+	// Data Export Events
+
+	EventDataExportRequested string = "data_export_requested"
+	EventDataExportReady     string = "data_export_ready"
+	EventDataExportFailed    string = "data_export_failed"
 )
 
 // AuthPlzEvent event type for asynchronous communication
@@ -60,6 +106,7 @@ type AuthPlzEvent struct {
 	Time      time.Time
 	Type      string
 	Data      map[string]string
+	Request   *api.RequestContext
 }
 
 // GetType fetches the event type
@@ -74,12 +121,40 @@ func (e *AuthPlzEvent) GetTime() time.Time { return e.Time }
 // GetData fetches data associated with the event
 func (e *AuthPlzEvent) GetData() map[string]string { return e.Data }
 
+// GetRequest fetches the context of the request that caused the event, if any
+func (e *AuthPlzEvent) GetRequest() *api.RequestContext { return e.Request }
+
 // NewEvent Create a new AuthPlz event
 func NewEvent(userExtID, eventType string, data map[string]string) *AuthPlzEvent {
-	return &AuthPlzEvent{userExtID, time.Now(), eventType, data}
+	return &AuthPlzEvent{userExtID, time.Now(), eventType, data, nil}
 }
 
 // EventEmitter interface for event producers
 type EventEmitter interface {
 	SendEvent(interface{})
 }
+
+// RequestScoper interface for event producers that can be bound to a request
+// Events sent by the returned instance carry the context of the request
+type RequestScoper interface {
+	WithRequest(request *api.RequestContext) interface{}
+}
+
+// RequestEmitter wraps an EventEmitter to attach a request context to sent events
+type RequestEmitter struct {
+	emitter EventEmitter
+	request *api.RequestContext
+}
+
+// NewRequestEmitter creates an emitter attaching the provided request context to events
+func NewRequestEmitter(emitter EventEmitter, request *api.RequestContext) *RequestEmitter {
+	return &RequestEmitter{emitter, request}
+}
+
+// SendEvent attaches the request context to an event and passes it to the underlying emitter
+func (re *RequestEmitter) SendEvent(e interface{}) {
+	if event, ok := e.(*AuthPlzEvent); ok && event.Request == nil {
+		event.Request = re.request
+	}
+	re.emitter.SendEvent(e)
+}
@@ -0,0 +1,62 @@
+/*
+ * Identity canonicalization
+ * Normalizes user identifiers (email addresses and usernames) for comparison and storage
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package identity
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Identity errors
+var (
+	ErrorInvalidEmail    = errors.New("Identity: invalid email address")
+	ErrorInvalidUsername = errors.New("Identity: invalid username")
+)
+
+// fold applies NFKC normalization and Unicode case folding to a string
+// Normalization is re-applied after folding as folding may denormalize the string
+func fold(s string) string {
+	return norm.NFKC.String(cases.Fold().String(norm.NFKC.String(s)))
+}
+
+// CanonicalUsername returns the canonical form of a username
+// Usernames that differ only by case or Unicode representation share a canonical form
+func CanonicalUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", ErrorInvalidUsername
+	}
+
+	return fold(username), nil
+}
+
+// CanonicalEmail returns the canonical form of an email address
+// The local part is normalized and case folded, and the domain is converted to its
+// lower case ASCII (punycode) form so that internationalized domains compare equal
+func CanonicalEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	i := strings.LastIndex(email, "@")
+	if i <= 0 || i == len(email)-1 {
+		return "", ErrorInvalidEmail
+	}
+
+	local := fold(email[:i])
+
+	domain, err := idna.Lookup.ToASCII(email[i+1:])
+	if err != nil {
+		return "", ErrorInvalidEmail
+	}
+
+	return local + "@" + strings.ToLower(domain), nil
+}
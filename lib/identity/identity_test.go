@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+
+	t.Run("Canonicalizes email addresses", func(t *testing.T) {
+		tests := []struct {
+			in, out string
+		}{
+			{"bob@example.com", "bob@example.com"},
+			{"Bob@Example.COM", "bob@example.com"},
+			{"  bob@example.com ", "bob@example.com"},
+			{"ｂｏｂ@example.com", "bob@example.com"},
+			{"straße@example.com", "strasse@example.com"},
+			{"bob@bücher.example", "bob@xn--bcher-kva.example"},
+			{"bob@BÜCHER.example", "bob@xn--bcher-kva.example"},
+			{"bob@xn--bcher-kva.example", "bob@xn--bcher-kva.example"},
+		}
+
+		for _, test := range tests {
+			out, err := CanonicalEmail(test.in)
+			if err != nil {
+				t.Errorf("Error canonicalizing %s (%s)", test.in, err)
+				continue
+			}
+			if out != test.out {
+				t.Errorf("Expected %s for %s (received %s)", test.out, test.in, out)
+			}
+		}
+	})
+
+	t.Run("Rejects invalid email addresses", func(t *testing.T) {
+		for _, in := range []string{"", "bob", "@example.com", "bob@", "bob@exa mple.com"} {
+			if _, err := CanonicalEmail(in); err != ErrorInvalidEmail {
+				t.Errorf("Expected ErrorInvalidEmail for %s (received %v)", in, err)
+			}
+		}
+	})
+
+	t.Run("Canonicalizes usernames", func(t *testing.T) {
+		tests := []struct {
+			in, out string
+		}{
+			{"bob", "bob"},
+			{"Bob", "bob"},
+			{"ＢＯＢ", "bob"},
+			{"ǅemal", "džemal"},
+		}
+
+		for _, test := range tests {
+			out, err := CanonicalUsername(test.in)
+			if err != nil {
+				t.Errorf("Error canonicalizing %s (%s)", test.in, err)
+				continue
+			}
+			if out != test.out {
+				t.Errorf("Expected %s for %s (received %s)", test.out, test.in, out)
+			}
+		}
+
+		if _, err := CanonicalUsername(" "); err != ErrorInvalidUsername {
+			t.Errorf("Expected ErrorInvalidUsername (received %v)", err)
+		}
+	})
+}
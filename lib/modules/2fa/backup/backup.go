@@ -14,8 +14,8 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"time"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/events"
 
 	"github.com/NebulousLabs/entropy-mnemonics"
@@ -49,6 +49,14 @@ func NewController(issuerName string, backupStore Storer, emitter events.EventEm
 	}
 }
 
+// WithRequest creates a copy of the backup code controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (bc *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *bc
+	c.emitter = events.NewRequestEmitter(bc.emitter, request)
+	return &c
+}
+
 func cryptoBytes(size int) ([]byte, error) {
 	data := make([]byte, size)
 	n, err := rand.Read(data)
@@ -61,22 +69,7 @@ func cryptoBytes(size int) ([]byte, error) {
 	return data, nil
 }
 
-// BackupKey structure for API use
-type BackupKey struct {
-	// Mnemonic key name
-	Name string
-	// Mnemonic key code
-	Code string
-	// Key Hash
-	Hash string
-}
-
-// CodeResponse is the backup code response object returned when codes are created
-type CodeResponse struct {
-	Keys []BackupKey
-}
-
-func (bc *Controller) generateCode(len int) (*BackupKey, error) {
+func (bc *Controller) generateCode(len int) (*api.BackupKey, error) {
 	code, err := cryptoBytes(len)
 	if err != nil {
 		return nil, err
@@ -104,20 +97,15 @@ func (bc *Controller) generateCode(len int) (*BackupKey, error) {
 		return nil, err
 	}
 
-	key := BackupKey{mnemonicName.String(), mnemonicCode.String(), string(hash)}
+	key := api.BackupKey{Name: mnemonicName.String(), Code: mnemonicCode.String(), Hash: string(hash)}
 
 	return &key, nil
 }
 
-type CreateResponse struct {
-	Service string
-	Tokens  []BackupKey
-}
-
 // CreateCodes creates a set of backup codes for a user
 // TODO: should this erase existing codes?
-func (bc *Controller) CreateCodes(userid string) (*CreateResponse, error) {
-	keys := make([]BackupKey, numRecoveryKeys)
+func (bc *Controller) CreateCodes(userid string) (*api.BackupCodes, error) {
+	keys := make([]api.BackupKey, numRecoveryKeys)
 
 	// Generate backup keys
 	for i := range keys {
@@ -137,7 +125,7 @@ func (bc *Controller) CreateCodes(userid string) (*CreateResponse, error) {
 		}
 	}
 
-	resp := CreateResponse{bc.issuerName, keys}
+	resp := api.BackupCodes{Service: bc.issuerName, Tokens: keys}
 
 	data := make(map[string]string)
 	bc.emitter.SendEvent(events.NewEvent(userid, events.Event2faBackupCodesAdded, data))
@@ -246,15 +234,8 @@ func (bc *Controller) ValidateCode(userid string, codeString string) (bool, erro
 	return true, nil
 }
 
-type BackupCode struct {
-	Name      string
-	Used      bool
-	CreatedAt time.Time
-	UsedAt    time.Time
-}
-
 // ListCodes fetches a list of the available backup codes
-func (bc *Controller) ListCodes(userid string) ([]BackupCode, error) {
+func (bc *Controller) ListCodes(userid string) ([]api.BackupCode, error) {
 	// Fetch codes for a user
 	codes, err := bc.backupStore.GetBackupTokens(userid)
 	if err != nil {
@@ -262,10 +243,10 @@ func (bc *Controller) ListCodes(userid string) ([]BackupCode, error) {
 		return nil, errors.New("Backup Code Controller: internal error")
 	}
 
-	safeCodes := make([]BackupCode, len(codes))
+	safeCodes := make([]api.BackupCode, len(codes))
 	for i := range codes {
 		code := codes[i].(Code)
-		safeCodes[i] = BackupCode{
+		safeCodes[i] = api.BackupCode{
 			Name:      code.GetName(),
 			Used:      code.IsUsed(),
 			UsedAt:    code.GetUsedAt(),
@@ -33,7 +33,7 @@ type backupCodeAPICtx struct {
 // Helper middleware to bind module to API context
 func bindBackupCodeContext(backupCodeModule *Controller) func(ctx *backupCodeAPICtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	return func(ctx *backupCodeAPICtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-		ctx.backupCodeModule = backupCodeModule
+		ctx.backupCodeModule = backupCodeModule.WithRequest(ctx.GetRequestContext()).(*Controller)
 		next(rw, req)
 	}
 }
@@ -47,9 +47,22 @@ func (backupCodeModule *Controller) BindAPI(router *web.Router) {
 	backupCodeRouter.Middleware(bindBackupCodeContext(backupCodeModule))
 
 	// Bind endpoints
-	backupCodeRouter.Get("/create", (*backupCodeAPICtx).backupCodesCreate)
 	backupCodeRouter.Post("/authenticate", (*backupCodeAPICtx).backupCodeAuthenticatePost)
 	backupCodeRouter.Get("/codes", (*backupCodeAPICtx).backupCodeListTokens)
+
+	// Code creation requires a current sudo session
+	sudoRouter := router.Subrouter(backupCodeAPICtx{}, "/api/backupcode")
+	sudoRouter.Middleware(bindBackupCodeContext(backupCodeModule))
+	sudoRouter.Middleware((*backupCodeAPICtx).RequireSudoMiddleware)
+
+	sudoRouter.Get("/create", (*backupCodeAPICtx).backupCodesCreate)
+}
+
+// RequireSudoMiddleware requires logged in users to have re-authenticated prior to creating codes
+func (c *backupCodeAPICtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
 }
 
 // backupCodeEnrolGet creates a set of backup codes and returns them to the user
@@ -60,6 +73,12 @@ func (c *backupCodeAPICtx) backupCodesCreate(rw web.ResponseWriter, req *web.Req
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// TODO: check if codes already exist, then decide what to do
 
 	// Create new codes
@@ -104,7 +123,10 @@ func (c *backupCodeAPICtx) backupCodeAuthenticatePost(rw web.ResponseWriter, req
 	}
 
 	log.Printf("backupCodeAuthenticatePost: Valid authentication for account %s (action %s)\n", userid, action)
-	c.UserAction(userid, action, rw, req)
+	if err := c.UserAction(userid, action, rw, req); err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	rw.WriteHeader(http.StatusOK)
 }
 
@@ -14,6 +14,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
 	"github.com/ryankurte/authplz/lib/test"
@@ -55,7 +56,7 @@ func TestBackupModule(t *testing.T) {
 		assert.NotNil(t, code)
 	})
 
-	var tokens *CreateResponse
+	var tokens *api.BackupCodes
 
 	t.Run("Create backup tokens for user", func(t *testing.T) {
 		codes, err := bc.CreateCodes(user.GetExtID())
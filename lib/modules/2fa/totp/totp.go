@@ -9,9 +9,11 @@
 package totp
 
 import (
+	"errors"
 	"log"
 	"time"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/events"
 
 	"github.com/gocraft/web"
@@ -19,11 +21,18 @@ import (
 	"github.com/pquerna/otp/totp"
 )
 
+// TOTP controller errors
+var (
+	ErrorTokenNotFound    = errors.New("TOTP Controller: token not found")
+	ErrorLastSecondFactor = errors.New("TOTP Controller: the last second factor cannot be removed")
+)
+
 // Controller TOTP controller instance
 type Controller struct {
-	issuerName string
-	totpStore  Storer
-	emitter    events.EventEmitter
+	issuerName    string
+	totpStore     Storer
+	emitter       events.EventEmitter
+	removalPolicy RemovalPolicy
 }
 
 // NewController creates a new TOTP controller
@@ -38,10 +47,23 @@ func NewController(issuerName string, totpStore Storer, emitter events.EventEmit
 	}
 }
 
+// WithRequest creates a copy of the TOTP controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (totpModule *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *totpModule
+	c.emitter = events.NewRequestEmitter(totpModule.emitter, request)
+	return &c
+}
+
+// SetRemovalPolicy sets the policy used to check whether tokens can be removed
+func (totpModule *Controller) SetRemovalPolicy(policy RemovalPolicy) {
+	totpModule.removalPolicy = policy
+}
+
 // Helper middleware to bind module to API context
 func bindTOTPContext(totpModule *Controller) func(ctx *totpAPICtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	return func(ctx *totpAPICtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-		ctx.totpModule = totpModule
+		ctx.totpModule = totpModule.WithRequest(ctx.GetRequestContext()).(*Controller)
 		next(rw, req)
 	}
 }
@@ -56,10 +78,18 @@ func (totpModule *Controller) BindAPI(router *web.Router) {
 	totpRouter.Middleware(totpSessionMiddleware)
 
 	// Bind endpoints
-	totpRouter.Get("/enrol", (*totpAPICtx).TOTPEnrolGet)
-	totpRouter.Post("/enrol", (*totpAPICtx).TOTPEnrolPost)
 	totpRouter.Post("/authenticate", (*totpAPICtx).TOTPAuthenticatePost)
 	totpRouter.Get("/tokens", (*totpAPICtx).TOTPListTokens)
+
+	// Token enrolment and removal require a current sudo session
+	sudoRouter := router.Subrouter(totpAPICtx{}, "/api/totp")
+	sudoRouter.Middleware(bindTOTPContext(totpModule))
+	sudoRouter.Middleware(totpSessionMiddleware)
+	sudoRouter.Middleware((*totpAPICtx).RequireSudoMiddleware)
+
+	sudoRouter.Get("/enrol", (*totpAPICtx).TOTPEnrolGet)
+	sudoRouter.Post("/enrol", (*totpAPICtx).TOTPEnrolPost)
+	sudoRouter.Delete("/tokens", (*totpAPICtx).TOTPRemoveToken)
 }
 
 // IsSupported Checks whether totp is supported for a given user by userid
@@ -164,13 +194,6 @@ func (totpModule *Controller) ValidateToken(userid string, token string) (bool,
 	return true, nil
 }
 
-// TokenResp is a sanatised token instance to return from the controller
-type TokenResp struct {
-	Name       string
-	LastUsed   time.Time
-	UsageCount uint
-}
-
 // ListTokens lists tokens for a given user
 func (totpModule *Controller) ListTokens(userid string) ([]interface{}, error) {
 	// Fetch tokens from database
@@ -185,7 +208,7 @@ func (totpModule *Controller) ListTokens(userid string) ([]interface{}, error) {
 	cleanTokens := make([]interface{}, len(tokens))
 	for i, t := range tokens {
 		ti := t.(TokenInterface)
-		cleanTokens[i] = &TokenResp{
+		cleanTokens[i] = &api.TOTPToken{
 			Name:       ti.GetName(),
 			LastUsed:   ti.GetLastUsed(),
 			UsageCount: ti.GetCounter(),
@@ -196,3 +219,50 @@ func (totpModule *Controller) ListTokens(userid string) ([]interface{}, error) {
 
 	return cleanTokens, nil
 }
+
+// RemoveToken removes a named token from a given user
+// The removal policy may prevent a users last second factor from being removed
+func (totpModule *Controller) RemoveToken(userid, tokenName string) error {
+	tokens, err := totpModule.totpStore.GetTotpTokens(userid)
+	if err != nil {
+		log.Printf("TOTPModule.RemoveToken: error fetching TOTP tokens (%s)", err)
+		return err
+	}
+
+	var token interface{}
+	for _, t := range tokens {
+		if t.(TokenInterface).GetName() == tokenName {
+			token = t
+			break
+		}
+	}
+	if token == nil {
+		return ErrorTokenNotFound
+	}
+
+	// Check the removal policy once the token is known to exist
+	if totpModule.removalPolicy != nil {
+		ok, err := totpModule.removalPolicy.SecondFactorRemovable(userid)
+		if err != nil {
+			log.Printf("TOTPModule.RemoveToken: error checking removal policy (%s)", err)
+			return err
+		}
+		if !ok {
+			return ErrorLastSecondFactor
+		}
+	}
+
+	err = totpModule.totpStore.RemoveTotpToken(token)
+	if err != nil {
+		log.Printf("TOTPModule.RemoveToken: error removing token (%s)", err)
+		return err
+	}
+
+	log.Printf("TOTPModule.RemoveToken: removed token for user %s", userid)
+
+	data := make(map[string]string)
+	data["Token Name"] = tokenName
+	totpModule.emitter.SendEvent(events.NewEvent(userid, events.Event2faTotpRemoved, data))
+
+	return nil
+}
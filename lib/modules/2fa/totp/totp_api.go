@@ -67,24 +67,33 @@ func totpSessionMiddleware(ctx *totpAPICtx, rw web.ResponseWriter, req *web.Requ
 	next(rw, req)
 }
 
-// RegisterChallenge is a TOTP registration challenge
-type RegisterChallenge struct {
-	AccountName string
-	Issuer      string
-	TokenName   string
-	URL         string
-	Image       string
-	Secret      string
+// RequireSudoMiddleware requires logged in users to have re-authenticated prior to altering tokens
+// Users with a second factor enrolment session may enrol tokens without re-authenticating
+func (c *totpAPICtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
 }
 
 // TOTPEnrolGet Fetches a challenge for TOTP enrolment and saves this to the totp session storage
+// This is also available to users with a second factor enrolment session (where enrolment is required prior to login)
 func (c *totpAPICtx) TOTPEnrolGet(rw web.ResponseWriter, req *web.Request) {
-	// Check if user is logged in
-	if c.GetUserID() == "" {
+	// Check if user is logged in or must enrol a second factor
+	userID := c.GetUserID()
+	if userID == "" {
+		userID = c.GetSecondFactorEnrolmentRequest(rw, req)
+	}
+	if userID == "" {
 		rw.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Fetch a name for the token
 	tokenName := req.URL.Query().Get("name")
 	if tokenName == "" {
@@ -93,7 +102,7 @@ func (c *totpAPICtx) TOTPEnrolGet(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	// Generate a token
-	token, err := c.totpModule.CreateToken(c.GetUserID())
+	token, err := c.totpModule.CreateToken(userID)
 	if err != nil {
 		log.Printf("TOTPEnrolGet: error creating token (%s)", err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -114,7 +123,14 @@ func (c *totpAPICtx) TOTPEnrolGet(rw web.ResponseWriter, req *web.Request) {
 	b64Image := base64.StdEncoding.EncodeToString(buf.Bytes())
 
 	// Create response structure
-	resp := RegisterChallenge{token.AccountName(), token.Issuer(), tokenName, token.String(), b64Image, token.Secret()}
+	resp := api.TOTPRegisterChallenge{
+		AccountName: token.AccountName(),
+		Issuer:      token.Issuer(),
+		TokenName:   tokenName,
+		URL:         token.String(),
+		Image:       b64Image,
+		Secret:      token.Secret(),
+	}
 
 	// Save token to session
 	c.totpSession.Values[totpRegisterTokenKey] = token.String()
@@ -130,13 +146,26 @@ func (c *totpAPICtx) TOTPEnrolGet(rw web.ResponseWriter, req *web.Request) {
 }
 
 // TOTPEnrolPost checks a totp code against the session stored TOTP token and enrols the token on success
+// Users with a second factor enrolment session must then log in using the enrolled token
 func (c *totpAPICtx) TOTPEnrolPost(rw web.ResponseWriter, req *web.Request) {
-	// Check if user is logged in
-	if c.GetUserID() == "" {
+	// Check if user is logged in or must enrol a second factor
+	userID := c.GetUserID()
+	enrolment := false
+	if userID == "" {
+		userID = c.GetSecondFactorEnrolmentRequest(rw, req)
+		enrolment = true
+	}
+	if userID == "" {
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().Unauthorized)
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Fetch session variables
 	if c.totpSession.Values[totpRegisterTokenKey] == nil {
 		log.Printf("TOTPEnrolPost: missing session variables (%s)", totpRegisterTokenKey)
@@ -158,7 +187,7 @@ func (c *totpAPICtx) TOTPEnrolPost(rw web.ResponseWriter, req *web.Request) {
 	req.ParseForm()
 	code := req.FormValue("code")
 
-	valid, err := c.totpModule.ValidateRegistration(c.GetUserID(), keyName, token.Secret(), code)
+	valid, err := c.totpModule.ValidateRegistration(userID, keyName, token.Secret(), code)
 	if err != nil {
 		log.Printf("TOTPEnrolPost: error validating token registration (%s)", err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -171,7 +200,14 @@ func (c *totpAPICtx) TOTPEnrolPost(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
-	log.Printf("TOTPEnrolPost: enrolled token for user %s", c.GetUserID())
+	log.Printf("TOTPEnrolPost: enrolled token for user %s", userID)
+
+	if enrolment {
+		c.ClearSecondFactorEnrolmentRequest(rw, req)
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SecondFactorEnrolled)
+		return
+	}
+
 	rw.WriteHeader(http.StatusOK)
 }
 
@@ -204,7 +240,10 @@ func (c *totpAPICtx) TOTPAuthenticatePost(rw web.ResponseWriter, req *web.Reques
 	}
 
 	log.Printf("TOTPAuthenticatePost: Valid authentication for account %s (action %s)\n", userid, action)
-	c.UserAction(userid, action, rw, req)
+	if err := c.UserAction(userid, action, rw, req); err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	rw.WriteHeader(http.StatusOK)
 }
 
@@ -227,6 +266,36 @@ func (c *totpAPICtx) TOTPListTokens(rw web.ResponseWriter, req *web.Request) {
 	c.WriteJson(rw, tokens)
 }
 
+// TOTPRemoveToken removes a named totp token from the logged in user
 func (c *totpAPICtx) TOTPRemoveToken(rw web.ResponseWriter, req *web.Request) {
-	rw.WriteHeader(http.StatusNotImplemented)
+	// Check if user is logged in
+	if c.GetUserID() == "" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	tokenName := req.URL.Query().Get("name")
+	if tokenName == "" {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().TokenNameRequired)
+		return
+	}
+
+	err := c.totpModule.RemoveToken(c.GetUserID(), tokenName)
+	switch err {
+	case nil:
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SecondFactorRemoved)
+	case ErrorTokenNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().SecondFactorNotFound)
+	case ErrorLastSecondFactor:
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().LastSecondFactor)
+	default:
+		log.Printf("TOTPRemoveToken: error removing token (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+	}
 }
@@ -40,6 +40,14 @@ type Storer interface {
 	GetTotpTokens(userid string) ([]interface{}, error)
 	// Update a provided fido token
 	UpdateTotpToken(token interface{}) (interface{}, error)
+	// Remove a provided totp token
+	RemoveTotpToken(token interface{}) error
+}
+
+// RemovalPolicy checks whether a user may remove a second factor
+// This allows the last second factor to be retained where second factors are required
+type RemovalPolicy interface {
+	SecondFactorRemovable(userid string) (bool, error)
 }
 
 // CompletedHandler Callback for 2fa signature completion
@@ -12,6 +12,16 @@ import (
 	totp "github.com/pquerna/otp/totp"
 )
 
+type mockRemovalPolicy struct {
+	removable bool
+	checked   bool
+}
+
+func (m *mockRemovalPolicy) SecondFactorRemovable(userid string) (bool, error) {
+	m.checked = true
+	return m.removable, nil
+}
+
 func TestU2FModule(t *testing.T) {
 	var fakeEmail = "test@abc.com"
 	var fakePass = "abcDEF123@abcDEF123@"
@@ -102,4 +112,27 @@ func TestU2FModule(t *testing.T) {
 		}
 	})
 
+	t.Run("Remove tokens", func(t *testing.T) {
+		policy := mockRemovalPolicy{}
+		totpModule.SetRemovalPolicy(&policy)
+		defer totpModule.SetRemovalPolicy(nil)
+
+		// Missing tokens are reported without checking the removal policy
+		if err := totpModule.RemoveToken(user.GetExtID(), "missing token"); err != ErrorTokenNotFound {
+			t.Errorf("Expected ErrorTokenNotFound (received %v)", err)
+		}
+		if policy.checked {
+			t.Errorf("Unexpected removal policy check")
+		}
+
+		if err := totpModule.RemoveToken(user.GetExtID(), "test token"); err != ErrorLastSecondFactor {
+			t.Errorf("Expected ErrorLastSecondFactor (received %v)", err)
+		}
+
+		policy.removable = true
+		if err := totpModule.RemoveToken(user.GetExtID(), "test token"); err != nil {
+			t.Error(err)
+		}
+	})
+
 }
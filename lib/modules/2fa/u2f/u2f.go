@@ -10,19 +10,28 @@
 package u2f
 
 import (
+	"errors"
 	"log"
 	"time"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/events"
 
 	u2f "github.com/ryankurte/go-u2f"
 )
 
+// U2F controller errors
+var (
+	ErrorTokenNotFound    = errors.New("U2F Controller: token not found")
+	ErrorLastSecondFactor = errors.New("U2F Controller: the last second factor cannot be removed")
+)
+
 // Controller U2F controller instance storage
 type Controller struct {
-	url      string
-	u2fStore Storer
-	emitter  events.EventEmitter
+	url           string
+	u2fStore      Storer
+	emitter       events.EventEmitter
+	removalPolicy RemovalPolicy
 }
 
 // NewController creates a new U2F controller
@@ -37,6 +46,19 @@ func NewController(url string, u2fStore Storer, emitter events.EventEmitter) *Co
 	}
 }
 
+// WithRequest creates a copy of the U2F controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (u2fModule *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *u2fModule
+	c.emitter = events.NewRequestEmitter(u2fModule.emitter, request)
+	return &c
+}
+
+// SetRemovalPolicy sets the policy used to check whether tokens can be removed
+func (u2fModule *Controller) SetRemovalPolicy(policy RemovalPolicy) {
+	u2fModule.removalPolicy = policy
+}
+
 // IsSupported Checks whether u2f is supported for a given user by userid
 // This is required to implement the generic 2fa interface for binding into the core module.
 func (u2fModule *Controller) IsSupported(userid string) bool {
@@ -173,9 +195,50 @@ func (u2fModule *Controller) UpdateToken() {
 
 }
 
-// RemoveToken Removes a token instance
-func (u2fModule *Controller) RemoveToken() {
+// RemoveToken removes a named token from a given user
+// The removal policy may prevent a users last second factor from being removed
+func (u2fModule *Controller) RemoveToken(userid, tokenName string) error {
+	tokens, err := u2fModule.ListTokens(userid)
+	if err != nil {
+		return err
+	}
+
+	var token interface{}
+	for _, t := range tokens {
+		if t.(TokenInterface).GetName() == tokenName {
+			token = t
+			break
+		}
+	}
+	if token == nil {
+		return ErrorTokenNotFound
+	}
+
+	// Check the removal policy once the token is known to exist
+	if u2fModule.removalPolicy != nil {
+		ok, err := u2fModule.removalPolicy.SecondFactorRemovable(userid)
+		if err != nil {
+			log.Printf("U2FModule.RemoveToken: error checking removal policy (%s)", err)
+			return err
+		}
+		if !ok {
+			return ErrorLastSecondFactor
+		}
+	}
+
+	err = u2fModule.u2fStore.RemoveFidoToken(token)
+	if err != nil {
+		log.Printf("U2FModule.RemoveToken: error removing token (%s)", err)
+		return err
+	}
+
+	log.Printf("U2FModule.RemoveToken: removed token for user %s", userid)
 
+	data := make(map[string]string)
+	data["Token Name"] = tokenName
+	u2fModule.emitter.SendEvent(events.NewEvent(userid, events.Event2faU2FRemoved, data))
+
+	return nil
 }
 
 // ListTokens lists tokens for a given user
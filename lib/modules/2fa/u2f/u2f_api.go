@@ -52,7 +52,7 @@ func init() {
 // BindU2FContext Helper middleware to bind module to API context
 func BindU2FContext(u2fModule *Controller) func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	return func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-		ctx.um = u2fModule
+		ctx.um = u2fModule.WithRequest(ctx.GetRequestContext()).(*Controller)
 		next(rw, req)
 	}
 }
@@ -66,22 +66,48 @@ func (u2fModule *Controller) BindAPI(router *web.Router) {
 	u2frouter.Middleware(BindU2FContext(u2fModule))
 
 	// Bind endpoints
-	u2frouter.Get("/enrol", (*apiCtx).U2FEnrolGet)
-	u2frouter.Post("/enrol", (*apiCtx).U2FEnrolPost)
 	u2frouter.Get("/authenticate", (*apiCtx).U2FAuthenticateGet)
 	u2frouter.Post("/authenticate", (*apiCtx).U2FAuthenticatePost)
 	u2frouter.Get("/tokens", (*apiCtx).U2FTokensGet)
+
+	// Token enrolment and removal require a current sudo session
+	sudoRouter := router.Subrouter(apiCtx{}, "/api/u2f")
+	sudoRouter.Middleware(BindU2FContext(u2fModule))
+	sudoRouter.Middleware((*apiCtx).RequireSudoMiddleware)
+
+	sudoRouter.Get("/enrol", (*apiCtx).U2FEnrolGet)
+	sudoRouter.Post("/enrol", (*apiCtx).U2FEnrolPost)
+	sudoRouter.Delete("/tokens", (*apiCtx).U2FTokenDelete)
+}
+
+// RequireSudoMiddleware requires logged in users to have re-authenticated prior to altering tokens
+// Users with a second factor enrolment session may enrol tokens without re-authenticating
+func (c *apiCtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
 }
 
 // U2FEnrolGet First stage token enrolment (get) handler
 // This creates and caches a challenge for a device to be registered
+// This is also available to users with a second factor enrolment session (where enrolment is required prior to login)
 func (c *apiCtx) U2FEnrolGet(rw web.ResponseWriter, req *web.Request) {
-	// Check if user is logged in
-	if c.GetUserID() == "" {
+	// Check if user is logged in or must enrol a second factor
+	userID := c.GetUserID()
+	if userID == "" {
+		userID = c.GetSecondFactorEnrolmentRequest(rw, req)
+	}
+	if userID == "" {
 		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	tokenName := req.URL.Query().Get("name")
 	if tokenName == "" {
 		rw.WriteHeader(http.StatusBadRequest)
@@ -90,7 +116,7 @@ func (c *apiCtx) U2FEnrolGet(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	// Build U2F challenge
-	challenge, err := c.um.GetChallenge(c.GetUserID())
+	challenge, err := c.um.GetChallenge(userID)
 	if err != nil {
 		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
 		return
@@ -110,14 +136,27 @@ func (c *apiCtx) U2FEnrolGet(rw web.ResponseWriter, req *web.Request) {
 
 // U2FEnrolPost Second stage token enrolment (post) handler
 // This checks the cached challenge and completes device enrolment
+// Users with a second factor enrolment session must then log in using the enrolled device
 func (c *apiCtx) U2FEnrolPost(rw web.ResponseWriter, req *web.Request) {
 
-	// Check if user is logged in
-	if c.GetUserID() == "" {
+	// Check if user is logged in or must enrol a second factor
+	userID := c.GetUserID()
+	enrolment := false
+	if userID == "" {
+		userID = c.GetSecondFactorEnrolmentRequest(rw, req)
+		enrolment = true
+	}
+	if userID == "" {
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().Unauthorized)
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Fetch request from session vars
 	// TODO: move this to a separate session flash
 	if c.GetSession().Values[u2fRegisterChallengeKey] == nil {
@@ -140,18 +179,25 @@ func (c *apiCtx) U2FEnrolPost(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	// Validate registration
-	ok, err := c.um.ValidateRegistration(c.GetUserID(), keyName, challenge, &registerResp)
+	ok, err := c.um.ValidateRegistration(userID, keyName, challenge, &registerResp)
 	if err != nil {
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().InternalError)
 		return
 	}
 	if !ok {
-		log.Printf("U2F enrolment failed for user %s\n", c.GetUserID())
+		log.Printf("U2F enrolment failed for user %s\n", userID)
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().U2FRegistrationFailed)
 		return
 	}
 
-	log.Printf("Enrolled U2F token for account %s\n", c.GetUserID())
+	log.Printf("Enrolled U2F token for account %s\n", userID)
+
+	if enrolment {
+		c.ClearSecondFactorEnrolmentRequest(rw, req)
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SecondFactorEnrolled)
+		return
+	}
+
 	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().U2FRegistrationComplete)
 	return
 }
@@ -246,7 +292,10 @@ func (c *apiCtx) U2FAuthenticatePost(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	log.Printf("U2FAuthenticatePost: Valid authentication for account %s (action %s)\n", userid, action)
-	c.UserAction(userid, action, rw, req)
+	if err := c.UserAction(userid, action, rw, req); err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
 	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().LoginSuccessful)
 }
 
@@ -267,6 +316,53 @@ func (c *apiCtx) U2FTokensGet(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	// Map to API safe token objects
+	safeTokens := make([]api.U2FToken, len(tokens))
+	for i, v := range tokens {
+		t := v.(TokenInterface)
+		safeTokens[i] = api.U2FToken{
+			Name:      t.GetName(),
+			KeyHandle: t.GetKeyHandle(),
+			Counter:   t.GetCounter(),
+			LastUsed:  t.GetLastUsed(),
+		}
+	}
+
 	// Write tokens out
-	c.WriteJson(rw, tokens)
+	c.WriteJson(rw, safeTokens)
+}
+
+// U2FTokenDelete removes a named u2f token from the logged in user
+func (c *apiCtx) U2FTokenDelete(rw web.ResponseWriter, req *web.Request) {
+
+	// Check if user is logged in
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	tokenName := req.URL.Query().Get("name")
+	if tokenName == "" {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().TokenNameRequired)
+		return
+	}
+
+	err := c.um.RemoveToken(c.GetUserID(), tokenName)
+	switch err {
+	case nil:
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SecondFactorRemoved)
+	case ErrorTokenNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().SecondFactorNotFound)
+	case ErrorLastSecondFactor:
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().LastSecondFactor)
+	default:
+		log.Printf("U2FTokenDelete: error removing token (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+	}
 }
@@ -36,6 +36,14 @@ type Storer interface {
 	GetFidoTokens(userid string) ([]interface{}, error)
 	// Update a provided fido token
 	UpdateFidoToken(token interface{}) (interface{}, error)
+	// Remove a provided fido token
+	RemoveFidoToken(token interface{}) error
+}
+
+// RemovalPolicy checks whether a user may remove a second factor
+// This allows the last second factor to be retained where second factors are required
+type RemovalPolicy interface {
+	SecondFactorRemovable(userid string) (bool, error)
 }
 
 // CompletedHandler Callback for 2fa signature completion
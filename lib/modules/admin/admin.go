@@ -0,0 +1,445 @@
+/*
+ * Admin Module
+ * Provides administrator user account management
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/appcontext"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// Admin control errors
+var (
+	ErrorUserNotFound = errors.New("Admin Controller: user not found")
+	ErrorFindingUser  = errors.New("Admin Controller: error fetching user")
+	ErrorUpdatingUser = errors.New("Admin Controller: error updating user")
+	ErrorDeletingUser = errors.New("Admin Controller: error deleting user")
+	ErrorSelfAction   = errors.New("Admin Controller: action not permitted on own account")
+	ErrorUserDisabled = errors.New("Admin Controller: user account is disabled")
+	ErrorInternal     = errors.New("Admin Controller: internal error")
+
+	ErrorInvalidNetworks = errors.New("Admin Controller: invalid allowed networks")
+)
+
+// Default and maximum number of users returned by a search
+const (
+	defaultSearchCount uint = 20
+	maximumSearchCount uint = 100
+)
+
+// Number of random bytes used to invalidate passwords on forced reset
+const resetPasswordBytes = 32
+
+// Admin actions, recorded in admin audit events
+const (
+	ActionSearchUsers           = "search_users"
+	ActionViewUser              = "view_user"
+	ActionViewFactors           = "view_second_factors"
+	ActionViewClients           = "view_oauth_clients"
+	ActionEnable                = "enable"
+	ActionDisable               = "disable"
+	ActionLock                  = "lock"
+	ActionUnlock                = "unlock"
+	ActionResetPassword         = "reset_password"
+	ActionRequirePasswordChange = "require_password_change"
+	ActionRevokeSessions        = "revoke_sessions"
+	ActionGrantAdmin            = "grant_admin"
+	ActionRevokeAdmin           = "revoke_admin"
+	ActionDelete                = "delete"
+	ActionSetAllowedNetworks    = "set_allowed_networks"
+)
+
+// Controller Admin module controller
+type Controller struct {
+	store   Storer
+	oauth   OAuthManager
+	emitter events.EventEmitter
+}
+
+// NewController Creates a new admin controller
+func NewController(store Storer, oauth OAuthManager, emitter events.EventEmitter) *Controller {
+	return &Controller{store, oauth, emitter}
+}
+
+// WithRequest creates a copy of the admin controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (ac *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *ac
+	c.emitter = events.NewRequestEmitter(ac.emitter, request)
+	return &c
+}
+
+// IsAdmin checks whether the provided user is an administrator
+func (ac *Controller) IsAdmin(userid string) (bool, error) {
+	u, err := ac.fetchUser(userid)
+	if err == ErrorUserNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return u.IsAdmin(), nil
+}
+
+// SearchUsers finds user accounts with an email, username or ID containing the provided query
+func (ac *Controller) SearchUsers(adminID, query string, count, offset uint) (*api.AdminUserList, error) {
+	if count == 0 {
+		count = defaultSearchCount
+	}
+	if count > maximumSearchCount {
+		count = maximumSearchCount
+	}
+
+	users, err := ac.store.SearchUsers(query, offset, count)
+	if err != nil {
+		log.Printf("AdminModule.SearchUsers: error searching users (%s)", err)
+		return nil, ErrorFindingUser
+	}
+
+	resp := api.AdminUserList{
+		Paginate: api.Paginate{Count: count, Offset: offset},
+		Users:    make([]api.AdminUserResp, len(users)),
+	}
+	for i, u := range users {
+		resp.Users[i] = NewUserResp(u.(User))
+	}
+
+	ac.audit(adminID, ActionSearchUsers, "", map[string]string{"Query": query})
+
+	return &resp, nil
+}
+
+// GetUser fetches a user account
+func (ac *Controller) GetUser(adminID, userid string) (*api.AdminUserResp, error) {
+	u, err := ac.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := NewUserResp(u)
+
+	ac.audit(adminID, ActionViewUser, userid, nil)
+
+	return &resp, nil
+}
+
+// GetSecondFactors fetches the second factors registered to a user account
+func (ac *Controller) GetSecondFactors(adminID, userid string) (*api.AdminSecondFactors, error) {
+	if _, err := ac.fetchUser(userid); err != nil {
+		return nil, err
+	}
+
+	totpTokens, err := ac.store.GetTotpTokens(userid)
+	if err != nil {
+		log.Printf("AdminModule.GetSecondFactors: error fetching TOTP tokens (%s)", err)
+		return nil, ErrorInternal
+	}
+	fidoTokens, err := ac.store.GetFidoTokens(userid)
+	if err != nil {
+		log.Printf("AdminModule.GetSecondFactors: error fetching U2F tokens (%s)", err)
+		return nil, ErrorInternal
+	}
+	backupCodes, err := ac.store.GetBackupTokens(userid)
+	if err != nil {
+		log.Printf("AdminModule.GetSecondFactors: error fetching backup codes (%s)", err)
+		return nil, ErrorInternal
+	}
+
+	// Map to API safe objects
+	factors := api.AdminSecondFactors{
+		TOTP:   make([]api.TOTPToken, len(totpTokens)),
+		U2F:    make([]api.U2FToken, len(fidoTokens)),
+		Backup: make([]api.BackupCode, len(backupCodes)),
+	}
+	for i, v := range totpTokens {
+		t := v.(TOTPToken)
+		factors.TOTP[i] = api.TOTPToken{Name: t.GetName(), LastUsed: t.GetLastUsed(), UsageCount: t.GetCounter()}
+	}
+	for i, v := range fidoTokens {
+		t := v.(U2FToken)
+		factors.U2F[i] = api.U2FToken{Name: t.GetName(), KeyHandle: t.GetKeyHandle(), Counter: t.GetCounter(), LastUsed: t.GetLastUsed()}
+	}
+	for i, v := range backupCodes {
+		c := v.(BackupCode)
+		factors.Backup[i] = api.BackupCode{Name: c.GetName(), Used: c.IsUsed(), CreatedAt: c.GetCreatedAt(), UsedAt: c.GetUsedAt()}
+	}
+
+	ac.audit(adminID, ActionViewFactors, userid, nil)
+
+	return &factors, nil
+}
+
+// GetOAuthClients fetches the OAuth clients owned by a user account
+func (ac *Controller) GetOAuthClients(adminID, userid string) ([]api.OAuthClientResp, error) {
+	if _, err := ac.fetchUser(userid); err != nil {
+		return nil, err
+	}
+
+	clients, err := ac.oauth.GetClients(userid)
+	if err != nil {
+		log.Printf("AdminModule.GetOAuthClients: error fetching clients (%s)", err)
+		return nil, ErrorInternal
+	}
+
+	ac.audit(adminID, ActionViewClients, userid, nil)
+
+	return clients, nil
+}
+
+// SetEnabled enables or disables a user account
+// Disabling an account also invalidates existing sessions
+func (ac *Controller) SetEnabled(adminID, userid string, enabled bool) error {
+	action, eventType := ActionDisable, events.EventAccountDisabled
+	if enabled {
+		action, eventType = ActionEnable, events.EventAccountEnabled
+	}
+
+	return ac.updateUser(adminID, userid, action, eventType, !enabled, func(u User) {
+		u.SetEnabled(enabled)
+	})
+}
+
+// SetLocked locks or unlocks a user account
+func (ac *Controller) SetLocked(adminID, userid string, locked bool) error {
+	action, eventType := ActionUnlock, events.EventAccountUnlocked
+	if locked {
+		action, eventType = ActionLock, events.EventAccountLocked
+	}
+
+	return ac.updateUser(adminID, userid, action, eventType, locked, func(u User) {
+		u.SetLocked(locked)
+		if !locked {
+			u.ClearLoginRetries()
+		}
+	})
+}
+
+// SetAdmin grants or revokes administrator rights for a user account
+func (ac *Controller) SetAdmin(adminID, userid string, admin bool) error {
+	action, eventType := ActionRevokeAdmin, events.EventAccountAdminRevoke
+	if admin {
+		action, eventType = ActionGrantAdmin, events.EventAccountAdminGrant
+	}
+
+	return ac.updateUser(adminID, userid, action, eventType, !admin, func(u User) {
+		u.SetAdmin(admin)
+	})
+}
+
+// ForcePasswordReset invalidates the current password for a user account and revokes existing sessions
+// The user must then use account recovery to set a new password
+func (ac *Controller) ForcePasswordReset(adminID, userid string) error {
+	data := make([]byte, resetPasswordBytes)
+	if _, err := rand.Read(data); err != nil {
+		log.Printf("AdminModule.ForcePasswordReset: error generating password (%s)", err)
+		return ErrorInternal
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(base64.URLEncoding.EncodeToString(data)), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("AdminModule.ForcePasswordReset: error hashing password (%s)", err)
+		return ErrorInternal
+	}
+
+	return ac.updateUser(adminID, userid, ActionResetPassword, events.EventPasswordResetForce, true, func(u User) {
+		u.SetPassword(string(hash))
+	})
+}
+
+// RequirePasswordChange requires a user to change their password at next login and revokes existing sessions
+func (ac *Controller) RequirePasswordChange(adminID, userid string) error {
+	return ac.updateUser(adminID, userid, ActionRequirePasswordChange, events.EventPasswordChangeRequired, true, func(u User) {
+		u.SetPasswordChangeRequired(true)
+	})
+}
+
+// RevokeSessions invalidates all login sessions and OAuth tokens for a user account
+func (ac *Controller) RevokeSessions(adminID, userid string) error {
+	return ac.updateUser(adminID, userid, ActionRevokeSessions, events.EventSessionsRevoked, true, func(u User) {})
+}
+
+// SetAllowedNetworks sets the networks a user account may log in from, an empty list removes the restriction
+// Unlike user changes this does not require the current address be included, allowing recovery from lockouts
+func (ac *Controller) SetAllowedNetworks(adminID, userid string, networks []string) error {
+	parsed, err := appcontext.ParseNetworks(networks)
+	if err != nil {
+		return ErrorInvalidNetworks
+	}
+
+	normalised := make([]string, len(parsed))
+	for i, n := range parsed {
+		normalised[i] = n.String()
+	}
+
+	return ac.updateUser(adminID, userid, ActionSetAllowedNetworks, events.EventAllowedNetworksUpdated, false, func(u User) {
+		u.SetAllowedNetworks(normalised)
+	})
+}
+
+// DeleteUser deletes a user account
+// Sessions and credentials are removed immediately, with the account purged after the deletion grace period
+func (ac *Controller) DeleteUser(adminID, userid string) error {
+	if adminID == userid {
+		return ErrorSelfAction
+	}
+
+	u, err := ac.fetchUser(userid)
+	if err != nil {
+		return err
+	}
+
+	if err := ac.store.SoftDeleteUser(u); err != nil {
+		log.Printf("AdminModule.DeleteUser: error deleting user %s (%s)", userid, err)
+		return ErrorDeletingUser
+	}
+
+	// Emit event on the target account
+	data := map[string]string{"Admin": adminID, "Email": u.GetEmail(), "Username": u.GetUsername()}
+	ac.emitter.SendEvent(events.NewEvent(userid, events.EventAccountDeleted, data))
+
+	ac.audit(adminID, ActionDelete, userid, nil)
+
+	log.Printf("AdminModule.DeleteUser: admin %s deleted user %s", adminID, userid)
+
+	return nil
+}
+
+// StartImpersonation checks an administrator can impersonate the provided user and records the start of impersonation
+// The impersonation session itself is managed by the caller
+func (ac *Controller) StartImpersonation(adminID, userid string) error {
+	if adminID == userid {
+		return ErrorSelfAction
+	}
+
+	u, err := ac.fetchUser(userid)
+	if err != nil {
+		return err
+	}
+	if !u.IsEnabled() {
+		return ErrorUserDisabled
+	}
+
+	ac.emitImpersonationEvents(adminID, userid, events.EventAccountImpersonationStart)
+
+	log.Printf("AdminModule.StartImpersonation: admin %s started impersonating user %s", adminID, userid)
+
+	return nil
+}
+
+// StopImpersonation records the end of an impersonation session
+func (ac *Controller) StopImpersonation(adminID, userid string) {
+	ac.emitImpersonationEvents(adminID, userid, events.EventAccountImpersonationStop)
+
+	log.Printf("AdminModule.StopImpersonation: admin %s stopped impersonating user %s", adminID, userid)
+}
+
+// emitImpersonationEvents emits impersonation events on both the administrator and target accounts
+func (ac *Controller) emitImpersonationEvents(adminID, userid, eventType string) {
+	ac.emitter.SendEvent(events.NewEvent(userid, eventType, map[string]string{"Admin": adminID}))
+	ac.emitter.SendEvent(events.NewEvent(adminID, eventType, map[string]string{"User": userid}))
+}
+
+// updateUser applies an administrative change to a user account
+// Where revoke is set existing sessions and OAuth tokens for the account are revoked, and
+// the change cannot be applied by administrators to their own account
+func (ac *Controller) updateUser(adminID, userid, action, eventType string, revoke bool, update func(u User)) error {
+	// Block administrators from locking themselves out
+	if adminID == userid && revoke {
+		return ErrorSelfAction
+	}
+
+	u, err := ac.fetchUser(userid)
+	if err != nil {
+		return err
+	}
+
+	update(u)
+	if revoke {
+		u.SetSessionsRevoked(time.Now())
+	}
+
+	if _, err := ac.store.UpdateUser(u); err != nil {
+		log.Printf("AdminModule.updateUser: error updating user %s (%s)", userid, err)
+		return ErrorUpdatingUser
+	}
+
+	if revoke {
+		if err := ac.oauth.RevokeUserSessions(userid); err != nil {
+			log.Printf("AdminModule.updateUser: error revoking OAuth sessions for user %s (%s)", userid, err)
+			return ErrorInternal
+		}
+	}
+
+	// Emit event on the target account
+	data := map[string]string{"Admin": adminID}
+	ac.emitter.SendEvent(events.NewEvent(userid, eventType, data))
+
+	ac.audit(adminID, action, userid, nil)
+
+	log.Printf("AdminModule.updateUser: admin %s applied %s to user %s", adminID, action, userid)
+
+	return nil
+}
+
+// audit emits an admin action event on the acting administrators account
+func (ac *Controller) audit(adminID, action, userid string, data map[string]string) {
+	if data == nil {
+		data = make(map[string]string)
+	}
+	data["Action"] = action
+	if userid != "" {
+		data["User"] = userid
+	}
+
+	ac.emitter.SendEvent(events.NewEvent(adminID, events.EventAdminAction, data))
+}
+
+// fetchUser fetches a user by userid, wrapping store errors
+func (ac *Controller) fetchUser(userid string) (User, error) {
+	u, err := ac.store.GetUserByExtID(userid)
+	if err != nil {
+		log.Printf("AdminModule.fetchUser: error fetching user %s (%s)", userid, err)
+		return nil, ErrorFindingUser
+	}
+	if u == nil {
+		return nil, ErrorUserNotFound
+	}
+
+	return u.(User), nil
+}
+
+// NewUserResp maps a user to an API safe admin response
+func NewUserResp(u User) api.AdminUserResp {
+	return api.AdminUserResp{
+		UserResp: api.UserResp{
+			ExtId:     u.GetExtID(),
+			Email:     u.GetEmail(),
+			Username:  u.GetUsername(),
+			Activated: u.IsActivated(),
+			Enabled:   u.IsEnabled(),
+			Locked:    u.IsLocked(),
+			LastLogin: u.GetLastLogin(),
+			CreatedAt: u.GetCreatedAt(),
+		},
+		Admin:                  u.IsAdmin(),
+		LoginRetries:           u.GetLoginRetries(),
+		PasswordChanged:        u.GetPasswordChanged(),
+		PasswordChangeRequired: u.IsPasswordChangeRequired(),
+		ServiceAccount:         u.IsServiceAccount(),
+		Dormant:                u.IsDormant(),
+		AllowedNetworks:        u.GetAllowedNetworks(),
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * Admin Module API
+ * Provides administrator user management endpoints
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gocraft/web"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/appcontext"
+)
+
+// apiCtx API context instance
+type apiCtx struct {
+	// Base context required by router
+	*appcontext.AuthPlzCtx
+	// Admin module instance
+	ac *Controller
+}
+
+// BindAdminContext Helper middleware to bind module to API context
+func BindAdminContext(ac *Controller) func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	return func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+		ctx.ac = ac.WithRequest(ctx.GetRequestContext()).(*Controller)
+		next(rw, req)
+	}
+}
+
+// BindAPI Binds the admin API to the provided router
+func (ac *Controller) BindAPI(router *web.Router) {
+	// Create router for admin module
+	adminRouter := router.Subrouter(apiCtx{}, "/api/admin")
+
+	// Attach module context and restrict access to administrators
+	adminRouter.Middleware(BindAdminContext(ac))
+	adminRouter.Middleware((*apiCtx).RequireAdminMiddleware)
+
+	// Bind endpoints
+	adminRouter.Get("/users", (*apiCtx).UsersGet)
+	adminRouter.Get("/users/:id", (*apiCtx).UserGet)
+	adminRouter.Delete("/users/:id", (*apiCtx).UserDelete)
+	adminRouter.Get("/users/:id/factors", (*apiCtx).UserFactorsGet)
+	adminRouter.Get("/users/:id/clients", (*apiCtx).UserClientsGet)
+
+	adminRouter.Post("/users/:id/enable", (*apiCtx).UserEnablePost)
+	adminRouter.Post("/users/:id/disable", (*apiCtx).UserDisablePost)
+	adminRouter.Post("/users/:id/lock", (*apiCtx).UserLockPost)
+	adminRouter.Post("/users/:id/unlock", (*apiCtx).UserUnlockPost)
+	adminRouter.Post("/users/:id/reset", (*apiCtx).UserResetPost)
+	adminRouter.Post("/users/:id/password-change", (*apiCtx).UserPasswordChangePost)
+	adminRouter.Post("/users/:id/revoke", (*apiCtx).UserRevokePost)
+	adminRouter.Post("/users/:id/admin", (*apiCtx).UserAdminPost)
+	adminRouter.Delete("/users/:id/admin", (*apiCtx).UserAdminDelete)
+	adminRouter.Post("/users/:id/networks", (*apiCtx).UserNetworksPost)
+	adminRouter.Post("/users/:id/impersonate", (*apiCtx).UserImpersonatePost)
+
+	// Impersonation endpoints are bound separately as the session user is the impersonated user
+	impersonationRouter := router.Subrouter(apiCtx{}, "/api/impersonation")
+	impersonationRouter.Middleware(BindAdminContext(ac))
+	impersonationRouter.Get("/", (*apiCtx).ImpersonationGet)
+	impersonationRouter.Post("/stop", (*apiCtx).ImpersonationStopPost)
+}
+
+// RequireAdminMiddleware restricts access to logged in administrators with a current sudo session
+func (c *apiCtx) RequireAdminMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block admin actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	isAdmin, err := c.ac.IsAdmin(c.GetUserID())
+	if err != nil {
+		log.Printf("AdminAPI.RequireAdminMiddleware: error checking admin status (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+	if !isAdmin {
+		log.Printf("AdminAPI.RequireAdminMiddleware: blocked non-admin user %s", c.GetUserID())
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().AdminRequired)
+		return
+	}
+
+	if !c.CanSudo(rw, req) {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().SudoRequired)
+		return
+	}
+
+	next(rw, req)
+}
+
+// writeError writes an API error for the provided controller error
+func (c *apiCtx) writeError(rw web.ResponseWriter, err error) {
+	switch err {
+	case ErrorUserNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().UserNotFound)
+	case ErrorSelfAction:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().AdminSelfActionBlocked)
+	case ErrorUserDisabled:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().UserDisabled)
+	case ErrorInvalidNetworks:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().NetworksInvalid)
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+	}
+}
+
+// UsersGet searches user accounts
+// Supports `q` (search query), `count` and `offset` query parameters
+func (c *apiCtx) UsersGet(rw web.ResponseWriter, req *web.Request) {
+	query := req.URL.Query()
+
+	count, offset := uint64(0), uint64(0)
+	var err error
+	if s := query.Get("count"); s != "" {
+		if count, err = strconv.ParseUint(s, 10, 32); err != nil {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+			return
+		}
+	}
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.ParseUint(s, 10, 32); err != nil {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+			return
+		}
+	}
+
+	users, err := c.ac.SearchUsers(c.GetUserID(), query.Get("q"), uint(count), uint(offset))
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.WriteJson(rw, users)
+}
+
+// UserGet fetches a user account
+func (c *apiCtx) UserGet(rw web.ResponseWriter, req *web.Request) {
+	user, err := c.ac.GetUser(c.GetUserID(), req.PathParams["id"])
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.WriteJson(rw, user)
+}
+
+// UserFactorsGet fetches the second factors registered to a user account
+func (c *apiCtx) UserFactorsGet(rw web.ResponseWriter, req *web.Request) {
+	factors, err := c.ac.GetSecondFactors(c.GetUserID(), req.PathParams["id"])
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.WriteJson(rw, factors)
+}
+
+// UserClientsGet fetches the OAuth clients owned by a user account
+func (c *apiCtx) UserClientsGet(rw web.ResponseWriter, req *web.Request) {
+	clients, err := c.ac.GetOAuthClients(c.GetUserID(), req.PathParams["id"])
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.WriteJson(rw, clients)
+}
+
+// writeActionResult writes the result of an administrative action
+func (c *apiCtx) writeActionResult(rw web.ResponseWriter, err error) {
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().AdminActionSuccessful)
+}
+
+// UserEnablePost enables a user account
+func (c *apiCtx) UserEnablePost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetEnabled(c.GetUserID(), req.PathParams["id"], true))
+}
+
+// UserDisablePost disables a user account
+func (c *apiCtx) UserDisablePost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetEnabled(c.GetUserID(), req.PathParams["id"], false))
+}
+
+// UserLockPost locks a user account
+func (c *apiCtx) UserLockPost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetLocked(c.GetUserID(), req.PathParams["id"], true))
+}
+
+// UserUnlockPost unlocks a user account
+func (c *apiCtx) UserUnlockPost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetLocked(c.GetUserID(), req.PathParams["id"], false))
+}
+
+// UserResetPost forces a password reset for a user account
+func (c *apiCtx) UserResetPost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.ForcePasswordReset(c.GetUserID(), req.PathParams["id"]))
+}
+
+// UserPasswordChangePost requires a user to change their password at next login
+func (c *apiCtx) UserPasswordChangePost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.RequirePasswordChange(c.GetUserID(), req.PathParams["id"]))
+}
+
+// UserRevokePost revokes all sessions and OAuth tokens for a user account
+func (c *apiCtx) UserRevokePost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.RevokeSessions(c.GetUserID(), req.PathParams["id"]))
+}
+
+// UserAdminPost grants administrator rights to a user account
+func (c *apiCtx) UserAdminPost(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetAdmin(c.GetUserID(), req.PathParams["id"], true))
+}
+
+// UserAdminDelete revokes administrator rights from a user account
+func (c *apiCtx) UserAdminDelete(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.SetAdmin(c.GetUserID(), req.PathParams["id"], false))
+}
+
+// UserNetworksPost sets the networks a user account may log in from
+func (c *apiCtx) UserNetworksPost(rw web.ResponseWriter, req *web.Request) {
+	networks := api.AllowedNetworks{}
+	defer req.Body.Close()
+	if err := json.NewDecoder(req.Body).Decode(&networks); err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	c.writeActionResult(rw, c.ac.SetAllowedNetworks(c.GetUserID(), req.PathParams["id"], networks.Networks))
+}
+
+// UserDelete deletes a user account
+func (c *apiCtx) UserDelete(rw web.ResponseWriter, req *web.Request) {
+	c.writeActionResult(rw, c.ac.DeleteUser(c.GetUserID(), req.PathParams["id"]))
+}
+
+// UserImpersonatePost starts an impersonation session for a user account
+// Sensitive account actions are blocked until impersonation is stopped
+func (c *apiCtx) UserImpersonatePost(rw web.ResponseWriter, req *web.Request) {
+	userID := req.PathParams["id"]
+
+	err := c.ac.StartImpersonation(c.GetUserID(), userID)
+	if err != nil {
+		c.writeError(rw, err)
+		return
+	}
+
+	c.StartImpersonation(userID, rw, req)
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().AdminActionSuccessful)
+}
+
+// ImpersonationGet fetches the impersonation status of the current session
+func (c *apiCtx) ImpersonationGet(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	status := api.ImpersonationStatus{}
+	if impersonation := c.GetImpersonation(); impersonation != nil {
+		status = api.ImpersonationStatus{
+			Impersonating: true,
+			AdminID:       impersonation.AdminID,
+			UserID:        impersonation.UserID,
+			Started:       impersonation.Started,
+		}
+	}
+
+	c.WriteJson(rw, &status)
+}
+
+// ImpersonationStopPost stops an impersonation session and restores the administrator session
+func (c *apiCtx) ImpersonationStopPost(rw web.ResponseWriter, req *web.Request) {
+	impersonation := c.StopImpersonation(rw, req)
+	if impersonation == nil {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().ImpersonationNotActive)
+		return
+	}
+
+	c.ac.StopImpersonation(impersonation.AdminID, impersonation.UserID)
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().AdminActionSuccessful)
+}
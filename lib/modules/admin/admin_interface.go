@@ -0,0 +1,92 @@
+/*
+ * Admin Module interfaces
+ * Defines interfaces required by the Admin module
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package admin
+
+import (
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// User Defines the User object interfaces required by this module
+type User interface {
+	GetExtID() string
+	GetEmail() string
+	GetUsername() string
+	GetCreatedAt() time.Time
+	GetLastLogin() time.Time
+
+	SetPassword(pass string)
+	GetPasswordChanged() time.Time
+	IsPasswordChangeRequired() bool
+	SetPasswordChangeRequired(required bool)
+
+	IsActivated() bool
+
+	IsEnabled() bool
+	SetEnabled(enabled bool)
+
+	IsLocked() bool
+	SetLocked(locked bool)
+	GetLoginRetries() uint
+	ClearLoginRetries()
+
+	IsAdmin() bool
+	SetAdmin(admin bool)
+
+	IsServiceAccount() bool
+	IsDormant() bool
+
+	SetSessionsRevoked(t time.Time)
+
+	GetAllowedNetworks() []string
+	SetAllowedNetworks(networks []string)
+}
+
+// TOTPToken Defines the TOTP token interfaces required by this module
+type TOTPToken interface {
+	GetName() string
+	GetCounter() uint
+	GetLastUsed() time.Time
+}
+
+// U2FToken Defines the U2F token interfaces required by this module
+type U2FToken interface {
+	GetName() string
+	GetKeyHandle() string
+	GetCounter() uint
+	GetLastUsed() time.Time
+}
+
+// BackupCode Defines the backup code interfaces required by this module
+type BackupCode interface {
+	GetName() string
+	IsUsed() bool
+	GetCreatedAt() time.Time
+	GetUsedAt() time.Time
+}
+
+// Storer Defines the required store interfaces for the admin module
+// Returned interfaces must satisfy the User, TOTPToken, U2FToken and BackupCode interfaces
+type Storer interface {
+	GetUserByExtID(userid string) (interface{}, error)
+	SearchUsers(query string, offset, limit uint) ([]interface{}, error)
+	UpdateUser(user interface{}) (interface{}, error)
+	SoftDeleteUser(user interface{}) error
+
+	GetTotpTokens(userid string) ([]interface{}, error)
+	GetFidoTokens(userid string) ([]interface{}, error)
+	GetBackupTokens(userid string) ([]interface{}, error)
+}
+
+// OAuthManager Defines the OAuth management interfaces required by this module
+type OAuthManager interface {
+	GetClients(userID string) ([]api.OAuthClientResp, error)
+	RevokeUserSessions(userID string) error
+}
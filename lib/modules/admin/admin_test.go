@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/events"
+	"github.com/ryankurte/authplz/lib/test"
+)
+
+type mockOAuthManager struct {
+	Revoked string
+}
+
+func (m *mockOAuthManager) GetClients(userID string) ([]api.OAuthClientResp, error) {
+	return []api.OAuthClientResp{}, nil
+}
+
+func (m *mockOAuthManager) RevokeUserSessions(userID string) error {
+	m.Revoked = userID
+	return nil
+}
+
+func TestAdminController(t *testing.T) {
+
+	ts, err := test.NewTestServer()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	a, err := ts.DataStore.AddUser("admin@abc.com", "admin.user", test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	adminUser := a.(*datastore.User)
+	adminUser.SetAdmin(true)
+	ts.DataStore.UpdateUser(adminUser)
+	adminID := adminUser.GetExtID()
+
+	u, err := ts.DataStore.AddUser(test.FakeEmail, test.FakeName, test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	userID := u.(*datastore.User).GetExtID()
+
+	mockOAuth := mockOAuthManager{}
+	ac := NewController(ts.DataStore, &mockOAuth, ts.EventEmitter)
+
+	checkAudit := func(t *testing.T, action string) {
+		e := ts.EventEmitter.Event
+		if e.Type != events.EventAdminAction || e.UserExtID != adminID || e.Data["Action"] != action {
+			t.Errorf("Expected admin audit event for action %s (received %+v)", action, e)
+		}
+	}
+
+	t.Run("Checks admin status", func(t *testing.T) {
+		isAdmin, err := ac.IsAdmin(adminID)
+		if err != nil || !isAdmin {
+			t.Errorf("Expected admin user (err: %v)", err)
+		}
+		isAdmin, err = ac.IsAdmin(userID)
+		if err != nil || isAdmin {
+			t.Errorf("Expected non-admin user (err: %v)", err)
+		}
+	})
+
+	t.Run("Searches users", func(t *testing.T) {
+		resp, err := ac.SearchUsers(adminID, test.FakeName, 0, 0)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if len(resp.Users) != 1 || resp.Users[0].Email != test.FakeEmail {
+			t.Errorf("Unexpected search results (%+v)", resp.Users)
+		}
+		checkAudit(t, ActionSearchUsers)
+
+		resp, err = ac.SearchUsers(adminID, "", 1, 1)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if len(resp.Users) != 1 || resp.Count != 1 || resp.Offset != 1 {
+			t.Errorf("Unexpected paginated results (%+v)", resp)
+		}
+	})
+
+	t.Run("Fetches user second factors", func(t *testing.T) {
+		factors, err := ac.GetSecondFactors(adminID, userID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if len(factors.TOTP) != 0 || len(factors.U2F) != 0 || len(factors.Backup) != 0 {
+			t.Errorf("Unexpected second factors (%+v)", factors)
+		}
+		checkAudit(t, ActionViewFactors)
+	})
+
+	t.Run("Disables accounts and revokes sessions", func(t *testing.T) {
+		loginAt := time.Now()
+
+		err := ac.SetEnabled(adminID, userID, false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		checkAudit(t, ActionDisable)
+
+		u, _ := ts.DataStore.GetUserByExtID(userID)
+		user := u.(*datastore.User)
+		if user.IsEnabled() {
+			t.Errorf("User not disabled")
+		}
+		if !user.GetSessionsRevoked().After(loginAt) {
+			t.Errorf("User sessions not revoked")
+		}
+		if mockOAuth.Revoked != userID {
+			t.Errorf("User OAuth sessions not revoked")
+		}
+
+		if err := ac.SetEnabled(adminID, userID, true); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Locks and unlocks accounts", func(t *testing.T) {
+		if err := ac.SetLocked(adminID, userID, true); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		u, _ := ts.DataStore.GetUserByExtID(userID)
+		if !u.(*datastore.User).IsLocked() {
+			t.Errorf("User not locked")
+		}
+
+		if err := ac.SetLocked(adminID, userID, false); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		u, _ = ts.DataStore.GetUserByExtID(userID)
+		if u.(*datastore.User).IsLocked() {
+			t.Errorf("User not unlocked")
+		}
+		checkAudit(t, ActionUnlock)
+	})
+
+	t.Run("Forces password resets", func(t *testing.T) {
+		u, _ := ts.DataStore.GetUserByExtID(userID)
+		password := u.(*datastore.User).GetPassword()
+
+		if err := ac.ForcePasswordReset(adminID, userID); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		u, _ = ts.DataStore.GetUserByExtID(userID)
+		if u.(*datastore.User).GetPassword() == password {
+			t.Errorf("User password not reset")
+		}
+		checkAudit(t, ActionResetPassword)
+	})
+
+	t.Run("Grants and revokes admin", func(t *testing.T) {
+		if err := ac.SetAdmin(adminID, userID, true); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		isAdmin, _ := ac.IsAdmin(userID)
+		if !isAdmin {
+			t.Errorf("Admin not granted")
+		}
+
+		if err := ac.SetAdmin(adminID, userID, false); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		isAdmin, _ = ac.IsAdmin(userID)
+		if isAdmin {
+			t.Errorf("Admin not revoked")
+		}
+		checkAudit(t, ActionRevokeAdmin)
+	})
+
+	t.Run("Sets allowed networks", func(t *testing.T) {
+		if err := ac.SetAllowedNetworks(adminID, userID, []string{"not-a-network"}); err != ErrorInvalidNetworks {
+			t.Errorf("Expected ErrorInvalidNetworks (received %v)", err)
+		}
+
+		if err := ac.SetAllowedNetworks(adminID, userID, []string{"10.1.2.0/24", "192.168.1.1"}); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		u, _ := ts.DataStore.GetUserByExtID(userID)
+		networks := u.(*datastore.User).GetAllowedNetworks()
+		if len(networks) != 2 || networks[1] != "192.168.1.1/32" {
+			t.Errorf("Unexpected allowed networks %v", networks)
+		}
+		checkAudit(t, ActionSetAllowedNetworks)
+
+		if err := ac.SetAllowedNetworks(adminID, userID, []string{}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Blocks admins locking themselves out", func(t *testing.T) {
+		if err := ac.SetEnabled(adminID, adminID, false); err != ErrorSelfAction {
+			t.Errorf("Expected ErrorSelfAction (received %v)", err)
+		}
+		if err := ac.SetAdmin(adminID, adminID, false); err != ErrorSelfAction {
+			t.Errorf("Expected ErrorSelfAction (received %v)", err)
+		}
+	})
+
+	t.Run("Records impersonation on admin and user accounts", func(t *testing.T) {
+		if err := ac.StartImpersonation(adminID, userID); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		e := ts.EventEmitter.Event
+		if e.Type != events.EventAccountImpersonationStart || e.UserExtID != adminID || e.Data["User"] != userID {
+			t.Errorf("Expected impersonation start event (received %+v)", e)
+		}
+
+		ac.StopImpersonation(adminID, userID)
+		e = ts.EventEmitter.Event
+		if e.Type != events.EventAccountImpersonationStop || e.UserExtID != adminID || e.Data["User"] != userID {
+			t.Errorf("Expected impersonation stop event (received %+v)", e)
+		}
+	})
+
+	t.Run("Blocks impersonation of self and disabled accounts", func(t *testing.T) {
+		if err := ac.StartImpersonation(adminID, adminID); err != ErrorSelfAction {
+			t.Errorf("Expected ErrorSelfAction (received %v)", err)
+		}
+
+		ac.SetEnabled(adminID, userID, false)
+		if err := ac.StartImpersonation(adminID, userID); err != ErrorUserDisabled {
+			t.Errorf("Expected ErrorUserDisabled (received %v)", err)
+		}
+		ac.SetEnabled(adminID, userID, true)
+	})
+
+	t.Run("Deletes user accounts", func(t *testing.T) {
+		if err := ac.DeleteUser(adminID, adminID); err != ErrorSelfAction {
+			t.Errorf("Expected ErrorSelfAction (received %v)", err)
+		}
+
+		if err := ac.DeleteUser(adminID, userID); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		checkAudit(t, ActionDelete)
+
+		if _, err := ac.GetUser(adminID, userID); err != ErrorUserNotFound {
+			t.Errorf("Expected deleted user to be hidden (received %v)", err)
+		}
+	})
+
+	t.Run("Returns not found for missing users", func(t *testing.T) {
+		if _, err := ac.GetUser(adminID, "fake-user"); err != ErrorUserNotFound {
+			t.Errorf("Expected ErrorUserNotFound (received %v)", err)
+		}
+	})
+}
@@ -3,6 +3,8 @@ package audit
 import (
 	"log"
 	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // Controller instance
@@ -16,8 +18,13 @@ func NewController(store Storer) *Controller {
 }
 
 // AddEvent adds an event to the audit log
-func (ac *Controller) AddEvent(userExtId, eventType string, eventTime time.Time, data map[string]string) error {
-	_, err := ac.store.AddAuditEvent(userExtId, eventType, eventTime, data)
+// The request context is optional, and is recorded where an event was caused by a request
+func (ac *Controller) AddEvent(userExtId, eventType string, eventTime time.Time, request *api.RequestContext, data map[string]string) error {
+	if request == nil {
+		request = &api.RequestContext{}
+	}
+
+	_, err := ac.store.AddAuditEvent(userExtId, eventType, eventTime, request.RequestID, request.IP, request.UserAgent, data)
 	if err != nil {
 		log.Printf("AuditController.AddEvent: error adding audit event (%s)", err)
 		return err
@@ -31,18 +38,39 @@ func (ac *Controller) AddEvent(userExtId, eventType string, eventTime time.Time,
 // HandleEvent handles async events for go-async
 func (ac *Controller) HandleEvent(event interface{}) error {
 	auditEvent := event.(Event)
-	ac.AddEvent(auditEvent.GetUserExtID(), auditEvent.GetType(), auditEvent.GetTime(), auditEvent.GetData())
+	ac.AddEvent(auditEvent.GetUserExtID(), auditEvent.GetType(), auditEvent.GetTime(), auditEvent.GetRequest(), auditEvent.GetData())
 	return nil
 }
 
 // ListEvents fetches events for the provided userID
-func (ac *Controller) ListEvents(userid string) ([]interface{}, error) {
+func (ac *Controller) ListEvents(userid string) ([]api.AuditEvent, error) {
 
 	events, err := ac.store.GetAuditEvents(userid)
 	if err != nil {
-		log.Printf("AuditController.AddEvent: error adding audit event (%s)", err)
-		return events, err
+		log.Printf("AuditController.ListEvents: error fetching audit events (%s)", err)
+		return make([]api.AuditEvent, 0), err
+	}
+
+	// Map to API safe event objects
+	safeEvents := make([]api.AuditEvent, len(events))
+	for i, e := range events {
+		record := e.(Record)
+
+		data, err := record.GetData()
+		if err != nil {
+			log.Printf("AuditController.ListEvents: error decoding event data (%s)", err)
+			return make([]api.AuditEvent, 0), err
+		}
+
+		safeEvents[i] = api.AuditEvent{
+			Type:      record.GetType(),
+			Time:      record.GetTime(),
+			Data:      data,
+			RequestID: record.GetRequestID(),
+			IP:        record.GetIP(),
+			UserAgent: record.GetUserAgent(),
+		}
 	}
 
-	return events, err
+	return safeEvents, nil
 }
@@ -2,6 +2,8 @@ package audit
 
 import (
 	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // Event Audit event type interface
@@ -10,6 +12,18 @@ type Event interface {
 	GetType() string
 	GetTime() time.Time
 	GetData() map[string]string
+	GetRequest() *api.RequestContext
+}
+
+// Record Stored audit event type interface
+// This must be implemented by audit events returned from the datastore
+type Record interface {
+	GetType() string
+	GetTime() time.Time
+	GetData() (map[string]string, error)
+	GetRequestID() string
+	GetIP() string
+	GetUserAgent() string
 }
 
 // User Audit user type interface
@@ -19,6 +33,6 @@ type User interface {
 
 // Storer Interface that datastore must implement to provide audit controller
 type Storer interface {
-	AddAuditEvent(userid, eventType string, eventTime time.Time, data map[string]string) (interface{}, error)
+	AddAuditEvent(userid, eventType string, eventTime time.Time, requestID, ip, userAgent string, data map[string]string) (interface{}, error)
 	GetAuditEvents(userid string) ([]interface{}, error)
 }
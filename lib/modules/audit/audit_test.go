@@ -6,6 +6,7 @@ import (
 )
 
 import (
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
 	"github.com/ryankurte/authplz/lib/events"
@@ -41,7 +42,7 @@ func TestAuditController(t *testing.T) {
 
 	// Run tests
 	t.Run("Add login event", func(t *testing.T) {
-		err := ac.AddEvent(user.GetExtID(), events.EventAccountCreated, time.Now(), make(map[string]string))
+		err := ac.AddEvent(user.GetExtID(), events.EventAccountCreated, time.Now(), nil, make(map[string]string))
 		if err != nil {
 			t.Error(err)
 		}
@@ -64,7 +65,8 @@ func TestAuditController(t *testing.T) {
 	t.Run("Post audit event", func(t *testing.T) {
 		d := make(map[string]string)
 		d["ip"] = "127.0.0.1"
-		e := events.AuthPlzEvent{user.GetExtID(), time.Now(), events.EventAccountActivated, d}
+		r := api.RequestContext{RequestID: "request-id", IP: "127.0.0.1", UserAgent: "test-agent"}
+		e := events.AuthPlzEvent{user.GetExtID(), time.Now(), events.EventAccountActivated, d, &r}
 
 		serviceManager.SendEvent(&e)
 
@@ -78,6 +80,30 @@ func TestAuditController(t *testing.T) {
 		}
 		if len(events) != 2 {
 			t.Errorf("Expected 2 events, received %d events", len(events))
+			return
+		}
+		if events[1].RequestID != "request-id" || events[1].IP != "127.0.0.1" || events[1].UserAgent != "test-agent" {
+			t.Errorf("Request context not recorded (%+v)", events[1])
+		}
+	})
+
+	t.Run("Records events for removed accounts", func(t *testing.T) {
+		if err := ds.RemoveUser(user); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		err := ac.AddEvent(user.GetExtID(), events.EventAccountPurged, time.Now(), nil, make(map[string]string))
+		if err != nil {
+			t.Error(err)
+		}
+
+		events, err := ac.ListEvents(user.GetExtID())
+		if err != nil {
+			t.Error(err)
+		}
+		if len(events) != 1 {
+			t.Errorf("Expected 1 event, received %d events", len(events))
 		}
 	})
 
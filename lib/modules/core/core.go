@@ -17,33 +17,78 @@ type Controller struct {
 
 	// Token handler implementations
 	// This allows token handlers to be bound on a per-module basis using the actions
-	// defined in api.TokenAction. Note that there must not be overlaps in bindings
-	// TODO: this should probably be implemented as a bind function to panic if overlap is attempted
+	// defined in api.TokenAction. Actions can only be bound to a single handler
 	tokenHandlers map[api.TokenAction]TokenHandler
 
+	// Token actions that may be applied without logging in
+	anonymousActions map[api.TokenAction]bool
+
 	// 2nd Factor Authentication implementations
-	secondFactorHandlers map[string]SecondFactorProvider
+	secondFactorHandlers hookChain
 
 	// Event handler implementations
-	eventHandlers map[string]EventHandler
+	eventHandlers hookChain
 
 	// Login handler implementations
-	preLogin         map[string]PreLoginHook
-	postLoginSuccess map[string]PostLoginSuccessHook
-	postLoginFailure map[string]PostLoginFailureHook
+	// Hook chains are executed in priority order
+	preLogin         hookChain
+	loginContext     hookChain
+	postLoginSuccess hookChain
+	postLoginFailure hookChain
+	passwordChange   hookChain
+
+	// Second factor enrolment handler implementations
+	secondFactorEnrolment hookChain
+
+	// Registration handler implementations
+	preCreate  hookChain
+	postCreate hookChain
 }
 
 // NewController Create a new core module instance
 func NewController(tokenValidator TokenValidator, loginProvider LoginProvider, emitter events.EventEmitter) *Controller {
 	return &Controller{
-		tokenControl:         tokenValidator,
-		userControl:          loginProvider,
-		tokenHandlers:        make(map[api.TokenAction]TokenHandler),
-		secondFactorHandlers: make(map[string]SecondFactorProvider),
-
-		preLogin:         make(map[string]PreLoginHook),
-		postLoginSuccess: make(map[string]PostLoginSuccessHook),
-		postLoginFailure: make(map[string]PostLoginFailureHook),
-		eventHandlers:    make(map[string]EventHandler),
+		tokenControl:  tokenValidator,
+		userControl:   loginProvider,
+		tokenHandlers: make(map[api.TokenAction]TokenHandler),
+		// Securing an account or cancelling and reverting email changes must not require logging in,
+		// as the account may be compromised
+		anonymousActions: map[api.TokenAction]bool{
+			api.TokenActionSecure:      true,
+			api.TokenActionEmailCancel: true,
+			api.TokenActionEmailRevert: true,
+		},
+	}
+}
+
+// WithRequest creates a copy of the core module bound to a request
+// The login provider, token handlers and hooks that can be bound to a request are bound so that
+// events emitted during logins and token actions carry the request context
+func (coreModule *Controller) WithRequest(request *api.RequestContext) *Controller {
+	c := *coreModule
+
+	c.userControl = bindRequest(coreModule.userControl, request).(LoginProvider)
+
+	c.tokenHandlers = make(map[api.TokenAction]TokenHandler)
+	for action, handler := range coreModule.tokenHandlers {
+		c.tokenHandlers[action] = bindRequest(handler, request).(TokenHandler)
+	}
+
+	chains := []*hookChain{
+		&c.secondFactorHandlers, &c.eventHandlers, &c.preLogin, &c.loginContext, &c.postLoginSuccess,
+		&c.postLoginFailure, &c.passwordChange, &c.secondFactorEnrolment, &c.preCreate, &c.postCreate,
+	}
+	for _, chain := range chains {
+		*chain = chain.withRequest(request)
+	}
+
+	return &c
+}
+
+// bindRequest binds a module to a request where supported
+func bindRequest(mod interface{}, request *api.RequestContext) interface{} {
+	if scoper, ok := mod.(events.RequestScoper); ok {
+		return scoper.WithRequest(request)
 	}
+	return mod
 }
@@ -2,8 +2,11 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gocraft/web"
@@ -26,7 +29,7 @@ type coreCtx struct {
 // Helper middleware to bind module to API context
 func bindCoreContext(coreModule *Controller) func(ctx *coreCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	return func(ctx *coreCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-		ctx.cm = coreModule
+		ctx.cm = coreModule.WithRequest(ctx.GetRequestContext())
 		next(rw, req)
 	}
 }
@@ -46,10 +49,16 @@ func (coreModule *Controller) BindAPI(router *web.Router) {
 	coreRouter.Post("/action", (*coreCtx).Action)
 	coreRouter.Get("/recovery", (*coreCtx).RecoverGet)
 	coreRouter.Post("/recovery", (*coreCtx).RecoverPost)
+	coreRouter.Get("/sudo", (*coreCtx).SudoGet)
+	coreRouter.Post("/sudo", (*coreCtx).SudoPost)
+	coreRouter.Delete("/sudo", (*coreCtx).SudoDelete)
 }
 
 // Handle an action token (both get and post calls)
-// This adds the action token to a session flash for use post-login attempt
+// This adds the action token to a session flash for use post-login attempt,
+// except for actions such as securing an account that are applied without logging in.
+// As links may be fetched by mail scanners these actions are only applied on POST with confirm=true,
+// GET requests are redirected to a confirmation page
 func (c *coreCtx) Action(rw web.ResponseWriter, req *web.Request) {
 	// Grab token string from get or post request
 	var tokenString string
@@ -64,6 +73,26 @@ func (c *coreCtx) Action(rw web.ResponseWriter, req *web.Request) {
 
 	log.Printf("Received activation token!")
 
+	// Apply actions that do not require logging in once confirmed
+	if c.cm.IsAnonymousToken(tokenString) {
+		if req.Method != http.MethodPost {
+			c.DoRedirect(fmt.Sprintf("/#/action?token=%s", url.QueryEscape(tokenString)), rw, req)
+			return
+		}
+		if req.FormValue("confirm") != "true" {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, "Action requires confirmation")
+			return
+		}
+
+		handled, err := c.cm.HandleAnonymousToken(tokenString)
+		if err != nil || !handled {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, "Action failed")
+			return
+		}
+		c.WriteApiResult(rw, api.ResultOk, "Action complete")
+		return
+	}
+
 	// If the user isn't logged in
 	if c.GetUserID() == "" {
 		session := c.GetSession()
@@ -80,8 +109,18 @@ func (c *coreCtx) Action(rw web.ResponseWriter, req *web.Request) {
 		c.DoRedirect("/#login", rw, req)
 
 	} else {
-		//TODO: handle any active-user tokens here
-		c.WriteApiResultWithCode(rw, http.StatusNotImplemented, api.ResultError, "Action endpoint not yet implemented for logged in users")
+		// Apply token directly for logged in users
+		tokenOk, err := c.cm.HandleToken(c.GetUserID(), nil, tokenString)
+		if err != nil {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, "Action failed")
+			return
+		}
+		if !tokenOk {
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, "Invalid action token")
+			return
+		}
+
+		c.WriteApiResult(rw, api.ResultOk, "Action complete")
 	}
 }
 
@@ -89,9 +128,13 @@ func (c *coreCtx) Action(rw web.ResponseWriter, req *web.Request) {
 func (c *coreCtx) Login(rw web.ResponseWriter, req *web.Request) {
 
 	// Fetch parameters
-	email := req.FormValue("email")
-	if !govalidator.IsEmail(email) {
-		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Missing or invalid email argument")
+	// Users may log in with either an email address or username
+	identifier := req.FormValue("email")
+	if identifier == "" {
+		identifier = req.FormValue("username")
+	}
+	if identifier == "" || (strings.Contains(identifier, "@") && !govalidator.IsEmail(identifier)) {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Missing or invalid email or username argument")
 		return
 	}
 	password := req.FormValue("password")
@@ -108,7 +151,7 @@ func (c *coreCtx) Login(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	// Attempt login via UserControl interface
-	loginOk, u, e := c.cm.userControl.Login(email, password)
+	loginOk, u, e := c.cm.userControl.Login(identifier, password)
 	if e != nil {
 		// Run post login failure handlers
 		err := c.cm.PostLoginFailure(u)
@@ -157,17 +200,27 @@ func (c *coreCtx) Login(rw web.ResponseWriter, req *web.Request) {
 		}
 
 		// Reload login state
-		loginOk, u, e = c.cm.userControl.Login(email, password)
+		loginOk, u, e = c.cm.userControl.Login(identifier, password)
 		if e != nil {
 			c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Internal server error")
 			log.Printf("Core.Login: user controller error %s\n", e)
 			return
 		}
+		if !loginOk {
+			// Actions such as email changes may invalidate the provided credentials
+			c.WriteApiResult(rw, api.ResultOk, "Action complete, please log in again")
+			return
+		}
 		user = u.(UserInterface)
 	}
 
 	// Call PreLogin handlers
 	preLoginOk, err := c.cm.PreLogin(u)
+	if blocked, ok := err.(*api.LoginBlockedError); ok {
+		log.Printf("Core.Login: PreLogin blocked login (%s)\n", blocked.Reason)
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().LoginBlockedReason(blocked.Reason))
+		return
+	}
 	if err != nil {
 		log.Printf("Core.Login: PreLogin error (%s)\n", err)
 		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Internal server error")
@@ -175,17 +228,46 @@ func (c *coreCtx) Login(rw web.ResponseWriter, req *web.Request) {
 	}
 	if !preLoginOk {
 		log.Printf("Core.Login: PreLogin blocked login\n")
-		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Login blocked, check you're emails for an unlock link")
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().LoginBlocked)
 		return
 	}
 
+	// Run login context handlers with the client the login was made from
+	// This runs prior to second factors so that logins using a compromised password are detected
+	login := api.LoginContext{IP: c.GetRemoteAddr(), UserAgent: req.UserAgent()}
+	err = c.cm.LoginContext(u, &login)
+	if err != nil {
+		log.Printf("Core.Login: LoginContext error (%s)\n", err)
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Internal server error")
+		return
+	}
+
+	// Check whether a password change is required
+	// Users that must change their password are only granted a password change session
+	passwordChangeRequired, err := c.cm.PasswordChangeRequired(u)
+	if err != nil {
+		log.Printf("Core.Login: PasswordChangeRequired error (%s)\n", err)
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Internal server error")
+		return
+	}
+	loginAction := "login"
+	if passwordChangeRequired {
+		loginAction = "password-change"
+	}
+
 	// Check for available second factors
 	secondFactorRequired, factorsAvailable := c.cm.CheckSecondFactors(user.GetExtID())
 
+	// Skip the second factor where the user has remembered this device
+	if secondFactorRequired && c.IsTrustedDevice(user.GetExtID(), req) {
+		log.Printf("Core.Login: Second factor skipped for remembered device (user %s)", user.GetExtID())
+		secondFactorRequired = false
+	}
+
 	// Respond with list of available 2fa components if required
 	if loginOk && preLoginOk && secondFactorRequired {
 		log.Println("Core.Login: Partial login (2fa required)")
-		c.Bind2FARequest(rw, req, user.GetExtID(), "login")
+		c.Bind2FARequest(rw, req, user.GetExtID(), loginAction)
 
 		rw.Header().Set("Content-Type", "application/json")
 		rw.WriteHeader(http.StatusAccepted)
@@ -199,6 +281,29 @@ func (c *coreCtx) Login(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	// Bind password change session in place of login
+	if passwordChangeRequired {
+		log.Printf("Core.Login: Partial login (password change required) for user: %s", user.GetExtID())
+		c.BindPasswordChangeRequest(user.GetExtID(), rw, req)
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().PasswordChangeRequired)
+		return
+	}
+
+	// Check whether users without a second factor must enrol one
+	// Users that must enrol a second factor are only granted an enrolment session
+	enrolmentRequired, err := c.cm.SecondFactorEnrolmentRequired(u)
+	if err != nil {
+		log.Printf("Core.Login: SecondFactorEnrolmentRequired error (%s)\n", err)
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, "Internal server error")
+		return
+	}
+	if enrolmentRequired {
+		log.Printf("Core.Login: Partial login (2fa enrolment required) for user: %s", user.GetExtID())
+		c.BindSecondFactorEnrolmentRequest(user.GetExtID(), rw, req)
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().SecondFactorEnrolment)
+		return
+	}
+
 	// Handle login success
 	if loginOk && preLoginOk {
 		// Run post login success handlers
@@ -235,6 +340,99 @@ func (c *coreCtx) Logout(rw web.ResponseWriter, req *web.Request) {
 	rw.WriteHeader(http.StatusOK)
 }
 
+// Sudo endpoints allow logged in users to re-authenticate prior to sensitive account actions
+
+// SudoGet fetches the sudo status of the current session
+func (c *coreCtx) SudoGet(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	status := api.SudoStatus{}
+	if sudo := c.GetSudo(rw, req); sudo != nil {
+		status.Active = true
+		status.Expires = sudo.SessionEnd
+	}
+
+	c.WriteJson(rw, &status)
+}
+
+// SudoPost re-authenticates a logged in user to grant a sudo session
+// Users with second factors must complete a second factor (with or without their password),
+// in which case the available factors are returned and sudo is granted on completion
+func (c *coreCtx) SudoPost(rw web.ResponseWriter, req *web.Request) {
+	userID := c.GetUserID()
+	if userID == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Administrators must re-authenticate as themselves once impersonation is stopped
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	password := req.FormValue("password")
+	secondFactorRequired, factorsAvailable := c.cm.CheckSecondFactors(userID)
+
+	if password == "" && !secondFactorRequired {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().SudoPasswordRequired)
+		return
+	}
+
+	// Check password where provided
+	if password != "" {
+		ok, err := c.cm.userControl.Reauthenticate(userID, password)
+		if err != nil {
+			log.Printf("Core.SudoPost: Reauthenticate error (%s)\n", err)
+			c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+			return
+		}
+		if !ok {
+			log.Printf("Core.SudoPost: invalid password for user %s\n", userID)
+			c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().SudoPasswordIncorrect)
+			return
+		}
+	}
+
+	// Bind a 2fa request with the sudo action
+	// c.UserAction will be called at completion to grant the sudo session
+	if secondFactorRequired {
+		log.Printf("Core.SudoPost: sudo requires 2fa for user %s", userID)
+		c.Bind2FARequest(rw, req, userID, "sudo")
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusAccepted)
+		js, err := json.Marshal(factorsAvailable)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		rw.Write(js)
+		return
+	}
+
+	c.SetSudo(userID, c.GetSudoDuration(), rw, req)
+
+	log.Printf("Core.SudoPost: granted sudo session for user %s", userID)
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SudoGranted)
+}
+
+// SudoDelete ends the sudo session for the current session
+func (c *coreCtx) SudoDelete(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	c.ClearSudo(rw, req)
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().SudoCleared)
+}
+
 // Recover endpoints provide mechanisms for user account recovery
 
 const (
@@ -7,13 +7,21 @@ import (
 // LoginProvider Interface for a user control module
 type LoginProvider interface {
 	// Login method, returns boolean result, user interface for further use, error in case of failure
-	Login(email string, password string) (bool, interface{}, error)
+	// The identifier may be either an email address or a username
+	Login(identifier string, password string) (bool, interface{}, error)
 	GetUserByEmail(email string) (interface{}, error)
+	// LoadUser fetches the user object passed to login hooks by user ID
+	LoadUser(userid string) (interface{}, error)
+	// Reauthenticate checks the password of a logged in user for sudo sessions
+	Reauthenticate(userid string, password string) (bool, error)
 }
 
 // TokenValidator Interface for token validation
 type TokenValidator interface {
 	ValidateToken(userid string, tokenString string) (*api.TokenAction, error)
+	GetTokenSubject(tokenString string) (string, error)
+	GetTokenData(tokenString string) (string, error)
+	SetUsed(tokenString string) error
 }
 
 // SecondFactorProvider for 2 factor authentication modules
@@ -32,13 +40,26 @@ type TokenHandler interface {
 	HandleToken(userid string, tokenAction api.TokenAction) error
 }
 
+// TokenDataHandler for token handler modules with actions that require data bound to the token
+// Where implemented this is called in place of HandleToken
+type TokenDataHandler interface {
+	HandleTokenData(userid string, tokenAction api.TokenAction, data string) error
+}
+
 // Core Event Hook Interfaces
 
 // PreLoginHook PreLogin hooks may allow or deny login
+// Hooks may return an *api.LoginBlockedError to deny login with a reason reported to the user
 type PreLoginHook interface {
 	PreLogin(u interface{}) (bool, error)
 }
 
+// LoginContextHook Login context hooks are called with the client context of logins once credentials are accepted
+// This allows logins from new devices or locations to be detected prior to any second factor
+type LoginContextHook interface {
+	LoginContext(u interface{}, login *api.LoginContext) error
+}
+
 // PostLoginSuccessHook Post login success hooks called on login success
 type PostLoginSuccessHook interface {
 	PostLoginSuccess(u interface{}) error
@@ -49,12 +70,36 @@ type PostLoginFailureHook interface {
 	PostLoginFailure(u interface{}) error
 }
 
+// PasswordChangeHook Password change hooks may require a password change prior to login
+// Users requiring a password change are given a restricted session that only allows the password to be changed
+type PasswordChangeHook interface {
+	PasswordChangeRequired(u interface{}) (bool, error)
+}
+
+// SecondFactorEnrolmentHook Second factor enrolment hooks may require users without a second factor to enrol one prior to login
+// Users requiring enrolment are given a restricted session that only allows a second factor to be enrolled
+type SecondFactorEnrolmentHook interface {
+	SecondFactorEnrolmentRequired(u interface{}) (bool, error)
+}
+
+// PreCreateHook PreCreate hooks may reject or enrich account registrations
+// Returning an *api.RegistrationError rejects the registration with the provided reason,
+// other errors cause registration to fail as unavailable
+type PreCreateHook interface {
+	PreCreate(reg *api.Registration) error
+}
+
+// PostCreateHook Post create hooks called following account creation
+type PostCreateHook interface {
+	PostCreate(u interface{}, reg *api.Registration) error
+}
+
 // EventHandler Interface for event handler modules
 // These modules are bound into the event manager to provide asynchronous services
 // based on system events.
 // For example, the mailer module accepts a variety of user events and sends mail in response.
 type EventHandler interface {
-	HandleEvent(userid string, u interface{}) error
+	HandleEvent(e interface{}) error
 }
 
 // UserInterface Interface for user instances
@@ -35,6 +35,14 @@ func (mh *MockHandler) GetUserByEmail(email string) (interface{}, error) {
 	return mh.u, nil
 }
 
+func (mh *MockHandler) LoadUser(userid string) (interface{}, error) {
+	return mh.u, nil
+}
+
+func (mh *MockHandler) Reauthenticate(userid string, password string) (bool, error) {
+	return mh.LoginCallResp, nil
+}
+
 // 2fa handler interface
 func (mh *MockHandler) IsSupported(userid string) bool {
 	return mh.SecondFactorRequired
@@ -50,6 +58,45 @@ func (mh *MockHandler) PreLogin(u interface{}) (bool, error) {
 	return mh.LoginAllowed, nil
 }
 
+type MockCreateHook struct {
+	Err     error
+	Created interface{}
+}
+
+func (mch *MockCreateHook) PreCreate(reg *api.Registration) error {
+	reg.Data["Mock"] = "true"
+	return mch.Err
+}
+
+func (mch *MockCreateHook) PostCreate(u interface{}, reg *api.Registration) error {
+	mch.Created = u
+	return nil
+}
+
+type MockOrderedHook struct {
+	name  string
+	order *[]string
+}
+
+func (moh *MockOrderedHook) PostLoginSuccess(u interface{}) error {
+	*moh.order = append(*moh.order, moh.name)
+	return nil
+}
+
+type MockRequestHook struct {
+	request *api.RequestContext
+	seen    *[]*api.RequestContext
+}
+
+func (mrh *MockRequestHook) WithRequest(request *api.RequestContext) interface{} {
+	return &MockRequestHook{request: request, seen: mrh.seen}
+}
+
+func (mrh *MockRequestHook) PostLoginSuccess(u interface{}) error {
+	*mrh.seen = append(*mrh.seen, mrh.request)
+	return nil
+}
+
 type FakeActionTokenStore struct {
 	tokens map[string]datastore.ActionToken
 }
@@ -120,6 +167,44 @@ func TestCoreModule(t *testing.T) {
 		}
 	})
 
+	t.Run("Anonymous action tokens can only be used once", func(t *testing.T) {
+		coreControl.BindActionHandler(api.TokenActionSecure, &mockHandler)
+
+		d, _ := time.ParseDuration("10m")
+		token, _ := tokenControl.BuildToken("fakeid", api.TokenActionSecure, d)
+
+		ok, err := coreControl.HandleAnonymousToken(token)
+		if err != nil {
+			t.Error(err)
+		}
+		if !ok {
+			t.Errorf("Anonymous token action failed")
+		}
+
+		ok, err = coreControl.HandleAnonymousToken(token)
+		if err != nil {
+			t.Error(err)
+		}
+		if ok {
+			t.Errorf("Anonymous token accepted twice")
+		}
+	})
+
+	t.Run("Email cancel and revert tokens require confirmation", func(t *testing.T) {
+		d, _ := time.ParseDuration("10m")
+		for _, action := range []api.TokenAction{api.TokenActionEmailCancel, api.TokenActionEmailRevert} {
+			token, _ := tokenControl.BuildToken("fakeid", action, d)
+			if !coreControl.IsAnonymousToken(token) {
+				t.Errorf("Expected %s to be applied as a confirmed anonymous action", action)
+			}
+		}
+
+		token, _ := tokenControl.BuildToken("fakeid", api.TokenActionActivate, d)
+		if coreControl.IsAnonymousToken(token) {
+			t.Errorf("Unexpected anonymous action %s", api.TokenActionActivate)
+		}
+	})
+
 	t.Run("Bind and check second factor handlers", func(t *testing.T) {
 		coreControl.BindSecondFactor("mock-2fa", &mockHandler)
 
@@ -146,7 +231,7 @@ func TestCoreModule(t *testing.T) {
 	t.Run("Bind PreLogin handlers", func(t *testing.T) {
 		var u interface{}
 
-		coreControl.BindPreLogin("mock-login-handler", &mockHandler)
+		coreControl.BindPreLogin("mock-login-handler", DefaultPriority, &mockHandler)
 
 		mockHandler.LoginAllowed = false
 		ok, err := coreControl.PreLogin(u)
@@ -168,6 +253,98 @@ func TestCoreModule(t *testing.T) {
 
 	})
 
+	t.Run("Bind create hooks", func(t *testing.T) {
+		createHook := MockCreateHook{}
+		coreControl.BindModule("mock-create-hook", &createHook)
+
+		reg := api.Registration{Email: fakeEmail, Data: make(map[string]string)}
+		if err := coreControl.PreCreate(&reg); err != nil {
+			t.Error(err)
+		}
+		if reg.Data["Mock"] != "true" {
+			t.Errorf("Expected registration data to be set by PreCreate hook")
+		}
+
+		hookErr := &api.RegistrationError{Reason: api.RegistrationReasonRejected}
+		createHook.Err = hookErr
+		err := coreControl.PreCreate(&reg)
+		if regErr, ok := err.(*api.RegistrationError); !ok || regErr.Reason != api.RegistrationReasonRejected || regErr.Hook != "mock-create-hook" {
+			t.Errorf("Expected rejected registration error (received %v)", err)
+		}
+		if hookErr.Hook != "" {
+			t.Errorf("PreCreate modified the hook error (%+v)", hookErr)
+		}
+
+		createHook.Err = fmt.Errorf("mock error")
+		err = coreControl.PreCreate(&reg)
+		if regErr, ok := err.(*api.RegistrationError); !ok || regErr.Reason != api.RegistrationReasonUnavailable {
+			t.Errorf("Expected unavailable registration error (received %v)", err)
+		}
+
+		if err := coreControl.PostCreate(fakeEmail, &reg); err != nil {
+			t.Error(err)
+		}
+		if createHook.Created != fakeEmail {
+			t.Errorf("PostCreate hook not called")
+		}
+	})
+
+	t.Run("Hooks run in priority order and duplicates are rejected", func(t *testing.T) {
+		order := make([]string, 0)
+		priorities := map[string]int{"late": DefaultPriority + 10, "early": DefaultPriority - 10, "default": DefaultPriority}
+		for _, name := range []string{"late", "early", "default"} {
+			hook := &MockOrderedHook{name: name, order: &order}
+			if err := coreControl.BindPostLoginSuccess(name, priorities[name], hook); err != nil {
+				t.Error(err)
+			}
+		}
+
+		if err := coreControl.PostLoginSuccess(nil); err != nil {
+			t.Error(err)
+		}
+		if len(order) != 3 || order[0] != "early" || order[1] != "default" || order[2] != "late" {
+			t.Errorf("Unexpected hook order %v", order)
+		}
+
+		err := coreControl.BindPostLoginSuccess("early", DefaultPriority, &MockOrderedHook{})
+		if err != ErrorDuplicateBinding {
+			t.Errorf("Expected ErrorDuplicateBinding (received %v)", err)
+		}
+		err = coreControl.BindActionHandler("mock-action", &mockHandler)
+		if err != ErrorDuplicateBinding {
+			t.Errorf("Expected ErrorDuplicateBinding (received %v)", err)
+		}
+
+		found := 0
+		for _, h := range coreControl.Hooks() {
+			if h.Chain == ChainPostLoginSuccess {
+				found++
+			}
+		}
+		if found != 3 {
+			t.Errorf("Expected three post login success hooks listed (found %d)", found)
+		}
+	})
+
+	t.Run("Hooks are bound to requests where supported", func(t *testing.T) {
+		seen := make([]*api.RequestContext, 0)
+		if err := coreControl.BindPostLoginSuccess("request", DefaultPriority, &MockRequestHook{seen: &seen}); err != nil {
+			t.Error(err)
+		}
+
+		request := api.RequestContext{RequestID: "request-id", IP: "127.0.0.1", UserAgent: "test-agent"}
+		if err := coreControl.WithRequest(&request).PostLoginSuccess(nil); err != nil {
+			t.Error(err)
+		}
+		if err := coreControl.PostLoginSuccess(nil); err != nil {
+			t.Error(err)
+		}
+
+		if len(seen) != 2 || seen[0] != &request || seen[1] != nil {
+			t.Errorf("Unexpected hook request contexts %+v", seen)
+		}
+	})
+
 	t.Run("Bind event handlers", func(t *testing.T) {
 
 	})
@@ -17,7 +17,8 @@ func (coreModule *Controller) CheckSecondFactors(userid string) (bool, map[strin
 	availableHandlers := make(map[string]bool)
 	secondFactorRequired := false
 
-	for key, handler := range coreModule.secondFactorHandlers {
+	for _, e := range coreModule.secondFactorHandlers.entries {
+		key, handler := e.name, e.hook.(SecondFactorProvider)
 		supported := handler.IsSupported(userid)
 		if supported {
 			secondFactorRequired = true
@@ -44,8 +45,17 @@ func (coreModule *Controller) HandleToken(userid string, user interface{}, token
 		return false, err
 	}
 
-	// Execute token action
-	err = tokenHandler.HandleToken(userid, *action)
+	// Execute token action, passing bound data to handlers that require it
+	if dataHandler, ok := tokenHandler.(TokenDataHandler); ok {
+		data, err := coreModule.tokenControl.GetTokenData(tokenString)
+		if err != nil {
+			log.Printf("CoreModule.HandleToken: token parsing failed %s\n", err)
+			return false, nil
+		}
+		err = dataHandler.HandleTokenData(userid, *action, data)
+	} else {
+		err = tokenHandler.HandleToken(userid, *action)
+	}
 	if err != nil {
 		log.Printf("CoreModule.HandleToken: token action %s handler error %s\n", action, err)
 		return false, err
@@ -55,6 +65,54 @@ func (coreModule *Controller) HandleToken(userid string, user interface{}, token
 	return true, nil
 }
 
+// IsAnonymousToken checks whether a token string is valid for an action applied without logging in
+func (coreModule *Controller) IsAnonymousToken(tokenString string) bool {
+	userid, err := coreModule.tokenControl.GetTokenSubject(tokenString)
+	if err != nil {
+		return false
+	}
+
+	action, err := coreModule.tokenControl.ValidateToken(userid, tokenString)
+	if err != nil {
+		return false
+	}
+
+	return coreModule.anonymousActions[*action]
+}
+
+// HandleAnonymousToken handles a token string for a user that is not logged in
+// Only actions that may be applied without logging in are executed, returning false for other actions
+func (coreModule *Controller) HandleAnonymousToken(tokenString string) (bool, error) {
+	userid, err := coreModule.tokenControl.GetTokenSubject(tokenString)
+	if err != nil {
+		log.Printf("CoreModule.HandleAnonymousToken: token parsing failed %s\n", err)
+		return false, nil
+	}
+
+	action, err := coreModule.tokenControl.ValidateToken(userid, tokenString)
+	if err != nil {
+		log.Printf("CoreModule.HandleAnonymousToken: token validation failed %s\n", err)
+		return false, nil
+	}
+	if !coreModule.anonymousActions[*action] {
+		return false, nil
+	}
+
+	ok, err := coreModule.HandleToken(userid, nil, tokenString)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	// Anonymous tokens are single use as they are not bound to a session
+	err = coreModule.tokenControl.SetUsed(tokenString)
+	if err != nil {
+		log.Printf("CoreModule.HandleAnonymousToken: error marking token used %s\n", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
 // HandleRecoveryToken handles a password reset or account recovery token
 func (coreModule *Controller) HandleRecoveryToken(email string, tokenString string) (bool, interface{}, error) {
 
@@ -81,10 +139,15 @@ func (coreModule *Controller) HandleRecoveryToken(email string, tokenString stri
 	return true, u, nil
 }
 
-// PreLogin Runs bound login handlers to accept user logins
+// PreLogin Runs bound login handlers in priority order to accept user logins
 func (coreModule *Controller) PreLogin(u interface{}) (bool, error) {
-	for key, handler := range coreModule.preLogin {
+	for _, e := range coreModule.preLogin.entries {
+		key, handler := e.name, e.hook.(PreLoginHook)
 		ok, err := handler.PreLogin(u)
+		if blocked, isBlocked := err.(*api.LoginBlockedError); isBlocked {
+			log.Printf("CoreModule.LoginHandlers: login blocked by handler %s (%s)", key, blocked.Reason)
+			return false, blocked
+		}
 		if err != nil {
 			log.Printf("CoreModule.LoginHandlers: error in handler %s (%s)", key, err)
 			return false, err
@@ -98,9 +161,23 @@ func (coreModule *Controller) PreLogin(u interface{}) (bool, error) {
 	return true, nil
 }
 
+// LoginContext Runs bound login context handlers with the client context of a login
+func (coreModule *Controller) LoginContext(u interface{}, login *api.LoginContext) error {
+	for _, e := range coreModule.loginContext.entries {
+		key, handler := e.name, e.hook.(LoginContextHook)
+		err := handler.LoginContext(u, login)
+		if err != nil {
+			log.Printf("CoreModule.LoginContext: error in handler %s (%s)", key, err)
+			return err
+		}
+	}
+	return nil
+}
+
 // PostLoginSuccess Runs bound post login success handlers
 func (coreModule *Controller) PostLoginSuccess(u interface{}) error {
-	for key, handler := range coreModule.postLoginSuccess {
+	for _, e := range coreModule.postLoginSuccess.entries {
+		key, handler := e.name, e.hook.(PostLoginSuccessHook)
 		err := handler.PostLoginSuccess(u)
 		if err != nil {
 			log.Printf("CoreModule.PostLoginSuccess: error in handler %s (%s)", key, err)
@@ -110,9 +187,21 @@ func (coreModule *Controller) PostLoginSuccess(u interface{}) error {
 	return nil
 }
 
+// CompleteLogin runs bound post login success handlers for logins completed with a second factor
+func (coreModule *Controller) CompleteLogin(userid string, request *api.RequestContext) error {
+	u, err := coreModule.userControl.LoadUser(userid)
+	if err != nil {
+		log.Printf("CoreModule.CompleteLogin: error fetching user %s (%s)", userid, err)
+		return err
+	}
+
+	return coreModule.WithRequest(request).PostLoginSuccess(u)
+}
+
 // PostLoginFailure Runs bound post login failure handlers
 func (coreModule *Controller) PostLoginFailure(u interface{}) error {
-	for key, handler := range coreModule.postLoginFailure {
+	for _, e := range coreModule.postLoginFailure.entries {
+		key, handler := e.name, e.hook.(PostLoginFailureHook)
 		err := handler.PostLoginFailure(u)
 		if err != nil {
 			log.Printf("CoreModule.PostLoginFailure: error in handler %s (%s)", key, err)
@@ -122,10 +211,75 @@ func (coreModule *Controller) PostLoginFailure(u interface{}) error {
 	return nil
 }
 
+// PasswordChangeRequired Runs bound password change handlers to check whether a password change is required
+func (coreModule *Controller) PasswordChangeRequired(u interface{}) (bool, error) {
+	for _, e := range coreModule.passwordChange.entries {
+		key, handler := e.name, e.hook.(PasswordChangeHook)
+		required, err := handler.PasswordChangeRequired(u)
+		if err != nil {
+			log.Printf("CoreModule.PasswordChangeRequired: error in handler %s (%s)", key, err)
+			return false, err
+		}
+		if required {
+			log.Printf("CoreModule.PasswordChangeRequired: password change required by handler %s", key)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SecondFactorEnrolmentRequired Runs bound second factor enrolment handlers to check whether a user
+// without a second factor must enrol one prior to login
+func (coreModule *Controller) SecondFactorEnrolmentRequired(u interface{}) (bool, error) {
+	for _, e := range coreModule.secondFactorEnrolment.entries {
+		key, handler := e.name, e.hook.(SecondFactorEnrolmentHook)
+		required, err := handler.SecondFactorEnrolmentRequired(u)
+		if err != nil {
+			log.Printf("CoreModule.SecondFactorEnrolmentRequired: error in handler %s (%s)", key, err)
+			return false, err
+		}
+		if required {
+			log.Printf("CoreModule.SecondFactorEnrolmentRequired: second factor enrolment required by handler %s", key)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PreCreate Runs bound pre create handlers to accept or reject account registrations
+// Registrations rejected without an *api.RegistrationError are rejected as unavailable
+func (coreModule *Controller) PreCreate(reg *api.Registration) error {
+	for _, e := range coreModule.preCreate.entries {
+		key, handler := e.name, e.hook.(PreCreateHook)
+		err := handler.PreCreate(reg)
+		if err == nil {
+			continue
+		}
+		if regErr, ok := err.(*api.RegistrationError); ok {
+			log.Printf("CoreModule.PreCreate: registration rejected by handler %s (%s)", key, regErr.Reason)
+			return &api.RegistrationError{Reason: regErr.Reason, Hook: key}
+		}
+		log.Printf("CoreModule.PreCreate: error in handler %s (%s)", key, err)
+		return &api.RegistrationError{Reason: api.RegistrationReasonUnavailable, Hook: key}
+	}
+	return nil
+}
+
+// PostCreate Runs bound post create handlers
+func (coreModule *Controller) PostCreate(u interface{}, reg *api.Registration) error {
+	for _, e := range coreModule.postCreate.entries {
+		key, handler := e.name, e.hook.(PostCreateHook)
+		err := handler.PostCreate(u, reg)
+		if err != nil {
+			log.Printf("CoreModule.PostCreate: error in handler %s (%s)", key, err)
+			return err
+		}
+	}
+	return nil
+}
 
 // PostLoginFailure Runs bound post login failure handlers
 func (coreModule *Controller) PasswordResetStart(email string) error {
-	
-	
+
 	return nil
 }
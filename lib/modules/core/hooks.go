@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// DefaultPriority is the priority used for hooks bound without an explicit priority
+// Hooks with lower priority values are run first, hooks of equal priority are run in binding order
+const DefaultPriority = 100
+
+// Hook chain names, used to identify bound hooks
+const (
+	ChainSecondFactor      = "second-factor"
+	ChainTokenAction       = "token-action"
+	ChainEvent             = "event"
+	ChainPreLogin          = "pre-login"
+	ChainLoginContext      = "login-context"
+	ChainPostLoginSuccess  = "post-login-success"
+	ChainPostLoginFailure  = "post-login-failure"
+	ChainPasswordChange    = "password-change"
+	ChainSecondFactorEnrol = "second-factor-enrolment"
+	ChainPreCreate         = "pre-create"
+	ChainPostCreate        = "post-create"
+)
+
+// ErrorDuplicateBinding is returned when a hook is bound with a name (or action) that is already bound
+var ErrorDuplicateBinding = errors.New("Core Controller: a hook with this name is already bound")
+
+// HookInfo describes a bound hook for diagnostics
+type HookInfo struct {
+	Chain    string
+	Name     string
+	Priority int
+}
+
+// hookEntry is a named hook bound to a hook chain
+type hookEntry struct {
+	name     string
+	priority int
+	hook     interface{}
+}
+
+// hookChain is a list of hooks ordered by priority then binding order
+type hookChain struct {
+	entries []hookEntry
+}
+
+// has checks whether a hook with the provided name is bound to the chain
+func (hc *hookChain) has(name string) bool {
+	for _, e := range hc.entries {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// add binds a hook to the chain, failing if a hook with the same name is already bound
+func (hc *hookChain) add(name string, priority int, hook interface{}) error {
+	if hc.has(name) {
+		return ErrorDuplicateBinding
+	}
+
+	hc.entries = append(hc.entries, hookEntry{name, priority, hook})
+	sort.SliceStable(hc.entries, func(i, j int) bool {
+		return hc.entries[i].priority < hc.entries[j].priority
+	})
+
+	return nil
+}
+
+// info lists the hooks bound to the chain in execution order
+func (hc *hookChain) info(chain string) []HookInfo {
+	info := make([]HookInfo, len(hc.entries))
+	for i, e := range hc.entries {
+		info[i] = HookInfo{Chain: chain, Name: e.name, Priority: e.priority}
+	}
+	return info
+}
+
+// withRequest creates a copy of the chain with hooks bound to a request where supported
+func (hc *hookChain) withRequest(request *api.RequestContext) hookChain {
+	entries := make([]hookEntry, len(hc.entries))
+	for i, e := range hc.entries {
+		entries[i] = hookEntry{e.name, e.priority, bindRequest(e.hook, request)}
+	}
+	return hookChain{entries}
+}
@@ -1,14 +1,22 @@
 package core
 
 import (
+	"log"
+	"sort"
+
 	"github.com/ryankurte/authplz/lib/api"
 )
 
 // BindActionHandler Binds a token action handler instance to the core module
 // Token actions are validated and executed following successful login
-func (coreModule *Controller) BindActionHandler(action api.TokenAction, thi TokenHandler) {
-	// TODO: check if exists before attaching and throw an error
+// Each action can only be bound to a single handler
+func (coreModule *Controller) BindActionHandler(action api.TokenAction, thi TokenHandler) error {
+	if _, ok := coreModule.tokenHandlers[action]; ok {
+		log.Printf("CoreModule.BindActionHandler: action %s already bound", action)
+		return ErrorDuplicateBinding
+	}
 	coreModule.tokenHandlers[action] = thi
+	return nil
 }
 
 // BindSecondFactor Binds a 2fa handler instance into the core module
@@ -16,51 +24,159 @@ func (coreModule *Controller) BindActionHandler(action api.TokenAction, thi Toke
 // If any 2fa module returns true, login will be halted, the user alerted (with available options),
 // and a 2fa-pending session variable set in the global context for a 2fa implementation to
 // pick up
-func (coreModule *Controller) BindSecondFactor(name string, sfi SecondFactorProvider) {
-	// TODO: check if exists before attaching and throw an error
-	coreModule.secondFactorHandlers[name] = sfi
+func (coreModule *Controller) BindSecondFactor(name string, sfi SecondFactorProvider) error {
+	return coreModule.bind(&coreModule.secondFactorHandlers, ChainSecondFactor, name, DefaultPriority, sfi)
 }
 
 // BindEventHandler Binds an event handler interface into the core module
 // Event handlers are called during a variety of evens
-func (coreModule *Controller) BindEventHandler(name string, ehi EventHandler) {
-	coreModule.eventHandlers[name] = ehi
+func (coreModule *Controller) BindEventHandler(name string, priority int, ehi EventHandler) error {
+	return coreModule.bind(&coreModule.eventHandlers, ChainEvent, name, priority, ehi)
 }
 
 // BindPreLogin Binds a PreLogin handler interface to the core module
 // PreLogin handlers are called in the login chain to check login requirements
-func (coreModule *Controller) BindPreLogin(name string, lhi PreLoginHook) {
-	coreModule.preLogin[name] = lhi
+func (coreModule *Controller) BindPreLogin(name string, priority int, lhi PreLoginHook) error {
+	return coreModule.bind(&coreModule.preLogin, ChainPreLogin, name, priority, lhi)
+}
+
+// BindLoginContext binds a LoginContext handler interface to the core module
+// This handler will be called with the client context of logins once credentials are accepted
+func (coreModule *Controller) BindLoginContext(name string, priority int, lci LoginContextHook) error {
+	return coreModule.bind(&coreModule.loginContext, ChainLoginContext, name, priority, lci)
 }
 
 // BindPostLoginSuccess binds a PostLoginSuccess handler interface to the core module
 // This handler will be called on successful logins
-func (coreModule *Controller) BindPostLoginSuccess(name string, plsi PostLoginSuccessHook) {
-	coreModule.postLoginSuccess[name] = plsi
+func (coreModule *Controller) BindPostLoginSuccess(name string, priority int, plsi PostLoginSuccessHook) error {
+	return coreModule.bind(&coreModule.postLoginSuccess, ChainPostLoginSuccess, name, priority, plsi)
 }
 
 // BindPostLoginFailure binds a PostLoginFailure handler interface to the core module
 // This handler will be called on failed logins
-func (coreModule *Controller) BindPostLoginFailure(name string, plfi PostLoginFailureHook) {
-	coreModule.postLoginFailure[name] = plfi
+func (coreModule *Controller) BindPostLoginFailure(name string, priority int, plfi PostLoginFailureHook) error {
+	return coreModule.bind(&coreModule.postLoginFailure, ChainPostLoginFailure, name, priority, plfi)
+}
+
+// BindPasswordChange binds a PasswordChange handler interface to the core module
+// This handler will be called following login to check whether a password change is required
+func (coreModule *Controller) BindPasswordChange(name string, priority int, pchi PasswordChangeHook) error {
+	return coreModule.bind(&coreModule.passwordChange, ChainPasswordChange, name, priority, pchi)
+}
+
+// BindSecondFactorEnrolment binds a SecondFactorEnrolment handler interface to the core module
+// This handler will be called following login of users without second factors to check whether enrolment is required
+func (coreModule *Controller) BindSecondFactorEnrolment(name string, priority int, sfei SecondFactorEnrolmentHook) error {
+	return coreModule.bind(&coreModule.secondFactorEnrolment, ChainSecondFactorEnrol, name, priority, sfei)
+}
+
+// BindPreCreate binds a PreCreate handler interface to the core module
+// This handler will be called prior to account creation and may reject or enrich the registration
+func (coreModule *Controller) BindPreCreate(name string, priority int, pci PreCreateHook) error {
+	return coreModule.bind(&coreModule.preCreate, ChainPreCreate, name, priority, pci)
+}
+
+// BindPostCreate binds a PostCreate handler interface to the core module
+// This handler will be called following account creation
+func (coreModule *Controller) BindPostCreate(name string, priority int, pci PostCreateHook) error {
+	return coreModule.bind(&coreModule.postCreate, ChainPostCreate, name, priority, pci)
+}
+
+// bind adds a hook to the provided hook chain
+func (coreModule *Controller) bind(hc *hookChain, chain, name string, priority int, hook interface{}) error {
+	err := hc.add(name, priority, hook)
+	if err != nil {
+		log.Printf("CoreModule.Bind: %s hook %s already bound", chain, name)
+		return err
+	}
+	return nil
 }
 
 // BindModule Magic binding function, detects interfaces implemented by a given module
-// and binds as appropriate
-func (coreModule *Controller) BindModule(name string, mod interface{}) {
-	if i, ok := mod.(SecondFactorProvider); ok {
-		coreModule.BindSecondFactor(name, i)
+// and binds as appropriate using the default priority
+func (coreModule *Controller) BindModule(name string, mod interface{}) error {
+	return coreModule.BindModuleWithPriority(name, DefaultPriority, mod)
+}
+
+// BindModuleWithPriority detects interfaces implemented by a given module and binds each
+// with the provided priority. No hooks are bound if any would duplicate an existing binding
+func (coreModule *Controller) BindModuleWithPriority(name string, priority int, mod interface{}) error {
+	chains := coreModule.moduleChains(mod)
+
+	for chain, hc := range chains {
+		if hc.has(name) {
+			log.Printf("CoreModule.BindModule: %s hook %s already bound", chain, name)
+			return ErrorDuplicateBinding
+		}
 	}
-	if i, ok := mod.(EventHandler); ok {
-		coreModule.BindEventHandler(name, i)
+
+	for chain, hc := range chains {
+		if err := coreModule.bind(hc, chain, name, priority, mod); err != nil {
+			return err
+		}
 	}
-	if i, ok := mod.(PreLoginHook); ok {
-		coreModule.BindPreLogin(name, i)
+
+	return nil
+}
+
+// moduleChains fetches the hook chains a module implements the interfaces for
+func (coreModule *Controller) moduleChains(mod interface{}) map[string]*hookChain {
+	chains := make(map[string]*hookChain)
+
+	if _, ok := mod.(SecondFactorProvider); ok {
+		chains[ChainSecondFactor] = &coreModule.secondFactorHandlers
+	}
+	if _, ok := mod.(EventHandler); ok {
+		chains[ChainEvent] = &coreModule.eventHandlers
+	}
+	if _, ok := mod.(PreLoginHook); ok {
+		chains[ChainPreLogin] = &coreModule.preLogin
+	}
+	if _, ok := mod.(LoginContextHook); ok {
+		chains[ChainLoginContext] = &coreModule.loginContext
+	}
+	if _, ok := mod.(PostLoginSuccessHook); ok {
+		chains[ChainPostLoginSuccess] = &coreModule.postLoginSuccess
+	}
+	if _, ok := mod.(PostLoginFailureHook); ok {
+		chains[ChainPostLoginFailure] = &coreModule.postLoginFailure
 	}
-	if i, ok := mod.(PostLoginSuccessHook); ok {
-		coreModule.BindPostLoginSuccess(name, i)
+	if _, ok := mod.(PasswordChangeHook); ok {
+		chains[ChainPasswordChange] = &coreModule.passwordChange
 	}
-	if i, ok := mod.(PostLoginFailureHook); ok {
-		coreModule.BindPostLoginFailure(name, i)
+	if _, ok := mod.(SecondFactorEnrolmentHook); ok {
+		chains[ChainSecondFactorEnrol] = &coreModule.secondFactorEnrolment
 	}
+	if _, ok := mod.(PreCreateHook); ok {
+		chains[ChainPreCreate] = &coreModule.preCreate
+	}
+	if _, ok := mod.(PostCreateHook); ok {
+		chains[ChainPostCreate] = &coreModule.postCreate
+	}
+
+	return chains
+}
+
+// Hooks lists the bound hooks and token actions for diagnostics
+// Hooks are listed in execution order for each chain
+func (coreModule *Controller) Hooks() []HookInfo {
+	hooks := make([]HookInfo, 0)
+
+	for action := range coreModule.tokenHandlers {
+		hooks = append(hooks, HookInfo{Chain: ChainTokenAction, Name: string(action)})
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Name < hooks[j].Name })
+
+	hooks = append(hooks, coreModule.secondFactorHandlers.info(ChainSecondFactor)...)
+	hooks = append(hooks, coreModule.eventHandlers.info(ChainEvent)...)
+	hooks = append(hooks, coreModule.preLogin.info(ChainPreLogin)...)
+	hooks = append(hooks, coreModule.loginContext.info(ChainLoginContext)...)
+	hooks = append(hooks, coreModule.postLoginSuccess.info(ChainPostLoginSuccess)...)
+	hooks = append(hooks, coreModule.postLoginFailure.info(ChainPostLoginFailure)...)
+	hooks = append(hooks, coreModule.passwordChange.info(ChainPasswordChange)...)
+	hooks = append(hooks, coreModule.secondFactorEnrolment.info(ChainSecondFactorEnrol)...)
+	hooks = append(hooks, coreModule.preCreate.info(ChainPreCreate)...)
+	hooks = append(hooks, coreModule.postCreate.info(ChainPostCreate)...)
+
+	return hooks
 }
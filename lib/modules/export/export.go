@@ -0,0 +1,318 @@
+/*
+ * Export Module
+ * Generates personal data exports for account holders
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// Export control errors
+var (
+	ErrorExportNotFound = errors.New("Export Controller: export not found")
+	ErrorExportPending  = errors.New("Export Controller: an export is already pending")
+	ErrorExportExpired  = errors.New("Export Controller: export has expired")
+	ErrorExportFailed   = errors.New("Export Controller: export failed")
+	ErrorInternal       = errors.New("Export Controller: internal error")
+)
+
+// DefaultLifetime is the default period for which exports can be downloaded
+const DefaultLifetime = 24 * time.Hour
+
+// Controller Export controller instance
+type Controller struct {
+	store    Storer
+	oauth    OAuthProvider
+	emitter  events.EventEmitter
+	lifetime time.Duration
+}
+
+// NewController Creates a new export controller
+// Exports can be downloaded for the provided lifetime after they are requested
+func NewController(store Storer, oauth OAuthProvider, emitter events.EventEmitter, lifetime time.Duration) *Controller {
+	if lifetime == 0 {
+		lifetime = DefaultLifetime
+	}
+	return &Controller{store: store, oauth: oauth, emitter: emitter, lifetime: lifetime}
+}
+
+// WithRequest creates a copy of the export controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (ec *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *ec
+	c.emitter = events.NewRequestEmitter(ec.emitter, request)
+	return &c
+}
+
+// RequestExport requests a personal data export for the provided user
+// Exports are generated asynchronously, and an event is emitted on completion
+func (ec *Controller) RequestExport(userid string) (*api.DataExportStatus, error) {
+	// Only allow one pending export at a time
+	exports, err := ec.store.GetDataExports(userid)
+	if err != nil {
+		log.Printf("ExportModule.RequestExport: error fetching exports (%s)", err)
+		return nil, ErrorInternal
+	}
+	for _, e := range exports {
+		if e.(Export).GetStatus() == api.DataExportPending {
+			return nil, ErrorExportPending
+		}
+	}
+
+	exportID := uuid.NewV4().String()
+	e, err := ec.store.AddDataExport(userid, exportID, api.DataExportPending, time.Now().Add(ec.lifetime))
+	if err != nil {
+		log.Printf("ExportModule.RequestExport: error creating export (%s)", err)
+		return nil, ErrorInternal
+	}
+
+	data := map[string]string{"Export": exportID}
+	ec.emitter.SendEvent(events.NewEvent(userid, events.EventDataExportRequested, data))
+
+	log.Printf("ExportModule.RequestExport: user %s requested export %s", userid, exportID)
+
+	return exportStatus(e.(Export)), nil
+}
+
+// ListExports lists the unexpired data exports for the provided user
+func (ec *Controller) ListExports(userid string) ([]api.DataExportStatus, error) {
+	exports, err := ec.store.GetDataExports(userid)
+	if err != nil {
+		log.Printf("ExportModule.ListExports: error fetching exports (%s)", err)
+		return nil, ErrorInternal
+	}
+
+	statuses := make([]api.DataExportStatus, 0)
+	for _, e := range exports {
+		export := e.(Export)
+		if time.Now().After(export.GetExpiresAt()) {
+			continue
+		}
+		statuses = append(statuses, *exportStatus(export))
+	}
+
+	return statuses, nil
+}
+
+// GetExport fetches the archive for a completed export belonging to the provided user
+func (ec *Controller) GetExport(userid, exportID string) ([]byte, error) {
+	e, err := ec.store.GetDataExport(exportID)
+	if err != nil {
+		log.Printf("ExportModule.GetExport: error fetching export (%s)", err)
+		return nil, ErrorInternal
+	}
+	if e == nil {
+		return nil, ErrorExportNotFound
+	}
+
+	export := e.(Export)
+
+	// Exports are only available to their owner
+	if export.GetUserExtID() != userid {
+		log.Printf("ExportModule.GetExport: user %s attempted to access export %s", userid, exportID)
+		return nil, ErrorExportNotFound
+	}
+	if time.Now().After(export.GetExpiresAt()) {
+		return nil, ErrorExportExpired
+	}
+
+	switch export.GetStatus() {
+	case api.DataExportComplete:
+	case api.DataExportPending:
+		return nil, ErrorExportPending
+	default:
+		return nil, ErrorExportFailed
+	}
+
+	return []byte(export.GetData()), nil
+}
+
+// PurgeExpired removes expired exports
+func (ec *Controller) PurgeExpired() error {
+	err := ec.store.RemoveExpiredDataExports(time.Now())
+	if err != nil {
+		log.Printf("ExportModule.PurgeExpired: error removing expired exports (%s)", err)
+		return ErrorInternal
+	}
+	return nil
+}
+
+// HandleEvent handles async events for go-async
+// Exports are generated in response to EventDataExportRequested events
+func (ec *Controller) HandleEvent(event interface{}) error {
+	e := event.(Event)
+	if e.GetType() != events.EventDataExportRequested {
+		return nil
+	}
+
+	userid, exportID := e.GetUserExtID(), e.GetData()["Export"]
+	data := map[string]string{"Export": exportID}
+
+	export, err := ec.generate(userid, exportID)
+	if err != nil {
+		log.Printf("ExportModule.HandleEvent: error generating export %s (%s)", exportID, err)
+		ec.emitter.SendEvent(events.NewEvent(userid, events.EventDataExportFailed, data))
+		return err
+	}
+
+	data["Expires"] = export.GetExpiresAt().Format(time.RFC1123)
+	ec.emitter.SendEvent(events.NewEvent(userid, events.EventDataExportReady, data))
+
+	log.Printf("ExportModule.HandleEvent: generated export %s for user %s", exportID, userid)
+
+	return nil
+}
+
+// generate builds and stores the archive for a pending export
+func (ec *Controller) generate(userid, exportID string) (Export, error) {
+	e, err := ec.store.GetDataExport(exportID)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrorExportNotFound
+	}
+	export := e.(Export)
+
+	status, data := api.DataExportComplete, ""
+
+	archive, err := ec.buildArchive(userid)
+	if err == nil {
+		var encoded []byte
+		encoded, err = json.MarshalIndent(archive, "", "  ")
+		data = string(encoded)
+	}
+	if err != nil {
+		status, data = api.DataExportFailed, ""
+	}
+
+	export.SetComplete(status, data)
+	if _, updateErr := ec.store.UpdateDataExport(export); updateErr != nil {
+		return nil, updateErr
+	}
+
+	return export, err
+}
+
+// buildArchive gathers the data held for a user account
+func (ec *Controller) buildArchive(userid string) (*api.DataExport, error) {
+	u, err := ec.store.GetUserByExtID(userid)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("user %s not found", userid)
+	}
+	user := u.(User)
+
+	archive := api.DataExport{
+		Generated: time.Now(),
+		User: api.DataExportUser{
+			ExtID:           user.GetExtID(),
+			Email:           user.GetEmail(),
+			Username:        user.GetUsername(),
+			CreatedAt:       user.GetCreatedAt(),
+			LastLogin:       user.GetLastLogin(),
+			PasswordChanged: user.GetPasswordChanged(),
+			Activated:       user.IsActivated(),
+			Enabled:         user.IsEnabled(),
+			Locked:          user.IsLocked(),
+			Admin:           user.IsAdmin(),
+		},
+	}
+
+	// Second factor metadata, secrets are never exported
+	totpTokens, err := ec.store.GetTotpTokens(userid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range totpTokens {
+		t := v.(TOTPToken)
+		archive.TOTP = append(archive.TOTP, api.TOTPToken{Name: t.GetName(), LastUsed: t.GetLastUsed(), UsageCount: t.GetCounter()})
+	}
+
+	fidoTokens, err := ec.store.GetFidoTokens(userid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range fidoTokens {
+		t := v.(U2FToken)
+		archive.U2F = append(archive.U2F, api.U2FToken{Name: t.GetName(), KeyHandle: t.GetKeyHandle(), Counter: t.GetCounter(), LastUsed: t.GetLastUsed()})
+	}
+
+	backupCodes, err := ec.store.GetBackupTokens(userid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range backupCodes {
+		c := v.(BackupCode)
+		archive.Backup = append(archive.Backup, api.BackupCode{Name: c.GetName(), Used: c.IsUsed(), CreatedAt: c.GetCreatedAt(), UsedAt: c.GetUsedAt()})
+	}
+
+	// OAuth clients and grants
+	archive.OAuthClients, err = ec.oauth.GetClients(userid)
+	if err != nil {
+		return nil, err
+	}
+	for i := range archive.OAuthClients {
+		archive.OAuthClients[i].Secret = ""
+	}
+
+	sessions, err := ec.oauth.GetUserSessions(userid)
+	if err != nil {
+		return nil, err
+	}
+	archive.OAuthSessions = *sessions
+
+	// Audit events
+	auditEvents, err := ec.store.GetAuditEvents(userid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range auditEvents {
+		r := v.(AuditRecord)
+		data, err := r.GetData()
+		if err != nil {
+			return nil, err
+		}
+		archive.AuditEvents = append(archive.AuditEvents, api.AuditEvent{
+			Type:      r.GetType(),
+			Time:      r.GetTime(),
+			Data:      data,
+			RequestID: r.GetRequestID(),
+			IP:        r.GetIP(),
+			UserAgent: r.GetUserAgent(),
+		})
+	}
+
+	return &archive, nil
+}
+
+// exportStatus maps an export to an API safe status object
+func exportStatus(export Export) *api.DataExportStatus {
+	status := api.DataExportStatus{
+		ID:          export.GetExportID(),
+		Status:      export.GetStatus(),
+		CreatedAt:   export.GetCreatedAt(),
+		CompletedAt: export.GetCompletedAt(),
+		ExpiresAt:   export.GetExpiresAt(),
+	}
+	if status.Status == api.DataExportComplete {
+		status.URL = fmt.Sprintf("/api/export/%s", status.ID)
+	}
+	return &status
+}
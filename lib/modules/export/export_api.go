@@ -0,0 +1,122 @@
+/*
+ * Export Module API
+ * Provides personal data export endpoints
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package export
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gocraft/web"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/appcontext"
+)
+
+// apiCtx API context instance
+type apiCtx struct {
+	// Base context required by router
+	*appcontext.AuthPlzCtx
+	// Export module instance
+	ec *Controller
+}
+
+// BindExportContext Helper middleware to bind module to API context
+func BindExportContext(ec *Controller) func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	return func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+		ctx.ec = ec.WithRequest(ctx.GetRequestContext()).(*Controller)
+		next(rw, req)
+	}
+}
+
+// BindAPI Binds the export API to the provided router
+func (ec *Controller) BindAPI(router *web.Router) {
+	// Create router for export module
+	exportRouter := router.Subrouter(apiCtx{}, "/api/export")
+
+	// Attach module context
+	exportRouter.Middleware(BindExportContext(ec))
+	exportRouter.Middleware((*apiCtx).RequireLoginMiddleware)
+
+	// Bind endpoints
+	exportRouter.Get("/", (*apiCtx).ExportsGet)
+	exportRouter.Post("/", (*apiCtx).ExportPost)
+	exportRouter.Get("/:id", (*apiCtx).ExportDownloadGet)
+}
+
+// RequireLoginMiddleware restricts access to logged in users who are not being impersonated
+func (c *apiCtx) RequireLoginMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	next(rw, req)
+}
+
+// ExportsGet lists the data exports for the logged in user
+func (c *apiCtx) ExportsGet(rw web.ResponseWriter, req *web.Request) {
+	exports, err := c.ec.ListExports(c.GetUserID())
+	if err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteJson(rw, exports)
+}
+
+// ExportPost requests a data export for the logged in user
+// A download link is emailed to the user once the export is complete
+func (c *apiCtx) ExportPost(rw web.ResponseWriter, req *web.Request) {
+	status, err := c.ec.RequestExport(c.GetUserID())
+	switch err {
+	case nil:
+	case ErrorExportPending:
+		c.WriteApiResultWithCode(rw, http.StatusConflict, api.ResultError, c.GetAPILocale().ExportPending)
+		return
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusAccepted)
+	c.WriteJson(rw, status)
+}
+
+// ExportDownloadGet downloads a completed data export archive
+func (c *apiCtx) ExportDownloadGet(rw web.ResponseWriter, req *web.Request) {
+	exportID := req.PathParams["id"]
+
+	data, err := c.ec.GetExport(c.GetUserID(), exportID)
+	switch err {
+	case nil:
+	case ErrorExportNotFound, ErrorExportFailed:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().ExportNotFound)
+		return
+	case ErrorExportPending:
+		c.WriteApiResultWithCode(rw, http.StatusConflict, api.ResultError, c.GetAPILocale().ExportPending)
+		return
+	case ErrorExportExpired:
+		c.WriteApiResultWithCode(rw, http.StatusGone, api.ResultError, c.GetAPILocale().ExportExpired)
+		return
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"authplz-export-%s.json\"", exportID))
+	rw.Write(data)
+}
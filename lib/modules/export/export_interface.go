@@ -0,0 +1,104 @@
+/*
+ * Export Module interfaces
+ * Defines interfaces required by the Export module
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package export
+
+import (
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// User Defines the User object interfaces required by this module
+type User interface {
+	GetExtID() string
+	GetEmail() string
+	GetUsername() string
+	GetCreatedAt() time.Time
+	GetLastLogin() time.Time
+	GetPasswordChanged() time.Time
+	IsActivated() bool
+	IsEnabled() bool
+	IsLocked() bool
+	IsAdmin() bool
+}
+
+// TOTPToken Defines the TOTP token interfaces required by this module
+type TOTPToken interface {
+	GetName() string
+	GetCounter() uint
+	GetLastUsed() time.Time
+}
+
+// U2FToken Defines the U2F token interfaces required by this module
+type U2FToken interface {
+	GetName() string
+	GetKeyHandle() string
+	GetCounter() uint
+	GetLastUsed() time.Time
+}
+
+// BackupCode Defines the backup code interfaces required by this module
+type BackupCode interface {
+	GetName() string
+	IsUsed() bool
+	GetCreatedAt() time.Time
+	GetUsedAt() time.Time
+}
+
+// AuditRecord Defines the stored audit event interfaces required by this module
+type AuditRecord interface {
+	GetType() string
+	GetTime() time.Time
+	GetData() (map[string]string, error)
+	GetRequestID() string
+	GetIP() string
+	GetUserAgent() string
+}
+
+// Export Defines the data export object interfaces required by this module
+type Export interface {
+	GetExportID() string
+	GetUserExtID() string
+	GetStatus() string
+	GetData() string
+	GetCreatedAt() time.Time
+	GetCompletedAt() time.Time
+	GetExpiresAt() time.Time
+	SetComplete(status, data string)
+}
+
+// Event Defines the async event interfaces required by this module
+type Event interface {
+	GetUserExtID() string
+	GetType() string
+	GetData() map[string]string
+}
+
+// Storer Defines the required store interfaces for the export module
+// Returned interfaces must satisfy the User, TOTPToken, U2FToken, BackupCode, AuditRecord and Export interfaces
+type Storer interface {
+	GetUserByExtID(userid string) (interface{}, error)
+
+	GetTotpTokens(userid string) ([]interface{}, error)
+	GetFidoTokens(userid string) ([]interface{}, error)
+	GetBackupTokens(userid string) ([]interface{}, error)
+	GetAuditEvents(userid string) ([]interface{}, error)
+
+	AddDataExport(userid, exportID, status string, expiry time.Time) (interface{}, error)
+	GetDataExport(exportID string) (interface{}, error)
+	GetDataExports(userid string) ([]interface{}, error)
+	UpdateDataExport(export interface{}) (interface{}, error)
+	RemoveExpiredDataExports(t time.Time) error
+}
+
+// OAuthProvider Defines the OAuth interfaces required by this module
+type OAuthProvider interface {
+	GetClients(userID string) ([]api.OAuthClientResp, error)
+	GetUserSessions(userID string) (*api.OAuthUserSessions, error)
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/events"
+	"github.com/ryankurte/authplz/lib/test"
+)
+
+type mockOAuthProvider struct{}
+
+func (m *mockOAuthProvider) GetClients(userID string) ([]api.OAuthClientResp, error) {
+	return []api.OAuthClientResp{{ClientID: "fake-client", Secret: "fake-secret"}}, nil
+}
+
+func (m *mockOAuthProvider) GetUserSessions(userID string) (*api.OAuthUserSessions, error) {
+	return &api.OAuthUserSessions{}, nil
+}
+
+func TestExportController(t *testing.T) {
+
+	ts, err := test.NewTestServer()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	u, err := ts.DataStore.AddUser(test.FakeEmail, test.FakeName, test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	userID := u.(*datastore.User).GetExtID()
+
+	ts.DataStore.AddAuditEvent(userID, events.EventAccountCreated, time.Now(), "", "", "", map[string]string{})
+
+	ec := NewController(ts.DataStore, &mockOAuthProvider{}, ts.EventEmitter, time.Hour)
+
+	var exportID string
+
+	t.Run("Requests exports", func(t *testing.T) {
+		status, err := ec.RequestExport(userID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if status.Status != api.DataExportPending {
+			t.Errorf("Expected pending export (received %s)", status.Status)
+		}
+		exportID = status.ID
+
+		e := ts.EventEmitter.Event
+		if e.Type != events.EventDataExportRequested || e.Data["Export"] != exportID {
+			t.Errorf("Expected export request event (received %+v)", e)
+		}
+	})
+
+	t.Run("Blocks concurrent exports", func(t *testing.T) {
+		if _, err := ec.RequestExport(userID); err != ErrorExportPending {
+			t.Errorf("Expected ErrorExportPending (received %v)", err)
+		}
+		if _, err := ec.GetExport(userID, exportID); err != ErrorExportPending {
+			t.Errorf("Expected ErrorExportPending (received %v)", err)
+		}
+	})
+
+	t.Run("Generates exports on request events", func(t *testing.T) {
+		err := ec.HandleEvent(ts.EventEmitter.Event)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		e := ts.EventEmitter.Event
+		if e.Type != events.EventDataExportReady || e.Data["Export"] != exportID {
+			t.Errorf("Expected export ready event (received %+v)", e)
+		}
+	})
+
+	t.Run("Downloads completed exports", func(t *testing.T) {
+		data, err := ec.GetExport(userID, exportID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		archive := api.DataExport{}
+		if err := json.Unmarshal(data, &archive); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if archive.User.Email != test.FakeEmail {
+			t.Errorf("Export user mismatch (%+v)", archive.User)
+		}
+		if len(archive.AuditEvents) != 1 {
+			t.Errorf("Expected 1 audit event, received %d", len(archive.AuditEvents))
+		}
+		if len(archive.OAuthClients) != 1 || archive.OAuthClients[0].Secret != "" {
+			t.Errorf("Expected exported clients without secrets (%+v)", archive.OAuthClients)
+		}
+
+		exports, err := ec.ListExports(userID)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(exports) != 1 || exports[0].Status != api.DataExportComplete || exports[0].URL == "" {
+			t.Errorf("Unexpected export list (%+v)", exports)
+		}
+	})
+
+	t.Run("Restricts exports to their owner", func(t *testing.T) {
+		if _, err := ec.GetExport("fake-user", exportID); err != ErrorExportNotFound {
+			t.Errorf("Expected ErrorExportNotFound (received %v)", err)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ * IP Filter Module
+ * Restricts logins and OAuth token issuance by client network
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package ipfilter
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/appcontext"
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// IP filter control errors
+var (
+	ErrorUserNotFound           = errors.New("IP Filter Controller: user not found")
+	ErrorInvalidNetwork         = errors.New("IP Filter Controller: invalid network")
+	ErrorCurrentAddressExcluded = errors.New("IP Filter Controller: allowed networks exclude the current address")
+	ErrorInternal               = errors.New("IP Filter Controller: internal error")
+)
+
+// Reasons for blocked access, included in access blocked events
+const (
+	ReasonDenied            = "denied"
+	ReasonNotAllowed        = "not_allowed"
+	ReasonAdminNotAllowed   = "admin_not_allowed"
+	ReasonAccountNotAllowed = "account_not_allowed"
+)
+
+// Access types, included in access blocked events
+const (
+	AccessLogin          = "login"
+	AccessOAuthAuthorize = "oauth_authorize"
+	AccessOAuthToken     = "oauth_token"
+)
+
+// Controller IP filter controller instance
+type Controller struct {
+	store      Storer
+	emitter    events.EventEmitter
+	allow      []*net.IPNet
+	deny       []*net.IPNet
+	adminAllow []*net.IPNet
+	request    *api.RequestContext
+}
+
+// NewController Creates a new IP filter controller from the provided allow and deny lists
+func NewController(store Storer, emitter events.EventEmitter, cfg config.IPFilterConfig) (*Controller, error) {
+	allow, err := appcontext.ParseNetworks(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := appcontext.ParseNetworks(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+	adminAllow, err := appcontext.ParseNetworks(cfg.AdminAllow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Controller{store: store, emitter: emitter, allow: allow, deny: deny, adminAllow: adminAllow}, nil
+}
+
+// WithRequest creates a copy of the IP filter controller bound to a request
+// Logins are checked against the client address of the bound request
+func (ic *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *ic
+	c.emitter = events.NewRequestEmitter(ic.emitter, request)
+	c.request = request
+	return &c
+}
+
+// check checks an address against the configured and per-user lists, returning the reason
+// access is blocked or an empty string where access is allowed
+// Admins are checked against the admin allow list in place of the global allow list where set
+func (ic *Controller) check(user User, ip net.IP) string {
+	if appcontext.ContainsIP(ic.deny, ip) {
+		return ReasonDenied
+	}
+	if user == nil {
+		return ""
+	}
+
+	if user.IsAdmin() && len(ic.adminAllow) > 0 {
+		if !appcontext.ContainsIP(ic.adminAllow, ip) {
+			return ReasonAdminNotAllowed
+		}
+	} else if len(ic.allow) > 0 && !appcontext.ContainsIP(ic.allow, ip) {
+		return ReasonNotAllowed
+	}
+
+	networks, err := appcontext.ParseNetworks(user.GetAllowedNetworks())
+	if err != nil {
+		log.Printf("IPFilterModule.check: invalid allowed networks for user %s (%s)\r\n", user.GetExtID(), err)
+		return ReasonAccountNotAllowed
+	}
+	if len(networks) > 0 && !appcontext.ContainsIP(networks, ip) {
+		return ReasonAccountNotAllowed
+	}
+
+	return ""
+}
+
+// blocked records a blocked access attempt
+func (ic *Controller) blocked(emitter events.EventEmitter, userID, ip, reason, access string) {
+	log.Printf("IPFilterModule: blocked %s from %s for user '%s' (%s)\r\n", access, ip, userID, reason)
+
+	if userID == "" {
+		return
+	}
+
+	data := map[string]string{"IP": ip, "Reason": reason, "Access": access}
+	emitter.SendEvent(events.NewEvent(userID, events.EventAccountAccessBlocked, data))
+}
+
+// PreLogin checks the client address of the bound request against the allow and deny lists
+// Blocked logins return an *api.LoginBlockedError so the user is told the network is not permitted
+func (ic *Controller) PreLogin(u interface{}) (bool, error) {
+	if ic.request == nil {
+		return true, nil
+	}
+
+	user := u.(User)
+
+	reason := ic.check(user, net.ParseIP(ic.request.IP))
+	if reason != "" {
+		ic.blocked(ic.emitter, user.GetExtID(), ic.request.IP, reason, AccessLogin)
+		return false, &api.LoginBlockedError{Reason: api.LoginBlockedReasonNetwork}
+	}
+
+	return true, nil
+}
+
+// CheckAuthorize checks whether a user may authorize an OAuth client from the request address
+// This applies the same policy as logins
+func (ic *Controller) CheckAuthorize(userID string, request *api.RequestContext) (bool, error) {
+	u, err := ic.store.GetUserByExtID(userID)
+	if err != nil {
+		log.Printf("IPFilterModule.CheckAuthorize: error fetching user %s (%s)\r\n", userID, err)
+		return false, ErrorInternal
+	}
+	if u == nil {
+		return false, ErrorUserNotFound
+	}
+
+	reason := ic.check(u.(User), net.ParseIP(request.IP))
+	if reason != "" {
+		ic.blocked(events.NewRequestEmitter(ic.emitter, request), userID, request.IP, reason, AccessOAuthAuthorize)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// CheckToken checks whether an OAuth token may be issued to the request address
+// Where the grant identifies a user the same policy as logins applies, otherwise token requests
+// are made by client applications rather than users and only the deny list applies
+func (ic *Controller) CheckToken(userID string, request *api.RequestContext) (bool, error) {
+	var user User
+	if userID != "" {
+		u, err := ic.store.GetUserByExtID(userID)
+		if err != nil {
+			log.Printf("IPFilterModule.CheckToken: error fetching user %s (%s)\r\n", userID, err)
+			return false, ErrorInternal
+		}
+		if u != nil {
+			user = u.(User)
+		}
+	}
+
+	reason := ic.check(user, net.ParseIP(request.IP))
+	if reason != "" {
+		ic.blocked(events.NewRequestEmitter(ic.emitter, request), userID, request.IP, reason, AccessOAuthToken)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// GetAllowedNetworks fetches the networks a user may log in from
+func (ic *Controller) GetAllowedNetworks(userid string) (*api.AllowedNetworks, error) {
+	u, err := ic.store.GetUserByExtID(userid)
+	if err != nil {
+		log.Printf("IPFilterModule.GetAllowedNetworks: error fetching user %s (%s)\r\n", userid, err)
+		return nil, ErrorInternal
+	}
+	if u == nil {
+		return nil, ErrorUserNotFound
+	}
+
+	return &api.AllowedNetworks{Networks: u.(User).GetAllowedNetworks()}, nil
+}
+
+// SetAllowedNetworks sets the networks a user may log in from, an empty list removes the restriction
+// Lists that would exclude the current address are rejected to avoid users locking themselves out
+func (ic *Controller) SetAllowedNetworks(userid string, networks []string, currentIP string) error {
+	parsed, err := appcontext.ParseNetworks(networks)
+	if err != nil {
+		return ErrorInvalidNetwork
+	}
+	if len(parsed) > 0 && !appcontext.ContainsIP(parsed, net.ParseIP(currentIP)) {
+		return ErrorCurrentAddressExcluded
+	}
+
+	u, err := ic.store.GetUserByExtID(userid)
+	if err != nil {
+		log.Printf("IPFilterModule.SetAllowedNetworks: error fetching user %s (%s)\r\n", userid, err)
+		return ErrorInternal
+	}
+	if u == nil {
+		return ErrorUserNotFound
+	}
+
+	// Store normalised networks
+	normalised := make([]string, len(parsed))
+	for i, n := range parsed {
+		normalised[i] = n.String()
+	}
+
+	user := u.(User)
+	user.SetAllowedNetworks(normalised)
+
+	_, err = ic.store.UpdateUser(user)
+	if err != nil {
+		log.Printf("IPFilterModule.SetAllowedNetworks: error updating user %s (%s)\r\n", userid, err)
+		return ErrorInternal
+	}
+
+	data := map[string]string{"Networks": strings.Join(normalised, ",")}
+	ic.emitter.SendEvent(events.NewEvent(userid, events.EventAllowedNetworksUpdated, data))
+
+	log.Printf("IPFilterModule.SetAllowedNetworks: updated allowed networks for user %s\r\n", userid)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+ * IP Filter Module API
+ * Provides endpoints for managing per-account allowed networks
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package ipfilter
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gocraft/web"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/appcontext"
+)
+
+// apiCtx API context instance
+type apiCtx struct {
+	// Base context required by router
+	*appcontext.AuthPlzCtx
+	// IP filter module instance
+	ic *Controller
+}
+
+// BindIPFilterContext Helper middleware to bind module to API context
+func BindIPFilterContext(ic *Controller) func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	return func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+		ctx.ic = ic.WithRequest(ctx.GetRequestContext()).(*Controller)
+		next(rw, req)
+	}
+}
+
+// BindAPI Binds the IP filter API to the provided router
+func (ic *Controller) BindAPI(router *web.Router) {
+	// Create router for IP filter module
+	networksRouter := router.Subrouter(apiCtx{}, "/api/account/networks")
+
+	// Attach module context
+	networksRouter.Middleware(BindIPFilterContext(ic))
+	networksRouter.Middleware((*apiCtx).RequireLoginMiddleware)
+
+	// Bind endpoints
+	networksRouter.Get("/", (*apiCtx).NetworksGet)
+
+	// Updating allowed networks requires a current sudo session
+	sudoRouter := router.Subrouter(apiCtx{}, "/api/account/networks")
+	sudoRouter.Middleware(BindIPFilterContext(ic))
+	sudoRouter.Middleware((*apiCtx).RequireLoginMiddleware)
+	sudoRouter.Middleware((*apiCtx).RequireSudoMiddleware)
+
+	sudoRouter.Post("/", (*apiCtx).NetworksPost)
+}
+
+// RequireSudoMiddleware requires users to have re-authenticated prior to updating allowed networks
+func (c *apiCtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
+}
+
+// RequireLoginMiddleware restricts access to logged in users who are not being impersonated
+func (c *apiCtx) RequireLoginMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	next(rw, req)
+}
+
+// NetworksGet fetches the allowed networks for the logged in user
+func (c *apiCtx) NetworksGet(rw web.ResponseWriter, req *web.Request) {
+	networks, err := c.ic.GetAllowedNetworks(c.GetUserID())
+	if err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteJson(rw, networks)
+}
+
+// NetworksPost sets the allowed networks for the logged in user
+func (c *apiCtx) NetworksPost(rw web.ResponseWriter, req *web.Request) {
+	networks := api.AllowedNetworks{}
+	defer req.Body.Close()
+	if err := json.NewDecoder(req.Body).Decode(&networks); err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	err := c.ic.SetAllowedNetworks(c.GetUserID(), networks.Networks, c.GetRequestContext().IP)
+	switch err {
+	case nil:
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().NetworksUpdated)
+	case ErrorInvalidNetwork:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().NetworksInvalid)
+	case ErrorCurrentAddressExcluded:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().NetworksExcludeCurrent)
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+	}
+}
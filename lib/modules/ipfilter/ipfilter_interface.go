@@ -0,0 +1,23 @@
+/*
+ * IP Filter Module interfaces
+ * Defines interfaces required by the IP Filter module
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package ipfilter
+
+// User Defines the User object interfaces required by this module
+type User interface {
+	GetExtID() string
+	IsAdmin() bool
+	GetAllowedNetworks() []string
+	SetAllowedNetworks(networks []string)
+}
+
+// Storer Defines the storage interfaces required by this module
+type Storer interface {
+	GetUserByExtID(userid string) (interface{}, error)
+	UpdateUser(user interface{}) (interface{}, error)
+}
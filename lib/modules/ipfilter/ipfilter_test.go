@@ -0,0 +1,178 @@
+package ipfilter
+
+import (
+	"testing"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/events"
+	"github.com/ryankurte/authplz/lib/test"
+)
+
+func TestIPFilterController(t *testing.T) {
+
+	ts, err := test.NewTestServer()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	u, err := ts.DataStore.AddUser(test.FakeEmail, test.FakeName, test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	user := u.(*datastore.User)
+	userID := user.GetExtID()
+
+	a, err := ts.DataStore.AddUser("admin@abc.com", "admin.user", test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	admin := a.(*datastore.User)
+	admin.SetAdmin(true)
+	ts.DataStore.UpdateUser(admin)
+
+	cfg := config.IPFilterConfig{
+		Allow:      []string{"10.0.0.0/8", "192.168.0.0/16"},
+		Deny:       []string{"10.6.6.0/24"},
+		AdminAllow: []string{"192.168.1.0/24"},
+	}
+	ic, err := NewController(ts.DataStore, ts.EventEmitter, cfg)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	preLogin := func(u interface{}, ip string) bool {
+		ok, err := ic.WithRequest(&api.RequestContext{IP: ip}).(*Controller).PreLogin(u)
+		if blocked, isBlocked := err.(*api.LoginBlockedError); isBlocked {
+			if ok || blocked.Reason != api.LoginBlockedReasonNetwork {
+				t.Errorf("Unexpected blocked login result %v (%v)", ok, blocked)
+			}
+		} else if err != nil {
+			t.Error(err)
+		}
+		return ok
+	}
+
+	t.Run("Rejects invalid configuration", func(t *testing.T) {
+		_, err := NewController(ts.DataStore, ts.EventEmitter, config.IPFilterConfig{Deny: []string{"10.0.0.0/33"}})
+		if err == nil {
+			t.Errorf("Expected invalid network to be rejected")
+		}
+	})
+
+	t.Run("Allows logins from allowed networks", func(t *testing.T) {
+		if !preLogin(user, "10.1.2.3") {
+			t.Errorf("Expected login to be allowed")
+		}
+		if ok, _ := ic.PreLogin(user); !ok {
+			t.Errorf("Expected logins without a request to be allowed")
+		}
+	})
+
+	t.Run("Blocks logins from denied and unlisted networks", func(t *testing.T) {
+		if preLogin(user, "10.6.6.1") {
+			t.Errorf("Expected login from denied network to be blocked")
+		}
+		e := ts.EventEmitter.Event
+		if e.Type != events.EventAccountAccessBlocked || e.Data["Reason"] != ReasonDenied || e.GetRequest() == nil {
+			t.Errorf("Expected access blocked event (received %+v)", e)
+		}
+
+		if preLogin(user, "203.0.113.1") {
+			t.Errorf("Expected login from unlisted network to be blocked")
+		}
+		if ts.EventEmitter.Event.Data["Reason"] != ReasonNotAllowed {
+			t.Errorf("Unexpected blocked reason %s", ts.EventEmitter.Event.Data["Reason"])
+		}
+	})
+
+	t.Run("Applies the admin allow list to admins", func(t *testing.T) {
+		if !preLogin(admin, "192.168.1.10") {
+			t.Errorf("Expected admin login to be allowed")
+		}
+		if preLogin(admin, "10.1.2.3") {
+			t.Errorf("Expected admin login outside admin networks to be blocked")
+		}
+		if ts.EventEmitter.Event.Data["Reason"] != ReasonAdminNotAllowed {
+			t.Errorf("Unexpected blocked reason %s", ts.EventEmitter.Event.Data["Reason"])
+		}
+	})
+
+	t.Run("Users can set allowed networks", func(t *testing.T) {
+		err := ic.SetAllowedNetworks(userID, []string{"not-a-network"}, "10.1.2.3")
+		if err != ErrorInvalidNetwork {
+			t.Errorf("Expected ErrorInvalidNetwork (received %v)", err)
+		}
+
+		err = ic.SetAllowedNetworks(userID, []string{"10.9.0.0/16"}, "10.1.2.3")
+		if err != ErrorCurrentAddressExcluded {
+			t.Errorf("Expected ErrorCurrentAddressExcluded (received %v)", err)
+		}
+
+		err = ic.SetAllowedNetworks(userID, []string{"10.1.0.0/16"}, "10.1.2.3")
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if e := ts.EventEmitter.Event; e.Type != events.EventAllowedNetworksUpdated {
+			t.Errorf("Expected allowed networks updated event (received %+v)", e)
+		}
+
+		networks, err := ic.GetAllowedNetworks(userID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if len(networks.Networks) != 1 || networks.Networks[0] != "10.1.0.0/16" {
+			t.Errorf("Unexpected allowed networks %v", networks.Networks)
+		}
+	})
+
+	t.Run("Blocks logins outside user allowed networks", func(t *testing.T) {
+		u, _ := ts.DataStore.GetUserByExtID(userID)
+
+		if !preLogin(u, "10.1.9.9") {
+			t.Errorf("Expected login to be allowed")
+		}
+		if preLogin(u, "10.2.0.1") {
+			t.Errorf("Expected login outside user networks to be blocked")
+		}
+		if ts.EventEmitter.Event.Data["Reason"] != ReasonAccountNotAllowed {
+			t.Errorf("Unexpected blocked reason %s", ts.EventEmitter.Event.Data["Reason"])
+		}
+	})
+
+	t.Run("Checks OAuth access", func(t *testing.T) {
+		ok, err := ic.CheckAuthorize(userID, &api.RequestContext{IP: "10.2.0.1"})
+		if err != nil || ok {
+			t.Errorf("Expected authorization outside user networks to be blocked (%v)", err)
+		}
+		if ts.EventEmitter.Event.Data["Access"] != AccessOAuthAuthorize {
+			t.Errorf("Unexpected blocked access %s", ts.EventEmitter.Event.Data["Access"])
+		}
+
+		// Token requests without a user are made by client servers, so only the deny list applies
+		if ok, _ := ic.CheckToken("", &api.RequestContext{IP: "203.0.113.1"}); !ok {
+			t.Errorf("Expected token request to be allowed")
+		}
+		if ok, _ := ic.CheckToken(userID, &api.RequestContext{IP: "10.6.6.1"}); ok {
+			t.Errorf("Expected token request from denied network to be blocked")
+		}
+
+		// Token requests for a user apply the user's allowed networks
+		if ok, _ := ic.CheckToken(userID, &api.RequestContext{IP: "10.1.9.9"}); !ok {
+			t.Errorf("Expected token request within user networks to be allowed")
+		}
+		if ok, _ := ic.CheckToken(userID, &api.RequestContext{IP: "10.2.0.1"}); ok {
+			t.Errorf("Expected token request outside user networks to be blocked")
+		}
+		if ts.EventEmitter.Event.Data["Reason"] != ReasonAccountNotAllowed {
+			t.Errorf("Unexpected blocked reason %s", ts.EventEmitter.Event.Data["Reason"])
+		}
+	})
+}
@@ -4,18 +4,62 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/ory/fosite"
+
+	"github.com/ryankurte/authplz/lib/config"
 )
 
 // FositeAdaptor adapts a generic interface for osin compliance
 type FositeAdaptor struct {
-	Storer Storer
+	Storer    Storer
+	lifespans config.TokenLifespans
 }
 
 // NewAdaptor creates a new wraper/adaptor around a Storer interface
-func NewAdaptor(s Storer) *FositeAdaptor {
-	return &FositeAdaptor{s}
+// Default token lifespans are applied to sessions unless overridden by the associated client
+func NewAdaptor(s Storer, lifespans config.TokenLifespans) *FositeAdaptor {
+	return &FositeAdaptor{s, lifespans}
+}
+
+// clientLifespans fetches the effective token lifespans for a given client
+func (oa *FositeAdaptor) clientLifespans(c fosite.Client) config.TokenLifespans {
+	cw, ok := c.(*ClientWrapper)
+	if !ok {
+		return oa.lifespans
+	}
+	return oa.lifespans.Merge(config.TokenLifespans{
+		AccessToken:   cw.GetAccessTokenLifespan(),
+		AuthorizeCode: cw.GetAuthorizeCodeLifespan(),
+		IDToken:       cw.GetIDTokenLifespan(),
+		RefreshToken:  cw.GetRefreshTokenLifespan(),
+	})
+}
+
+// applyLifespan updates the session expiry for the provided token type using the client lifespans
+// Session expiries are updated in place so fosite responses (ie. expires_in) reflect the stored value
+func (oa *FositeAdaptor) applyLifespan(request fosite.Requester, tokenType fosite.TokenType) time.Time {
+	session := request.GetSession().(*SessionWrap)
+	lifespans := oa.clientLifespans(request.GetClient())
+
+	var lifespan time.Duration
+	switch tokenType {
+	case fosite.AccessToken:
+		lifespan = lifespans.AccessToken
+	case fosite.AuthorizeCode:
+		lifespan = lifespans.AuthorizeCode
+	case fosite.IDToken:
+		lifespan = lifespans.IDToken
+	case fosite.RefreshToken:
+		lifespan = lifespans.RefreshToken
+	}
+
+	if lifespan > 0 {
+		session.SetExpiresAt(tokenType, time.Now().Add(lifespan))
+	}
+
+	return session.GetExpiresAt(tokenType)
 }
 
 func PackRequest(req *fosite.Request) (string, error) {
@@ -59,8 +103,10 @@ func (oa *FositeAdaptor) CreateAuthorizeCodeSession(ctx context.Context, code st
 	requestedScopes := []string(request.GetRequestedScopes())
 	grantedScopes := []string(request.GetGrantedScopes())
 
+	expiry := oa.applyLifespan(request, fosite.AuthorizeCode)
+
 	_, err = oa.Storer.AddAuthorizeCodeSession(session.GetUserID(), client.GetID(), code, request.GetID(), request.GetRequestedAt(),
-		session.GetAuthorizeExpiry(), requestedScopes, grantedScopes)
+		expiry, requestedScopes, grantedScopes)
 
 	return err
 }
@@ -103,8 +149,10 @@ func (oa *FositeAdaptor) CreateAccessTokenSession(c context.Context, signature s
 	requestedScopes := []string(request.GetRequestedScopes())
 	grantedScopes := []string(request.GetGrantedScopes())
 
+	expiry := oa.applyLifespan(request, fosite.AccessToken)
+
 	_, err = oa.Storer.AddAccessTokenSession(session.GetUserID(), client.GetID(), signature, request.GetID(), request.GetRequestedAt(),
-		session.GetAccessExpiry(), requestedScopes, grantedScopes)
+		expiry, requestedScopes, grantedScopes)
 
 	return err
 }
@@ -142,8 +190,10 @@ func (oa *FositeAdaptor) CreateRefreshTokenSession(ctx context.Context, signatur
 	requestedScopes := []string(request.GetRequestedScopes())
 	grantedScopes := []string(request.GetGrantedScopes())
 
+	expiry := oa.applyLifespan(request, fosite.RefreshToken)
+
 	_, err = oa.Storer.AddRefreshTokenSession(session.GetUserID(), client.GetID(), signature, request.GetID(), request.GetRequestedAt(),
-		session.GetRefreshExpiry(), requestedScopes, grantedScopes)
+		expiry, requestedScopes, grantedScopes)
 
 	return err
 }
@@ -153,6 +203,15 @@ func (oa *FositeAdaptor) GetRefreshTokenSession(ctx context.Context, signature s
 	if err != nil {
 		return nil, err
 	}
+	if a == nil {
+		return nil, fosite.ErrNotFound
+	}
+
+	// Reject expired refresh tokens
+	expiry := a.(RefreshTokenSession).GetSession().(UserSession).GetRefreshExpiry()
+	if !expiry.IsZero() && time.Now().After(expiry) {
+		return nil, fosite.ErrInvalidGrant
+	}
 
 	return NewRefreshTokenWrap(a).(fosite.Requester), nil
 }
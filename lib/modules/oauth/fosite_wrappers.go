@@ -71,11 +71,16 @@ func (session *SessionWrap) GetExpiresAt(key fosite.TokenType) time.Time {
 }
 
 func (s *SessionWrap) GetUsername() string {
-	return s.GetUsername()
+	return s.UserSession.GetUsername()
 }
 
+// GetSubject fetches the session subject, falling back to the user ID where not set
+// This is returned as the `sub` field of introspection responses
 func (s *SessionWrap) GetSubject() string {
-	return s.GetSubject()
+	if subject := s.UserSession.GetSubject(); subject != "" {
+		return subject
+	}
+	return s.UserSession.GetUserID()
 }
 
 func (s *SessionWrap) Clone() fosite.Session {
@@ -22,6 +22,7 @@ import (
 	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 )
 
@@ -35,11 +36,18 @@ const (
 // This is a safe error return for the OAuth API to wrap underlying errors
 var ErrInternal = errors.New("OAuth internal error")
 
+// ErrClientNotFound indicates a client could not be found (or is not owned by the user)
+var ErrClientNotFound = errors.New("OAuth client not found")
+
+// ErrLifespanTooLong indicates a requested token lifespan exceeds the allowed maximum
+var ErrLifespanTooLong = errors.New("OAuth token lifespan exceeds allowed maximum")
+
 // Controller OAuth module controller
 type Controller struct {
 	OAuth2 fosite.OAuth2Provider
 	store  Storer
 	config config.OAuthConfig
+	access AccessFilter
 }
 
 // NewController Creates a new OAuth2 controller instance
@@ -47,9 +55,9 @@ func NewController(store Storer, config config.OAuthConfig) *Controller {
 
 	// Create configuration
 	var oauthConfig = &compose.Config{
-		AccessTokenLifespan:   time.Hour * 1,
-		AuthorizeCodeLifespan: time.Hour * 1,
-		IDTokenLifespan:       time.Hour * 1,
+		AccessTokenLifespan:   config.Lifespans.AccessToken,
+		AuthorizeCodeLifespan: config.Lifespans.AuthorizeCode,
+		IDTokenLifespan:       config.Lifespans.IDToken,
 		HashCost:              clientSecretHashRounds,
 	}
 
@@ -59,7 +67,7 @@ func NewController(store Storer, config config.OAuthConfig) *Controller {
 		//OpenIDConnectTokenStrategy: compose.NewOpenIDConnectStrategy(cfg.Key),
 	}
 
-	wrappedStore := NewAdaptor(store)
+	wrappedStore := NewAdaptor(store, config.Lifespans)
 
 	var oauth2 = compose.Compose(
 		oauthConfig,
@@ -89,9 +97,27 @@ func NewController(store Storer, config config.OAuthConfig) *Controller {
 	return &c
 }
 
+// SetAccessFilter sets the filter used to check the client address of authorizations and token requests
+func (oc *Controller) SetAccessFilter(access AccessFilter) {
+	oc.access = access
+}
+
+// NewSession creates an OAuth session for the provided user with the default token expiries
+// Per-client overrides are applied by the storage adaptor when sessions are persisted
+func (oc *Controller) NewSession(userID string) *Session {
+	now := time.Now()
+	return &Session{
+		UserID:          userID,
+		AccessExpiry:    now.Add(oc.config.Lifespans.AccessToken),
+		IDExpiry:        now.Add(oc.config.Lifespans.IDToken),
+		AuthorizeExpiry: now.Add(oc.config.Lifespans.AuthorizeCode),
+		RefreshExpiry:   now.Add(oc.config.Lifespans.RefreshToken),
+	}
+}
+
 // CreateClient Creates an OAuth Client Credential grant based client for a given user
 // This is used to authenticate simple devices and must be pre-created
-func (oc *Controller) CreateClient(userID, clientName string, scopes, redirects, grantTypes, responseTypes []string, public bool) (*ClientResp, error) {
+func (oc *Controller) CreateClient(userID, clientName string, scopes, redirects, grantTypes, responseTypes []string, public bool) (*api.OAuthClientResp, error) {
 
 	// Fetch the associated user account
 	u, err := oc.store.GetUserByExtID(userID)
@@ -157,7 +183,7 @@ func (oc *Controller) CreateClient(userID, clientName string, scopes, redirects,
 
 	// Create API safe response instance
 	// Note that this is the only time the client secret is available
-	resp := ClientResp{
+	resp := api.OAuthClientResp{
 		ClientID:     client.GetID(),
 		Name:         client.GetName(),
 		CreatedAt:    client.GetCreatedAt(),
@@ -165,6 +191,7 @@ func (oc *Controller) CreateClient(userID, clientName string, scopes, redirects,
 		Scopes:       client.GetScopes(),
 		GrantTypes:   client.GetGrantTypes(),
 		RedirectURIs: client.GetRedirectURIs(),
+		Lifespans:    clientLifespans(client),
 		Secret:       clientSecret,
 	}
 
@@ -173,13 +200,7 @@ func (oc *Controller) CreateClient(userID, clientName string, scopes, redirects,
 	return &resp, nil
 }
 
-type OptionResp struct {
-	Scopes        []string `json:"scopes"`
-	GrantTypes    []string `json:"grant_types"`
-	ResponseTypes []string `json:"response_types"`
-}
-
-func (oc *Controller) GetOptions(userID string) (*OptionResp, error) {
+func (oc *Controller) GetOptions(userID string) (*api.OAuthOptionResp, error) {
 	// Fetch the associated user account
 	u, err := oc.store.GetUserByExtID(userID)
 	if err != nil {
@@ -189,27 +210,23 @@ func (oc *Controller) GetOptions(userID string) (*OptionResp, error) {
 	user := u.(User)
 
 	if user.IsAdmin() {
-		return &OptionResp{oc.config.AllowedScopes.Admin, oc.config.AllowedGrants.Admin, oc.config.AllowedResponses}, nil
+		return &api.OAuthOptionResp{Scopes: oc.config.AllowedScopes.Admin, GrantTypes: oc.config.AllowedGrants.Admin, ResponseTypes: oc.config.AllowedResponses}, nil
 	}
-	return &OptionResp{oc.config.AllowedScopes.User, oc.config.AllowedGrants.User, oc.config.AllowedResponses}, nil
+	return &api.OAuthOptionResp{Scopes: oc.config.AllowedScopes.User, GrantTypes: oc.config.AllowedGrants.User, ResponseTypes: oc.config.AllowedResponses}, nil
 }
 
-// ClientResp is the API safe object returned by client requests
-type ClientResp struct {
-	ClientID      string    `json:"id"`
-	Name          string    `json:"name"`
-	CreatedAt     time.Time `json:"created_at"`
-	LastUsed      time.Time `json:"last_used"`
-	Scopes        []string  `json:"allowed_scopes"`
-	GrantTypes    []string  `json:"grant_types"`
-	ResponseTypes []string  `json:"response_types"`
-	RedirectURIs  []string  `json:"redirect_uris"`
-	Secret        string    `json:"secret"`
+func clientLifespans(client Client) api.OAuthLifespans {
+	return api.OAuthLifespans{
+		AccessToken:   uint(client.GetAccessTokenLifespan() / time.Second),
+		AuthorizeCode: uint(client.GetAuthorizeCodeLifespan() / time.Second),
+		IDToken:       uint(client.GetIDTokenLifespan() / time.Second),
+		RefreshToken:  uint(client.GetRefreshTokenLifespan() / time.Second),
+	}
 }
 
 // GetClients Fetch clients owned by a given user
-func (oc *Controller) GetClients(userID string) ([]ClientResp, error) {
-	clientResps := make([]ClientResp, 0)
+func (oc *Controller) GetClients(userID string) ([]api.OAuthClientResp, error) {
+	clientResps := make([]api.OAuthClientResp, 0)
 
 	clients, err := oc.store.GetClientsByUserID(userID)
 	if err != nil {
@@ -220,7 +237,7 @@ func (oc *Controller) GetClients(userID string) ([]ClientResp, error) {
 	for _, c := range clients {
 		client := c.(Client)
 
-		clean := ClientResp{
+		clean := api.OAuthClientResp{
 			ClientID:      client.GetID(),
 			Name:          client.GetName(),
 			CreatedAt:     client.GetCreatedAt(),
@@ -229,6 +246,7 @@ func (oc *Controller) GetClients(userID string) ([]ClientResp, error) {
 			GrantTypes:    client.GetGrantTypes(),
 			ResponseTypes: client.GetResponseTypes(),
 			RedirectURIs:  client.GetRedirectURIs(),
+			Lifespans:     clientLifespans(client),
 		}
 
 		clientResps = append(clientResps, clean)
@@ -248,6 +266,138 @@ func (oc *Controller) UpdateClient(client Client) error {
 	return nil
 }
 
+// SetClientLifespans sets token lifespan overrides for a client owned by the provided user
+// Overrides may not exceed the global defaults unless the owning user is an admin
+func (oc *Controller) SetClientLifespans(userID, clientID string, lifespans api.OAuthLifespans) error {
+	u, err := oc.store.GetUserByExtID(userID)
+	if err != nil {
+		log.Printf("OAuthController.SetClientLifespans error fetching user: %s", err)
+		return ErrInternal
+	}
+	user := u.(User)
+
+	c, err := oc.store.GetClientByID(clientID)
+	if err != nil {
+		log.Printf("OAuthController.SetClientLifespans error fetching client: %s", err)
+		return ErrInternal
+	}
+	if c == nil {
+		return ErrClientNotFound
+	}
+	client := c.(Client)
+
+	// Check client ownership
+	owned, err := oc.isClientOwner(userID, clientID)
+	if err != nil {
+		return err
+	}
+	if !owned {
+		return ErrClientNotFound
+	}
+
+	overrides := config.TokenLifespans{
+		AccessToken:   time.Duration(lifespans.AccessToken) * time.Second,
+		AuthorizeCode: time.Duration(lifespans.AuthorizeCode) * time.Second,
+		IDToken:       time.Duration(lifespans.IDToken) * time.Second,
+		RefreshToken:  time.Duration(lifespans.RefreshToken) * time.Second,
+	}
+
+	// Non-admin users can only shorten token lifespans
+	if !user.IsAdmin() {
+		defaults := oc.config.Lifespans
+		if overrides.AccessToken > defaults.AccessToken || overrides.AuthorizeCode > defaults.AuthorizeCode ||
+			overrides.IDToken > defaults.IDToken || overrides.RefreshToken > defaults.RefreshToken {
+			return ErrLifespanTooLong
+		}
+	}
+
+	client.SetAccessTokenLifespan(overrides.AccessToken)
+	client.SetAuthorizeCodeLifespan(overrides.AuthorizeCode)
+	client.SetIDTokenLifespan(overrides.IDToken)
+	client.SetRefreshTokenLifespan(overrides.RefreshToken)
+
+	if err := oc.UpdateClient(client); err != nil {
+		return err
+	}
+
+	log.Printf("OAuthController.SetClientLifespans updated lifespans for client %s (%+v)", clientID, lifespans)
+
+	return nil
+}
+
+// RotateClientSecret generates a new secret for a client owned by the provided user
+// The previous secret is invalidated, and the new secret is only available in the returned response
+func (oc *Controller) RotateClientSecret(userID, clientID string) (*api.OAuthClientResp, error) {
+	c, err := oc.store.GetClientByID(clientID)
+	if err != nil {
+		log.Printf("OAuthController.RotateClientSecret error fetching client: %s", err)
+		return nil, ErrInternal
+	}
+	if c == nil {
+		return nil, ErrClientNotFound
+	}
+	client := c.(Client)
+
+	// Check client ownership
+	owned, err := oc.isClientOwner(userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, ErrClientNotFound
+	}
+
+	// Generate and hash new secret
+	clientSecret, err := generateSecret(OAuthSecretBytes)
+	if err != nil {
+		log.Printf("OAuthController.RotateClientSecret error generating client secret: %s", err)
+		return nil, ErrInternal
+	}
+	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(clientSecret), clientSecretHashRounds)
+	if err != nil {
+		log.Printf("OAuthController.RotateClientSecret error generating secret hash: %s", err)
+		return nil, ErrInternal
+	}
+
+	client.SetSecret(string(hashedSecret))
+
+	if err := oc.UpdateClient(client); err != nil {
+		return nil, err
+	}
+
+	resp := api.OAuthClientResp{
+		ClientID:      client.GetID(),
+		Name:          client.GetName(),
+		CreatedAt:     client.GetCreatedAt(),
+		LastUsed:      client.GetLastUsed(),
+		Scopes:        client.GetScopes(),
+		GrantTypes:    client.GetGrantTypes(),
+		ResponseTypes: client.GetResponseTypes(),
+		RedirectURIs:  client.GetRedirectURIs(),
+		Lifespans:     clientLifespans(client),
+		Secret:        clientSecret,
+	}
+
+	log.Printf("OAuthController.RotateClientSecret rotated secret for client %s", clientID)
+
+	return &resp, nil
+}
+
+// isClientOwner checks whether a client is owned by the provided user
+func (oc *Controller) isClientOwner(userID, clientID string) (bool, error) {
+	clients, err := oc.store.GetClientsByUserID(userID)
+	if err != nil {
+		log.Printf("OAuthController.isClientOwner error fetching clients: %s", err)
+		return false, ErrInternal
+	}
+	for _, c := range clients {
+		if c.(Client).GetID() == clientID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // RemoveClient Removes a client instance
 func (oc *Controller) RemoveClient(clientID string) error {
 	err := oc.store.RemoveClientByID(clientID)
@@ -258,14 +408,8 @@ func (oc *Controller) RemoveClient(clientID string) error {
 	return nil
 }
 
-// AccessTokenInfo is an access token information response
-type AccessTokenInfo struct {
-	RequestedAt time.Time
-	ExpiresAt   time.Time
-}
-
 // GetAccessTokenInfo fetches information for a provided access token
-func (oc *Controller) GetAccessTokenInfo(tokenString string) (*AccessTokenInfo, error) {
+func (oc *Controller) GetAccessTokenInfo(tokenString string) (*api.OAuthAccessTokenInfo, error) {
 	a, err := oc.store.GetAccessTokenSession(tokenString)
 	if err != nil {
 		log.Printf("OAuthController.GetAccessTokenInfo error fetching token session: %s", err)
@@ -277,7 +421,7 @@ func (oc *Controller) GetAccessTokenInfo(tokenString string) (*AccessTokenInfo,
 
 	access := a.(AccessTokenSession)
 
-	ar := AccessTokenInfo{
+	ar := api.OAuthAccessTokenInfo{
 		RequestedAt: access.GetRequestedAt(),
 		ExpiresAt:   access.GetExpiresAt(),
 	}
@@ -285,22 +429,8 @@ func (oc *Controller) GetAccessTokenInfo(tokenString string) (*AccessTokenInfo,
 	return &ar, nil
 }
 
-type GrantInfo struct {
-	ID          string    `json:"id"`
-	Type        string    `json:"type"`
-	Scopes      []string  `json:"scopes"`
-	RequestedAt time.Time `json:"requested_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
-}
-
-type UserSessions struct {
-	AuthorizationCodes []GrantInfo `json:"authorization_codes"`
-	RefreshTokens      []GrantInfo `json:"refresh_tokens"`
-	AccessCodes        []GrantInfo `json:"access_codes"`
-}
-
-func sessionBaseToGrantInfo(s SessionBase) GrantInfo {
-	grant := GrantInfo{
+func sessionBaseToGrantInfo(s SessionBase) api.OAuthGrantInfo {
+	grant := api.OAuthGrantInfo{
 		ID:          s.GetRequestID(),
 		Scopes:      s.GetRequestedScopes(),
 		RequestedAt: s.GetRequestedAt(),
@@ -310,7 +440,7 @@ func sessionBaseToGrantInfo(s SessionBase) GrantInfo {
 }
 
 // GetUserSessions fetches a list of all OAuth sessions for a given user ID
-func (oc *Controller) GetUserSessions(userID string) (*UserSessions, error) {
+func (oc *Controller) GetUserSessions(userID string) (*api.OAuthUserSessions, error) {
 
 	// Fetch the associated user account
 	u, err := oc.store.GetUserByExtID(userID)
@@ -320,7 +450,7 @@ func (oc *Controller) GetUserSessions(userID string) (*UserSessions, error) {
 	}
 	user := u.(User)
 
-	grants := UserSessions{}
+	grants := api.OAuthUserSessions{}
 
 	// Fetch authorization code grants
 	authorizationCodes, err := oc.store.GetAuthorizeCodeSessionsByUserID(user.GetExtID())
@@ -354,3 +484,47 @@ func (oc *Controller) GetUserSessions(userID string) (*UserSessions, error) {
 
 	return &grants, nil
 }
+
+// RevokeUserSessions removes all authorization codes, access tokens and refresh tokens issued to a given user ID
+func (oc *Controller) RevokeUserSessions(userID string) error {
+	authorizationCodes, err := oc.store.GetAuthorizeCodeSessionsByUserID(userID)
+	if err != nil {
+		log.Printf("OAuthController.RevokeUserSessions error fetching authorization code sessions for user: %s (%s)", userID, err)
+		return ErrInternal
+	}
+	for _, s := range authorizationCodes {
+		if err := oc.store.RemoveAuthorizeCodeSession(s.(AuthorizeCodeSession).GetCode()); err != nil {
+			log.Printf("OAuthController.RevokeUserSessions error removing authorization code session: %s", err)
+			return ErrInternal
+		}
+	}
+
+	refreshTokens, err := oc.store.GetRefreshTokenSessionsByUserID(userID)
+	if err != nil {
+		log.Printf("OAuthController.RevokeUserSessions error fetching refresh token sessions for user: %s (%s)", userID, err)
+		return ErrInternal
+	}
+	for _, s := range refreshTokens {
+		if err := oc.store.RemoveRefreshToken(s.(RefreshTokenSession).GetSignature()); err != nil {
+			log.Printf("OAuthController.RevokeUserSessions error removing refresh token session: %s", err)
+			return ErrInternal
+		}
+	}
+
+	accessTokens, err := oc.store.GetAccessTokenSessionsByUserID(userID)
+	if err != nil {
+		log.Printf("OAuthController.RevokeUserSessions error fetching access token sessions for user: %s (%s)", userID, err)
+		return ErrInternal
+	}
+	for _, s := range accessTokens {
+		if err := oc.store.RemoveAccessTokenSession(s.(AccessTokenSession).GetSignature()); err != nil {
+			log.Printf("OAuthController.RevokeUserSessions error removing access token session: %s", err)
+			return ErrInternal
+		}
+	}
+
+	log.Printf("OAuthController.RevokeUserSessions revoked %d authorization codes, %d refresh tokens and %d access tokens for user %s",
+		len(authorizationCodes), len(refreshTokens), len(accessTokens), userID)
+
+	return nil
+}
@@ -64,7 +64,6 @@ func (oc *Controller) BindAPI(base *web.Router) *web.Router {
 	// Bind paths to endpoint
 	router.Get("/clients", (*APICtx).ClientsGet)
 	router.Get("/options", (*APICtx).OptionsGet)
-	router.Post("/clients", (*APICtx).ClientsPost)
 
 	router.Get("/auth", (*APICtx).AuthorizeRequestGet)
 	router.Get("/pending", (*APICtx).AuthorizePendingGet)
@@ -72,16 +71,33 @@ func (oc *Controller) BindAPI(base *web.Router) *web.Router {
 
 	router.Post("/token", (*APICtx).TokenPost)
 	router.Get("/introspect", (*APICtx).IntrospectPost)
+	router.Post("/introspect", (*APICtx).IntrospectPost)
 	router.Get("/test", (*APICtx).TestGet)
 
 	router.Get("/info", (*APICtx).AccessTokenInfoGet)
 
 	router.Get("/sessions", (*APICtx).SessionsInfoGet)
 
+	// Client management requires a current sudo session
+	sudoRouter := base.Subrouter(APICtx{}, "/api/oauth")
+	sudoRouter.Middleware(BindOauthContext(oc))
+	sudoRouter.Middleware((*APICtx).RequireSudoMiddleware)
+
+	sudoRouter.Post("/clients", (*APICtx).ClientsPost)
+	sudoRouter.Post("/clients/:id/lifespans", (*APICtx).ClientLifespansPost)
+	sudoRouter.Post("/clients/:id/secret", (*APICtx).ClientSecretPost)
+
 	// Return router for external use
 	return router
 }
 
+// RequireSudoMiddleware requires logged in users to have re-authenticated prior to managing clients
+func (c *APICtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
+}
+
 // ClientsGet Lists clients bound owned by a user account
 func (c *APICtx) ClientsGet(rw web.ResponseWriter, req *web.Request) {
 	// Check user is logged in
@@ -119,15 +135,6 @@ func (c *APICtx) OptionsGet(rw web.ResponseWriter, req *web.Request) {
 	c.WriteJson(rw, options)
 }
 
-// ClientReq is a client request object used to create an OAuth client
-type ClientReq struct {
-	Name      string   `json:"name"`
-	Scopes    []string `json:"scopes"`
-	Redirects []string `json:"redirects"`
-	Grants    []string `json:"grant_types"`
-	Responses []string `json:"response_types"`
-}
-
 var clientNameExp = regexp.MustCompile(`([a-zA-Z0-9\. ]+)`)
 var validResponses = []string{"code", "token"}
 
@@ -139,8 +146,14 @@ func (c *APICtx) ClientsPost(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Decode client request
-	clientReq := ClientReq{}
+	clientReq := api.OAuthClientReq{}
 	defer req.Body.Close()
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(&clientReq); err != nil {
@@ -170,6 +183,90 @@ func (c *APICtx) ClientsPost(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	// Apply lifespan overrides if provided
+	if clientReq.Lifespans != nil {
+		err = c.oc.SetClientLifespans(c.GetUserID(), client.ClientID, *clientReq.Lifespans)
+		if err == ErrLifespanTooLong {
+			c.oc.RemoveClient(client.ClientID)
+			c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, err.Error())
+			return
+		} else if err != nil {
+			c.oc.RemoveClient(client.ClientID)
+			c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, err.Error())
+			return
+		}
+		client.Lifespans = *clientReq.Lifespans
+	}
+
+	c.WriteJson(rw, client)
+}
+
+// ClientLifespansPost updates the token lifespan overrides for a client
+func (c *APICtx) ClientLifespansPost(rw web.ResponseWriter, req *web.Request) {
+	// Check user is logged in
+	if c.GetUserID() == "" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	clientID := req.PathParams["id"]
+
+	lifespans := api.OAuthLifespans{}
+	defer req.Body.Close()
+	decoder := json.NewDecoder(req.Body)
+	if err := decoder.Decode(&lifespans); err != nil {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	err := c.oc.SetClientLifespans(c.GetUserID(), clientID, lifespans)
+	switch err {
+	case nil:
+	case ErrClientNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, err.Error())
+		return
+	case ErrLifespanTooLong:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, err.Error())
+		return
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteJson(rw, &lifespans)
+}
+
+// ClientSecretPost rotates the secret for a client
+func (c *APICtx) ClientSecretPost(rw web.ResponseWriter, req *web.Request) {
+	// Check user is logged in
+	if c.GetUserID() == "" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	client, err := c.oc.RotateClientSecret(c.GetUserID(), req.PathParams["id"])
+	switch err {
+	case nil:
+	case ErrClientNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, err.Error())
+		return
+	default:
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
 	c.WriteJson(rw, client)
 }
 
@@ -206,13 +303,6 @@ func (c *APICtx) AuthorizeRequestGet(rw web.ResponseWriter, req *web.Request) {
 
 }
 
-type AuthorizationRequest struct {
-	State       string   `json:"state"`
-	Name        string   `json:"name"`
-	RedirectURI string   `json:"redirect_uri"`
-	Scopes      []string `json:"scopes"`
-}
-
 // AuthorizePendingGet Fetch pending authorizations for a user
 func (c *APICtx) AuthorizePendingGet(rw web.ResponseWriter, req *web.Request) {
 	// Check user is logged in
@@ -232,7 +322,7 @@ func (c *APICtx) AuthorizePendingGet(rw web.ResponseWriter, req *web.Request) {
 	ar.Client = nil
 
 	// Map to safe API struct
-	resp := AuthorizationRequest{
+	resp := api.OAuthAuthorizationRequest{
 		State: ar.State,
 		//Name:        ar.GetClient().(Client).GetName(),
 		RedirectURI: ar.RedirectURI.String(),
@@ -243,13 +333,6 @@ func (c *APICtx) AuthorizePendingGet(rw web.ResponseWriter, req *web.Request) {
 	c.WriteJson(rw, &resp)
 }
 
-// AuthorizeConfirm authorization confirmation object
-type AuthorizeConfirm struct {
-	Accept        bool     `json:"accept"`
-	State         string   `json:"state"`
-	GrantedScopes []string `json:"granted_scopes"`
-}
-
 // AuthorizeConfirmPost Confirm authorization of a token
 // This finalises and stores the authentication, and redirects back to the calling service
 // TODO: this endpoint /really/ needs CSRF / CORS protection
@@ -260,13 +343,19 @@ func (c *APICtx) AuthorizeConfirmPost(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Fetch authorization request from session
 	if c.GetSession().Values["oauth"] == nil {
 		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, api.ApiMessageEn.NoOAuthPending)
 		return
 	}
 
-	authorizeConfirm := AuthorizeConfirm{}
+	authorizeConfirm := api.OAuthAuthorizeConfirm{}
 	defer req.Body.Close()
 	decoder := json.NewDecoder(req.Body)
 	if err := decoder.Decode(&authorizeConfirm); err != nil {
@@ -288,14 +377,20 @@ func (c *APICtx) AuthorizeConfirmPost(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
-	oauthSession := Session{
-		UserID: c.GetUserID(),
+	// Check authorization is allowed from the client address
+	if c.oc.access != nil {
+		ok, err := c.oc.access.CheckAuthorize(c.GetUserID(), c.GetRequestContext())
+		if err != nil {
+			c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+			return
+		}
+		if !ok {
+			c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().NetworkBlocked)
+			return
+		}
 	}
 
-	oauthSession.AccessExpiry = time.Now().Add(time.Hour * 1)
-	oauthSession.IDExpiry = time.Now().Add(time.Hour * 1)
-	oauthSession.AuthorizeExpiry = time.Now().Add(time.Hour * 1)
-	oauthSession.RefreshExpiry = time.Now().Add(time.Hour * 24)
+	oauthSession := c.oc.NewSession(c.GetUserID())
 
 	log.Printf("AuthConfirm: %+v", authorizeConfirm)
 
@@ -310,7 +405,7 @@ func (c *APICtx) AuthorizeConfirmPost(rw web.ResponseWriter, req *web.Request) {
 	log.Printf("AuthRequest: %+v", authorizeRequest)
 
 	// Create response
-	response, err := c.oc.OAuth2.NewAuthorizeResponse(c.fositeContext, &authorizeRequest, NewSessionWrap(&oauthSession))
+	response, err := c.oc.OAuth2.NewAuthorizeResponse(c.fositeContext, &authorizeRequest, NewSessionWrap(oauthSession))
 	if err != nil {
 		log.Printf("OauthAPI.AuthorizeConfirmPost error: %s", errors.Cause(err))
 		c.oc.OAuth2.WriteAuthorizeError(rw, &authorizeRequest, err)
@@ -368,24 +463,34 @@ func (c *APICtx) TokenPost(rw web.ResponseWriter, req *web.Request) {
 	ctx := fosite.NewContext()
 
 	// Create session
-	session := Session{
-		AccessExpiry:    time.Now().Add(time.Hour * 1),
-		IDExpiry:        time.Now().Add(time.Hour * 2),
-		RefreshExpiry:   time.Now().Add(time.Hour * 3),
-		AuthorizeExpiry: time.Now().Add(time.Hour * 4),
-	}
+	session := c.oc.NewSession("")
 
 	// TODO: How on earth do I pull a user ID out of this?
 	// Should be associated with an oauth request type, but I don't have access to it here.
 
 	// Create access request
-	ar, err := c.oc.OAuth2.NewAccessRequest(ctx, req.Request, NewSessionWrap(&session))
+	ar, err := c.oc.OAuth2.NewAccessRequest(ctx, req.Request, NewSessionWrap(session))
 	if err != nil {
 		log.Printf("oauth.TokenPost NewAccessRequest error: %s", err)
 		c.oc.OAuth2.WriteAccessError(rw, ar, err)
 		return
 	}
 
+	// Check token issuance is allowed from the client address
+	// The session is loaded from the original grant where available, identifying the user
+	if c.oc.access != nil {
+		userID := ""
+		if s, ok := ar.GetSession().(*SessionWrap); ok {
+			userID = s.GetUserID()
+		}
+
+		ok, err := c.oc.access.CheckToken(userID, c.GetRequestContext())
+		if err != nil || !ok {
+			c.oc.OAuth2.WriteAccessError(rw, ar, fosite.ErrAccessDenied)
+			return
+		}
+	}
+
 	// Fetch client from request
 	client := ar.(fosite.Requester).GetClient().(*ClientWrapper)
 
@@ -25,6 +25,7 @@ import (
 	"github.com/ory/fosite"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
 	"github.com/ryankurte/authplz/lib/modules/core"
@@ -71,7 +72,7 @@ func GrantOauth(client *test.TestClient, responseType, clientID, redirect string
 	}
 
 	// Accept authorization (post confirm object)
-	ac := AuthorizeConfirm{true, v.Get("state"), []string{"public.read"}}
+	ac := api.OAuthAuthorizeConfirm{Accept: true, State: v.Get("state"), GrantedScopes: []string{"public.read"}}
 	resp, err = client.PostJSON("/oauth/auth", 302, &ac)
 	if err != nil {
 		return nil, fmt.Errorf("GrantOauth error: %s", err)
@@ -117,7 +118,7 @@ func TestOauthAPI(t *testing.T) {
 
 	redirect := "localhost:9000/auth"
 
-	var oauthClient ClientResp
+	var oauthClient api.OAuthClientResp
 
 	client := test.NewTestClient("http://" + test.Address + "/api")
 
@@ -155,6 +156,14 @@ func TestOauthAPI(t *testing.T) {
 			t.Error(err)
 			t.FailNow()
 		}
+
+		// Re-authenticate for client management
+		v = url.Values{}
+		v.Set("password", test.FakePass)
+		if _, err := client.PostForm("/sudo", http.StatusOK, v); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
 	})
 
 	// Run tests
@@ -170,7 +179,7 @@ func TestOauthAPI(t *testing.T) {
 	responses := []string{"token", "code"}
 
 	t.Run("OAuthAPI create client", func(t *testing.T) {
-		cr := ClientReq{
+		cr := api.OAuthClientReq{
 			Name:      "test-client",
 			Scopes:    scopes,
 			Redirects: redirects,
@@ -240,7 +249,7 @@ func TestOauthAPI(t *testing.T) {
 		}
 
 		// Accept authorization (post confirm object)
-		ac := AuthorizeConfirm{true, v.Get("state"), []string{"public.read"}}
+		ac := api.OAuthAuthorizeConfirm{Accept: true, State: v.Get("state"), GrantedScopes: []string{"public.read"}}
 		resp, err = client.PostJSON("/oauth/auth", 302, &ac)
 		if err != nil {
 			t.Error(err)
@@ -306,7 +315,7 @@ func TestOauthAPI(t *testing.T) {
 		assert.Equal(t, authReq.State, v.Get("state"), "Invalid state")
 
 		// Accept authorization (post confirm object)
-		ac := AuthorizeConfirm{true, v.Get("state"), []string{"public.read"}}
+		ac := api.OAuthAuthorizeConfirm{Accept: true, State: v.Get("state"), GrantedScopes: []string{"public.read"}}
 		resp, err = client.PostJSON("/oauth/auth", 302, &ac)
 		if err != nil {
 			t.Error(err)
@@ -393,7 +402,7 @@ func TestOauthAPI(t *testing.T) {
 		}
 
 		// Accept authorization (post confirm object)
-		ac := AuthorizeConfirm{true, v.Get("state"), []string{"public.read"}}
+		ac := api.OAuthAuthorizeConfirm{Accept: true, State: v.Get("state"), GrantedScopes: []string{"public.read"}}
 		resp, err = client.PostJSON("/oauth/auth", 302, &ac)
 		assert.Nil(t, err)
 
@@ -430,7 +439,7 @@ func TestOauthAPI(t *testing.T) {
 
 		t.SkipNow()
 
-		sessions := UserSessions{}
+		sessions := api.OAuthUserSessions{}
 		if err := client.GetJSON("/oauth/sessions", http.StatusOK, &sessions); err != nil {
 			t.Error(err)
 			t.FailNow()
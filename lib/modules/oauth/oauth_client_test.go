@@ -0,0 +1,186 @@
+/*
+ * OAuth Module Client Tests
+ * Tests the management of OAuth clients
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/test"
+)
+
+func TestOauthClients(t *testing.T) {
+
+	ts, err := test.NewTestServer()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	config := config.DefaultOAuthConfig()
+
+	oauthModule := NewController(ts.DataStore, config)
+
+	u, err := ts.DataStore.AddUser(test.FakeEmail, test.FakeName, test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	user := u.(*datastore.User)
+
+	o, err := ts.DataStore.AddUser("other@abc.com", "other.user", test.FakePass)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	other := o.(*datastore.User)
+
+	scopes := []string{"public.read", "offline"}
+	redirects := []string{"https://fake-redirect.cows"}
+	grants := []string{"authorization_code", "refresh_token"}
+	responses := []string{"code"}
+
+	t.Run("Client secrets can be rotated", func(t *testing.T) {
+		c, err := oauthModule.CreateClient(user.GetExtID(), "client-test-rotate", scopes, redirects, grants, responses, false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer oauthModule.RemoveClient(c.ClientID)
+
+		c2, err := oauthModule.RotateClientSecret(user.GetExtID(), c.ClientID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if c2.Secret == "" || c2.Secret == c.Secret {
+			t.Errorf("Client secret not rotated")
+		}
+
+		_, err = oauthModule.RotateClientSecret(other.GetExtID(), c.ClientID)
+		if err != ErrClientNotFound {
+			t.Errorf("Expected ErrClientNotFound for non-owner, received %s", err)
+		}
+	})
+
+	t.Run("Non-admin users can only shorten client lifespans", func(t *testing.T) {
+		c, err := oauthModule.CreateClient(user.GetExtID(), "client-test-lifespans", scopes, redirects, grants, responses, false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer oauthModule.RemoveClient(c.ClientID)
+
+		longer := api.OAuthLifespans{AccessToken: uint((config.Lifespans.AccessToken + time.Hour) / time.Second)}
+		shorter := api.OAuthLifespans{AccessToken: 60}
+
+		if err := oauthModule.SetClientLifespans(user.GetExtID(), c.ClientID, longer); err != ErrLifespanTooLong {
+			t.Errorf("Expected ErrLifespanTooLong, received %v", err)
+		}
+		if err := oauthModule.SetClientLifespans(user.GetExtID(), c.ClientID, shorter); err != nil {
+			t.Error(err)
+		}
+		if err := oauthModule.SetClientLifespans(other.GetExtID(), c.ClientID, shorter); err != ErrClientNotFound {
+			t.Errorf("Expected ErrClientNotFound for non-owner, received %v", err)
+		}
+
+		user.SetAdmin(true)
+		ts.DataStore.UpdateUser(user)
+		defer func() {
+			user.SetAdmin(false)
+			ts.DataStore.UpdateUser(user)
+		}()
+
+		if err := oauthModule.SetClientLifespans(user.GetExtID(), c.ClientID, longer); err != nil {
+			t.Errorf("Unexpected error extending lifespan as admin: %v", err)
+		}
+	})
+
+	adaptor := NewAdaptor(ts.DataStore, config.Lifespans)
+
+	t.Run("Client lifespans are applied to sessions", func(t *testing.T) {
+		c, err := oauthModule.CreateClient(user.GetExtID(), "client-test-expiry", scopes, redirects, grants, responses, false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer oauthModule.RemoveClient(c.ClientID)
+
+		err = oauthModule.SetClientLifespans(user.GetExtID(), c.ClientID, api.OAuthLifespans{AccessToken: 60})
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		client, err := adaptor.GetClient(context.Background(), c.ClientID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		req := fosite.NewRequest()
+		req.Client = client
+		req.Session = NewSessionWrap(NewSession(user.GetExtID(), user.GetUsername()))
+
+		// Overridden lifespans are applied to the session
+		now := time.Now()
+		expiry := adaptor.applyLifespan(req, fosite.AccessToken)
+		if expiry.Before(now.Add(time.Minute)) || expiry.After(time.Now().Add(time.Minute)) {
+			t.Errorf("Unexpected access token expiry %s (expected ~%s)", expiry, now.Add(time.Minute))
+		}
+		if !req.Session.GetExpiresAt(fosite.AccessToken).Equal(expiry) {
+			t.Errorf("Session access token expiry not updated")
+		}
+
+		// Other token types use the global defaults
+		now = time.Now()
+		expiry = adaptor.applyLifespan(req, fosite.RefreshToken)
+		if expiry.Before(now.Add(config.Lifespans.RefreshToken)) || expiry.After(time.Now().Add(config.Lifespans.RefreshToken)) {
+			t.Errorf("Unexpected refresh token expiry %s (expected ~%s)", expiry, now.Add(config.Lifespans.RefreshToken))
+		}
+	})
+
+	t.Run("Expired refresh tokens are rejected", func(t *testing.T) {
+		c, err := oauthModule.CreateClient(user.GetExtID(), "client-test-refresh", scopes, redirects, grants, responses, false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer oauthModule.RemoveClient(c.ClientID)
+
+		now := time.Now()
+
+		_, err = ts.DataStore.AddRefreshTokenSession(user.GetExtID(), c.ClientID, "refresh-valid", "request-valid",
+			now, now.Add(time.Hour), scopes, scopes)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		_, err = ts.DataStore.AddRefreshTokenSession(user.GetExtID(), c.ClientID, "refresh-expired", "request-expired",
+			now.Add(-2*time.Hour), now.Add(-time.Hour), scopes, scopes)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		if _, err := adaptor.GetRefreshTokenSession(context.Background(), "refresh-valid", nil); err != nil {
+			t.Errorf("Unexpected error fetching valid refresh token: %v", err)
+		}
+		if _, err := adaptor.GetRefreshTokenSession(context.Background(), "refresh-expired", nil); err != fosite.ErrInvalidGrant {
+			t.Errorf("Expected ErrInvalidGrant for expired refresh token, received %v", err)
+		}
+	})
+
+}
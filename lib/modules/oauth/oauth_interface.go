@@ -10,6 +10,8 @@ package oauth
 
 import (
 	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // User OAuth user interface
@@ -23,6 +25,7 @@ type Client interface {
 	GetID() string
 	GetName() string
 	GetSecret() string
+	SetSecret(secret string)
 	GetRedirectURIs() []string
 	GetUserData() interface{}
 	GetScopes() []string
@@ -32,6 +35,16 @@ type Client interface {
 	GetCreatedAt() time.Time
 	GetLastUsed() time.Time
 	SetLastUsed(time.Time)
+
+	// Per-client token lifespan overrides (zero for default)
+	GetAccessTokenLifespan() time.Duration
+	GetAuthorizeCodeLifespan() time.Duration
+	GetIDTokenLifespan() time.Duration
+	GetRefreshTokenLifespan() time.Duration
+	SetAccessTokenLifespan(time.Duration)
+	SetAuthorizeCodeLifespan(time.Duration)
+	SetIDTokenLifespan(time.Duration)
+	SetRefreshTokenLifespan(time.Duration)
 }
 
 // SessionBase defines the common interface across all OAuth sessions
@@ -93,6 +106,12 @@ type UserSession interface {
 	Clone() interface{}
 }
 
+// AccessFilter checks whether OAuth authorizations and token requests are allowed from a client address
+type AccessFilter interface {
+	CheckAuthorize(userID string, request *api.RequestContext) (bool, error)
+	CheckToken(userID string, request *api.RequestContext) (bool, error)
+}
+
 // Storer OAuth storage interface
 // This must be implemented by the underlying storage device
 type Storer interface {
@@ -3,31 +3,159 @@ package user
 import (
 	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/events"
+	"github.com/ryankurte/authplz/lib/identity"
 	"golang.org/x/crypto/bcrypt"
 )
 
-//TODO: change this to enforce actual complexity
+// Minimum password length where no password policy is set
 const minimumPasswordLength = 12
 const hashRounds = 8
 
+// DefaultDeletionGracePeriod is the period after deletion during which an account can be restored
+const DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+// DefaultUsernameChangeCooldown is the minimum period between username changes
+const DefaultUsernameChangeCooldown = 30 * 24 * time.Hour
+
+// DefaultReservedUsernames are usernames that cannot be claimed by changing username
+var DefaultReservedUsernames = []string{
+	"admin", "administrator", "root", "system", "support", "help",
+	"security", "abuse", "postmaster", "webmaster", "noreply", "api", "authplz",
+}
+
+// Usernames must start with a letter or number and contain only lower case letters, numbers, '.', '-' and '_'
+var usernameValidExp = regexp.MustCompile(`^[a-z0-9][a-z0-9\.\-_]{2,31}$`)
+
 // Controller User controller instance storage
 type Controller struct {
-	userStore  Storer
-	emitter    events.EventEmitter
-	hashRounds int
+	userStore         Storer
+	emitter           events.EventEmitter
+	hashRounds        int
+	deletionGrace     time.Duration
+	usernameCooldown  time.Duration
+	reservedUsernames map[string]bool
+	policy            PasswordPolicy
+	maxPasswordAge    time.Duration
+	expiryWarning     time.Duration
+	dormancyWarning   time.Duration
+	dormancyDisable   time.Duration
+	registration      config.RegistrationConfig
+	secondFactor      config.SecondFactorConfig
+	disposableDomains []string
+	createHooks       CreateHooks
 }
 
 // NewController Create a new user controller
 func NewController(userStore Storer, emitter events.EventEmitter) *Controller {
-	return &Controller{userStore, emitter, hashRounds}
+	userModule := Controller{
+		userStore:        userStore,
+		emitter:          emitter,
+		hashRounds:       hashRounds,
+		deletionGrace:    DefaultDeletionGracePeriod,
+		usernameCooldown: DefaultUsernameChangeCooldown,
+	}
+	userModule.SetReservedUsernames(DefaultReservedUsernames)
+	userModule.SetRegistration(config.DefaultRegistrationConfig())
+	userModule.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+	return &userModule
+}
+
+// WithRequest creates a copy of the user controller bound to a request
+// Events emitted by the returned controller carry the request context
+func (userModule *Controller) WithRequest(request *api.RequestContext) interface{} {
+	c := *userModule
+	c.emitter = events.NewRequestEmitter(userModule.emitter, request)
+	return &c
+}
+
+// SetDeletionGracePeriod sets the period after deletion during which an account can be restored
+func (userModule *Controller) SetDeletionGracePeriod(grace time.Duration) {
+	userModule.deletionGrace = grace
+}
+
+// SetPasswordPolicy sets the password policy used when creating accounts and setting passwords
+func (userModule *Controller) SetPasswordPolicy(policy PasswordPolicy) {
+	userModule.policy = policy
+}
+
+// SetCreateHooks sets the hooks run before and after account creation
+func (userModule *Controller) SetCreateHooks(hooks CreateHooks) {
+	userModule.createHooks = hooks
+}
+
+// SetPasswordExpiry sets the maximum password age and the period prior to expiry in which users are warned
+// A zero maximum age disables password expiry
+func (userModule *Controller) SetPasswordExpiry(maxAge, warning time.Duration) {
+	userModule.maxPasswordAge = maxAge
+	userModule.expiryWarning = warning
+}
+
+// SetDormancy sets the periods of inactivity after which users are warned and accounts are disabled
+// A zero disable period disables dormancy checks
+func (userModule *Controller) SetDormancy(warnAfter, disableAfter time.Duration) {
+	userModule.dormancyWarning = warnAfter
+	userModule.dormancyDisable = disableAfter
+}
+
+// SetUsernameChangeCooldown sets the minimum period between username changes
+func (userModule *Controller) SetUsernameChangeCooldown(cooldown time.Duration) {
+	userModule.usernameCooldown = cooldown
+}
+
+// SetReservedUsernames sets the usernames that cannot be claimed by changing username
+func (userModule *Controller) SetReservedUsernames(usernames []string) {
+	userModule.reservedUsernames = make(map[string]bool)
+	for _, u := range usernames {
+		if key, err := identity.CanonicalUsername(u); err == nil {
+			userModule.reservedUsernames[key] = true
+		}
+	}
 }
 
 // Create a new user account
+// Accounts can only be created in this manner where registration is open
 func (userModule *Controller) Create(email, username, pass string) (user User, err error) {
+	switch userModule.registration.Mode {
+	case config.RegistrationDisabled:
+		return nil, ErrorRegistrationDisabled
+	case config.RegistrationInvite:
+		return nil, ErrorInviteRequired
+	}
+
+	return userModule.create(email, username, pass, nil)
+}
+
+// create creates a new user account, using the provided invitation where set
+func (userModule *Controller) create(email, username, pass string, invite Invite) (user User, err error) {
+
+	// Identifiers must have a canonical form for case insensitive lookups
+	if _, err := identity.CanonicalEmail(email); err != nil {
+		return nil, ErrorInvalidEmail
+	}
+	usernameKey, err := identity.CanonicalUsername(username)
+	if err != nil || !usernameValidExp.MatchString(usernameKey) {
+		return nil, ErrorInvalidUsername
+	}
+	if userModule.reservedUsernames[usernameKey] {
+		return nil, ErrorReservedUsername
+	}
+
+	// Check email domain against registration restrictions
+	if err := userModule.checkDomain(email); err != nil {
+		return nil, err
+	}
+
+	// Check password against policy
+	if err := userModule.checkPassword(nil, pass, email, username); err != nil {
+		return nil, err
+	}
 
 	// Generate password hash
 	hash, hashErr := bcrypt.GenerateFromPassword([]byte(pass), userModule.hashRounds)
@@ -35,10 +163,6 @@ func (userModule *Controller) Create(email, username, pass string) (user User, e
 		return nil, ErrorPasswordHashTooShort
 	}
 
-	if len(pass) < minimumPasswordLength {
-		return nil, ErrorPasswordTooShort
-	}
-
 	// Check if user exists
 	u, err := userModule.userStore.GetUserByEmail(email)
 	if err != nil {
@@ -65,6 +189,19 @@ func (userModule *Controller) Create(email, username, pass string) (user User, e
 		return nil, ErrorDuplicateAccount
 	}
 
+	// Run registration hooks, these may reject or add data to the registration
+	reg := &api.Registration{
+		Email:    email,
+		Username: username,
+		Invited:  invite != nil,
+		Data:     make(map[string]string),
+	}
+	if userModule.createHooks != nil {
+		if err := userModule.createHooks.PreCreate(reg); err != nil {
+			return nil, err
+		}
+	}
+
 	// Add user to database (disabled)
 	u, err = userModule.userStore.AddUser(email, username, string(hash))
 	if err != nil {
@@ -75,10 +212,43 @@ func (userModule *Controller) Create(email, username, pass string) (user User, e
 
 	user = u.(User)
 
-	// Emit user creation event
+	userModule.recordPassword(user)
+
 	data := make(map[string]string)
+	for k, v := range reg.Data {
+		data[k] = v
+	}
+
+	// Invitations verify the email address so invited accounts are activated immediately
+	if invite != nil {
+		user.SetActivated(true)
+		_, err = userModule.userStore.UpdateUser(user)
+		if err != nil {
+			log.Printf("UserModule.Create: error activating user %s (%s)\r\n", user.GetExtID(), err)
+			return nil, ErrorUpdatingUser
+		}
+
+		invite.SetUsed(user.GetExtID(), time.Now())
+		_, err = userModule.userStore.UpdateInvite(invite)
+		if err != nil {
+			log.Printf("UserModule.Create: error updating invite (%s)\r\n", err)
+			return nil, ErrorUpdatingInvite
+		}
+
+		data["Invited"] = "true"
+		data["InvitedBy"] = invite.GetUserExtID()
+	}
+
+	// Emit user creation event
 	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountCreated, data))
 
+	// Post create hook failures are logged as the account has already been created
+	if userModule.createHooks != nil {
+		if err := userModule.createHooks.PostCreate(user, reg); err != nil {
+			log.Printf("UserModule.Create: post create hook error for user %s (%s)\r\n", user.GetExtID(), err)
+		}
+	}
+
 	log.Printf("UserModule.Create: User %s created\r\n", user.GetExtID())
 
 	return user, nil
@@ -183,13 +353,421 @@ func (userModule *Controller) Unlock(email string) (user User, err error) {
 	return user, nil
 }
 
+// SetEnabled enables or disables the provided user account
+func (userModule *Controller) SetEnabled(userid string, enabled bool) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	user.SetEnabled(enabled)
+
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.SetEnabled: error updating user %s (%s)\r\n", userid, err)
+		return nil, ErrorUpdatingUser
+	}
+
+	// Emit enable / disable event
+	eventType := events.EventAccountDisabled
+	if enabled {
+		eventType = events.EventAccountEnabled
+	}
+	data := make(map[string]string)
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), eventType, data))
+
+	log.Printf("UserModule.SetEnabled: User %s enabled: %t\r\n", user.GetExtID(), enabled)
+
+	return user, nil
+}
+
+// SetAdmin grants or revokes admin rights for the provided user account
+func (userModule *Controller) SetAdmin(userid string, admin bool) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	user.SetAdmin(admin)
+
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.SetAdmin: error updating user %s (%s)\r\n", userid, err)
+		return nil, ErrorUpdatingUser
+	}
+
+	// Emit admin grant / revoke event
+	eventType := events.EventAccountAdminRevoke
+	if admin {
+		eventType = events.EventAccountAdminGrant
+	}
+	data := make(map[string]string)
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), eventType, data))
+
+	log.Printf("UserModule.SetAdmin: User %s admin: %t\r\n", user.GetExtID(), admin)
+
+	return user, nil
+}
+
+// Delete permanently removes the provided user account
+func (userModule *Controller) Delete(userid string) error {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return err
+	}
+
+	err = userModule.userStore.RemoveUser(user)
+	if err != nil {
+		log.Printf("UserModule.Delete: error removing user %s (%s)\r\n", userid, err)
+		return ErrorRemovingUser
+	}
+
+	// Emit deletion event
+	// Removed accounts cannot be fetched by event handlers, so the event carries the account details
+	data := make(map[string]string)
+	data["Email"] = user.GetEmail()
+	data["Username"] = user.GetUsername()
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountDeleted, data))
+
+	log.Printf("UserModule.Delete: User %s deleted\r\n", user.GetExtID())
+
+	return nil
+}
+
+// ScheduleDeletion soft deletes the provided user account
+// This revokes sessions and removes credentials immediately, with the account purged after the grace period
+func (userModule *Controller) ScheduleDeletion(userid string) error {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return err
+	}
+
+	err = userModule.userStore.SoftDeleteUser(user)
+	if err != nil {
+		log.Printf("UserModule.ScheduleDeletion: error deleting user %s (%s)\r\n", userid, err)
+		return ErrorRemovingUser
+	}
+
+	// Emit deletion event
+	data := make(map[string]string)
+	data["Email"] = user.GetEmail()
+	data["Username"] = user.GetUsername()
+	data["PurgeAfter"] = time.Now().Add(userModule.deletionGrace).Format(time.RFC3339)
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountDeleted, data))
+
+	log.Printf("UserModule.ScheduleDeletion: User %s deleted, pending purge\r\n", user.GetExtID())
+
+	return nil
+}
+
+// CancelDeletion restores a deleted account within the grace period
+// This requires the account password, as deleted accounts cannot log in
+func (userModule *Controller) CancelDeletion(email, password string) (User, error) {
+	u, err := userModule.userStore.GetDeletedUserByEmail(email)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorFindingUser
+	}
+
+	// Fake hash if user does not exist to avoid leaking account info by timing
+	hash := "fake password hash"
+	if u != nil {
+		hash = u.(User).GetPassword()
+	}
+
+	hashErr := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if u == nil {
+		return nil, ErrorUserNotFound
+	}
+	if hashErr != nil {
+		return nil, ErrorPasswordMismatch
+	}
+
+	user := u.(User)
+
+	if time.Now().After(user.GetDeletedAt().Add(userModule.deletionGrace)) {
+		return nil, ErrorDeletionExpired
+	}
+
+	err = userModule.userStore.RestoreUser(user)
+	if err != nil {
+		log.Printf("UserModule.CancelDeletion: error restoring user %s (%s)\r\n", user.GetExtID(), err)
+		return nil, ErrorUpdatingUser
+	}
+
+	data := make(map[string]string)
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountDeletionCancelled, data))
+
+	log.Printf("UserModule.CancelDeletion: User %s restored\r\n", user.GetExtID())
+
+	return user, nil
+}
+
+// PurgeDeleted permanently removes accounts deleted prior to the grace period
+// This returns the number of accounts removed
+func (userModule *Controller) PurgeDeleted() (int, error) {
+	users, err := userModule.userStore.GetUsersDeletedBefore(time.Now().Add(-userModule.deletionGrace))
+	if err != nil {
+		log.Printf("UserModule.PurgeDeleted: error fetching deleted users (%s)\r\n", err)
+		return 0, ErrorFindingUser
+	}
+
+	count := 0
+	for _, u := range users {
+		user := u.(User)
+
+		err = userModule.userStore.RemoveUser(user)
+		if err != nil {
+			log.Printf("UserModule.PurgeDeleted: error removing user %s (%s)\r\n", user.GetExtID(), err)
+			return count, ErrorRemovingUser
+		}
+
+		data := make(map[string]string)
+		userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountPurged, data))
+
+		log.Printf("UserModule.PurgeDeleted: User %s purged\r\n", user.GetExtID())
+
+		count++
+	}
+
+	return count, nil
+}
+
+// passwordExpires returns the time at which a users password expires, or a zero time if passwords do not expire
+func (userModule *Controller) passwordExpires(user User) time.Time {
+	if userModule.maxPasswordAge == 0 {
+		return time.Time{}
+	}
+
+	// Accounts that have never set a password are aged from creation
+	changed := user.GetPasswordChanged()
+	if changed.IsZero() {
+		changed = user.GetCreatedAt()
+	}
+
+	return changed.Add(userModule.maxPasswordAge)
+}
+
+// WarnExpiringPasswords warns users with passwords that will expire within the warning period
+// Users are warned once per password, this returns the number of users warned
+func (userModule *Controller) WarnExpiringPasswords() (int, error) {
+	if userModule.maxPasswordAge == 0 || userModule.expiryWarning == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	users, err := userModule.userStore.GetUsersPasswordChangedBefore(now.Add(userModule.expiryWarning - userModule.maxPasswordAge))
+	if err != nil {
+		log.Printf("UserModule.WarnExpiringPasswords: error fetching users (%s)\r\n", err)
+		return 0, ErrorFindingUser
+	}
+
+	count := 0
+	for _, u := range users {
+		user := u.(User)
+
+		// Skip expired passwords and users already warned about the current password
+		expires := userModule.passwordExpires(user)
+		if now.After(expires) || user.GetPasswordExpiryWarned().After(expires.Add(-userModule.maxPasswordAge)) {
+			continue
+		}
+
+		user.SetPasswordExpiryWarned(now)
+		_, err = userModule.userStore.UpdateUser(user)
+		if err != nil {
+			log.Printf("UserModule.WarnExpiringPasswords: error updating user %s (%s)\r\n", user.GetExtID(), err)
+			return count, ErrorUpdatingUser
+		}
+
+		data := map[string]string{"Expires": expires.Format(time.RFC1123)}
+		userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventPasswordExpiring, data))
+
+		log.Printf("UserModule.WarnExpiringPasswords: User %s warned of password expiry\r\n", user.GetExtID())
+
+		count++
+	}
+
+	return count, nil
+}
+
+// lastActive returns the time at which a user was last active (logged in, created or reactivated)
+func lastActive(user User) time.Time {
+	last := user.GetCreatedAt()
+	for _, t := range []time.Time{user.GetLastLogin(), user.GetReactivated()} {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// CheckDormantAccounts warns inactive users and disables accounts past the dormancy period
+// Administrators and service accounts are exempt, this returns the number of users warned and disabled
+func (userModule *Controller) CheckDormantAccounts() (int, int, error) {
+	if userModule.dormancyDisable == 0 {
+		return 0, 0, nil
+	}
+
+	// Warnings are only sent prior to accounts being disabled
+	since := userModule.dormancyDisable
+	if userModule.dormancyWarning > 0 && userModule.dormancyWarning < since {
+		since = userModule.dormancyWarning
+	}
+
+	now := time.Now()
+	users, err := userModule.userStore.GetUsersInactiveSince(now.Add(-since))
+	if err != nil {
+		log.Printf("UserModule.CheckDormantAccounts: error fetching users (%s)\r\n", err)
+		return 0, 0, ErrorFindingUser
+	}
+
+	warned, disabled := 0, 0
+	for _, u := range users {
+		user := u.(User)
+		if user.IsAdmin() || user.IsServiceAccount() {
+			continue
+		}
+
+		last := lastActive(user)
+		data := map[string]string{"LastActive": last.Format(time.RFC1123)}
+
+		if now.After(last.Add(userModule.dormancyDisable)) {
+			// Disable dormant accounts
+			user.SetEnabled(false)
+			user.SetDormant(true)
+			data["Reason"] = "dormant"
+
+			if _, err = userModule.userStore.UpdateUser(user); err != nil {
+				log.Printf("UserModule.CheckDormantAccounts: error updating user %s (%s)\r\n", user.GetExtID(), err)
+				return warned, disabled, ErrorUpdatingUser
+			}
+
+			userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountDisabled, data))
+			log.Printf("UserModule.CheckDormantAccounts: User %s disabled due to inactivity\r\n", user.GetExtID())
+			disabled++
+
+		} else if !user.GetDormancyWarned().After(last) {
+			// Warn users once per period of inactivity
+			user.SetDormancyWarned(now)
+			data["Disables"] = last.Add(userModule.dormancyDisable).Format(time.RFC1123)
+
+			if _, err = userModule.userStore.UpdateUser(user); err != nil {
+				log.Printf("UserModule.CheckDormantAccounts: error updating user %s (%s)\r\n", user.GetExtID(), err)
+				return warned, disabled, ErrorUpdatingUser
+			}
+
+			userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountDormant, data))
+			log.Printf("UserModule.CheckDormantAccounts: User %s warned of inactivity\r\n", user.GetExtID())
+			warned++
+		}
+	}
+
+	return warned, disabled, nil
+}
+
+// reactivate re-enables an account that was disabled due to inactivity
+// Accounts disabled for other reasons cannot be reactivated
+func (userModule *Controller) reactivate(user User) error {
+	if user.IsEnabled() || !user.IsDormant() {
+		return ErrorNotDormant
+	}
+
+	user.SetEnabled(true)
+	user.SetDormant(false)
+	user.SetReactivated(time.Now())
+
+	_, err := userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.reactivate: error updating user %s (%s)\r\n", user.GetExtID(), err)
+		return ErrorUpdatingUser
+	}
+
+	data := make(map[string]string)
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountReactivated, data))
+
+	log.Printf("UserModule.reactivate: User %s reactivated\r\n", user.GetExtID())
+
+	return nil
+}
+
+// SetServiceAccount sets whether a user is a service account
+// Service accounts are exempt from dormancy checks
+func (userModule *Controller) SetServiceAccount(userid string, service bool) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	user.SetServiceAccount(service)
+
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.SetServiceAccount: error updating user %s (%s)\r\n", userid, err)
+		return nil, ErrorUpdatingUser
+	}
+
+	log.Printf("UserModule.SetServiceAccount: User %s service account: %t\r\n", userid, service)
+
+	return user, nil
+}
+
+// SetPasswordChangeRequired sets whether a user must change their password prior to logging in
+// Requiring a password change revokes existing sessions
+func (userModule *Controller) SetPasswordChangeRequired(userid string, required bool) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	user.SetPasswordChangeRequired(required)
+	if required {
+		user.SetSessionsRevoked(time.Now())
+	}
+
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.SetPasswordChangeRequired: error updating user %s (%s)\r\n", userid, err)
+		return nil, ErrorUpdatingUser
+	}
+
+	if required {
+		data := make(map[string]string)
+		userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventPasswordChangeRequired, data))
+	}
+
+	log.Printf("UserModule.SetPasswordChangeRequired: User %s password change required: %t\r\n", userid, required)
+
+	return user, nil
+}
+
+// fetchUser fetches a user by userid, wrapping store errors
+func (userModule *Controller) fetchUser(userid string) (User, error) {
+	u, err := userModule.userStore.GetUserByExtID(userid)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorFindingUser
+	}
+	if u == nil {
+		return nil, ErrorUserNotFound
+	}
+
+	return u.(User), nil
+}
+
 // Login checks user credentials and returns a login state and the associated user object (if found)
-func (userModule *Controller) Login(email string, pass string) (bool, interface{}, error) {
+// Users may log in with either their email address or username
+func (userModule *Controller) Login(identifier string, pass string) (bool, interface{}, error) {
 
 	// Fetch user account
-	u, err := userModule.userStore.GetUserByEmail(email)
+	var u interface{}
+	var err error
+	if strings.Contains(identifier, "@") {
+		u, err = userModule.userStore.GetUserByEmail(identifier)
+	} else {
+		u, err = userModule.userStore.GetUserByUsername(identifier)
+	}
 	if err != nil {
-		log.Printf("UserModule.Login: error fetching user %s (%s)\r\n", email, err)
+		log.Printf("UserModule.Login: error fetching user %s (%s)\r\n", identifier, err)
 		return false, nil, nil
 	}
 
@@ -246,19 +824,38 @@ func (userModule *Controller) Login(email string, pass string) (bool, interface{
 	return false, nil, nil
 }
 
-type UserResp struct {
-	ExtId     string
-	Email     string
-	Username  string
-	Activated bool
-	Enabled   bool
-	Locked    bool
-	LastLogin time.Time
-	CreatedAt time.Time
+// Reauthenticate checks the password of a logged in user prior to granting a sudo session
+// Failed attempts count towards locking the account in the same manner as failed logins
+func (userModule *Controller) Reauthenticate(userid, pass string) (bool, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return false, err
+	}
+
+	ok, u, err := userModule.Login(user.GetEmail(), pass)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	// Successful re-authentication clears failed attempts as with a successful login
+	user = u.(User)
+	user.SetLoginRetries(0)
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.Reauthenticate: error %s\r\n", err)
+		return false, err
+	}
+
+	return true, nil
 }
 
-func (ur *UserResp) GetExtID() string { return ur.ExtId }
-func (ur *UserResp) GetEmail() string { return ur.Email }
+// LoadUser fetches the user object for a user ID, for use by login hooks
+func (userModule *Controller) LoadUser(userid string) (interface{}, error) {
+	return userModule.fetchUser(userid)
+}
 
 // GetUser finds a user by userID
 func (userModule *Controller) GetUser(userid string) (interface{}, error) {
@@ -277,7 +874,7 @@ func (userModule *Controller) GetUser(userid string) (interface{}, error) {
 	}
 
 	user := u.(User)
-	resp := UserResp{
+	resp := api.UserResp{
 		ExtId:     user.GetExtID(),
 		Email:     user.GetEmail(),
 		Username:  user.GetUsername(),
@@ -307,7 +904,7 @@ func (userModule *Controller) GetUserByEmail(email string) (interface{}, error)
 	}
 
 	user := u.(User)
-	resp := UserResp{
+	resp := api.UserResp{
 		ExtId:     user.GetExtID(),
 		Email:     user.GetEmail(),
 		Username:  user.GetUsername(),
@@ -320,10 +917,66 @@ func (userModule *Controller) GetUserByEmail(email string) (interface{}, error)
 	return &resp, nil
 }
 
+// checkPassword checks a password against the password policy and password history (for existing users)
+// Without a password policy only the minimum password length is enforced
+func (userModule *Controller) checkPassword(user User, password, email, username string) error {
+	if userModule.policy == nil {
+		if len(password) < minimumPasswordLength {
+			return ErrorPasswordTooShort
+		}
+		return nil
+	}
+
+	err := userModule.policy.Check(password, email, username)
+	if err != nil {
+		return err
+	}
+
+	if user == nil || userModule.policy.HistorySize() == 0 {
+		return nil
+	}
+
+	history, err := userModule.userStore.GetPasswordHistory(user.GetExtID(), userModule.policy.HistorySize())
+	if err != nil {
+		log.Printf("UserModule.checkPassword: error fetching password history (%s)", err)
+		return ErrorFindingUser
+	}
+
+	// Include the current password in case it predates the password history
+	hashes := []string{user.GetPassword()}
+	for _, h := range history {
+		hashes = append(hashes, h.(PasswordRecord).GetHash())
+	}
+
+	return userModule.policy.CheckHistory(password, hashes)
+}
+
+// recordPassword adds a users current password to the password history
+// Failures are logged rather than blocking password changes
+func (userModule *Controller) recordPassword(user User) {
+	if userModule.policy == nil || userModule.policy.HistorySize() == 0 {
+		return
+	}
+
+	_, err := userModule.userStore.AddPasswordHistory(user.GetExtID(), user.GetPassword())
+	if err != nil {
+		log.Printf("UserModule.recordPassword: error adding password history (%s)", err)
+		return
+	}
+
+	err = userModule.userStore.TrimPasswordHistory(user.GetExtID(), userModule.policy.HistorySize())
+	if err != nil {
+		log.Printf("UserModule.recordPassword: error trimming password history (%s)", err)
+	}
+}
+
 func (userModule *Controller) handleSetPassword(user User, password string) error {
 
-	// TODO: check password requirements here.
-	// Not URL, Not in most common list, does not contain username or servicename
+	// Check password against policy and history
+	err := userModule.checkPassword(user, password, user.GetEmail(), user.GetUsername())
+	if err != nil {
+		return err
+	}
 
 	// Generate new hash
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), userModule.hashRounds)
@@ -340,6 +993,11 @@ func (userModule *Controller) handleSetPassword(user User, password string) erro
 		return ErrorUpdatingUser
 	}
 
+	userModule.recordPassword(user)
+
+	// Remembered devices must complete the second factor again after a password change
+	userModule.clearTrustedDevices(user)
+
 	// Emit password update event
 	data := make(map[string]string)
 	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventPasswordUpdate, data))
@@ -407,9 +1065,206 @@ func (userModule *Controller) UpdatePassword(userid string, old string, new stri
 	return user, err
 }
 
+// ChangeUsername changes the username for the provided user
+// Usernames must be valid, unused and not reserved, and can only be changed once per cooldown period
+func (userModule *Controller) ChangeUsername(userid, username string) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !usernameValidExp.MatchString(username) {
+		return nil, ErrorInvalidUsername
+	}
+	if key, _ := identity.CanonicalUsername(username); userModule.reservedUsernames[key] {
+		return nil, ErrorReservedUsername
+	}
+
+	changed := user.GetUsernameChanged()
+	if !changed.IsZero() && time.Now().Before(changed.Add(userModule.usernameCooldown)) {
+		return nil, ErrorUsernameCooldown
+	}
+
+	// Check the new username is not already in use
+	u, err := userModule.userStore.GetUserByUsername(username)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorFindingUser
+	}
+	if u != nil {
+		return nil, ErrorDuplicateAccount
+	}
+
+	oldUsername := user.GetUsername()
+	user.SetUsername(username)
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorUpdatingUser
+	}
+
+	data := map[string]string{"OldUsername": oldUsername, "NewUsername": username}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventUsernameChanged, data))
+
+	log.Printf("UserModule.ChangeUsername: User %s username changed\r\n", user.GetExtID())
+
+	return user, nil
+}
+
+// RequestEmailChange starts an email change for the provided user
+// The new address is stored as pending until the change is confirmed via an emailed token
+func (userModule *Controller) RequestEmailChange(userid, email string) (User, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	// New addresses are subject to the same domain restrictions as registration
+	if err := userModule.checkDomain(email); err != nil {
+		return nil, err
+	}
+
+	// Check the new address is not already in use
+	u, err := userModule.userStore.GetUserByEmail(email)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorFindingUser
+	}
+	if u != nil {
+		return nil, ErrorDuplicateAccount
+	}
+
+	user.SetPendingEmail(email)
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorUpdatingUser
+	}
+
+	data := map[string]string{"OldEmail": user.GetEmail(), "NewEmail": email}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventEmailChangeRequested, data))
+
+	log.Printf("UserModule.RequestEmailChange: User %s requested email change\r\n", user.GetExtID())
+
+	return user, nil
+}
+
+// confirmEmailChange swaps a users email address for the pending address
+// The confirmation token is bound to the requested address so links from earlier requests cannot
+// confirm a different pending address
+func (userModule *Controller) confirmEmailChange(user User, requested string) error {
+	email := user.GetPendingEmail()
+	if email == "" {
+		return ErrorNoEmailChangePending
+	}
+	if requested != email {
+		return ErrorEmailChangeMismatch
+	}
+
+	// Re-check domain restrictions as these may have changed since the request
+	if err := userModule.checkDomain(email); err != nil {
+		return err
+	}
+
+	// Re-check uniqueness as the address may have been claimed since the request
+	u, err := userModule.userStore.GetUserByEmail(email)
+	if err != nil {
+		log.Println(err)
+		return ErrorFindingUser
+	}
+	if u != nil {
+		return ErrorDuplicateAccount
+	}
+
+	oldEmail := user.GetEmail()
+	user.SetEmail(email)
+	user.SetPendingEmail("")
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Println(err)
+		return ErrorUpdatingUser
+	}
+
+	data := map[string]string{"OldEmail": oldEmail, "NewEmail": email}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventEmailChanged, data))
+
+	log.Printf("UserModule.confirmEmailChange: User %s email changed\r\n", user.GetExtID())
+
+	return nil
+}
+
+// cancelEmailChange clears a pending email change
+// The cancellation token is bound to the requested address so only that request is cancelled
+func (userModule *Controller) cancelEmailChange(user User, requested string) error {
+	email := user.GetPendingEmail()
+	if email == "" {
+		return ErrorNoEmailChangePending
+	}
+	if requested != email {
+		return ErrorEmailChangeMismatch
+	}
+
+	user.SetPendingEmail("")
+	_, err := userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Println(err)
+		return ErrorUpdatingUser
+	}
+
+	data := map[string]string{"NewEmail": email}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventEmailChangeCancelled, data))
+
+	log.Printf("UserModule.cancelEmailChange: User %s email change cancelled\r\n", user.GetExtID())
+
+	return nil
+}
+
+// revertEmailChange restores the address an email change was confirmed from and secures the account
+// This is used where the owner of the previous address did not make the change
+func (userModule *Controller) revertEmailChange(user User, previous string) error {
+	if previous == "" {
+		return ErrorInvalidEmail
+	}
+	if user.GetEmail() == previous {
+		return nil
+	}
+
+	// Check the previous address has not been claimed since the change
+	u, err := userModule.userStore.GetUserByEmail(previous)
+	if err != nil {
+		log.Println(err)
+		return ErrorFindingUser
+	}
+	if u != nil {
+		return ErrorDuplicateAccount
+	}
+
+	email := user.GetEmail()
+	user.SetEmail(previous)
+	user.SetPendingEmail("")
+	_, err = userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Println(err)
+		return ErrorUpdatingUser
+	}
+
+	data := map[string]string{"OldEmail": email, "NewEmail": previous}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventEmailChangeReverted, data))
+
+	log.Printf("UserModule.revertEmailChange: User %s email change reverted\r\n", user.GetExtID())
+
+	return userModule.secure(user)
+}
+
 // HandleToken provides a generic method to handle an action token
 // This executes the specified api.TokenAction on the provided user
 func (userModule *Controller) HandleToken(userid string, action api.TokenAction) (err error) {
+	return userModule.HandleTokenData(userid, action, "")
+}
+
+// HandleTokenData handles an action token with the data bound to the token
+// Email change actions are bound to the address they were issued for
+func (userModule *Controller) HandleTokenData(userid string, action api.TokenAction, data string) (err error) {
 
 	u, err := userModule.userStore.GetUserByExtID(userid)
 	if err != nil {
@@ -436,6 +1291,26 @@ func (userModule *Controller) HandleToken(userid string, action api.TokenAction)
 		userModule.Activate(user.GetEmail())
 		return nil
 
+	case api.TokenActionEmailChange:
+		log.Printf("UserModule.HandleToken: Confirming email change\n")
+		return userModule.confirmEmailChange(user, data)
+
+	case api.TokenActionEmailCancel:
+		log.Printf("UserModule.HandleToken: Cancelling email change\n")
+		return userModule.cancelEmailChange(user, data)
+
+	case api.TokenActionEmailRevert:
+		log.Printf("UserModule.HandleToken: Reverting email change\n")
+		return userModule.revertEmailChange(user, data)
+
+	case api.TokenActionReactivate:
+		log.Printf("UserModule.HandleToken: Reactivating user\n")
+		return userModule.reactivate(user)
+
+	case api.TokenActionSecure:
+		log.Printf("UserModule.HandleToken: Securing user\n")
+		return userModule.secure(user)
+
 	default:
 		log.Printf("UserModule.HandleToken: Invalid token action\n")
 		return api.TokenError
@@ -467,12 +1342,70 @@ func (userModule *Controller) PreLogin(u interface{}) (bool, error) {
 	return true, nil
 }
 
+// PasswordChangeRequired checks whether a user must change their password prior to logging in
+// This is the case where a password has expired or a password change has been required for the user
+// Required password changes emit an event when set, expired passwords emit an event once per password
+func (userModule *Controller) PasswordChangeRequired(u interface{}) (bool, error) {
+	user := u.(User)
+
+	if user.IsPasswordChangeRequired() {
+		log.Printf("UserModule.PasswordChangeRequired: User %s must change password (required)\r\n", user.GetExtID())
+		return true, nil
+	}
+
+	expires := userModule.passwordExpires(user)
+	if expires.IsZero() || !time.Now().After(expires) {
+		return false, nil
+	}
+
+	log.Printf("UserModule.PasswordChangeRequired: User %s must change password (expired)\r\n", user.GetExtID())
+
+	// Skip users already notified of the expiry of the current password
+	if !user.GetPasswordExpiryWarned().Before(expires) {
+		return true, nil
+	}
+
+	user.SetPasswordExpiryWarned(time.Now())
+	_, err := userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.PasswordChangeRequired: error updating user %s (%s)\r\n", user.GetExtID(), err)
+		return false, ErrorUpdatingUser
+	}
+
+	data := map[string]string{"Expired": expires.Format(time.RFC1123)}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventPasswordExpired, data))
+
+	return true, nil
+}
+
+// ValidateSession checks whether a session created at the provided time is still valid for a user
+// Sessions are invalidated when a user is removed or disabled, or when sessions are revoked
+func (userModule *Controller) ValidateSession(userid string, loginAt time.Time) bool {
+	u, err := userModule.userStore.GetUserByExtID(userid)
+	if err != nil {
+		log.Printf("UserModule.ValidateSession: error fetching user %s (%s)\r\n", userid, err)
+		return false
+	}
+	if u == nil {
+		return false
+	}
+
+	user := u.(User)
+
+	if !user.IsEnabled() {
+		return false
+	}
+
+	return !loginAt.Before(user.GetSessionsRevoked())
+}
+
 // PostLoginSuccess runs success actions for the user module
 func (userModule *Controller) PostLoginSuccess(u interface{}) error {
 	user := u.(User)
 
 	// Update user object
 	user.SetLastLogin(time.Now())
+	user.SetLoginRetries(0)
 	_, err := userModule.userStore.UpdateUser(user)
 	if err != nil {
 		log.Printf("UserModule.PostLogin: error %s\r\n", err)
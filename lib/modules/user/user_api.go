@@ -3,7 +3,6 @@ package user
 import (
 	"log"
 	"net/http"
-	"regexp"
 	"strings"
 	//"encoding/json"
 )
@@ -26,7 +25,7 @@ type apiCtx struct {
 // BindUserContext Helper middleware to bind module to API context
 func BindUserContext(userModule *Controller) func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	return func(ctx *apiCtx, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-		ctx.um = userModule
+		ctx.um = userModule.WithRequest(ctx.GetRequestContext()).(*Controller)
 		next(rw, req)
 	}
 }
@@ -44,8 +43,31 @@ func (userModule *Controller) BindAPI(router *web.Router) {
 	userRouter.Get("/status", (*apiCtx).Status)
 	userRouter.Post("/create", (*apiCtx).Create)
 	userRouter.Get("/account", (*apiCtx).AccountGet)
-	userRouter.Post("/account", (*apiCtx).AccountPost)
+	userRouter.Post("/account/restore", (*apiCtx).AccountRestorePost)
+	userRouter.Get("/account/devices", (*apiCtx).DevicesGet)
 	userRouter.Post("/reset", (*apiCtx).ResetPost)
+	userRouter.Get("/invites", (*apiCtx).InvitesGet)
+	userRouter.Post("/invites", (*apiCtx).InvitesPost)
+	userRouter.Get("/invites/:code", (*apiCtx).InviteGet)
+	userRouter.Delete("/invites/:code", (*apiCtx).InviteDelete)
+
+	// Sensitive account actions require a current sudo session
+	sudoRouter := router.Subrouter(apiCtx{}, "/api")
+	sudoRouter.Middleware(BindUserContext(userModule))
+	sudoRouter.Middleware((*apiCtx).RequireSudoMiddleware)
+
+	sudoRouter.Post("/account", (*apiCtx).AccountPost)
+	sudoRouter.Delete("/account", (*apiCtx).AccountDelete)
+	sudoRouter.Post("/account/email", (*apiCtx).AccountEmailPost)
+	sudoRouter.Post("/account/username", (*apiCtx).AccountUsernamePost)
+	sudoRouter.Delete("/account/devices/:id", (*apiCtx).DeviceDelete)
+}
+
+// RequireSudoMiddleware requires logged in users to have re-authenticated prior to sensitive actions
+func (c *apiCtx) RequireSudoMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if c.CheckSudo(rw, req) {
+		next(rw, req)
+	}
 }
 
 // Test endpoint
@@ -62,8 +84,6 @@ func (c *apiCtx) Status(rw web.ResponseWriter, req *web.Request) {
 	}
 }
 
-var usernameExp = regexp.MustCompile(`([a-z0-9\.]+)`)
-
 func (c *apiCtx) Create(rw web.ResponseWriter, req *web.Request) {
 
 	email := strings.ToLower(req.FormValue("email"))
@@ -73,7 +93,7 @@ func (c *apiCtx) Create(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 	username := strings.ToLower(req.FormValue("username"))
-	if !usernameExp.MatchString(username) {
+	if !usernameValidExp.MatchString(username) {
 		log.Printf("Create: missing or invalid username (%s)", username)
 		c.WriteApiResult(rw, api.ResultError, "Missing or invalid username field")
 		return
@@ -85,16 +105,55 @@ func (c *apiCtx) Create(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
-	u, e := c.um.Create(email, username, password)
+	// Invitations are optional where registration is open
+	invite := req.FormValue("invite")
+
+	var u User
+	var e error
+	if invite != "" {
+		u, e = c.um.CreateWithInvite(email, username, password, invite)
+	} else {
+		u, e = c.um.Create(email, username, password)
+	}
 	if e != nil {
 		log.Printf("Create: user creation failed with %s", e)
 
+		if policyErr, ok := e.(*api.PasswordPolicyError); ok {
+			c.writePasswordPolicyError(rw, policyErr)
+			return
+		}
+		if regErr, ok := e.(*api.RegistrationError); ok {
+			c.writeRegistrationError(rw, regErr)
+			return
+		}
+
 		if e == ErrorDuplicateAccount {
 			c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().DuplicateUserAccount)
 			return
 		} else if e == ErrorPasswordTooShort {
 			c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().PasswordComplexityTooLow)
 			return
+		} else if e == ErrorInvalidEmail {
+			c.WriteApiResult(rw, api.ResultError, "Missing or invalid email address field")
+			return
+		} else if e == ErrorInvalidUsername {
+			c.WriteApiResult(rw, api.ResultError, "Missing or invalid username field")
+			return
+		} else if e == ErrorReservedUsername {
+			c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().UsernameReserved)
+			return
+		} else if e == ErrorRegistrationDisabled {
+			c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().RegistrationDisabled)
+			return
+		} else if e == ErrorInviteRequired {
+			c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().InviteRequired)
+			return
+		} else if e == ErrorInvalidInvite {
+			c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().InviteInvalid)
+			return
+		} else if e == ErrorDomainNotAllowed {
+			c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().EmailDomainNotAllowed)
+			return
 		}
 
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().InternalError)
@@ -109,6 +168,12 @@ func (c *apiCtx) Create(rw web.ResponseWriter, req *web.Request) {
 
 	log.Println("Create: Create OK")
 
+	// Invited accounts are activated on creation
+	if invite != "" {
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().CreateUserInvited)
+		return
+	}
+
 	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().CreateUserSuccess)
 }
 
@@ -131,12 +196,25 @@ func (c *apiCtx) AccountGet(rw web.ResponseWriter, req *web.Request) {
 }
 
 // Update user object
+// This is also available to users with a password change session (where a password change is required prior to login)
 func (c *apiCtx) AccountPost(rw web.ResponseWriter, req *web.Request) {
-	if c.GetUserID() == "" {
+	userID := c.GetUserID()
+	passwordChange := false
+	if userID == "" {
+		userID = c.GetPasswordChangeRequest(rw, req)
+		passwordChange = true
+	}
+	if userID == "" {
 		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
 		return
 	}
 
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
 	// Fetch password arguments
 	oldPass := req.FormValue("old_password")
 	if oldPass == "" {
@@ -150,16 +228,166 @@ func (c *apiCtx) AccountPost(rw web.ResponseWriter, req *web.Request) {
 	}
 
 	// Update password
-	_, err := c.um.UpdatePassword(c.GetUserID(), oldPass, newPass)
+	_, err := c.um.UpdatePassword(userID, oldPass, newPass)
+	if policyErr, ok := err.(*api.PasswordPolicyError); ok {
+		c.writePasswordPolicyError(rw, policyErr)
+		return
+	}
 	if err != nil {
 		log.Print(err)
 		c.WriteApiResult(rw, api.ResultError, c.GetAPILocale().InternalError)
 		return
 	}
 
+	// Users with a password change session must then log in with the new password
+	if passwordChange {
+		c.ClearPasswordChangeRequest(rw, req)
+		c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().PasswordChangeComplete)
+		return
+	}
+
 	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().PasswordUpdated)
 }
 
+// AccountEmailPost requests a change of email address for the logged in user
+// The change is applied once confirmed via the link sent to the new address
+func (c *apiCtx) AccountEmailPost(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	email := strings.ToLower(req.FormValue("email"))
+	if !govalidator.IsEmail(email) {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	_, err := c.um.RequestEmailChange(c.GetUserID(), email)
+	switch err {
+	case nil:
+	case ErrorInvalidEmail:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	case ErrorDomainNotAllowed:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().EmailDomainNotAllowed)
+		return
+	case ErrorDuplicateAccount:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().DuplicateUserAccount)
+		return
+	default:
+		log.Printf("UserAPI.AccountEmailPost error requesting email change (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().EmailChangeRequested)
+}
+
+// AccountUsernamePost changes the username of the logged in user
+func (c *apiCtx) AccountUsernamePost(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	username := strings.ToLower(req.FormValue("username"))
+
+	_, err := c.um.ChangeUsername(c.GetUserID(), username)
+	switch err {
+	case nil:
+	case ErrorInvalidUsername:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().UsernameInvalid)
+		return
+	case ErrorReservedUsername:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().UsernameReserved)
+		return
+	case ErrorDuplicateAccount:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().DuplicateUserAccount)
+		return
+	case ErrorUsernameCooldown:
+		c.WriteApiResultWithCode(rw, http.StatusTooManyRequests, api.ResultError, c.GetAPILocale().UsernameChangeCooldown)
+		return
+	default:
+		log.Printf("UserAPI.AccountUsernamePost error changing username (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().UsernameUpdated)
+}
+
+// AccountDelete deletes the logged in user account
+// Accounts can be restored until they are purged at the end of the deletion grace period
+func (c *apiCtx) AccountDelete(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	err := c.um.ScheduleDeletion(c.GetUserID())
+	if err != nil {
+		log.Printf("UserAPI.AccountDelete error deleting account (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.LogoutUser(rw, req)
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().AccountDeleted)
+}
+
+// AccountRestorePost cancels the deletion of an account during the deletion grace period
+func (c *apiCtx) AccountRestorePost(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() != "" {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().AlreadyAuthenticated)
+		return
+	}
+
+	email := req.FormValue("email")
+	if !govalidator.IsEmail(email) {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+	password := req.FormValue("password")
+	if password == "" {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	_, err := c.um.CancelDeletion(email, password)
+	switch err {
+	case nil:
+	case ErrorUserNotFound, ErrorPasswordMismatch, ErrorDeletionExpired:
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().AccountRestoreFailed)
+		return
+	default:
+		log.Printf("UserAPI.AccountRestorePost error restoring account (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().AccountRestored)
+}
+
 // ResetPost handles password reset posts
 func (c *apiCtx) ResetPost(rw web.ResponseWriter, req *web.Request) {
 	if c.GetUserID() != "" {
@@ -186,6 +414,10 @@ func (c *apiCtx) ResetPost(rw web.ResponseWriter, req *web.Request) {
 
 	// Update password
 	_, err := c.um.SetPassword(userid, password)
+	if policyErr, ok := err.(*api.PasswordPolicyError); ok {
+		c.writePasswordPolicyError(rw, policyErr)
+		return
+	}
 	if err != nil {
 		log.Printf("UserAPI.ResetPost error setting password (%s)", err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -195,3 +427,200 @@ func (c *apiCtx) ResetPost(rw web.ResponseWriter, req *web.Request) {
 	// Write OK response
 	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().PasswordUpdated)
 }
+
+// InvitesGet lists the invitations issued by the logged in user
+func (c *apiCtx) InvitesGet(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	invites, err := c.um.GetInvites(c.GetUserID())
+	if err != nil {
+		log.Printf("UserAPI.InvitesGet error fetching invites (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	resp := make([]api.Invite, len(invites))
+	for i, invite := range invites {
+		resp[i] = api.Invite{
+			Code:      invite.GetCode(),
+			Email:     invite.GetEmail(),
+			CreatedAt: invite.GetCreatedAt(),
+			ExpiresAt: invite.GetExpiry(),
+			Used:      invite.IsUsed(),
+		}
+	}
+
+	c.WriteJson(rw, resp)
+}
+
+// InvitesPost issues an invitation to the provided email address
+func (c *apiCtx) InvitesPost(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	email := strings.ToLower(req.FormValue("email"))
+	if !govalidator.IsEmail(email) {
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().FormParsingError)
+		return
+	}
+
+	_, err := c.um.CreateInvite(c.GetUserID(), email)
+	switch err {
+	case nil:
+	case ErrorInviteNotAllowed:
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().InviteNotAllowed)
+		return
+	case ErrorRegistrationDisabled:
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().RegistrationDisabled)
+		return
+	case ErrorDomainNotAllowed:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().EmailDomainNotAllowed)
+		return
+	case ErrorDuplicateAccount:
+		c.WriteApiResultWithCode(rw, http.StatusBadRequest, api.ResultError, c.GetAPILocale().DuplicateUserAccount)
+		return
+	default:
+		log.Printf("UserAPI.InvitesPost error creating invite (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().InviteCreated)
+}
+
+// InviteGet fetches a valid invitation by code, used to pre-fill the registration form
+// This is available without logging in, the invitation code is not returned
+func (c *apiCtx) InviteGet(rw web.ResponseWriter, req *web.Request) {
+	invite, err := c.um.GetInvite(req.PathParams["code"])
+	switch err {
+	case nil:
+	case ErrorInvalidInvite:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().InviteInvalid)
+		return
+	default:
+		log.Printf("UserAPI.InviteGet error fetching invite (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteJson(rw, api.Invite{
+		Email:     invite.GetEmail(),
+		CreatedAt: invite.GetCreatedAt(),
+		ExpiresAt: invite.GetExpiry(),
+	})
+}
+
+// InviteDelete revokes an unused invitation issued by the logged in user
+func (c *apiCtx) InviteDelete(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	err := c.um.RevokeInvite(c.GetUserID(), req.PathParams["code"])
+	switch err {
+	case nil:
+	case ErrorInvalidInvite:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().InviteInvalid)
+		return
+	default:
+		log.Printf("UserAPI.InviteDelete error revoking invite (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().InviteRevoked)
+}
+
+// DevicesGet lists the devices remembered by the logged in user
+func (c *apiCtx) DevicesGet(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	devices, err := c.um.GetTrustedDevices(c.GetUserID())
+	if err != nil {
+		log.Printf("UserAPI.DevicesGet error fetching devices (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	resp := make([]api.TrustedDevice, len(devices))
+	for i, device := range devices {
+		resp[i] = api.TrustedDevice{
+			DeviceID:  device.GetDeviceID(),
+			UserAgent: device.GetUserAgent(),
+			CreatedAt: device.GetCreatedAt(),
+			LastUsed:  device.GetLastUsed(),
+			ExpiresAt: device.GetExpiry(),
+		}
+	}
+
+	c.WriteJson(rw, resp)
+}
+
+// DeviceDelete revokes a device remembered by the logged in user
+func (c *apiCtx) DeviceDelete(rw web.ResponseWriter, req *web.Request) {
+	if c.GetUserID() == "" {
+		c.WriteApiResultWithCode(rw, http.StatusUnauthorized, api.ResultError, c.GetAPILocale().Unauthorized)
+		return
+	}
+
+	// Block sensitive actions while impersonating
+	if c.IsImpersonating() {
+		c.WriteApiResultWithCode(rw, http.StatusForbidden, api.ResultError, c.GetAPILocale().ImpersonationBlocked)
+		return
+	}
+
+	err := c.um.RevokeTrustedDevice(c.GetUserID(), req.PathParams["id"])
+	switch err {
+	case nil:
+	case ErrorDeviceNotFound:
+		c.WriteApiResultWithCode(rw, http.StatusNotFound, api.ResultError, c.GetAPILocale().DeviceNotFound)
+		return
+	default:
+		log.Printf("UserAPI.DeviceDelete error revoking device (%s)", err)
+		c.WriteApiResultWithCode(rw, http.StatusInternalServerError, api.ResultError, c.GetAPILocale().InternalError)
+		return
+	}
+
+	c.WriteApiResult(rw, api.ResultOk, c.GetAPILocale().DeviceRevoked)
+}
+
+// writePasswordPolicyError writes a password policy rejection listing the failed policy rules
+func (c *apiCtx) writePasswordPolicyError(rw web.ResponseWriter, err *api.PasswordPolicyError) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusBadRequest)
+	c.WriteJson(rw, api.NewPasswordPolicyResponse(c.GetAPILocale(), err))
+}
+
+// writeRegistrationError writes a registration rejection from a registration hook
+// Unavailable registrations can be retried
+func (c *apiCtx) writeRegistrationError(rw web.ResponseWriter, err *api.RegistrationError) {
+	code := http.StatusForbidden
+	if err.Reason == api.RegistrationReasonUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	c.WriteJson(rw, api.NewRegistrationResponse(c.GetAPILocale(), err))
+}
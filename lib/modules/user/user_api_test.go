@@ -47,6 +47,7 @@ func TestUserApi(t *testing.T) {
 		//Middleware(web.ShowErrorsMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).SessionMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).GetIPMiddleware).
+		Middleware((*appcontext.AuthPlzCtx).RequestIDMiddleware).
 		Middleware((*appcontext.AuthPlzCtx).GetLocaleMiddleware)
 
 	userModule.BindAPI(router)
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// Length of generated device tokens
+const deviceTokenBytes = 32
+
+// hashDeviceToken generates the stored hash of a device token
+func hashDeviceToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// RememberDevice records a trusted device for a user that has completed a second factor
+// This returns the device token to be stored on the device, or a blank token where remembering devices is disabled
+func (userModule *Controller) RememberDevice(userid, userAgent string) (string, time.Time, error) {
+	if userModule.secondFactor.RememberDevice == 0 {
+		return "", time.Time{}, nil
+	}
+
+	data := make([]byte, deviceTokenBytes)
+	if _, err := rand.Read(data); err != nil {
+		log.Printf("UserModule.RememberDevice: error generating device token (%s)\r\n", err)
+		return "", time.Time{}, ErrorAddingToken
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+
+	expiry := time.Now().Add(userModule.secondFactor.RememberDevice)
+	d, err := userModule.userStore.AddTrustedDevice(userid, uuid.NewV4().String(), hashDeviceToken(token), userAgent, expiry)
+	if err != nil {
+		log.Printf("UserModule.RememberDevice: error adding device (%s)\r\n", err)
+		return "", time.Time{}, ErrorAddingToken
+	}
+	device := d.(TrustedDevice)
+
+	eventData := make(map[string]string)
+	eventData["DeviceID"] = device.GetDeviceID()
+	eventData["UserAgent"] = userAgent
+	eventData["Expires"] = expiry.Format(time.RFC1123)
+	userModule.emitter.SendEvent(events.NewEvent(userid, events.Event2faDeviceRemembered, eventData))
+
+	log.Printf("UserModule.RememberDevice: User %s remembered device %s\r\n", userid, device.GetDeviceID())
+
+	return token, expiry, nil
+}
+
+// ValidateDevice checks whether a device token matches an unexpired trusted device for a user
+func (userModule *Controller) ValidateDevice(userid, token string) bool {
+	devices, err := userModule.userStore.GetTrustedDevices(userid)
+	if err != nil {
+		log.Printf("UserModule.ValidateDevice: error fetching devices (%s)\r\n", err)
+		return false
+	}
+
+	hash := hashDeviceToken(token)
+	for _, d := range devices {
+		device := d.(TrustedDevice)
+		if subtle.ConstantTimeCompare([]byte(device.GetTokenHash()), []byte(hash)) != 1 {
+			continue
+		}
+		if time.Now().After(device.GetExpiry()) {
+			return false
+		}
+
+		device.SetLastUsed(time.Now())
+		_, err = userModule.userStore.UpdateTrustedDevice(device)
+		if err != nil {
+			log.Printf("UserModule.ValidateDevice: error updating device (%s)\r\n", err)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// GetTrustedDevices fetches the unexpired trusted devices for a user
+func (userModule *Controller) GetTrustedDevices(userid string) ([]TrustedDevice, error) {
+	d, err := userModule.userStore.GetTrustedDevices(userid)
+	if err != nil {
+		log.Printf("UserModule.GetTrustedDevices: error fetching devices (%s)\r\n", err)
+		return nil, ErrorFindingDevice
+	}
+
+	devices := make([]TrustedDevice, len(d))
+	for i := range d {
+		devices[i] = d[i].(TrustedDevice)
+	}
+
+	return devices, nil
+}
+
+// RevokeTrustedDevice revokes a trusted device for a user, requiring the second factor at the next login from the device
+func (userModule *Controller) RevokeTrustedDevice(userid, deviceID string) error {
+	devices, err := userModule.GetTrustedDevices(userid)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		if device.GetDeviceID() != deviceID {
+			continue
+		}
+
+		err = userModule.userStore.RemoveTrustedDevice(device)
+		if err != nil {
+			log.Printf("UserModule.RevokeTrustedDevice: error removing device (%s)\r\n", err)
+			return ErrorUpdatingDevice
+		}
+
+		eventData := make(map[string]string)
+		eventData["DeviceID"] = deviceID
+		userModule.emitter.SendEvent(events.NewEvent(userid, events.Event2faDeviceRevoked, eventData))
+
+		log.Printf("UserModule.RevokeTrustedDevice: User %s revoked device %s\r\n", userid, deviceID)
+
+		return nil
+	}
+
+	return ErrorDeviceNotFound
+}
+
+// clearTrustedDevices revokes all trusted devices for a user, this is called when a users password is changed
+// Failures are logged rather than blocking password changes
+func (userModule *Controller) clearTrustedDevices(user User) {
+	err := userModule.userStore.RemoveTrustedDevices(user.GetExtID())
+	if err != nil {
+		log.Printf("UserModule.clearTrustedDevices: error removing devices (%s)\r\n", err)
+	}
+}
@@ -12,6 +12,28 @@ var (
 	ErrorUserNotFound         = errors.New("User Controller: user not found")
 	ErrorPasswordMismatch     = errors.New("User Controller: password mismatch")
 	ErrorUpdatingUser         = errors.New("User Controller: error updating user")
+	ErrorRemovingUser         = errors.New("User Controller: error removing user")
 	ErrorAddingToken          = errors.New("User Controller: error adding token")
 	ErrorUpdatingToken        = errors.New("User Controller: error updating token")
+	ErrorDeletionExpired      = errors.New("User Controller: account deletion grace period has expired")
+	ErrorNoEmailChangePending = errors.New("User Controller: no email change pending")
+	ErrorEmailChangeMismatch  = errors.New("User Controller: email change token does not match the requested address")
+	ErrorInvalidEmail         = errors.New("User Controller: invalid email address")
+	ErrorInvalidUsername      = errors.New("User Controller: invalid username")
+	ErrorReservedUsername     = errors.New("User Controller: username is reserved")
+	ErrorUsernameCooldown     = errors.New("User Controller: username was changed too recently")
+	ErrorNotDormant           = errors.New("User Controller: account was not disabled due to inactivity")
+	ErrorRegistrationDisabled = errors.New("User Controller: registration is disabled")
+	ErrorInviteRequired       = errors.New("User Controller: registration requires an invitation")
+	ErrorInvalidInvite        = errors.New("User Controller: invitation is invalid, expired or already used")
+	ErrorInviteNotAllowed     = errors.New("User Controller: user is not permitted to issue invitations")
+	ErrorDomainNotAllowed     = errors.New("User Controller: email domain is not permitted for registration")
+	ErrorFindingInvite        = errors.New("User Controller: error fetching invitation")
+	ErrorCreatingInvite       = errors.New("User Controller: error creating invitation")
+	ErrorUpdatingInvite       = errors.New("User Controller: error updating invitation")
+	ErrorDeviceNotFound       = errors.New("User Controller: remembered device not found")
+	ErrorFindingDevice        = errors.New("User Controller: error fetching remembered devices")
+	ErrorUpdatingDevice       = errors.New("User Controller: error updating remembered device")
+	ErrorFindingLoginDevice   = errors.New("User Controller: error fetching login devices")
+	ErrorUpdatingLoginDevice  = errors.New("User Controller: error updating login device")
 )
@@ -3,17 +3,28 @@ package user
 import (
 	"errors"
 	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
 )
 
 // User Defines the User object interfaces required by this module
 type User interface {
 	GetExtID() string
 	GetEmail() string
+	SetEmail(email string)
+	GetPendingEmail() string
+	SetPendingEmail(email string)
 	GetUsername() string
+	SetUsername(username string)
+	GetUsernameChanged() time.Time
 
 	GetPassword() string
 	SetPassword(pass string)
 	GetPasswordChanged() time.Time
+	IsPasswordChangeRequired() bool
+	SetPasswordChangeRequired(required bool)
+	GetPasswordExpiryWarned() time.Time
+	SetPasswordExpiryWarned(t time.Time)
 
 	IsActivated() bool
 	SetActivated(activated bool)
@@ -31,16 +42,121 @@ type User interface {
 	SetLocked(locked bool)
 
 	IsAdmin() bool
+	SetAdmin(admin bool)
+
+	IsServiceAccount() bool
+	SetServiceAccount(service bool)
+	IsDormant() bool
+	SetDormant(dormant bool)
+	GetDormancyWarned() time.Time
+	SetDormancyWarned(t time.Time)
+	GetReactivated() time.Time
+	SetReactivated(t time.Time)
+
+	GetSecondFactorDeadline() time.Time
+	SetSecondFactorDeadline(t time.Time)
+	GetSecondFactorReminded() time.Time
+	SetSecondFactorReminded(t time.Time)
+
+	GetSessionsRevoked() time.Time
+	SetSessionsRevoked(t time.Time)
+	GetCreatedAt() time.Time
+	GetDeletedAt() time.Time
+}
+
+// PasswordRecord Defines the password history interfaces required by this module
+type PasswordRecord interface {
+	GetHash() string
+}
+
+// Invite Defines the registration invitation interfaces required by this module
+type Invite interface {
+	GetID() uint
+	GetCode() string
+	GetUserExtID() string
+	GetEmail() string
+	GetCreatedAt() time.Time
+	GetExpiry() time.Time
+	IsUsed() bool
+	GetUsedBy() string
+	SetUsed(userExtID string, t time.Time)
+}
+
+// TrustedDevice Defines the remembered device interfaces required by this module
+type TrustedDevice interface {
+	GetDeviceID() string
+	GetTokenHash() string
+	GetUserAgent() string
+	GetCreatedAt() time.Time
+	GetLastUsed() time.Time
+	SetLastUsed(t time.Time)
+	GetExpiry() time.Time
+}
+
+// LoginDevice Defines the login device interfaces required by this module
+type LoginDevice interface {
+	GetIPPrefix() string
+	GetUserAgentFamily() string
+	SetIP(ip string)
+	SetUserAgent(userAgent string)
+	SetLastSeen(t time.Time)
+}
+
+// CreateHooks Defines the registration hook interfaces used by this module
+// PreCreate may reject a registration by returning an *api.RegistrationError
+type CreateHooks interface {
+	PreCreate(reg *api.Registration) error
+	PostCreate(u interface{}, reg *api.Registration) error
+}
+
+// PasswordPolicy Defines the password policy interfaces required by this module
+// Check and CheckHistory return an *api.PasswordPolicyError where a password is rejected
+type PasswordPolicy interface {
+	Check(password string, identities ...string) error
+	CheckHistory(password string, hashes []string) error
+	HistorySize() int
 }
 
 // Storer Defines the required store interfaces for the user module
-// Returned interfaces must satisfy the User interface requirements
+// Returned interfaces must satisfy the User, PasswordRecord, Invite, TrustedDevice and LoginDevice interface requirements
 type Storer interface {
 	AddUser(email, username, pass string) (interface{}, error)
 	GetUserByExtID(userid string) (interface{}, error)
 	GetUserByEmail(email string) (interface{}, error)
 	GetUserByUsername(username string) (interface{}, error)
 	UpdateUser(user interface{}) (interface{}, error)
+	RemoveUser(user interface{}) error
+	GetUsersPasswordChangedBefore(t time.Time) ([]interface{}, error)
+	GetUsersInactiveSince(t time.Time) ([]interface{}, error)
+	GetUsersWithoutSecondFactors(adminsOnly bool) ([]interface{}, error)
+
+	GetFidoTokens(userid string) ([]interface{}, error)
+	GetTotpTokens(userid string) ([]interface{}, error)
+
+	AddPasswordHistory(userid, hash string) (interface{}, error)
+	GetPasswordHistory(userid string, limit int) ([]interface{}, error)
+	TrimPasswordHistory(userid string, keep int) error
+
+	SoftDeleteUser(user interface{}) error
+	GetDeletedUserByEmail(email string) (interface{}, error)
+	GetUsersDeletedBefore(t time.Time) ([]interface{}, error)
+	RestoreUser(user interface{}) error
+
+	AddInvite(userid, code, email string, expiry time.Time) (interface{}, error)
+	GetInviteByCode(code string) (interface{}, error)
+	GetInvites(userid string) ([]interface{}, error)
+	UpdateInvite(invite interface{}) (interface{}, error)
+	RemoveInvite(invite interface{}) error
+
+	AddTrustedDevice(userid, deviceID, tokenHash, userAgent string, expiry time.Time) (interface{}, error)
+	GetTrustedDevices(userid string) ([]interface{}, error)
+	UpdateTrustedDevice(device interface{}) (interface{}, error)
+	RemoveTrustedDevice(device interface{}) error
+	RemoveTrustedDevices(userid string) error
+
+	AddLoginDevice(userid, ip, ipPrefix, userAgentFamily, userAgent string) (interface{}, error)
+	GetLoginDevices(userid string) ([]interface{}, error)
+	UpdateLoginDevice(device interface{}) (interface{}, error)
 }
 
 /*
@@ -0,0 +1,169 @@
+package user
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// Network prefix lengths used to group login addresses
+const (
+	ipv4PrefixLength = 24
+	ipv6PrefixLength = 48
+)
+
+// Browser and operating system families, matched in order against user agents
+var browserFamilies = []struct{ match, family string }{
+	{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"Trident/", "Internet Explorer"},
+}
+var osFamilies = []struct{ match, family string }{
+	{"Windows", "Windows"}, {"iPhone", "iOS"}, {"iPad", "iOS"}, {"Mac OS X", "macOS"},
+	{"Android", "Android"}, {"CrOS", "Chrome OS"}, {"Linux", "Linux"},
+}
+
+// ipPrefix fetches the network prefix of an IP address, or the address itself where it cannot be parsed
+func ipPrefix(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		n := net.IPNet{IP: ip4.Mask(net.CIDRMask(ipv4PrefixLength, 32)), Mask: net.CIDRMask(ipv4PrefixLength, 32)}
+		return n.String()
+	}
+
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(ipv6PrefixLength, 128)), Mask: net.CIDRMask(ipv6PrefixLength, 128)}
+	return n.String()
+}
+
+// userAgentFamily fetches the browser and operating system family of a user agent
+// Versions are ignored so that browser updates are not detected as new devices
+func userAgentFamily(userAgent string) string {
+	browser, os := "", ""
+	for _, b := range browserFamilies {
+		if strings.Contains(userAgent, b.match) {
+			browser = b.family
+			break
+		}
+	}
+	for _, o := range osFamilies {
+		if strings.Contains(userAgent, o.match) {
+			os = o.family
+			break
+		}
+	}
+
+	// Fall back to the product name for non-browser clients
+	if browser == "" {
+		browser = strings.SplitN(strings.SplitN(userAgent, " ", 2)[0], "/", 2)[0]
+	}
+	if browser == "" {
+		browser = "Unknown"
+	}
+	if os == "" {
+		return browser
+	}
+
+	return browser + " on " + os
+}
+
+// LoginContext records the device a login was made from and detects logins from new devices
+// Logins from unseen devices emit a new device event, marked as suspicious where neither the network
+// nor the browser have been seen before. The first login for an account is recorded without notice
+func (userModule *Controller) LoginContext(u interface{}, login *api.LoginContext) error {
+	user := u.(User)
+
+	prefix := ipPrefix(login.IP)
+	family := userAgentFamily(login.UserAgent)
+
+	d, err := userModule.userStore.GetLoginDevices(user.GetExtID())
+	if err != nil {
+		log.Printf("UserModule.LoginContext: error fetching login devices (%s)\r\n", err)
+		return ErrorFindingLoginDevice
+	}
+
+	knownPrefix, knownFamily := false, false
+	for i := range d {
+		device := d[i].(LoginDevice)
+
+		if device.GetIPPrefix() == prefix {
+			knownPrefix = true
+		}
+		if device.GetUserAgentFamily() == family {
+			knownFamily = true
+		}
+
+		if device.GetIPPrefix() != prefix || device.GetUserAgentFamily() != family {
+			continue
+		}
+
+		// Known devices are updated with the latest address and user agent
+		device.SetIP(login.IP)
+		device.SetUserAgent(login.UserAgent)
+		device.SetLastSeen(time.Now())
+		_, err = userModule.userStore.UpdateLoginDevice(device)
+		if err != nil {
+			log.Printf("UserModule.LoginContext: error updating login device (%s)\r\n", err)
+			return ErrorUpdatingLoginDevice
+		}
+
+		return nil
+	}
+
+	_, err = userModule.userStore.AddLoginDevice(user.GetExtID(), login.IP, prefix, family, login.UserAgent)
+	if err != nil {
+		log.Printf("UserModule.LoginContext: error adding login device (%s)\r\n", err)
+		return ErrorUpdatingLoginDevice
+	}
+
+	if len(d) == 0 {
+		return nil
+	}
+
+	suspicious := !knownPrefix && !knownFamily
+
+	data := make(map[string]string)
+	data["IP"] = login.IP
+	data["IPPrefix"] = prefix
+	data["UserAgent"] = login.UserAgent
+	data["Device"] = family
+	data["Time"] = time.Now().Format(time.RFC1123)
+	if suspicious {
+		data["Suspicious"] = "true"
+	}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountLoginNewDevice, data))
+
+	log.Printf("UserModule.LoginContext: User %s login from new device %s (%s, suspicious: %t)\r\n",
+		user.GetExtID(), family, prefix, suspicious)
+
+	return nil
+}
+
+// secure locks an account and revokes existing sessions and remembered devices
+// This is used where a user reports a login they did not make
+func (userModule *Controller) secure(user User) error {
+	user.SetLocked(true)
+	user.SetSessionsRevoked(time.Now())
+
+	_, err := userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.secure: error updating user %s (%s)\r\n", user.GetExtID(), err)
+		return ErrorUpdatingUser
+	}
+
+	userModule.clearTrustedDevices(user)
+
+	data := map[string]string{"Reason": "secured"}
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventAccountLocked, data))
+	userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.EventSessionsRevoked, data))
+
+	log.Printf("UserModule.secure: User %s account secured\r\n", user.GetExtID())
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package user
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/events"
+	"github.com/ryankurte/authplz/lib/identity"
+)
+
+// Length of generated invitation codes in bytes
+const inviteCodeBytes = 24
+
+// DefaultDisposableDomains are well known disposable email domains, blocked where disposable email blocking is enabled
+var DefaultDisposableDomains = []string{
+	"10minutemail.com", "discard.email", "dispostable.com", "emailondeck.com", "fakeinbox.com",
+	"getnada.com", "guerrillamail.com", "guerrillamail.net", "mailcatch.com", "maildrop.cc",
+	"mailinator.com", "mailnesia.com", "mintemail.com", "mohmal.com", "sharklasers.com",
+	"spamgourmet.com", "temp-mail.org", "tempmail.com", "throwawaymail.com", "trashmail.com",
+	"yopmail.com",
+}
+
+// SetRegistration sets the registration mode and email domain restrictions
+// Additional disposable domains are loaded from the configured disposable file where set
+func (userModule *Controller) SetRegistration(c config.RegistrationConfig) error {
+	switch c.Mode {
+	case config.RegistrationOpen, config.RegistrationDisabled, config.RegistrationInvite:
+	default:
+		return fmt.Errorf("UserModule.SetRegistration: unknown registration mode '%s'", c.Mode)
+	}
+
+	disposable := append([]string{}, DefaultDisposableDomains...)
+	if c.DisposableFile != "" {
+		domains, err := loadDomainList(c.DisposableFile)
+		if err != nil {
+			return err
+		}
+		disposable = append(disposable, domains...)
+	}
+
+	userModule.registration = c
+	userModule.disposableDomains = disposable
+
+	return nil
+}
+
+// loadDomainList loads a list of domains from a file, one per line
+// Blank lines and lines starting with '#' are ignored
+func loadDomainList(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	domains := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+
+	return domains, scanner.Err()
+}
+
+// matchDomain checks whether a domain is, or is a subdomain of, any of the provided domains
+func matchDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d == "" {
+			continue
+		}
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDomain checks an email address against the registration domain restrictions
+func (userModule *Controller) checkDomain(email string) error {
+	key, err := identity.CanonicalEmail(email)
+	if err != nil {
+		return ErrorInvalidEmail
+	}
+	domain := key[strings.LastIndex(key, "@")+1:]
+
+	if len(userModule.registration.AllowedDomains) > 0 && !matchDomain(domain, userModule.registration.AllowedDomains) {
+		return ErrorDomainNotAllowed
+	}
+	if matchDomain(domain, userModule.registration.DeniedDomains) {
+		return ErrorDomainNotAllowed
+	}
+	if userModule.registration.BlockDisposable && matchDomain(domain, userModule.disposableDomains) {
+		return ErrorDomainNotAllowed
+	}
+
+	return nil
+}
+
+// fetchInvite fetches a valid (unused and unexpired) invitation by code
+func (userModule *Controller) fetchInvite(code string) (Invite, error) {
+	if code == "" {
+		return nil, ErrorInvalidInvite
+	}
+
+	i, err := userModule.userStore.GetInviteByCode(code)
+	if err != nil {
+		log.Printf("UserModule.fetchInvite: error fetching invite (%s)\r\n", err)
+		return nil, ErrorFindingInvite
+	}
+	if i == nil {
+		return nil, ErrorInvalidInvite
+	}
+
+	invite := i.(Invite)
+	if invite.IsUsed() || time.Now().After(invite.GetExpiry()) {
+		return nil, ErrorInvalidInvite
+	}
+
+	return invite, nil
+}
+
+// CreateWithInvite creates a new user account using an invitation
+// Invitations verify the email address, so accounts are activated on creation
+func (userModule *Controller) CreateWithInvite(email, username, pass, code string) (User, error) {
+	if userModule.registration.Mode == config.RegistrationDisabled {
+		return nil, ErrorRegistrationDisabled
+	}
+
+	invite, err := userModule.fetchInvite(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Invitations are bound to the email address they were issued for
+	emailKey, err := identity.CanonicalEmail(email)
+	if err != nil {
+		return nil, ErrorInvalidEmail
+	}
+	inviteKey, err := identity.CanonicalEmail(invite.GetEmail())
+	if err != nil || emailKey != inviteKey {
+		return nil, ErrorInvalidInvite
+	}
+
+	return userModule.create(email, username, pass, invite)
+}
+
+// GetInvite fetches a valid invitation by code, used to pre-fill registration
+func (userModule *Controller) GetInvite(code string) (Invite, error) {
+	return userModule.fetchInvite(code)
+}
+
+// CreateInvite issues a single use invitation for the provided email address
+// Invitations can be issued by admins, or by any user where user invites are enabled
+func (userModule *Controller) CreateInvite(userid, email string) (Invite, error) {
+	if userModule.registration.Mode == config.RegistrationDisabled {
+		return nil, ErrorRegistrationDisabled
+	}
+
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsAdmin() && !userModule.registration.UserInvites {
+		return nil, ErrorInviteNotAllowed
+	}
+
+	if err := userModule.checkDomain(email); err != nil {
+		return nil, err
+	}
+
+	// Check an account does not already exist
+	u, err := userModule.userStore.GetUserByEmail(email)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrorFindingUser
+	}
+	if u != nil {
+		return nil, ErrorDuplicateAccount
+	}
+
+	data := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(data); err != nil {
+		log.Printf("UserModule.CreateInvite: error generating invite code (%s)\r\n", err)
+		return nil, ErrorCreatingInvite
+	}
+	code := base64.RawURLEncoding.EncodeToString(data)
+
+	expiry := time.Now().Add(userModule.registration.InviteLifetime)
+	i, err := userModule.userStore.AddInvite(userid, code, email, expiry)
+	if err != nil {
+		log.Printf("UserModule.CreateInvite: error adding invite (%s)\r\n", err)
+		return nil, ErrorCreatingInvite
+	}
+
+	// Emit invite event, the mailer sends the invitation to the invited address
+	// Events are recorded for audit, so only the invite ID is included and the mailer fetches the code
+	invite := i.(Invite)
+	eventData := make(map[string]string)
+	eventData["Email"] = email
+	eventData["InviteID"] = strconv.FormatUint(uint64(invite.GetID()), 10)
+	eventData["Expires"] = expiry.Format(time.RFC1123)
+	userModule.emitter.SendEvent(events.NewEvent(userid, events.EventInviteCreated, eventData))
+
+	log.Printf("UserModule.CreateInvite: User %s issued invitation\r\n", userid)
+
+	return invite, nil
+}
+
+// GetInvites fetches the invitations issued by a user
+func (userModule *Controller) GetInvites(userid string) ([]Invite, error) {
+	i, err := userModule.userStore.GetInvites(userid)
+	if err != nil {
+		log.Printf("UserModule.GetInvites: error fetching invites (%s)\r\n", err)
+		return nil, ErrorFindingInvite
+	}
+
+	invites := make([]Invite, len(i))
+	for j := range i {
+		invites[j] = i[j].(Invite)
+	}
+
+	return invites, nil
+}
+
+// RevokeInvite revokes an unused invitation issued by the provided user
+func (userModule *Controller) RevokeInvite(userid, code string) error {
+	i, err := userModule.userStore.GetInviteByCode(code)
+	if err != nil {
+		log.Printf("UserModule.RevokeInvite: error fetching invite (%s)\r\n", err)
+		return ErrorFindingInvite
+	}
+	if i == nil {
+		return ErrorInvalidInvite
+	}
+
+	invite := i.(Invite)
+	if invite.GetUserExtID() != userid || invite.IsUsed() {
+		return ErrorInvalidInvite
+	}
+
+	err = userModule.userStore.RemoveInvite(invite)
+	if err != nil {
+		log.Printf("UserModule.RevokeInvite: error removing invite (%s)\r\n", err)
+		return ErrorUpdatingInvite
+	}
+
+	eventData := make(map[string]string)
+	eventData["Email"] = invite.GetEmail()
+	userModule.emitter.SendEvent(events.NewEvent(userid, events.EventInviteRevoked, eventData))
+
+	log.Printf("UserModule.RevokeInvite: User %s revoked invitation\r\n", userid)
+
+	return nil
+}
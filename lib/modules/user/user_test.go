@@ -1,14 +1,35 @@
 package user
 
-import "testing"
+import (
+	"strconv"
+	"testing"
+	"time"
+)
 
 import (
+	"github.com/ryankurte/authplz/lib/api"
 	"github.com/ryankurte/authplz/lib/config"
 	"github.com/ryankurte/authplz/lib/controllers/datastore"
+	"github.com/ryankurte/authplz/lib/controllers/password"
 	"github.com/ryankurte/authplz/lib/events"
 	"github.com/ryankurte/authplz/lib/test"
 )
 
+type mockCreateHooks struct {
+	err     error
+	created interface{}
+}
+
+func (m *mockCreateHooks) PreCreate(reg *api.Registration) error {
+	reg.Data["Source"] = "mock"
+	return m.err
+}
+
+func (m *mockCreateHooks) PostCreate(u interface{}, reg *api.Registration) error {
+	m.created = u
+	return nil
+}
+
 func TestUserController(t *testing.T) {
 	// Setup user controller for testing
 	var fakeEmail = "test@abc.com"
@@ -134,6 +155,40 @@ func TestUserController(t *testing.T) {
 		}
 	})
 
+	t.Run("Reauthenticate checks user passwords", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		ok, err := uc.Reauthenticate(userID, fakePass)
+		if err != nil {
+			t.Error(err)
+		}
+		if !ok {
+			t.Error("Reauthentication failed")
+		}
+
+		ok, err = uc.Reauthenticate(userID, "Wrong password")
+		if err != nil {
+			t.Error(err)
+		}
+		if ok {
+			t.Error("Reauthentication succeeded with incorrect password")
+		}
+
+		ok, err = uc.Reauthenticate(userID, fakePass)
+		if err != nil {
+			t.Error(err)
+		}
+		if !ok {
+			t.Error("Reauthentication failed")
+		}
+
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if retries := u.(User).GetLoginRetries(); retries != 0 {
+			t.Errorf("Reauthentication did not reset login retries (%d)", retries)
+		}
+	})
+
 	t.Run("PreLogin rejects disabled user accounts", func(t *testing.T) {
 		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
 
@@ -308,6 +363,919 @@ func TestUserController(t *testing.T) {
 		}
 	})
 
+	t.Run("SetEnabled disables and enables accounts", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+
+		u2, err := uc.SetEnabled(u.(User).GetExtID(), false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDisabled {
+			t.Error("Expected EventAccountDisabled")
+		}
+
+		res, _ := uc.PreLogin(u2)
+		if res {
+			t.Errorf("User account not disabled")
+		}
+
+		_, err = uc.SetEnabled(u.(User).GetExtID(), true)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountEnabled {
+			t.Error("Expected EventAccountEnabled")
+		}
+	})
+
+	t.Run("Can grant and revoke admin", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+
+		u2, err := uc.SetAdmin(u.(User).GetExtID(), true)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if !u2.IsAdmin() {
+			t.Errorf("User admin not granted")
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountAdminGrant {
+			t.Error("Expected EventAccountAdminGrant")
+		}
+
+		u2, err = uc.SetAdmin(u.(User).GetExtID(), false)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if u2.IsAdmin() {
+			t.Errorf("User admin not revoked")
+		}
+	})
+
+	t.Run("ValidateSession rejects revoked sessions", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		user := u.(*datastore.User)
+
+		loginAt := time.Now()
+		if !uc.ValidateSession(user.GetExtID(), loginAt) {
+			t.Errorf("Expected valid session")
+		}
+
+		user.SetSessionsRevoked(time.Now())
+		uc.userStore.UpdateUser(user)
+
+		if uc.ValidateSession(user.GetExtID(), loginAt) {
+			t.Errorf("Expected revoked session")
+		}
+		if !uc.ValidateSession(user.GetExtID(), time.Now()) {
+			t.Errorf("Expected valid session after revocation")
+		}
+		if uc.ValidateSession("fake-user", time.Now()) {
+			t.Errorf("Expected invalid session for missing user")
+		}
+	})
+
+	t.Run("Identifiers are case insensitive", func(t *testing.T) {
+		if _, err := uc.Create("TEST@abc.com", "another.user", fakePass); err != ErrorDuplicateAccount {
+			t.Errorf("Expected ErrorDuplicateAccount (received %v)", err)
+		}
+		if _, err := uc.Create("another@abc.com", "Test.User", fakePass); err != ErrorDuplicateAccount {
+			t.Errorf("Expected ErrorDuplicateAccount (received %v)", err)
+		}
+
+		res, _, _ := uc.Login("Test@ABC.com", fakePass)
+		if !res {
+			t.Error("User login with differently cased email failed")
+		}
+	})
+
+	t.Run("Create validates usernames", func(t *testing.T) {
+		if _, err := uc.Create("invalid@abc.com", "A!", fakePass); err != ErrorInvalidUsername {
+			t.Errorf("Expected ErrorInvalidUsername (received %v)", err)
+		}
+		if _, err := uc.Create("invalid@abc.com", "valid.prefix/../x", fakePass); err != ErrorInvalidUsername {
+			t.Errorf("Expected ErrorInvalidUsername (received %v)", err)
+		}
+		if _, err := uc.Create("reserved@abc.com", "Admin", fakePass); err != ErrorReservedUsername {
+			t.Errorf("Expected ErrorReservedUsername (received %v)", err)
+		}
+	})
+
+	t.Run("Login accepts usernames", func(t *testing.T) {
+		res, u, err := uc.Login(fakeName, fakePass)
+		if err != nil {
+			t.Error(err)
+		}
+		if !res || u == nil {
+			t.Error("User login by username failed")
+		}
+	})
+
+	t.Run("Username changes are validated", func(t *testing.T) {
+		var newName = "test.user2"
+
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		if _, err := uc.ChangeUsername(userID, "A!"); err != ErrorInvalidUsername {
+			t.Errorf("Expected ErrorInvalidUsername (received %v)", err)
+		}
+		if _, err := uc.ChangeUsername(userID, "admin"); err != ErrorReservedUsername {
+			t.Errorf("Expected ErrorReservedUsername (received %v)", err)
+		}
+		if _, err := uc.ChangeUsername(userID, fakeName); err != ErrorDuplicateAccount {
+			t.Errorf("Expected ErrorDuplicateAccount (received %v)", err)
+		}
+
+		_, err := uc.ChangeUsername(userID, newName)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventUsernameChanged {
+			t.Error("Expected EventUsernameChanged")
+		}
+
+		res, _, _ := uc.Login(newName, fakePass)
+		if !res {
+			t.Error("User login with new username failed")
+		}
+
+		if _, err := uc.ChangeUsername(userID, fakeName); err != ErrorUsernameCooldown {
+			t.Errorf("Expected ErrorUsernameCooldown (received %v)", err)
+		}
+
+		// Restore original username for following tests
+		uc.SetUsernameChangeCooldown(0)
+		defer uc.SetUsernameChangeCooldown(DefaultUsernameChangeCooldown)
+
+		_, err = uc.ChangeUsername(userID, fakeName)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Email changes are applied after confirmation", func(t *testing.T) {
+		var newEmail = "test2@abc.com"
+
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		if _, err := uc.RequestEmailChange(userID, fakeEmail); err != ErrorDuplicateAccount {
+			t.Errorf("Expected ErrorDuplicateAccount (received %v)", err)
+		}
+
+		_, err := uc.RequestEmailChange(userID, newEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventEmailChangeRequested {
+			t.Error("Expected EventEmailChangeRequested")
+		}
+
+		// Address is not changed until confirmed
+		u2, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		if u2 == nil {
+			t.Errorf("Email changed prior to confirmation")
+		}
+
+		// Tokens are bound to the requested address
+		if err := uc.HandleTokenData(userID, api.TokenActionEmailChange, "stale@abc.com"); err != ErrorEmailChangeMismatch {
+			t.Errorf("Expected ErrorEmailChangeMismatch (received %v)", err)
+		}
+
+		err = uc.HandleTokenData(userID, api.TokenActionEmailChange, newEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventEmailChanged {
+			t.Error("Expected EventEmailChanged")
+		}
+
+		u3, _ := uc.userStore.GetUserByEmail(newEmail)
+		if u3 == nil {
+			t.Errorf("Email not changed after confirmation")
+		}
+
+		if err := uc.HandleTokenData(userID, api.TokenActionEmailChange, newEmail); err != ErrorNoEmailChangePending {
+			t.Errorf("Expected ErrorNoEmailChangePending (received %v)", err)
+		}
+
+		// Changes can be cancelled prior to confirmation
+		_, err = uc.RequestEmailChange(userID, fakeEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		err = uc.HandleTokenData(userID, api.TokenActionEmailCancel, fakeEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventEmailChangeCancelled {
+			t.Error("Expected EventEmailChangeCancelled")
+		}
+		if err := uc.HandleTokenData(userID, api.TokenActionEmailChange, fakeEmail); err != ErrorNoEmailChangePending {
+			t.Errorf("Expected ErrorNoEmailChangePending (received %v)", err)
+		}
+
+		// Confirmed changes can be reverted from the previous address, securing the account
+		err = uc.HandleTokenData(userID, api.TokenActionEmailRevert, fakeEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		u4, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		if u4 == nil {
+			t.Fatalf("Email not reverted")
+		}
+		if !u4.(User).IsLocked() {
+			t.Errorf("Account not secured after reverting email change")
+		}
+
+		// Restore account state for following tests
+		u4.(User).SetLocked(false)
+		uc.userStore.UpdateUser(u4)
+	})
+
+	t.Run("Email changes enforce domain restrictions", func(t *testing.T) {
+		var newEmail = "changed@later.com"
+
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		defer uc.SetRegistration(config.DefaultRegistrationConfig())
+
+		rc := config.DefaultRegistrationConfig()
+		rc.BlockDisposable = true
+		rc.DeniedDomains = []string{"denied.com"}
+		uc.SetRegistration(rc)
+		for _, email := range []string{"test@mailinator.com", "test@denied.com"} {
+			if _, err := uc.RequestEmailChange(userID, email); err != ErrorDomainNotAllowed {
+				t.Errorf("Expected ErrorDomainNotAllowed for %s (received %v)", email, err)
+			}
+		}
+
+		// Restrictions applied after a request are enforced on confirmation
+		if _, err := uc.RequestEmailChange(userID, newEmail); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		rc.DeniedDomains = []string{"later.com"}
+		uc.SetRegistration(rc)
+		if err := uc.HandleTokenData(userID, api.TokenActionEmailChange, newEmail); err != ErrorDomainNotAllowed {
+			t.Errorf("Expected ErrorDomainNotAllowed (received %v)", err)
+		}
+		if u2, _ := uc.userStore.GetUserByEmail(fakeEmail); u2 == nil {
+			t.Errorf("Email changed to a denied domain")
+		}
+
+		if err := uc.HandleTokenData(userID, api.TokenActionEmailCancel, newEmail); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Password policy rejects weak and reused passwords", func(t *testing.T) {
+		var newPass = "Correct horse battery 42"
+		var newPass2 = "Different staple lantern 17"
+
+		policy, err := password.NewPolicy(config.DefaultPasswordConfig())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		uc.SetPasswordPolicy(policy)
+
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		// Passwords containing identities are rejected
+		_, err = uc.UpdatePassword(userID, fakePass, "Secret "+fakeName+" 2017!")
+		if perr, ok := err.(*api.PasswordPolicyError); !ok || perr.Reasons[0] != api.PasswordReasonContainsIdentity {
+			t.Errorf("Expected contains identity policy error (received %v)", err)
+		}
+
+		// Weak passwords are rejected with the reason
+		_, err = uc.UpdatePassword(userID, fakePass, "aaaaaaaaaaaa")
+		if perr, ok := err.(*api.PasswordPolicyError); !ok || perr.Reasons[0] != api.PasswordReasonTooWeak {
+			t.Errorf("Expected too weak policy error (received %v)", err)
+		}
+
+		// Previous passwords cannot be reused
+		if _, err = uc.UpdatePassword(userID, fakePass, newPass); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if _, err = uc.UpdatePassword(userID, newPass, newPass2); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		_, err = uc.UpdatePassword(userID, newPass2, newPass)
+		if perr, ok := err.(*api.PasswordPolicyError); !ok || perr.Reasons[0] != api.PasswordReasonReused {
+			t.Errorf("Expected reused policy error (received %v)", err)
+		}
+
+		// Restore original password for following tests
+		uc.SetPasswordPolicy(nil)
+		if _, err = uc.UpdatePassword(userID, newPass2, fakePass); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Expired passwords require a password change", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+
+		required, err := uc.PasswordChangeRequired(u)
+		if err != nil || required {
+			t.Errorf("Unexpected password change requirement (%v)", err)
+		}
+
+		uc.SetPasswordExpiry(time.Nanosecond, 0)
+		defer uc.SetPasswordExpiry(0, 0)
+
+		required, err = uc.PasswordChangeRequired(u)
+		if err != nil || !required {
+			t.Errorf("Expected password change requirement (%v)", err)
+		}
+		if mockEventEmitter.Event.Type != events.EventPasswordExpired {
+			t.Error("Expected EventPasswordExpired")
+		}
+
+		// Expiry is only notified once per password
+		mockEventEmitter.Event = nil
+		required, err = uc.PasswordChangeRequired(u)
+		if err != nil || !required {
+			t.Errorf("Expected password change requirement (%v)", err)
+		}
+		if mockEventEmitter.Event != nil {
+			t.Errorf("Unexpected event %+v", mockEventEmitter.Event)
+		}
+	})
+
+	t.Run("Password change can be required", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		_, err := uc.SetPasswordChangeRequired(userID, true)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		if mockEventEmitter.Event.Type != events.EventPasswordChangeRequired {
+			t.Error("Expected EventPasswordChangeRequired")
+		}
+
+		mockEventEmitter.Event = nil
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		required, err := uc.PasswordChangeRequired(u)
+		if err != nil || !required {
+			t.Errorf("Expected password change requirement (%v)", err)
+		}
+		if mockEventEmitter.Event != nil {
+			t.Errorf("Unexpected event %+v", mockEventEmitter.Event)
+		}
+
+		// Changing password clears the requirement
+		newPass := "Cleared requirement pass 93"
+		if _, err := uc.UpdatePassword(userID, fakePass, newPass); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		required, err = uc.PasswordChangeRequired(u)
+		if err != nil || required {
+			t.Errorf("Unexpected password change requirement (%v)", err)
+		}
+
+		// Restore original password for following tests
+		if _, err := uc.UpdatePassword(userID, newPass, fakePass); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Users are warned once prior to password expiry", func(t *testing.T) {
+		uc.SetPasswordExpiry(48*time.Hour, 72*time.Hour)
+		defer uc.SetPasswordExpiry(0, 0)
+
+		count, err := uc.WarnExpiringPasswords()
+		if err != nil {
+			t.Error(err)
+		}
+		if count == 0 {
+			t.Errorf("Expected password expiry warnings")
+		}
+		if mockEventEmitter.Event.Type != events.EventPasswordExpiring {
+			t.Error("Expected EventPasswordExpiring")
+		}
+
+		count, err = uc.WarnExpiringPasswords()
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 0 {
+			t.Errorf("Unexpected repeat password expiry warnings (%d)", count)
+		}
+	})
+
+	t.Run("Dormant accounts are warned, disabled and can be reactivated", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		defer uc.SetDormancy(0, 0)
+
+		// Administrators are exempt
+		uc.SetAdmin(userID, true)
+		uc.SetDormancy(time.Nanosecond, time.Nanosecond)
+		if _, _, err := uc.CheckDormantAccounts(); err != nil {
+			t.Error(err)
+		}
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if !u.(User).IsEnabled() {
+			t.Errorf("Administrator account disabled")
+		}
+		uc.SetAdmin(userID, false)
+
+		// Inactive users are warned once
+		uc.SetDormancy(time.Nanosecond, time.Hour)
+		warned, _, err := uc.CheckDormantAccounts()
+		if err != nil {
+			t.Error(err)
+		}
+		if warned == 0 {
+			t.Errorf("Expected dormancy warnings")
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDormant {
+			t.Error("Expected EventAccountDormant")
+		}
+		if warned, _, _ = uc.CheckDormantAccounts(); warned != 0 {
+			t.Errorf("Unexpected repeat dormancy warnings (%d)", warned)
+		}
+
+		// Dormant accounts are disabled
+		uc.SetDormancy(time.Nanosecond, time.Nanosecond)
+		_, disabled, err := uc.CheckDormantAccounts()
+		if err != nil {
+			t.Error(err)
+		}
+		if disabled == 0 {
+			t.Errorf("Expected dormant accounts to be disabled")
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDisabled {
+			t.Error("Expected EventAccountDisabled")
+		}
+
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if ok, _ := uc.PreLogin(u); ok {
+			t.Errorf("Dormant account login allowed")
+		}
+
+		// Dormant accounts can be reactivated
+		uc.SetDormancy(0, 0)
+		if err := uc.HandleToken(userID, api.TokenActionReactivate); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountReactivated {
+			t.Error("Expected EventAccountReactivated")
+		}
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if ok, _ := uc.PreLogin(u); !ok {
+			t.Errorf("Reactivated account login blocked")
+		}
+		if err := uc.HandleToken(userID, api.TokenActionReactivate); err != ErrorNotDormant {
+			t.Errorf("Expected ErrorNotDormant (received %v)", err)
+		}
+	})
+
+	t.Run("Second factors are required after the enrolment grace period", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		defer uc.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+
+		// Requirements for administrators do not apply to other users
+		uc.SetSecondFactorPolicy(config.SecondFactorConfig{Required: config.SecondFactorAdmins, GracePeriod: time.Hour, ReminderInterval: time.Hour})
+		if required, _ := uc.SecondFactorEnrolmentRequired(u); required {
+			t.Errorf("Unexpected second factor requirement for non-administrator")
+		}
+		if count, _ := uc.RemindSecondFactorEnrolment(); count != 0 {
+			t.Errorf("Unexpected second factor reminders (%d)", count)
+		}
+
+		// Users are reminded once per interval during the grace period
+		uc.SetSecondFactorPolicy(config.SecondFactorConfig{Required: config.SecondFactorAll, GracePeriod: time.Hour, ReminderInterval: time.Hour})
+		count, err := uc.RemindSecondFactorEnrolment()
+		if err != nil {
+			t.Error(err)
+		}
+		if count == 0 {
+			t.Errorf("Expected second factor reminders")
+		}
+		if mockEventEmitter.Event.Type != events.Event2faEnrolmentReminder {
+			t.Error("Expected Event2faEnrolmentReminder")
+		}
+		if count, _ = uc.RemindSecondFactorEnrolment(); count != 0 {
+			t.Errorf("Unexpected repeat second factor reminders (%d)", count)
+		}
+
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if required, _ := uc.SecondFactorEnrolmentRequired(u); required {
+			t.Errorf("Unexpected second factor requirement during grace period")
+		}
+
+		// Enrolment is required once the grace period expires
+		u.(User).SetSecondFactorDeadline(time.Now().Add(-time.Minute))
+		uc.userStore.UpdateUser(u)
+		required, err := uc.SecondFactorEnrolmentRequired(u)
+		if err != nil {
+			t.Error(err)
+		}
+		if !required {
+			t.Errorf("Expected second factor requirement after grace period")
+		}
+		if mockEventEmitter.Event.Type != events.Event2faEnrolmentRequired {
+			t.Error("Expected Event2faEnrolmentRequired")
+		}
+
+		// Users are only notified once the grace period expires
+		mockEventEmitter.Event = nil
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if required, _ := uc.SecondFactorEnrolmentRequired(u); !required {
+			t.Errorf("Expected second factor requirement after grace period")
+		}
+		if mockEventEmitter.Event != nil {
+			t.Errorf("Unexpected repeat event %s", mockEventEmitter.Event.Type)
+		}
+
+		// Users with an enrolled second factor are not required to enrol
+		dataStore.AddTotpToken(userID, "first", "secret", 0)
+		if required, _ := uc.SecondFactorEnrolmentRequired(u); required {
+			t.Errorf("Unexpected second factor requirement with enrolled factor")
+		}
+
+		// The last second factor cannot be removed
+		if removable, _ := uc.SecondFactorRemovable(userID); removable {
+			t.Errorf("Expected last second factor to be retained")
+		}
+		dataStore.AddTotpToken(userID, "second", "secret", 0)
+		if removable, _ := uc.SecondFactorRemovable(userID); !removable {
+			t.Errorf("Expected second factor to be removable")
+		}
+	})
+
+	t.Run("Remembered devices are validated, revoked and cleared on password change", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		uc.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+		token, expiry, err := uc.RememberDevice(userID, "test-agent")
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if token == "" || !expiry.After(time.Now()) {
+			t.Errorf("Invalid device token or expiry (%s)", expiry)
+		}
+		if mockEventEmitter.Event.Type != events.Event2faDeviceRemembered {
+			t.Error("Expected Event2faDeviceRemembered")
+		}
+
+		if !uc.ValidateDevice(userID, token) {
+			t.Errorf("Expected remembered device to be valid")
+		}
+		if uc.ValidateDevice(userID, token+"a") {
+			t.Errorf("Unexpected valid device for invalid token")
+		}
+
+		// Devices can be listed and revoked
+		devices, err := uc.GetTrustedDevices(userID)
+		if err != nil || len(devices) != 1 {
+			t.Errorf("Expected one remembered device (%v)", err)
+			t.FailNow()
+		}
+		if err = uc.RevokeTrustedDevice(userID, "not-a-device"); err != ErrorDeviceNotFound {
+			t.Errorf("Expected ErrorDeviceNotFound (received %v)", err)
+		}
+		if err = uc.RevokeTrustedDevice(userID, devices[0].GetDeviceID()); err != nil {
+			t.Error(err)
+		}
+		if uc.ValidateDevice(userID, token) {
+			t.Errorf("Unexpected valid device after revocation")
+		}
+
+		// Password changes clear remembered devices
+		token, _, _ = uc.RememberDevice(userID, "test-agent")
+		if _, err = uc.SetPassword(userID, fakePass); err != nil {
+			t.Error(err)
+		}
+		if uc.ValidateDevice(userID, token) {
+			t.Errorf("Unexpected valid device after password change")
+		}
+
+		// No tokens are issued where remembering devices is disabled
+		uc.SetSecondFactorPolicy(config.SecondFactorConfig{Required: config.SecondFactorOptional})
+		defer uc.SetSecondFactorPolicy(config.DefaultSecondFactorConfig())
+		if token, _, _ = uc.RememberDevice(userID, "test-agent"); token != "" {
+			t.Errorf("Unexpected device token with remembering disabled")
+		}
+	})
+
+	t.Run("Logins from new devices are detected and accounts can be secured", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:60.0) Gecko/20100101 Firefox/60.0"
+		chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/66.0.3359.139 Safari/537.36"
+
+		// The first login is recorded without notice
+		mockEventEmitter.Event = nil
+		if err := uc.LoginContext(u, &api.LoginContext{IP: "10.1.2.3", UserAgent: firefox}); err != nil {
+			t.Error(err)
+		}
+		if mockEventEmitter.Event != nil {
+			t.Errorf("Unexpected event for first login (%+v)", mockEventEmitter.Event)
+		}
+
+		// Logins from the same network and browser are known
+		if err := uc.LoginContext(u, &api.LoginContext{IP: "10.1.2.4", UserAgent: firefox}); err != nil {
+			t.Error(err)
+		}
+		if mockEventEmitter.Event != nil {
+			t.Errorf("Unexpected event for known device (%+v)", mockEventEmitter.Event)
+		}
+
+		// Logins from a new browser on a known network are reported
+		if err := uc.LoginContext(u, &api.LoginContext{IP: "10.1.2.5", UserAgent: chrome}); err != nil {
+			t.Error(err)
+		}
+		if mockEventEmitter.Event == nil || mockEventEmitter.Event.Type != events.EventAccountLoginNewDevice {
+			t.Fatalf("Expected EventAccountLoginNewDevice")
+		}
+		if mockEventEmitter.Event.Data["Device"] != "Chrome on Windows" || mockEventEmitter.Event.Data["Suspicious"] != "" {
+			t.Errorf("Unexpected new device data (%+v)", mockEventEmitter.Event.Data)
+		}
+
+		// Logins from a new browser and network are suspicious
+		if err := uc.LoginContext(u, &api.LoginContext{IP: "192.168.0.1", UserAgent: "curl/7.58.0"}); err != nil {
+			t.Error(err)
+		}
+		if mockEventEmitter.Event.Data["Suspicious"] != "true" {
+			t.Errorf("Expected suspicious login (%+v)", mockEventEmitter.Event.Data)
+		}
+
+		// Securing an account locks it and revokes sessions
+		loginAt := time.Now()
+		if err := uc.HandleToken(userID, api.TokenActionSecure); err != nil {
+			t.Error(err)
+		}
+		u, _ = uc.userStore.GetUserByEmail(fakeEmail)
+		if !u.(User).IsLocked() {
+			t.Errorf("Expected secured account to be locked")
+		}
+		if uc.ValidateSession(userID, loginAt) {
+			t.Errorf("Expected sessions to be revoked")
+		}
+		if mockEventEmitter.Event.Type != events.EventSessionsRevoked {
+			t.Error("Expected EventSessionsRevoked")
+		}
+
+		if _, err := uc.Unlock(fakeEmail); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Registration modes, domains and invitations are enforced", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+		invitedEmail := "invited@abc.com"
+
+		defer uc.SetRegistration(config.DefaultRegistrationConfig())
+
+		rc := config.DefaultRegistrationConfig()
+		rc.Mode = config.RegistrationDisabled
+		uc.SetRegistration(rc)
+		if _, err := uc.Create(invitedEmail, "invited.user", fakePass); err != ErrorRegistrationDisabled {
+			t.Errorf("Expected ErrorRegistrationDisabled (received %v)", err)
+		}
+
+		rc = config.DefaultRegistrationConfig()
+		rc.BlockDisposable = true
+		rc.DeniedDomains = []string{"denied.com"}
+		uc.SetRegistration(rc)
+		for _, email := range []string{"test@mailinator.com", "test@sub.mailinator.com", "test@denied.com"} {
+			if _, err := uc.Create(email, "invited.user", fakePass); err != ErrorDomainNotAllowed {
+				t.Errorf("Expected ErrorDomainNotAllowed for %s (received %v)", email, err)
+			}
+		}
+
+		rc = config.DefaultRegistrationConfig()
+		rc.AllowedDomains = []string{"example.com"}
+		uc.SetRegistration(rc)
+		if _, err := uc.Create(invitedEmail, "invited.user", fakePass); err != ErrorDomainNotAllowed {
+			t.Errorf("Expected ErrorDomainNotAllowed (received %v)", err)
+		}
+
+		rc = config.DefaultRegistrationConfig()
+		rc.Mode = config.RegistrationInvite
+		uc.SetRegistration(rc)
+		if _, err := uc.Create(invitedEmail, "invited.user", fakePass); err != ErrorInviteRequired {
+			t.Errorf("Expected ErrorInviteRequired (received %v)", err)
+		}
+
+		// Only admins can issue invites unless user invites are enabled
+		if _, err := uc.CreateInvite(userID, invitedEmail); err != ErrorInviteNotAllowed {
+			t.Errorf("Expected ErrorInviteNotAllowed (received %v)", err)
+		}
+		uc.SetAdmin(userID, true)
+		defer uc.SetAdmin(userID, false)
+
+		invite, err := uc.CreateInvite(userID, invitedEmail)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventInviteCreated {
+			t.Error("Expected EventInviteCreated")
+		}
+		if mockEventEmitter.Event.Data["InviteID"] != strconv.FormatUint(uint64(invite.GetID()), 10) {
+			t.Errorf("Expected invite ID in event data")
+		}
+		if _, ok := mockEventEmitter.Event.Data["Code"]; ok {
+			t.Errorf("Unexpected invite code in event data")
+		}
+
+		// Invites are bound to the invited email
+		if _, err := uc.CreateWithInvite("other@abc.com", "invited.user", fakePass, invite.GetCode()); err != ErrorInvalidInvite {
+			t.Errorf("Expected ErrorInvalidInvite (received %v)", err)
+		}
+
+		invited, err := uc.CreateWithInvite(invitedEmail, "invited.user", fakePass, invite.GetCode())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if !invited.IsActivated() {
+			t.Errorf("Invited account not activated")
+		}
+		if mockEventEmitter.Event.Data["Invited"] == "" {
+			t.Errorf("Expected invited account creation event")
+		}
+
+		// Invites are single use
+		if _, err := uc.CreateWithInvite(invitedEmail, "invited.other", fakePass, invite.GetCode()); err != ErrorInvalidInvite {
+			t.Errorf("Expected ErrorInvalidInvite (received %v)", err)
+		}
+		if err := uc.RevokeInvite(userID, invite.GetCode()); err != ErrorInvalidInvite {
+			t.Errorf("Expected ErrorInvalidInvite (received %v)", err)
+		}
+
+		invites, err := uc.GetInvites(userID)
+		if err != nil || len(invites) != 1 || !invites[0].IsUsed() {
+			t.Errorf("Expected one used invite (invites: %v err: %v)", invites, err)
+		}
+
+		if err := uc.Delete(invited.GetExtID()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Registration hooks can reject and enrich registrations", func(t *testing.T) {
+		hooks := mockCreateHooks{err: &api.RegistrationError{Reason: api.RegistrationReasonRejected}}
+		uc.SetCreateHooks(&hooks)
+		defer uc.SetCreateHooks(nil)
+
+		_, err := uc.Create("hooked@abc.com", "hooked.user", fakePass)
+		if regErr, ok := err.(*api.RegistrationError); !ok || regErr.Reason != api.RegistrationReasonRejected {
+			t.Errorf("Expected registration error (received %v)", err)
+		}
+		if u, _ := uc.userStore.GetUserByEmail("hooked@abc.com"); u != nil {
+			t.Errorf("Rejected registration created account")
+		}
+
+		hooks.err = nil
+		u, err := uc.Create("hooked@abc.com", "hooked.user", fakePass)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Data["Source"] != "mock" {
+			t.Errorf("Expected registration data in account created event")
+		}
+		if hooks.created == nil {
+			t.Errorf("PostCreate hook not called")
+		}
+
+		if err := uc.Delete(u.GetExtID()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Deleted accounts can be restored within the grace period", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		err := uc.ScheduleDeletion(userID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDeleted {
+			t.Error("Expected EventAccountDeleted")
+		}
+		if uc.ValidateSession(userID, time.Now()) {
+			t.Errorf("Expected sessions to be invalid for deleted accounts")
+		}
+
+		if _, err := uc.CancelDeletion(fakeEmail, "wrong password"); err != ErrorPasswordMismatch {
+			t.Errorf("Expected ErrorPasswordMismatch (received %v)", err)
+		}
+
+		_, err = uc.CancelDeletion(fakeEmail, fakePass)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDeletionCancelled {
+			t.Error("Expected EventAccountDeletionCancelled")
+		}
+
+		u2, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		if u2 == nil {
+			t.Errorf("User not restored")
+		}
+	})
+
+	t.Run("Deleted accounts are purged after the grace period", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		userID := u.(User).GetExtID()
+
+		err := uc.ScheduleDeletion(userID)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		count, err := uc.PurgeDeleted()
+		if err != nil || count != 0 {
+			t.Errorf("Unexpected purge within grace period (count: %d err: %v)", count, err)
+		}
+
+		uc.SetDeletionGracePeriod(0)
+		defer uc.SetDeletionGracePeriod(DefaultDeletionGracePeriod)
+
+		if _, err := uc.CancelDeletion(fakeEmail, fakePass); err != ErrorDeletionExpired {
+			t.Errorf("Expected ErrorDeletionExpired (received %v)", err)
+		}
+
+		count, err = uc.PurgeDeleted()
+		if err != nil || count != 1 {
+			t.Errorf("Expected one account purged (count: %d err: %v)", count, err)
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountPurged {
+			t.Error("Expected EventAccountPurged")
+		}
+
+		u2, _ := uc.userStore.GetDeletedUserByEmail(fakeEmail)
+		if u2 != nil {
+			t.Errorf("User not purged")
+		}
+
+		// Recreate user for following tests
+		u, err = uc.Create(fakeEmail, fakeName, fakePass)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Can delete users", func(t *testing.T) {
+		u, _ := uc.userStore.GetUserByEmail(fakeEmail)
+
+		err := uc.Delete(u.(User).GetExtID())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if mockEventEmitter.Event.Type != events.EventAccountDeleted {
+			t.Error("Expected EventAccountDeleted")
+		}
+
+		u2, _ := uc.userStore.GetUserByEmail(fakeEmail)
+		if u2 != nil {
+			t.Errorf("User not deleted")
+		}
+
+		err = uc.Delete(u.(User).GetExtID())
+		if err == nil {
+			t.Errorf("Expected error deleting missing user")
+		}
+	})
+
 	// Tear down user controller
 
 }
@@ -0,0 +1,184 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/config"
+	"github.com/ryankurte/authplz/lib/events"
+)
+
+// SetSecondFactorPolicy sets which users must enrol a second factor, the enrolment grace period and reminder interval
+func (userModule *Controller) SetSecondFactorPolicy(c config.SecondFactorConfig) error {
+	switch c.Required {
+	case config.SecondFactorOptional, config.SecondFactorAdmins, config.SecondFactorAll:
+	default:
+		return fmt.Errorf("UserModule.SetSecondFactorPolicy: unknown second factor requirement '%s'", c.Required)
+	}
+
+	userModule.secondFactor = c
+
+	return nil
+}
+
+// secondFactorApplies checks whether the second factor requirement applies to a user
+func (userModule *Controller) secondFactorApplies(user User) bool {
+	switch userModule.secondFactor.Required {
+	case config.SecondFactorAll:
+		return true
+	case config.SecondFactorAdmins:
+		return user.IsAdmin()
+	default:
+		return false
+	}
+}
+
+// secondFactorDeadline fetches the time by which a user must enrol a second factor
+// The grace period starts the first time the requirement is found to apply to the user
+func (userModule *Controller) secondFactorDeadline(user User) (time.Time, error) {
+	deadline := user.GetSecondFactorDeadline()
+	if !deadline.IsZero() {
+		return deadline, nil
+	}
+
+	deadline = time.Now().Add(userModule.secondFactor.GracePeriod)
+	user.SetSecondFactorDeadline(deadline)
+
+	_, err := userModule.userStore.UpdateUser(user)
+	if err != nil {
+		log.Printf("UserModule.secondFactorDeadline: error updating user %s (%s)\r\n", user.GetExtID(), err)
+		return time.Time{}, ErrorUpdatingUser
+	}
+
+	return deadline, nil
+}
+
+// enrolledSecondFactors counts the second factor tokens enrolled by a user
+func (userModule *Controller) enrolledSecondFactors(userid string) (int, error) {
+	fidoTokens, err := userModule.userStore.GetFidoTokens(userid)
+	if err != nil {
+		log.Printf("UserModule.enrolledSecondFactors: error fetching fido tokens for user %s (%s)\r\n", userid, err)
+		return 0, ErrorFindingUser
+	}
+	totpTokens, err := userModule.userStore.GetTotpTokens(userid)
+	if err != nil {
+		log.Printf("UserModule.enrolledSecondFactors: error fetching totp tokens for user %s (%s)\r\n", userid, err)
+		return 0, ErrorFindingUser
+	}
+
+	return len(fidoTokens) + len(totpTokens), nil
+}
+
+// SecondFactorEnrolmentRequired checks whether a user without a second factor must enrol one prior to logging in
+// This is the case where the second factor requirement applies to the user and the grace period has expired
+func (userModule *Controller) SecondFactorEnrolmentRequired(u interface{}) (bool, error) {
+	user := u.(User)
+
+	if !userModule.secondFactorApplies(user) {
+		return false, nil
+	}
+
+	// Users with enrolled second factors (ie. logging in from a remembered device) are not required to enrol
+	enrolled, err := userModule.enrolledSecondFactors(user.GetExtID())
+	if err != nil {
+		return false, err
+	}
+	if enrolled > 0 {
+		return false, nil
+	}
+
+	deadline, err := userModule.secondFactorDeadline(user)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if now.Before(deadline) {
+		return false, nil
+	}
+
+	log.Printf("UserModule.SecondFactorEnrolmentRequired: User %s must enrol a second factor\r\n", user.GetExtID())
+
+	// Notify the user once the deadline has passed, reminders are only sent prior to the deadline
+	if user.GetSecondFactorReminded().Before(deadline) {
+		user.SetSecondFactorReminded(now)
+		_, err = userModule.userStore.UpdateUser(user)
+		if err != nil {
+			log.Printf("UserModule.SecondFactorEnrolmentRequired: error updating user %s (%s)\r\n", user.GetExtID(), err)
+			return false, ErrorUpdatingUser
+		}
+
+		data := map[string]string{"Deadline": deadline.Format(time.RFC1123)}
+		userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.Event2faEnrolmentRequired, data))
+	}
+
+	return true, nil
+}
+
+// RemindSecondFactorEnrolment reminds users the second factor requirement applies to that have not enrolled a
+// second factor to do so prior to the end of the grace period. This returns the number of users reminded
+func (userModule *Controller) RemindSecondFactorEnrolment() (int, error) {
+	if userModule.secondFactor.Required != config.SecondFactorAdmins && userModule.secondFactor.Required != config.SecondFactorAll {
+		return 0, nil
+	}
+
+	users, err := userModule.userStore.GetUsersWithoutSecondFactors(userModule.secondFactor.Required == config.SecondFactorAdmins)
+	if err != nil {
+		log.Printf("UserModule.RemindSecondFactorEnrolment: error fetching users (%s)\r\n", err)
+		return 0, ErrorFindingUser
+	}
+
+	now := time.Now()
+	count := 0
+	for _, u := range users {
+		user := u.(User)
+
+		// Start the grace period for users the requirement has not yet applied to
+		deadline, err := userModule.secondFactorDeadline(user)
+		if err != nil {
+			return count, err
+		}
+
+		// Skip users past the deadline or reminded within the reminder interval
+		interval := userModule.secondFactor.ReminderInterval
+		if interval == 0 || now.After(deadline) || now.Before(user.GetSecondFactorReminded().Add(interval)) {
+			continue
+		}
+
+		user.SetSecondFactorReminded(now)
+		_, err = userModule.userStore.UpdateUser(user)
+		if err != nil {
+			log.Printf("UserModule.RemindSecondFactorEnrolment: error updating user %s (%s)\r\n", user.GetExtID(), err)
+			return count, ErrorUpdatingUser
+		}
+
+		data := map[string]string{"Deadline": deadline.Format(time.RFC1123)}
+		userModule.emitter.SendEvent(events.NewEvent(user.GetExtID(), events.Event2faEnrolmentReminder, data))
+
+		log.Printf("UserModule.RemindSecondFactorEnrolment: User %s reminded to enrol a second factor\r\n", user.GetExtID())
+
+		count++
+	}
+
+	return count, nil
+}
+
+// SecondFactorRemovable checks whether a user may remove one of their second factors
+// The last second factor cannot be removed while the second factor requirement applies to the user
+func (userModule *Controller) SecondFactorRemovable(userid string) (bool, error) {
+	user, err := userModule.fetchUser(userid)
+	if err != nil {
+		return false, err
+	}
+
+	if !userModule.secondFactorApplies(user) {
+		return true, nil
+	}
+
+	enrolled, err := userModule.enrolledSecondFactors(userid)
+	if err != nil {
+		return false, err
+	}
+
+	return enrolled > 1, nil
+}
@@ -0,0 +1,201 @@
+/*
+ * Resource Server Introspection Validator
+ * Validates tokens using the AuthPlz OAuth introspection endpoint with result caching
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryankurte/authplz/lib/api"
+)
+
+// DefaultCacheTTL is the default duration for which introspection results are cached
+const DefaultCacheTTL = time.Minute
+
+// IntrospectionConfig configures an introspection based validator
+type IntrospectionConfig struct {
+	// Endpoint is the AuthPlz introspection endpoint (ie. https://auth.example.com/api/oauth/introspect)
+	Endpoint string
+	// ClientID and ClientSecret identify the resource server to AuthPlz
+	// The client must be granted the introspect scope
+	ClientID     string
+	ClientSecret string
+	// CacheTTL is the maximum duration for which a result is cached, negative values disable caching
+	CacheTTL time.Duration
+	// HTTPClient is an optional http client to use for introspection requests
+	HTTPClient *http.Client
+}
+
+type cacheEntry struct {
+	info    *TokenInfo
+	expires time.Time
+}
+
+// IntrospectionValidator validates tokens using the AuthPlz introspection endpoint
+type IntrospectionValidator struct {
+	config IntrospectionConfig
+	client *http.Client
+
+	cache map[string]cacheEntry
+	lock  sync.Mutex
+}
+
+// NewIntrospectionValidator creates a validator using the provided introspection configuration
+func NewIntrospectionValidator(config IntrospectionConfig) *IntrospectionValidator {
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultCacheTTL
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &IntrospectionValidator{
+		config: config,
+		client: client,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+// Validate validates a token, using cached results where available
+func (iv *IntrospectionValidator) Validate(ctx context.Context, token string) (*TokenInfo, error) {
+	key := cacheKey(token)
+
+	if info, ok := iv.fetchCached(key); ok {
+		if info == nil {
+			return nil, ErrInvalidToken
+		}
+		return info, nil
+	}
+
+	info, err := iv.introspect(ctx, token)
+	if err != nil && err != ErrInvalidToken {
+		return nil, err
+	}
+
+	iv.store(key, info)
+
+	return info, err
+}
+
+// Flush removes all cached introspection results
+func (iv *IntrospectionValidator) Flush() {
+	iv.lock.Lock()
+	defer iv.lock.Unlock()
+
+	iv.cache = make(map[string]cacheEntry)
+}
+
+func (iv *IntrospectionValidator) introspect(ctx context.Context, token string) (*TokenInfo, error) {
+	v := url.Values{}
+	v.Set("token", token)
+	v.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequest("POST", iv.config.Endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(iv.config.ClientID), url.QueryEscape(iv.config.ClientSecret))
+
+	resp, err := iv.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Resource: introspection request failed with status %d", resp.StatusCode)
+	}
+
+	ir := api.OAuthIntrospection{}
+	if err := json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		return nil, err
+	}
+
+	if !ir.Active {
+		return nil, ErrInvalidToken
+	}
+
+	info := TokenInfo{
+		Subject:  ir.Subject,
+		ClientID: ir.ClientID,
+		Username: ir.Username,
+		Scopes:   strings.Fields(ir.Scope),
+	}
+	if ir.IssuedAt != 0 {
+		info.IssuedAt = time.Unix(ir.IssuedAt, 0)
+	}
+	if ir.ExpiresAt != 0 {
+		info.ExpiresAt = time.Unix(ir.ExpiresAt, 0)
+		if time.Now().After(info.ExpiresAt) {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return &info, nil
+}
+
+func (iv *IntrospectionValidator) fetchCached(key string) (*TokenInfo, bool) {
+	iv.lock.Lock()
+	defer iv.lock.Unlock()
+
+	entry, ok := iv.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(iv.cache, key)
+		return nil, false
+	}
+
+	return entry.info, true
+}
+
+// store caches an introspection result (nil for inactive tokens)
+// Entries never outlive the token expiry
+func (iv *IntrospectionValidator) store(key string, info *TokenInfo) {
+	if iv.config.CacheTTL < 0 {
+		return
+	}
+
+	expires := time.Now().Add(iv.config.CacheTTL)
+	if info != nil && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(expires) {
+		expires = info.ExpiresAt
+	}
+
+	iv.lock.Lock()
+	defer iv.lock.Unlock()
+
+	// Clear expired entries to bound cache growth
+	now := time.Now()
+	for k, e := range iv.cache {
+		if now.After(e.expires) {
+			delete(iv.cache, k)
+		}
+	}
+
+	iv.cache[key] = cacheEntry{info: info, expires: expires}
+}
+
+// cacheKey hashes tokens so raw tokens are not retained in memory
+func cacheKey(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
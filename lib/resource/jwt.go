@@ -0,0 +1,97 @@
+/*
+ * Resource Server JWT Validator
+ * Validates JWT formatted access tokens offline using a shared secret or public key
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// JWTConfig configures an offline JWT validator
+type JWTConfig struct {
+	// Key is the HMAC secret ([]byte) or public key (*rsa.PublicKey, *ecdsa.PublicKey) used to verify tokens
+	Key interface{}
+	// SigningMethods is the list of allowed signing algorithms (ie. HS256, RS256)
+	SigningMethods []string
+	// Issuer is the required token issuer (optional)
+	Issuer string
+	// Audience is the required token audience (optional)
+	Audience string
+}
+
+// accessClaims are the claims expected in a JWT access token
+type accessClaims struct {
+	ClientID string   `json:"client_id"`
+	Username string   `json:"username"`
+	Scope    string   `json:"scope"`
+	Scopes   []string `json:"scp"`
+	jwt.StandardClaims
+}
+
+// JWTValidator validates JWT access tokens without contacting the authorization server
+type JWTValidator struct {
+	config JWTConfig
+}
+
+// NewJWTValidator creates an offline JWT validator using the provided configuration
+func NewJWTValidator(config JWTConfig) *JWTValidator {
+	return &JWTValidator{config}
+}
+
+// Validate parses and validates a JWT access token
+func (jv *JWTValidator) Validate(ctx context.Context, tokenString string) (*TokenInfo, error) {
+	claims := accessClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		alg := token.Method.Alg()
+		for _, m := range jv.config.SigningMethods {
+			if m == alg {
+				return jv.config.Key, nil
+			}
+		}
+		return nil, fmt.Errorf("Unexpected signing method: %s", alg)
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// Access tokens must expire, the parser only checks expiry where it is set
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrInvalidToken
+	}
+
+	if jv.config.Issuer != "" && !claims.VerifyIssuer(jv.config.Issuer, true) {
+		return nil, ErrInvalidToken
+	}
+	if jv.config.Audience != "" && !claims.VerifyAudience(jv.config.Audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	scopes := claims.Scopes
+	if len(scopes) == 0 {
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	info := TokenInfo{
+		Subject:   claims.Subject,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		Scopes:    scopes,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	if claims.IssuedAt != 0 {
+		info.IssuedAt = time.Unix(claims.IssuedAt, 0)
+	}
+
+	return &info, nil
+}
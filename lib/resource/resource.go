@@ -0,0 +1,167 @@
+/*
+ * Resource Server Middleware
+ * This provides net/http middleware for protecting APIs with AuthPlz issued OAuth tokens
+ *
+ * AuthPlz Project (https://github.com/ryankurte/AuthPlz)
+ * Copyright 2017 Ryan Kurte
+ */
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken indicates a token was not valid (or is no longer active)
+var ErrInvalidToken = errors.New("Resource: invalid or inactive token")
+
+// ErrMissingToken indicates a request did not contain a bearer token
+var ErrMissingToken = errors.New("Resource: missing bearer token")
+
+// TokenInfo contains information about a validated access token
+type TokenInfo struct {
+	Subject   string
+	ClientID  string
+	Username  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// HasScope checks whether a token grants the provided scope
+// Scopes are hierarchic and split by '.' (ie. public grants public.read)
+func (ti *TokenInfo) HasScope(scope string) bool {
+	return hierarchicScope(ti.Scopes, scope)
+}
+
+// Validator interface validates a bearer token and returns the associated token information
+type Validator interface {
+	Validate(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+type contextKey int
+
+const tokenInfoKey contextKey = 0
+
+// NewContext returns a copy of the provided context containing the token information
+func NewContext(ctx context.Context, info *TokenInfo) context.Context {
+	return context.WithValue(ctx, tokenInfoKey, info)
+}
+
+// FromContext fetches the token information bound to a request context by the middleware
+func FromContext(ctx context.Context) (*TokenInfo, bool) {
+	info, ok := ctx.Value(tokenInfoKey).(*TokenInfo)
+	return info, ok
+}
+
+// Subject fetches the subject (user ID) of the token bound to a request context
+func Subject(ctx context.Context) string {
+	if info, ok := FromContext(ctx); ok {
+		return info.Subject
+	}
+	return ""
+}
+
+// ClientID fetches the client ID of the token bound to a request context
+func ClientID(ctx context.Context) string {
+	if info, ok := FromContext(ctx); ok {
+		return info.ClientID
+	}
+	return ""
+}
+
+// Scopes fetches the scopes granted to the token bound to a request context
+func Scopes(ctx context.Context) []string {
+	if info, ok := FromContext(ctx); ok {
+		return info.Scopes
+	}
+	return nil
+}
+
+// Middleware protects net/http handlers with AuthPlz tokens
+type Middleware struct {
+	validator Validator
+}
+
+// NewMiddleware creates a resource server middleware using the provided token validator
+func NewMiddleware(validator Validator) *Middleware {
+	return &Middleware{validator: validator}
+}
+
+// Handler wraps the provided handler, requiring a valid bearer token and any specified scopes
+// Token information is bound to the request context for use by the wrapped handler
+func (m *Middleware) Handler(next http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		tokenString := TokenFromRequest(req)
+		if tokenString == "" {
+			writeAuthError(rw, http.StatusUnauthorized, "invalid_request", ErrMissingToken.Error())
+			return
+		}
+
+		info, err := m.validator.Validate(req.Context(), tokenString)
+		if err == ErrInvalidToken {
+			writeAuthError(rw, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		} else if err != nil {
+			log.Printf("Resource.Middleware: error validating token (%s)", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, scope := range scopes {
+			if !info.HasScope(scope) {
+				writeAuthError(rw, http.StatusForbidden, "insufficient_scope", "Token missing required scope: "+scope)
+				return
+			}
+		}
+
+		next.ServeHTTP(rw, req.WithContext(NewContext(req.Context(), info)))
+	})
+}
+
+// RequireScopes creates a middleware function requiring the provided scopes
+// This is compatible with most net/http based routers
+func (m *Middleware) RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.Handler(next, scopes...)
+	}
+}
+
+// TokenFromRequest fetches a bearer token from the Authorization header of a request
+func TokenFromRequest(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	split := strings.SplitN(auth, " ", 2)
+	if len(split) != 2 || !strings.EqualFold(split[0], "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(split[1])
+}
+
+// authParamEscaper escapes values for use in quoted authentication parameters
+var authParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeAuthError writes an RFC6750 compliant authentication error
+func writeAuthError(rw http.ResponseWriter, status int, code, description string) {
+	rw.Header().Set("WWW-Authenticate", `Bearer error="`+authParamEscaper.Replace(code)+
+		`", error_description="`+authParamEscaper.Replace(description)+`"`)
+	rw.WriteHeader(status)
+}
+
+// hierarchicScope checks whether a required scope is granted by a set of scopes
+// This matches the hierarchic scope strategy used by the AuthPlz server
+func hierarchicScope(granted []string, required string) bool {
+	for _, s := range granted {
+		if s == required {
+			return true
+		}
+		if strings.HasPrefix(required, s+".") {
+			return true
+		}
+	}
+	return false
+}
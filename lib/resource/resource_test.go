@@ -0,0 +1,139 @@
+package resource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ryankurte/authplz/lib/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	fakeToken    = "fake-access-token"
+	fakeSubject  = "fake-user-id"
+	fakeClientID = "fake-client-id"
+)
+
+func TestResource(t *testing.T) {
+
+	introspectCount := 0
+
+	// Mock AuthPlz introspection endpoint
+	authServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		introspectCount++
+
+		if id, secret, ok := req.BasicAuth(); !ok || id != fakeClientID || secret != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		resp := api.OAuthIntrospection{Active: false}
+		if req.FormValue("token") == fakeToken {
+			resp = api.OAuthIntrospection{
+				Active:    true,
+				Scope:     "public private.read",
+				ClientID:  fakeClientID,
+				Subject:   fakeSubject,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			}
+		}
+
+		json.NewEncoder(rw).Encode(&resp)
+	}))
+	defer authServer.Close()
+
+	validator := NewIntrospectionValidator(IntrospectionConfig{
+		Endpoint:     authServer.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+	})
+
+	mw := NewMiddleware(validator)
+
+	handler := func(rw http.ResponseWriter, req *http.Request) {
+		assert.EqualValues(t, fakeSubject, Subject(req.Context()))
+		assert.EqualValues(t, fakeClientID, ClientID(req.Context()))
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	doRequest := func(h http.Handler, token string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	t.Run("Rejects requests without tokens", func(t *testing.T) {
+		h := mw.Handler(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusUnauthorized, doRequest(h, ""))
+	})
+
+	t.Run("Rejects invalid tokens", func(t *testing.T) {
+		h := mw.Handler(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusUnauthorized, doRequest(h, "not-a-token"))
+	})
+
+	t.Run("Accepts valid tokens", func(t *testing.T) {
+		h := mw.Handler(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusOK, doRequest(h, fakeToken))
+	})
+
+	t.Run("Caches introspection results", func(t *testing.T) {
+		count := introspectCount
+		h := mw.Handler(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusOK, doRequest(h, fakeToken))
+		assert.EqualValues(t, count, introspectCount)
+	})
+
+	t.Run("Enforces hierarchic scopes", func(t *testing.T) {
+		h := mw.RequireScopes("public.write", "private.read")(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusOK, doRequest(h, fakeToken))
+
+		h = mw.RequireScopes("private.write")(http.HandlerFunc(handler))
+		assert.EqualValues(t, http.StatusForbidden, doRequest(h, fakeToken))
+	})
+
+	t.Run("Validates JWT tokens offline", func(t *testing.T) {
+		secret := []byte("jwt-secret")
+		jv := NewJWTValidator(JWTConfig{Key: secret, SigningMethods: []string{"HS256"}})
+		h := NewMiddleware(jv).Handler(http.HandlerFunc(handler), "public.read")
+
+		claims := accessClaims{
+			ClientID: fakeClientID,
+			Scope:    "public",
+			StandardClaims: jwt.StandardClaims{
+				Subject:   fakeSubject,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		assert.Nil(t, err)
+		assert.EqualValues(t, http.StatusOK, doRequest(h, token))
+
+		token, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("wrong"))
+		assert.EqualValues(t, http.StatusUnauthorized, doRequest(h, token))
+
+		// Tokens without an expiry are rejected
+		claims.ExpiresAt = 0
+		token, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		assert.EqualValues(t, http.StatusUnauthorized, doRequest(h, token))
+
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		token, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		assert.EqualValues(t, http.StatusUnauthorized, doRequest(h, token))
+	})
+
+	t.Run("Escapes authentication error descriptions", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		writeAuthError(rw, http.StatusUnauthorized, "invalid_token", `bad "token" \ value`)
+		assert.EqualValues(t, `Bearer error="invalid_token", error_description="bad \"token\" \\ value"`,
+			rw.Header().Get("WWW-Authenticate"))
+	})
+}
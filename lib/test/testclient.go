@@ -79,6 +79,26 @@ func (tc *TestClient) GetWithParams(path string, statusCode int, v url.Values) (
 	return resp, err
 }
 
+// DeleteWithParams performs a DELETE request with query parameters and status code checks
+func (tc *TestClient) DeleteWithParams(path string, statusCode int, v url.Values) (*http.Response, error) {
+	queryPath := tc.basePath + path
+
+	req, _ := http.NewRequest("DELETE", queryPath, nil)
+
+	req.URL.RawQuery = v.Encode()
+
+	resp, err := tc.Do(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode != statusCode {
+		return resp, fmt.Errorf("Incorrect status code from '%s' received: '%d' expected: '%d'", path, resp.StatusCode, statusCode)
+	}
+
+	return resp, err
+}
+
 // CheckRedirect checks that a given redirect is correct
 func CheckRedirect(url string, resp *http.Response) error {
 	if loc := resp.Header.Get("Location"); loc != url {